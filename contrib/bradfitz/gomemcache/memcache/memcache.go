@@ -4,6 +4,10 @@
 // the same methods, so should be seamless for existing applications. It also
 // has an additional `WithContext` method which can be used to connect a span
 // to an existing trace.
+//
+// As gomemcache has no tagged releases, it supports the revisions providing
+// Client.DeleteAll, Client.FlushAll and Client.Touch, and is tested against
+// a41fca850d0b (September 2019) and later ones.
 package memcache // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/bradfitz/gomemcache/memcache"
 
 import (
@@ -54,109 +58,126 @@ func (c *Client) WithContext(ctx context.Context) *Client {
 	}
 }
 
-// startSpan starts a span from the context set with WithContext.
-func (c *Client) startSpan(resourceName string) ddtrace.Span {
-	span, _ := tracer.StartSpanFromContext(c.context, operationName,
+// startSpan starts a span from the context set with WithContext, for an
+// operation on the given number of keys. The keys themselves are not recorded.
+func (c *Client) startSpan(resourceName string, keys int) ddtrace.Span {
+	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeMemcached),
 		tracer.ServiceName(c.cfg.serviceName),
-		tracer.ResourceName(resourceName))
+		tracer.ResourceName(resourceName),
+	}
+	if keys > 0 {
+		opts = append(opts, tracer.Tag(keyCountTag, keys))
+	}
+	span, _ := tracer.StartSpanFromContext(c.context, operationName, opts...)
 	return span
 }
 
+// finishSpan finishes span with err. As misses are a regular outcome of cache
+// lookups, memcache.ErrCacheMiss does not mark the span as an error, and is
+// recorded in the cacheMissTag tag instead.
+func finishSpan(span ddtrace.Span, err error) {
+	if err == memcache.ErrCacheMiss {
+		span.SetTag(cacheMissTag, true)
+		err = nil
+	}
+	span.Finish(tracer.WithError(err))
+}
+
 // wrapped methods:
 
 // Add invokes and traces Client.Add.
 func (c *Client) Add(item *memcache.Item) error {
-	span := c.startSpan("Add")
+	span := c.startSpan("Add", 1)
 	err := c.Client.Add(item)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // CompareAndSwap invokes and traces Client.CompareAndSwap.
 func (c *Client) CompareAndSwap(item *memcache.Item) error {
-	span := c.startSpan("CompareAndSwap")
+	span := c.startSpan("CompareAndSwap", 1)
 	err := c.Client.CompareAndSwap(item)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // Decrement invokes and traces Client.Decrement.
 func (c *Client) Decrement(key string, delta uint64) (newValue uint64, err error) {
-	span := c.startSpan("Decrement")
+	span := c.startSpan("Decrement", 1)
 	newValue, err = c.Client.Decrement(key, delta)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return newValue, err
 }
 
 // Delete invokes and traces Client.Delete.
 func (c *Client) Delete(key string) error {
-	span := c.startSpan("Delete")
+	span := c.startSpan("Delete", 1)
 	err := c.Client.Delete(key)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // DeleteAll invokes and traces Client.DeleteAll.
 func (c *Client) DeleteAll() error {
-	span := c.startSpan("DeleteAll")
+	span := c.startSpan("DeleteAll", 0)
 	err := c.Client.DeleteAll()
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // FlushAll invokes and traces Client.FlushAll.
 func (c *Client) FlushAll() error {
-	span := c.startSpan("FlushAll")
+	span := c.startSpan("FlushAll", 0)
 	err := c.Client.FlushAll()
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // Get invokes and traces Client.Get.
 func (c *Client) Get(key string) (item *memcache.Item, err error) {
-	span := c.startSpan("Get")
+	span := c.startSpan("Get", 1)
 	item, err = c.Client.Get(key)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return item, err
 }
 
 // GetMulti invokes and traces Client.GetMulti.
 func (c *Client) GetMulti(keys []string) (map[string]*memcache.Item, error) {
-	span := c.startSpan("GetMulti")
+	span := c.startSpan("GetMulti", len(keys))
 	items, err := c.Client.GetMulti(keys)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return items, err
 }
 
 // Increment invokes and traces Client.Increment.
 func (c *Client) Increment(key string, delta uint64) (newValue uint64, err error) {
-	span := c.startSpan("Increment")
+	span := c.startSpan("Increment", 1)
 	newValue, err = c.Client.Increment(key, delta)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return newValue, err
 }
 
 // Replace invokes and traces Client.Replace.
 func (c *Client) Replace(item *memcache.Item) error {
-	span := c.startSpan("Replace")
+	span := c.startSpan("Replace", 1)
 	err := c.Client.Replace(item)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // Set invokes and traces Client.Set.
 func (c *Client) Set(item *memcache.Item) error {
-	span := c.startSpan("Set")
+	span := c.startSpan("Set", 1)
 	err := c.Client.Set(item)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
 
 // Touch invokes and traces Client.Touch.
 func (c *Client) Touch(key string, seconds int32) error {
-	span := c.startSpan("Touch")
+	span := c.startSpan("Touch", 1)
 	err := c.Client.Touch(key, seconds)
-	span.Finish(tracer.WithError(err))
+	finishSpan(span, err)
 	return err
 }
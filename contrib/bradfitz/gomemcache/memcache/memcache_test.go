@@ -84,6 +84,35 @@ func testMemcache(t *testing.T, addr string) {
 		assert.Equal(t, spans[1].TraceID(), spans[0].TraceID(),
 			"memcache span should be part of the parent trace")
 	})
+
+	t.Run("cache miss", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := client.Get("missing")
+		assert.Equal(t, memcache.ErrCacheMiss, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		validateMemcacheSpan(t, spans[0], "Get")
+		assert.Nil(t, spans[0].Tag(ext.Error), "cache misses should not be errors")
+		assert.Equal(t, true, spans[0].Tag("memcached.cache_miss"))
+		assert.Equal(t, 1, spans[0].Tag("memcached.key_count"))
+	})
+
+	t.Run("key count", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := client.GetMulti([]string{"missing1", "missing2"})
+		assert.Nil(t, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		validateMemcacheSpan(t, spans[0], "GetMulti")
+		assert.Equal(t, 2, spans[0].Tag("memcached.key_count"))
+		assert.Nil(t, spans[0].Tag("memcached.cache_miss"))
+	})
 }
 
 func TestFakeServer(t *testing.T) {
@@ -133,6 +162,9 @@ func makeFakeServer(t *testing.T) net.Listener {
 							return
 						}
 						fmt.Fprintf(c, "STORED\r\n")
+					case "gets":
+						// no key is ever found
+						fmt.Fprintf(c, "END\r\n")
 					default:
 						fmt.Fprintf(c, "SERVER ERROR unknown command: %v \r\n", args[0])
 						return
@@ -3,6 +3,12 @@ package memcache
 const (
 	serviceName   = "memcached"
 	operationName = "memcached.query"
+
+	// keyCountTag is the tag holding the number of keys of an operation.
+	keyCountTag = "memcached.key_count"
+
+	// cacheMissTag is the tag set on the spans of lookups missing the cache.
+	cacheMissTag = "memcached.cache_miss"
 )
 
 type clientConfig struct{ serviceName string }
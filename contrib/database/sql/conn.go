@@ -3,6 +3,7 @@ package sql // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
 import (
 	"context"
 	"database/sql/driver"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
@@ -39,7 +40,7 @@ func (tc *tracedConn) PrepareContext(ctx context.Context, query string) (stmt dr
 		span.Finish(tracer.WithError(err))
 	}()
 	if connPrepareCtx, ok := tc.Conn.(driver.ConnPrepareContext); ok {
-		stmt, err := connPrepareCtx.PrepareContext(ctx, query)
+		stmt, err = connPrepareCtx.PrepareContext(ctx, query)
 		if err != nil {
 			return nil, err
 		}
@@ -60,11 +61,17 @@ func (tc *tracedConn) Exec(query string, args []driver.Value) (driver.Result, er
 }
 
 func (tc *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (r driver.Result, err error) {
-	span := tc.newChildSpanFromContext(ctx, "Exec", query)
+	execContext, hasExecContext := tc.Conn.(driver.ExecerContext)
+	execer, hasExecer := tc.Conn.(driver.Execer)
+	if !hasExecContext && !hasExecer {
+		// database/sql falls back to preparing a statement, which is traced
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
 	defer func() {
-		span.Finish(tracer.WithError(err))
+		tc.tryTrace(ctx, "Exec", query, start, err)
 	}()
-	if execContext, ok := tc.Conn.(driver.ExecerContext); ok {
+	if hasExecContext {
 		return execContext.ExecContext(ctx, query, args)
 	}
 	dargs, err := namedValueToValue(args)
@@ -76,7 +83,7 @@ func (tc *tracedConn) ExecContext(ctx context.Context, query string, args []driv
 		return nil, ctx.Err()
 	default:
 	}
-	return tc.Exec(query, dargs)
+	return execer.Exec(query, dargs)
 }
 
 // tracedConn has a Ping method in order to implement the pinger interface
@@ -99,11 +106,17 @@ func (tc *tracedConn) Query(query string, args []driver.Value) (driver.Rows, err
 }
 
 func (tc *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
-	span := tc.newChildSpanFromContext(ctx, "Query", query)
+	queryerContext, hasQueryerContext := tc.Conn.(driver.QueryerContext)
+	queryer, hasQueryer := tc.Conn.(driver.Queryer)
+	if !hasQueryerContext && !hasQueryer {
+		// database/sql falls back to preparing a statement, which is traced
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
 	defer func() {
-		span.Finish(tracer.WithError(err))
+		tc.tryTrace(ctx, "Query", query, start, err)
 	}()
-	if queryerContext, ok := tc.Conn.(driver.QueryerContext); ok {
+	if hasQueryerContext {
 		return queryerContext.QueryContext(ctx, query, args)
 	}
 	dargs, err := namedValueToValue(args)
@@ -115,5 +128,5 @@ func (tc *tracedConn) QueryContext(ctx context.Context, query string, args []dri
 		return nil, ctx.Err()
 	default:
 	}
-	return tc.Query(query, dargs)
+	return queryer.Query(query, dargs)
 }
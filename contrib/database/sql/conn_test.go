@@ -0,0 +1,256 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyDriver is a driver implementing none of the optional interfaces of
+// database/sql/driver, so that only the fallbacks of the traced driver are used.
+type legacyDriver struct{}
+
+func (legacyDriver) Open(dsn string) (driver.Conn, error) { return legacyConn{}, nil }
+
+type legacyConn struct{}
+
+func (legacyConn) Prepare(query string) (driver.Stmt, error) { return legacyStmt{}, nil }
+func (legacyConn) Close() error                              { return nil }
+func (legacyConn) Begin() (driver.Tx, error)                 { return legacyTx{}, nil }
+
+type legacyStmt struct{}
+
+func (legacyStmt) Close() error  { return nil }
+func (legacyStmt) NumInput() int { return -1 }
+func (legacyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (legacyStmt) Query(args []driver.Value) (driver.Rows, error) { return legacyRows{}, nil }
+
+type legacyTx struct{}
+
+func (legacyTx) Commit() error   { return nil }
+func (legacyTx) Rollback() error { return nil }
+
+type legacyRows struct{}
+
+func (legacyRows) Columns() []string              { return []string{"id"} }
+func (legacyRows) Close() error                   { return nil }
+func (legacyRows) Next(dest []driver.Value) error { return io.EOF }
+
+// execerDriver is a legacyDriver whose connections execute queries without
+// preparing statements, through the interfaces predating contexts.
+type execerDriver struct{}
+
+func (execerDriver) Open(dsn string) (driver.Conn, error) { return execerConn{}, nil }
+
+type execerConn struct{ legacyConn }
+
+func (execerConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (execerConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	return legacyRows{}, nil
+}
+
+// skipConn is a connection whose context methods return driver.ErrSkip, as
+// drivers do when they need database/sql to prepare a statement.
+type skipConn struct{ legacyConn }
+
+func (skipConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (skipConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
+
+type skipDriver struct{}
+
+func (skipDriver) Open(dsn string) (driver.Conn, error) { return skipConn{}, nil }
+
+// spansByResource returns the finished spans of mt with the given resource.
+func spansByResource(mt mocktracer.Tracer, resource string) []mocktracer.Span {
+	var spans []mocktracer.Span
+	for _, s := range mt.FinishedSpans() {
+		if s.Tag(ext.ResourceName) == resource {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestLegacyDriver(t *testing.T) {
+	Register("legacy", legacyDriver{})
+	db, err := Open("legacy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	t.Run("context", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+		_, err := db.ExecContext(ctx, "UPDATE t SET a = 1")
+		assert.NoError(err)
+		rows, err := db.QueryContext(ctx, "SELECT id FROM t")
+		assert.NoError(err)
+		rows.Close()
+		tx, err := db.BeginTx(ctx, nil)
+		assert.NoError(err)
+		assert.NoError(tx.Commit())
+		parent.Finish()
+
+		for _, resource := range []string{"UPDATE t SET a = ?", "SELECT id FROM t", "Begin", "Commit"} {
+			spans := spansByResource(mt, resource)
+			if !assert.NotEmpty(spans, resource) {
+				continue
+			}
+			for _, s := range spans {
+				assert.Equal(parent.Context().SpanID(), s.ParentID(), resource)
+				assert.Equal("legacy.query", s.OperationName())
+				assert.Equal("legacy.db", s.Tag(ext.ServiceName))
+				assert.Equal(ext.SpanTypeSQL, s.Tag(ext.SpanType))
+				assert.Nil(s.Tag(ext.Error))
+			}
+		}
+	})
+
+	t.Run("no-context", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := db.Exec("UPDATE t SET a = 1")
+		assert.NoError(err)
+		stmt, err := db.Prepare("SELECT id FROM t")
+		assert.NoError(err)
+		rows, err := stmt.Query()
+		assert.NoError(err)
+		rows.Close()
+		stmt.Close()
+
+		for _, resource := range []string{"UPDATE t SET a = ?", "SELECT id FROM t"} {
+			spans := spansByResource(mt, resource)
+			assert.NotEmpty(spans, resource)
+			for _, s := range spans {
+				assert.Zero(s.ParentID(), resource)
+			}
+		}
+	})
+}
+
+func TestExecerDriver(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	Register("execer", execerDriver{})
+	db, err := Open("execer", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(context.Background(), "UPDATE t SET a = 1")
+	assert.NoError(err)
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM t")
+	assert.NoError(err)
+	rows.Close()
+
+	// the queries are run without preparing statements, in a single span each
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Len(spansByResource(mt, "UPDATE t SET a = ?"), 1)
+	assert.Len(spansByResource(mt, "SELECT id FROM t"), 1)
+}
+
+func TestErrSkip(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	Register("skip", skipDriver{})
+	db, err := Open("skip", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(context.Background(), "UPDATE t SET a = 1")
+	assert.NoError(err)
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM t")
+	assert.NoError(err)
+	rows.Close()
+
+	for _, query := range []string{"UPDATE t SET a = ?", "SELECT id FROM t"} {
+		// the statement prepared by database/sql and its execution; the
+		// skipped call is not traced
+		spans := spansByResource(mt, query)
+		assert.Len(spans, 2, query)
+		for _, s := range spans {
+			assert.Nil(s.Tag(ext.Error))
+		}
+	}
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	assert.False(t, Registered("concurrent"))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Register("concurrent", legacyDriver{})
+		}()
+	}
+	wg.Wait()
+	assert.True(t, Registered("concurrent"))
+}
+
+func TestQueryQuantization(t *testing.T) {
+	const query = `SELECT id FROM t WHERE path = 'C:\' AND id = 1`
+	for name, tt := range map[string]struct {
+		driverName string
+		opts       []RegisterOption
+		resource   string
+	}{
+		"default":  {"quantized", nil, "SELECT id FROM t WHERE path = ? AND id = ?"},
+		"disabled": {"unquantized", []RegisterOption{WithQueryQuantization(false)}, query},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			Register(tt.driverName, legacyDriver{}, tt.opts...)
+			db, err := Open(tt.driverName, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			_, err = db.Exec(query)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, spansByResource(mt, tt.resource))
+		})
+	}
+
+	t.Run("mysql", func(t *testing.T) {
+		// the backslash escapes the quote, so that the string never ends
+		tp := &traceParams{driverName: "mysql"}
+		assert.Equal(t, "SELECT id FROM t WHERE path = ?", tp.quantize(query))
+	})
+}
@@ -0,0 +1,51 @@
+// +build go1.10
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+var _ driver.Connector = (*tracedConnector)(nil)
+
+// tracedConnector wraps an inner connector with tracing. It implements the (database/sql).driver.Connector interface.
+type tracedConnector struct {
+	driver.Connector
+	driverName string
+	config     *registerConfig
+}
+
+// Connect returns a tracedConn. As connectors do not expose their DSN, the spans
+// of its connections have no tags about the database they connect to.
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tp := &traceParams{
+		driverName: c.driverName,
+		config:     c.config,
+	}
+	return &tracedConn{conn, tp}, nil
+}
+
+// OpenDB returns a DB using the traced version of the given connector, such as
+// those of drivers configured without a DSN. The driverName names the spans, and
+// suffixed with ".db" is the default service name, like with Register.
+func OpenDB(driverName string, c driver.Connector, opts ...RegisterOption) *sql.DB {
+	cfg := new(registerConfig)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	if cfg.serviceName == "" {
+		cfg.serviceName = driverName + ".db"
+	}
+	return sql.OpenDB(&tracedConnector{
+		Connector:  c,
+		driverName: driverName,
+		config:     cfg,
+	})
+}
@@ -0,0 +1,37 @@
+// +build go1.10
+
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type legacyConnector struct{}
+
+func (legacyConnector) Connect(context.Context) (driver.Conn, error) { return legacyConn{}, nil }
+func (legacyConnector) Driver() driver.Driver                        { return legacyDriver{} }
+
+func TestOpenDB(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	db := OpenDB("connector", legacyConnector{}, WithServiceName("my-db"))
+	defer db.Close()
+	_, err := db.Exec("UPDATE t SET a = 1")
+	assert.NoError(err)
+
+	spans := spansByResource(mt, "UPDATE t SET a = ?")
+	assert.NotEmpty(spans)
+	for _, s := range spans {
+		assert.Equal("connector.query", s.OperationName())
+		assert.Equal("my-db", s.Tag(ext.ServiceName))
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql/quantize"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -52,14 +54,18 @@ type traceParams struct {
 	meta       map[string]string
 }
 
-func (tp *traceParams) newChildSpanFromContext(ctx context.Context, resource string, query string) ddtrace.Span {
+func (tp *traceParams) newChildSpanFromContext(ctx context.Context, resource string, query string, opts ...ddtrace.StartSpanOption) ddtrace.Span {
 	name := fmt.Sprintf("%s.query", tp.driverName)
-	span, _ := tracer.StartSpanFromContext(ctx, name,
+	opts = append(opts,
 		tracer.SpanType(ext.SpanTypeSQL),
 		tracer.ServiceName(tp.config.serviceName),
 	)
+	span, _ := tracer.StartSpanFromContext(ctx, name, opts...)
 	if query != "" {
 		resource = query
+		if tp.config.quantize {
+			resource = tp.quantize(query)
+		}
 	}
 	span.SetTag(ext.ResourceName, resource)
 	for k, v := range tp.meta {
@@ -68,6 +74,26 @@ func (tp *traceParams) newChildSpanFromContext(ctx context.Context, resource str
 	return span
 }
 
+// quantize quantizes the given query, using the dialect of the driver.
+func (tp *traceParams) quantize(query string) string {
+	if tp.driverName == "mysql" {
+		return quantize.MySQL(query)
+	}
+	return quantize.SQL(query)
+}
+
+// tryTrace traces a query which started at startTime and returned err. Drivers
+// return driver.ErrSkip to have database/sql fall back to a prepared statement,
+// such as when they do not interpolate the arguments of queries themselves, in
+// which case the query is traced by the statement instead and no span is created.
+func (tp *traceParams) tryTrace(ctx context.Context, resource string, query string, startTime time.Time, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	span := tp.newChildSpanFromContext(ctx, resource, query, tracer.StartTime(startTime))
+	span.Finish(tracer.WithError(err))
+}
+
 // tracedDriverName returns the name of the traced version for the given driver name.
 func tracedDriverName(name string) string { return name + ".traced" }
 
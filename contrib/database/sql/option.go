@@ -1,12 +1,16 @@
 package sql
 
-type registerConfig struct{ serviceName string }
+type registerConfig struct {
+	serviceName string
+	quantize    bool // whether to quantize the queries used as resources
+}
 
 // RegisterOption represents an option that can be passed to Register.
 type RegisterOption func(*registerConfig)
 
 func defaults(cfg *registerConfig) {
 	// default cfg.serviceName set in Register based on driver name
+	cfg.quantize = true
 }
 
 // WithServiceName sets the given service name for the registered driver.
@@ -15,3 +19,13 @@ func WithServiceName(name string) RegisterOption {
 		cfg.serviceName = name
 	}
 }
+
+// WithQueryQuantization enables or disables quantizing the queries used as the
+// resources of spans, which replaces the values they hold with placeholders to
+// lower their cardinality. It is enabled by default. The queries of the "mysql"
+// driver are quantized using quantize.MySQL, and the others using quantize.SQL.
+func WithQueryQuantization(enabled bool) RegisterOption {
+	return func(cfg *registerConfig) {
+		cfg.quantize = enabled
+	}
+}
@@ -0,0 +1,311 @@
+// Package quantize provides functions to reduce the cardinality of the SQL
+// queries used as span resources, by replacing the values they hold with
+// placeholders.
+package quantize // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql/quantize"
+
+import (
+	"bytes"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// SQL returns the given query with its literals, including NULL, replaced by
+// "?", lists of literals and placeholders, such as the ones of IN clauses and
+// the rows of VALUES clauses, reduced to a single "( ? )", comments removed and
+// whitespace collapsed. Identifiers, keywords and placeholders are kept as is.
+// For example:
+//
+//	SQL("select * from t where id in (1,2,3) -- ids") == "select * from t where id in ( ? )"
+//
+// Quotes are escaped within strings by doubling them, as in standard SQL, and
+// backslashes only escape characters within the E'...' strings of PostgreSQL;
+// see MySQL for the dialects which always use backslash escapes. Unterminated
+// strings and comments extend to the end of the query. In the unexpected event
+// that the query can not be processed, a hash of it is returned, so that it is
+// not reported.
+func SQL(query string) string {
+	return quantize(query, false)
+}
+
+// MySQL is like SQL, for the dialects of MySQL and MariaDB, in which backslashes
+// escape characters within all strings.
+func MySQL(query string) string {
+	return quantize(query, true)
+}
+
+// quantize quantizes the query, as described by SQL. When backslashEscapes is
+// true, backslashes escape characters within all strings.
+func quantize(query string, backslashEscapes bool) (quantized string) {
+	defer func() {
+		if r := recover(); r != nil {
+			h := fnv.New64a()
+			h.Write([]byte(query))
+			quantized = "? " + strconv.FormatUint(h.Sum64(), 16)
+		}
+	}()
+	q := quantizer{tokens: make([]token, 0, len(query)/4), backslashEscapes: backslashEscapes}
+	q.tokenize(query)
+	return q.render()
+}
+
+// tokenKind specifies the kind of a token of a query.
+type tokenKind int
+
+const (
+	tokenOther       tokenKind = iota // keywords, identifiers, operators
+	tokenLiteral                      // strings and numbers, rendered as "?"
+	tokenPlaceholder                  // ?, $1, :name or @name, kept as is
+)
+
+// token is a token of a query.
+type token struct {
+	kind  tokenKind
+	text  string
+	space bool // whether the token is preceded by whitespace or a comment
+}
+
+// quantizer splits a query into tokens and renders them.
+type quantizer struct {
+	tokens []token
+
+	// backslashEscapes reports whether backslashes escape characters within
+	// all strings, rather than only within E'...' strings.
+	backslashEscapes bool
+}
+
+// push appends a token of the given kind to the quantizer.
+func (q *quantizer) push(kind tokenKind, text string, space bool) {
+	q.tokens = append(q.tokens, token{kind: kind, text: text, space: space})
+}
+
+// tokenize splits the query into tokens.
+func (q *quantizer) tokenize(query string) {
+	var space bool
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case isSpace(c):
+			space = true
+			i++
+			continue
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			// -- comment, up to the end of the line
+			i = indexFrom(query, i+2, "\n")
+			space = true
+			continue
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			// /* comment */
+			i = indexFrom(query, i+2, "*/") + 2
+			space = true
+			continue
+		case c == '\'':
+			escapes := q.backslashEscapes
+			if n := len(q.tokens); !space && n > 0 && (q.tokens[n-1].text == "E" || q.tokens[n-1].text == "e") {
+				// E'...' string of PostgreSQL
+				space = q.tokens[n-1].space
+				q.tokens = q.tokens[:n-1]
+				escapes = true
+			}
+			q.push(tokenLiteral, "?", space)
+			i = endOfString(query, i, escapes)
+		case c == '"' || c == '`':
+			// quoted identifier
+			end := indexFrom(query, i+1, query[i:i+1]) + 1
+			if end > len(query) {
+				end = len(query)
+			}
+			q.push(tokenOther, query[i:end], space)
+			i = end
+		case isDigit(c) || (c == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			if signSpace, ok := q.foldSign(); ok {
+				space = signSpace
+			}
+			q.push(tokenLiteral, "?", space)
+			i = endOfNumber(query, i)
+		case c == '?':
+			q.push(tokenPlaceholder, "?", space)
+			i++
+		case (c == '$' || c == ':' || c == '@') && i+1 < len(query) && isIdent(query[i+1]) && !(c == ':' && i > 0 && query[i-1] == ':'):
+			// $1, :name or @name, except for the casts of PostgreSQL (::int)
+			end := i + 1
+			for end < len(query) && isIdent(query[end]) {
+				end++
+			}
+			q.push(tokenPlaceholder, query[i:end], space)
+			i = end
+		case isIdent(c):
+			end := i + 1
+			for end < len(query) && isIdent(query[end]) {
+				end++
+			}
+			if strings.EqualFold(query[i:end], "null") && !q.afterIs() {
+				q.push(tokenLiteral, "?", space)
+			} else {
+				q.push(tokenOther, query[i:end], space)
+			}
+			i = end
+		default:
+			q.push(tokenOther, query[i:i+1], space)
+			i++
+		}
+		space = false
+	}
+}
+
+// foldSign removes the last token when it is the sign of the number which
+// follows, rather than an operator, e.g. in "id = -1" but not in "a - 1". It
+// returns whether the sign was preceded by whitespace.
+func (q *quantizer) foldSign() (space, ok bool) {
+	n := len(q.tokens)
+	if n == 0 {
+		return false, false
+	}
+	last := q.tokens[n-1]
+	if last.kind != tokenOther || (last.text != "-" && last.text != "+") {
+		return false, false
+	}
+	if n > 1 {
+		prev := q.tokens[n-2]
+		if prev.kind != tokenOther || len(prev.text) != 1 || !strings.Contains("(,=<>+-*/%", prev.text) {
+			return false, false
+		}
+	}
+	q.tokens = q.tokens[:n-1]
+	return last.space, true
+}
+
+// afterIs reports whether the last tokens are IS or IS NOT, in which case a
+// NULL which follows is part of the operator rather than a value.
+func (q *quantizer) afterIs() bool {
+	n := len(q.tokens)
+	if n > 1 && strings.EqualFold(q.tokens[n-1].text, "not") {
+		n--
+	}
+	return n > 0 && strings.EqualFold(q.tokens[n-1].text, "is")
+}
+
+// render returns the tokens as a string, reducing the lists which only hold
+// literals and placeholders, as well as sequences of such lists.
+func (q *quantizer) render() string {
+	var b bytes.Buffer
+	b.Grow(len(q.tokens) * 4)
+	for i := 0; i < len(q.tokens); i++ {
+		tok := q.tokens[i]
+		if tok.space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		if tok.kind == tokenOther && tok.text == "(" {
+			if end, ok := q.endOfList(i); ok {
+				b.WriteString("( ? )")
+				for end+2 < len(q.tokens) && q.tokens[end+1].text == "," && q.tokens[end+2].text == "(" {
+					next, ok := q.endOfList(end + 2)
+					if !ok {
+						break
+					}
+					end = next
+				}
+				i = end
+				continue
+			}
+		}
+		if tok.kind == tokenLiteral {
+			b.WriteByte('?')
+			continue
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// endOfList returns the index of the parenthesis closing the list opened at
+// the given index, if all its items are literals or placeholders.
+func (q *quantizer) endOfList(open int) (int, bool) {
+	item := true // whether an item is expected
+	for i := open + 1; i < len(q.tokens); i++ {
+		tok := q.tokens[i]
+		switch {
+		case item && tok.kind != tokenOther:
+			item = false
+		case !item && tok.text == ",":
+			item = true
+		case !item && tok.text == ")":
+			return i, true
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// endOfString returns the index following the string literal starting at the
+// given index, which holds a quote. Quotes are escaped by doubling them, or by
+// a backslash if backslashEscapes is true.
+func endOfString(query string, start int, backslashEscapes bool) int {
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case '\'':
+			if i+1 < len(query) && query[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// endOfNumber returns the index following the number starting at the given
+// index, such as 42, 4.2, .42, 4.2e-1 or 0x2a.
+func endOfNumber(query string, start int) int {
+	i := start
+	if strings.HasPrefix(query[i:], "0x") || strings.HasPrefix(query[i:], "0X") {
+		i += 2
+		for i < len(query) && isHex(query[i]) {
+			i++
+		}
+		return i
+	}
+	for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+		i++
+	}
+	if i < len(query) && (query[i] == 'e' || query[i] == 'E') {
+		j := i + 1
+		if j < len(query) && (query[j] == '+' || query[j] == '-') {
+			j++
+		}
+		if j < len(query) && isDigit(query[j]) {
+			for i = j; i < len(query) && isDigit(query[i]); i++ {
+			}
+		}
+	}
+	return i
+}
+
+// indexFrom returns the index of sep in s, starting at the given index, or the
+// length of s if it is not found.
+func indexFrom(s string, from int, sep string) int {
+	if from >= len(s) {
+		return len(s)
+	}
+	if i := strings.Index(s[from:], sep); i >= 0 {
+		return from + i
+	}
+	return len(s)
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isHex(c byte) bool { return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') }
+
+// isIdent reports whether c may be part of an identifier or keyword. Bytes of
+// multi-byte UTF-8 characters are treated as such.
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
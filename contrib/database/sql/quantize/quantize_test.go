@@ -0,0 +1,79 @@
+package quantize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQL(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"select * from t where id in (1,2,3)", "select * from t where id in ( ? )"},
+		{"SELECT * FROM players WHERE id = 123456", "SELECT * FROM players WHERE id = ?"},
+		{"SELECT * FROM players WHERE id = -1", "SELECT * FROM players WHERE id = ?"},
+		{"SELECT a - 1, b-2 FROM t", "SELECT a - ?, b-? FROM t"},
+		{"SELECT * FROM t WHERE a = 1.5e-3 AND b = .5 AND c = 0xFF AND d = 2E10", "SELECT * FROM t WHERE a = ? AND b = ? AND c = ? AND d = ?"},
+		{"SELECT * FROM t1 WHERE a2 = 3", "SELECT * FROM t1 WHERE a2 = ?"},
+		{"SELECT * FROM t WHERE name = 'O''Brien' AND y = ''", "SELECT * FROM t WHERE name = ? AND y = ?"},
+		{"SELECT * FROM t WHERE path = 'C:\\' AND id = 1", "SELECT * FROM t WHERE path = ? AND id = ?"},
+		{"SELECT * FROM t WHERE x = E'a\\'b' AND id = 1", "SELECT * FROM t WHERE x = ? AND id = ?"},
+		{"SELECT * FROM t WHERE name = 'unterminated", "SELECT * FROM t WHERE name = ?"},
+		{"SELECT \"id\", `name` FROM \"my table\" WHERE \"x\" = 1", "SELECT \"id\", `name` FROM \"my table\" WHERE \"x\" = ?"},
+		{"SELECT  *\n\tFROM   t\r\n WHERE id = 1", "SELECT * FROM t WHERE id = ?"},
+		{"SELECT * -- all columns\nFROM t /* the table */ WHERE id = 1 -- trailing", "SELECT * FROM t WHERE id = ?"},
+		{"SELECT * FROM t /* unterminated", "SELECT * FROM t"},
+		{"SELECT * FROM t WHERE id IN (?, ?, ?)", "SELECT * FROM t WHERE id IN ( ? )"},
+		{"SELECT * FROM t WHERE id IN ($1,$2) AND name = $3", "SELECT * FROM t WHERE id IN ( ? ) AND name = $3"},
+		{"SELECT * FROM t WHERE id = :id AND x = @x", "SELECT * FROM t WHERE id = :id AND x = @x"},
+		{"SELECT id::text FROM t", "SELECT id::text FROM t"},
+		{"INSERT INTO t (a, b) VALUES (1, 'x'), (-2, NULL)", "INSERT INTO t (a, b) VALUES ( ? )"},
+		{"INSERT INTO t (a, b) VALUES (1, 'x'), (2, now())", "INSERT INTO t (a, b) VALUES ( ? ), (?, now())"},
+		{"SELECT * FROM t WHERE a IS NULL AND b IS NOT null AND c = NULL", "SELECT * FROM t WHERE a IS NULL AND b IS NOT null AND c = ?"},
+		{"SELECT count(*) FROM t WHERE f(1, a) > 2", "SELECT count(*) FROM t WHERE f(?, a) > ?"},
+		{"SELECT * FROM t WHERE a IN ('x', 'y')", "SELECT * FROM t WHERE a IN ( ? )"},
+		{"SELECT * FROM t WHERE a IN ()", "SELECT * FROM t WHERE a IN ()"},
+		{"SELECT 'héllo', naïve FROM t", "SELECT ?, naïve FROM t"},
+	} {
+		assert.Equal(t, tt.out, SQL(tt.in), tt.in)
+	}
+}
+
+func TestMySQL(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"SELECT * FROM t WHERE name = 'O''Brien' AND x = 'a\\'b' AND y = ''", "SELECT * FROM t WHERE name = ? AND x = ? AND y = ?"},
+		{"SELECT * FROM t WHERE path = 'C:\\\\' AND id = 1", "SELECT * FROM t WHERE path = ? AND id = ?"},
+	} {
+		assert.Equal(t, tt.out, MySQL(tt.in), tt.in)
+	}
+}
+
+func TestSQLNoPanic(t *testing.T) {
+	for _, in := range []string{"'", "\"", "`", "--", "/*", "-", ".", "0x", "1e", "1e+", "$", ":", "@", "(", ")", "'\\", "(1,", "(1", "\x00\xff"} {
+		assert.NotPanics(t, func() { SQL(in) }, in)
+		assert.NotPanics(t, func() { SQL("SELECT " + in) }, in)
+		assert.NotPanics(t, func() { MySQL("SELECT " + in) }, in)
+	}
+}
+
+func BenchmarkSQL(b *testing.B) {
+	for _, bb := range []struct {
+		name, query string
+	}{
+		{"simple", "SELECT * FROM players WHERE id = 123456"},
+		{"in-list", "SELECT * FROM players WHERE id IN (" + strings.Repeat("42, ", 99) + "42) AND name = 'bob'"},
+		{"comments", "/* dashboard */ SELECT a, b, c -- columns\nFROM t WHERE x = 'O''Brien' AND y > 1.5e3"},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				SQL(bb.query)
+			}
+		})
+	}
+}
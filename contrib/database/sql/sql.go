@@ -15,15 +15,23 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"sync"
 )
 
+// registerMu serializes the calls to Register, so that a driver is registered once
+// even when it is registered concurrently.
+var registerMu sync.Mutex
+
 // Register tells the sql integration package about the driver that we will be tracing. It must
 // be called before Open, if that connection is to be traced. It uses the driverName suffixed
-// with ".db" as the default service name.
+// with ".db" as the default service name. Registering a driver again has no effect, and it is
+// safe to call concurrently.
 func Register(driverName string, driver driver.Driver, opts ...RegisterOption) {
 	if driver == nil {
 		panic("sqltrace: Register driver is nil")
 	}
+	registerMu.Lock()
+	defer registerMu.Unlock()
 	name := tracedDriverName(driverName)
 	if driverExists(name) {
 		// no problem, carry on
@@ -44,6 +52,11 @@ func Register(driverName string, driver driver.Driver, opts ...RegisterOption) {
 	})
 }
 
+// Registered reports whether the driver named driverName was registered using Register.
+func Registered(driverName string) bool {
+	return driverExists(tracedDriverName(driverName))
+}
+
 // errNotRegistered is returned when there is an attempt to open a database connection towards a driver
 // that has not previously been registered using this package.
 var errNotRegistered = errors.New("sqltrace: Register must be called before Open")
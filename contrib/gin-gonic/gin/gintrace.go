@@ -1,4 +1,11 @@
 // Package gin provides functions to trace the gin-gonic/gin package (https://github.com/gin-gonic/gin).
+//
+// It supports gin v1.5.0 or later, which provide Context.FullPath.
+//
+// The resource of the spans used to be the name of the handler of the
+// requests. It is now their method and route pattern, such as "GET /user/:id".
+// Resources can still be named after handlers with a WithResourceNamer option
+// returning c.HandlerName().
 package gin // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/gin-gonic/gin"
 
 import (
@@ -12,12 +19,19 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Middleware returns middleware that will trace incoming requests.
-// The last parameter is optional and can be used to pass a custom tracer.
-func Middleware(service string) gin.HandlerFunc {
+// Middleware returns middleware that will trace incoming requests. The resource
+// of the spans is the method of the requests followed by the pattern of their
+// matched route, such as "GET /user/:id", or by their path if no route matched
+// them, as for the requests served by the NoRoute handlers.
+func Middleware(service string, opts ...Option) gin.HandlerFunc {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
 	return func(c *gin.Context) {
-		resource := c.HandlerName()
-		opts := []ddtrace.StartSpanOption{
+		resource := cfg.resourceNamer(c)
+		spanopts := []ddtrace.StartSpanOption{
 			tracer.ServiceName(service),
 			tracer.ResourceName(resource),
 			tracer.SpanType(ext.SpanTypeWeb),
@@ -25,9 +39,9 @@ func Middleware(service string) gin.HandlerFunc {
 			tracer.Tag(ext.HTTPURL, c.Request.URL.Path),
 		}
 		if spanctx, err := tracer.Extract(tracer.HTTPHeadersCarrier(c.Request.Header)); err == nil {
-			opts = append(opts, tracer.ChildOf(spanctx))
+			spanopts = append(spanopts, tracer.ChildOf(spanctx))
 		}
-		span, ctx := tracer.StartSpanFromContext(c.Request.Context(), "http.request", opts...)
+		span, ctx := tracer.StartSpanFromContext(c.Request.Context(), "http.request", spanopts...)
 		defer span.Finish()
 
 		// pass the span through the request context
@@ -45,6 +59,12 @@ func Middleware(service string) gin.HandlerFunc {
 	}
 }
 
+// SpanFromContext returns the span serving the request of c, if any, for
+// handlers adding tags to it.
+func SpanFromContext(c *gin.Context) (ddtrace.Span, bool) {
+	return tracer.SpanFromContext(c.Request.Context())
+}
+
 // HTML will trace the rendering of the template as a child of the span in the given context.
 func HTML(c *gin.Context, code int, name string, obj interface{}) {
 	span, _ := tracer.StartSpanFromContext(c.Request.Context(), "gin.render.html")
@@ -69,13 +69,82 @@ func TestTrace200(t *testing.T) {
 	assert.Equal("http.request", span.OperationName())
 	assert.Equal(ext.SpanTypeWeb, span.Tag(ext.SpanType))
 	assert.Equal("foobar", span.Tag(ext.ServiceName))
-	assert.Contains(span.Tag(ext.ResourceName), "gin.TestTrace200")
+	assert.Equal("GET /user/:id", span.Tag(ext.ResourceName))
 	assert.Equal("200", span.Tag(ext.HTTPCode))
 	assert.Equal("GET", span.Tag(ext.HTTPMethod))
-	// TODO(x) would be much nicer to have "/user/:id" here
 	assert.Equal("/user/123", span.Tag(ext.HTTPURL))
 }
 
+func TestNoRoute(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := gin.New()
+	router.Use(Middleware("foobar"))
+	router.NoRoute(func(c *gin.Context) {
+		c.String(404, "not found")
+	})
+	r := httptest.NewRequest("GET", "/not_a_real_route", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(404, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("GET /not_a_real_route", spans[0].Tag(ext.ResourceName))
+	assert.Equal("404", spans[0].Tag(ext.HTTPCode))
+}
+
+func TestAbort(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := gin.New()
+	router.Use(Middleware("foobar"))
+	router.Use(func(c *gin.Context) {
+		c.AbortWithStatus(401)
+	})
+	router.GET("/user/:id", func(c *gin.Context) {
+		t.Fatal("aborted requests should not be served")
+	})
+	r := httptest.NewRequest("GET", "/user/123", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(401, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("GET /user/:id", spans[0].Tag(ext.ResourceName))
+	assert.Equal("401", spans[0].Tag(ext.HTTPCode))
+	assert.Nil(spans[0].Tag(ext.Error))
+}
+
+func TestResourceNamer(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := gin.New()
+	router.Use(Middleware("foobar", WithResourceNamer(func(c *gin.Context) string {
+		return c.HandlerName()
+	})))
+	router.GET("/user/:id", func(c *gin.Context) {
+		span, ok := SpanFromContext(c)
+		assert.True(ok)
+		span.SetTag("user.id", c.Param("id"))
+	})
+	r := httptest.NewRequest("GET", "/user/123", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Contains(spans[0].Tag(ext.ResourceName), "gin.TestResourceNamer")
+	assert.Equal("123", spans[0].Tag("user.id"))
+}
+
 func TestError(t *testing.T) {
 	assert := assert.New(t)
 	mt := mocktracer.Start()
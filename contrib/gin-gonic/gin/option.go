@@ -0,0 +1,32 @@
+package gin
+
+import "github.com/gin-gonic/gin"
+
+type config struct {
+	resourceNamer func(c *gin.Context) string
+}
+
+// Option represents an option that can be passed to Middleware.
+type Option func(*config)
+
+func defaults(cfg *config) {
+	cfg.resourceNamer = defaultResourceNamer
+}
+
+// defaultResourceNamer names resources after the method of the requests and
+// the pattern of their matched route, or their path if no route matched them.
+func defaultResourceNamer(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	return c.Request.Method + " " + route
+}
+
+// WithResourceNamer specifies a function returning the resource name of the
+// span of the request of c, instead of its method and route pattern.
+func WithResourceNamer(fn func(c *gin.Context) string) Option {
+	return func(cfg *config) {
+		cfg.resourceNamer = fn
+	}
+}
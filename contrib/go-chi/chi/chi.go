@@ -0,0 +1,61 @@
+// Package chi provides tracing functions for tracing the go-chi/chi package (https://github.com/go-chi/chi).
+//
+// It supports go-chi/chi v3.1.5 or later, which provide Context.RoutePattern.
+package chi // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/go-chi/chi"
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/httputil"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/go-chi/chi"
+)
+
+// Middleware returns middleware that will trace incoming requests. As the
+// route matching a request is only known once it was routed, the resource of
+// its span is set after the request was served, to the method of the request
+// followed by the pattern of the route, such as "GET /users/{id}". The path
+// of the request is used instead if no route matched it.
+func Middleware(opts ...Option) func(next http.Handler) http.Handler {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return func(next http.Handler) http.Handler {
+		h := routeHandler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.ignoreRequest != nil && cfg.ignoreRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			resource := r.Method + " " + r.URL.Path
+			httputil.TraceAndServe(h, w, r, cfg.serviceName, resource, cfg.spanOpts...)
+		})
+	}
+}
+
+// routeHandler returns a handler serving requests using next, then setting
+// the resource of their span to their route pattern. Panics mark the span
+// as an error before being propagated.
+func routeHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ := tracer.SpanFromContext(r.Context())
+		defer func() {
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if pattern := rctx.RoutePattern(); pattern != "" {
+					span.SetTag(ext.ResourceName, r.Method+" "+pattern)
+				}
+			}
+			if rec := recover(); rec != nil {
+				span.SetTag(ext.HTTPCode, "500")
+				span.SetTag(ext.Error, fmt.Errorf("panic: %v", rec))
+				panic(rec)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
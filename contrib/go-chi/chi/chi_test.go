@@ -0,0 +1,158 @@
+package chi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	for _, ht := range []struct {
+		code     int
+		method   string
+		url      string
+		resource string
+		errorStr string
+	}{
+		{
+			code:     http.StatusOK,
+			method:   "GET",
+			url:      "/200",
+			resource: "GET /200",
+		},
+		{
+			code:     http.StatusOK,
+			method:   "GET",
+			url:      "/users/6ac3fd",
+			resource: "GET /users/{id}",
+		},
+		{
+			code:     http.StatusOK,
+			method:   "GET",
+			url:      "/files/a/b.txt",
+			resource: "GET /files/*",
+		},
+		{
+			code:     http.StatusOK,
+			method:   "GET",
+			url:      "/api/teams/42",
+			resource: "GET /api/teams/{team}",
+		},
+		{
+			code:     http.StatusNotFound,
+			method:   "GET",
+			url:      "/not_a_real_route",
+			resource: "GET /not_a_real_route",
+		},
+		{
+			code:     http.StatusInternalServerError,
+			method:   "GET",
+			url:      "/500",
+			resource: "GET /500",
+			errorStr: "500: Internal Server Error",
+		},
+	} {
+		t.Run(ht.url, func(t *testing.T) {
+			assert := assert.New(t)
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			r := httptest.NewRequest(ht.method, ht.url, nil)
+			w := httptest.NewRecorder()
+			router().ServeHTTP(w, r)
+			assert.Equal(ht.code, w.Code)
+
+			spans := mt.FinishedSpans()
+			assert.Equal(1, len(spans))
+
+			s := spans[0]
+			assert.Equal("http.request", s.OperationName())
+			assert.Equal("my-service", s.Tag(ext.ServiceName))
+			assert.Equal(strconv.Itoa(ht.code), s.Tag(ext.HTTPCode))
+			assert.Equal(ht.method, s.Tag(ext.HTTPMethod))
+			assert.Equal(ht.url, s.Tag(ext.HTTPURL))
+			assert.Equal(ht.resource, s.Tag(ext.ResourceName))
+			if ht.errorStr != "" {
+				assert.Equal(ht.errorStr, s.Tag(ext.Error).(error).Error())
+			} else {
+				assert.Nil(s.Tag(ext.Error))
+			}
+		})
+	}
+}
+
+func TestPanic(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	r := httptest.NewRequest("GET", "/panic", nil)
+	w := httptest.NewRecorder()
+	assert.Panics(func() { router().ServeHTTP(w, r) })
+
+	spans := mt.FinishedSpans()
+	assert.Equal(1, len(spans))
+	assert.Equal("GET /panic", spans[0].Tag(ext.ResourceName))
+	assert.Equal("500", spans[0].Tag(ext.HTTPCode))
+	assert.Equal("panic: boom", spans[0].Tag(ext.Error).(error).Error())
+}
+
+func TestIgnoreRequest(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := chi.NewRouter()
+	router.Use(Middleware(WithIgnoreRequest(func(r *http.Request) bool {
+		return r.URL.Path == "/health"
+	})))
+	router.Handle("/health", okHandler())
+	router.Handle("/200", okHandler())
+	for _, url := range []string{"/health", "/200"} {
+		r := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(http.StatusOK, w.Code)
+	}
+
+	spans := mt.FinishedSpans()
+	assert.Equal(1, len(spans))
+	assert.Equal("chi.router", spans[0].Tag(ext.ServiceName))
+	assert.Equal("GET /200", spans[0].Tag(ext.ResourceName))
+}
+
+func router() http.Handler {
+	router := chi.NewRouter()
+	router.Use(Middleware(WithServiceName("my-service")))
+	router.Handle("/200", okHandler())
+	router.Handle("/500", errorHandler(http.StatusInternalServerError))
+	router.Get("/users/{id}", okHandler().ServeHTTP)
+	router.Get("/files/*", okHandler().ServeHTTP)
+	router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	api := chi.NewRouter()
+	api.Get("/teams/{team}", okHandler().ServeHTTP)
+	router.Mount("/api", api)
+	return router
+}
+
+func errorHandler(code int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("%d!", code), code)
+	})
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("200!\n"))
+	})
+}
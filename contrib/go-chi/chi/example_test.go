@@ -0,0 +1,27 @@
+package chi_test
+
+import (
+	"net/http"
+
+	chitrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/go-chi/chi"
+
+	"github.com/go-chi/chi"
+)
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Hello World!\n"))
+}
+
+func Example() {
+	router := chi.NewRouter()
+	router.Use(chitrace.Middleware())
+	router.Get("/", handler)
+	http.ListenAndServe(":8080", router)
+}
+
+func Example_withServiceName() {
+	router := chi.NewRouter()
+	router.Use(chitrace.Middleware(chitrace.WithServiceName("chi.router")))
+	router.Get("/", handler)
+	http.ListenAndServe(":8080", router)
+}
@@ -1,6 +1,9 @@
 package redis // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/go-redis/redis"
 
-type clientConfig struct{ serviceName string }
+type clientConfig struct {
+	serviceName string
+	rawCommand  bool // whether to add the raw commands, holding their arguments, to spans
+}
 
 // ClientOption represents an option that can be used to create or wrap a client.
 type ClientOption func(*clientConfig)
@@ -15,3 +18,13 @@ func WithServiceName(name string) ClientOption {
 		cfg.serviceName = name
 	}
 }
+
+// WithRawCommand enables or disables adding the raw commands sent to the server,
+// holding their arguments, as the "redis.raw_command" tag of spans. As arguments
+// may hold sensitive data, it is disabled by default, and only the number of
+// arguments is recorded.
+func WithRawCommand(enabled bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.rawCommand = enabled
+	}
+}
@@ -1,4 +1,8 @@
 // Package redis provides tracing functions for tracing the go-redis/redis package (https://github.com/go-redis/redis).
+//
+// It supports go-redis/redis v6.8.0 or later, except v6.10.0, where the
+// commands of clients returned by Client.WithContext are traced with the
+// context of the original client.
 package redis
 
 import (
@@ -19,6 +23,8 @@ import (
 type Client struct {
 	*redis.Client
 	*params
+
+	process func(cmd redis.Cmder) error // the untraced process function of the client
 }
 
 var _ redis.Cmdable = (*Client)(nil)
@@ -64,8 +70,11 @@ func WrapClient(c *redis.Client, opts ...ClientOption) *Client {
 		db:     strconv.Itoa(opt.DB),
 		config: cfg,
 	}
-	tc := &Client{c, params}
-	tc.Client.WrapProcess(createWrapperFromClient(tc))
+	tc := &Client{Client: c, params: params}
+	tc.Client.WrapProcess(func(oldProcess func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		tc.process = oldProcess
+		return tc.traceProcess
+	})
 	return tc
 }
 
@@ -96,8 +105,11 @@ func (c *Pipeliner) execWithContext(ctx context.Context) ([]redis.Cmder, error)
 		tracer.Tag("out.db", p.db),
 	)
 	cmds, err := c.Pipeliner.Exec()
-	span.SetTag(ext.ResourceName, commandsToString(cmds))
-	span.SetTag("redis.pipeline_length", strconv.Itoa(len(cmds)))
+	span.SetTag(ext.ResourceName, commandNames(cmds))
+	span.SetTag("redis.pipeline_length", len(cmds))
+	if p.config.rawCommand {
+		span.SetTag("redis.raw_command", commandsToString(cmds))
+	}
 	var opts []ddtrace.FinishOption
 	if err != redis.Nil {
 		opts = append(opts, tracer.WithError(err))
@@ -107,6 +119,15 @@ func (c *Pipeliner) execWithContext(ctx context.Context) ([]redis.Cmder, error)
 	return cmds, err
 }
 
+// commandNames returns the names of a slice of redis Commands, separated by spaces.
+func commandNames(cmds []redis.Cmder) string {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = strings.ToUpper(cmd.Name())
+	}
+	return strings.Join(names, " ")
+}
+
 // commandsToString returns a string representation of a slice of redis Commands, separated by newlines.
 func commandsToString(cmds []redis.Cmder) string {
 	var b bytes.Buffer
@@ -117,42 +138,48 @@ func commandsToString(cmds []redis.Cmder) string {
 	return b.String()
 }
 
-// WithContext sets a context on a Client. Use it to ensure that emitted spans have the correct parent.
+// WithContext returns a shallow copy of the Client with its context set to ctx. Use it to ensure
+// that emitted spans have the correct parent. The Client itself is left unchanged.
 func (c *Client) WithContext(ctx context.Context) *Client {
-	c.Client = c.Client.WithContext(ctx)
-	return c
+	clone := &Client{
+		Client:  c.Client.WithContext(ctx),
+		params:  c.params,
+		process: c.process,
+	}
+	// the copy inherits the process function of c, which traces commands using the
+	// context of c, so it is replaced by one using the context of the copy. To
+	// understand this functionality better see the documentation for the
+	// github.com/go-redis/redis.(*baseClient).WrapProcess function.
+	clone.Client.WrapProcess(func(func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return clone.traceProcess
+	})
+	return clone
 }
 
-// createWrapperFromClient returns a new createWrapper function which wraps the processor with tracing
-// information obtained from the provided Client. To understand this functionality better see the
-// documentation for the github.com/go-redis/redis.(*baseClient).WrapProcess function.
-func createWrapperFromClient(tc *Client) func(oldProcess func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
-	return func(oldProcess func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
-		return func(cmd redis.Cmder) error {
-			ctx := tc.Client.Context()
-			raw := cmderToString(cmd)
-			parts := strings.Split(raw, " ")
-			length := len(parts) - 1
-			p := tc.params
-			span, _ := tracer.StartSpanFromContext(ctx, "redis.command",
-				tracer.SpanType(ext.SpanTypeRedis),
-				tracer.ServiceName(p.config.serviceName),
-				tracer.ResourceName(parts[0]),
-				tracer.Tag(ext.TargetHost, p.host),
-				tracer.Tag(ext.TargetPort, p.port),
-				tracer.Tag("out.db", p.db),
-				tracer.Tag("redis.raw_command", raw),
-				tracer.Tag("redis.args_length", strconv.Itoa(length)),
-			)
-			err := oldProcess(cmd)
-			var opts []ddtrace.FinishOption
-			if err != redis.Nil {
-				opts = append(opts, tracer.WithError(err))
-			}
-			span.Finish(opts...)
-			return err
-		}
+// traceProcess processes cmd using the untraced process function of the client,
+// as a child of the span found in the context of the client.
+func (c *Client) traceProcess(cmd redis.Cmder) error {
+	p := c.params
+	opts := []ddtrace.StartSpanOption{
+		tracer.SpanType(ext.SpanTypeRedis),
+		tracer.ServiceName(p.config.serviceName),
+		tracer.ResourceName(strings.ToUpper(cmd.Name())),
+		tracer.Tag(ext.TargetHost, p.host),
+		tracer.Tag(ext.TargetPort, p.port),
+		tracer.Tag("out.db", p.db),
+		tracer.Tag("redis.args_length", strconv.Itoa(len(cmd.Args())-1)),
+	}
+	if p.config.rawCommand {
+		opts = append(opts, tracer.Tag("redis.raw_command", cmderToString(cmd)))
+	}
+	span, _ := tracer.StartSpanFromContext(c.Client.Context(), "redis.command", opts...)
+	err := c.process(cmd)
+	var finishOpts []ddtrace.FinishOption
+	if err != redis.Nil {
+		finishOpts = append(finishOpts, tracer.WithError(err))
 	}
+	span.Finish(finishOpts...)
+	return err
 }
 
 func cmderToString(cmd redis.Cmder) string {
@@ -160,12 +187,13 @@ func cmderToString(cmd redis.Cmder) string {
 	// older versions Cmder implements the Stringer interface, while in
 	// newer versions that was removed, and this String method which
 	// sometimes returns an error is used instead. By doing a type assertion
-	// we can support both versions.
-	if s, ok := cmd.(interface{ String() string }); ok {
+	// we can support both versions. The assertions are made on an empty
+	// interface, as either of them is impossible on a Cmder of the other version.
+	if s, ok := interface{}(cmd).(interface{ String() string }); ok {
 		return s.String()
 	}
 
-	if s, ok := cmd.(interface{ String() (string, error) }); ok {
+	if s, ok := interface{}(cmd).(interface{ String() (string, error) }); ok {
 		str, err := s.String()
 		if err == nil {
 			return str
@@ -44,8 +44,28 @@ func TestClient(t *testing.T) {
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 	assert.Equal("6379", span.Tag(ext.TargetPort))
-	assert.Equal("set test_key test_value: ", span.Tag("redis.raw_command"))
-	assert.Equal("3", span.Tag("redis.args_length"))
+	assert.Equal("0", span.Tag("out.db"))
+	assert.Equal("SET", span.Tag(ext.ResourceName))
+	assert.Nil(span.Tag("redis.raw_command"))
+	assert.Equal("2", span.Tag("redis.args_length"))
+}
+
+func TestRawCommand(t *testing.T) {
+	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithRawCommand(true))
+	client.Set("test_key", "test_value", 0)
+	pipeline := client.Pipeline()
+	pipeline.Expire("pipeline_counter", time.Hour)
+	pipeline.Exec()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("set test_key test_value: ", spans[0].Tag("redis.raw_command"))
+	assert.Equal("expire pipeline_counter 3600: false\n", spans[1].Tag("redis.raw_command"))
 }
 
 func TestPipeline(t *testing.T) {
@@ -68,10 +88,11 @@ func TestPipeline(t *testing.T) {
 	assert.Equal("redis.command", span.OperationName())
 	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
-	assert.Equal("expire pipeline_counter 3600: false\n", span.Tag(ext.ResourceName))
+	assert.Equal("EXPIRE", span.Tag(ext.ResourceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 	assert.Equal("6379", span.Tag(ext.TargetPort))
-	assert.Equal("1", span.Tag("redis.pipeline_length"))
+	assert.Equal(1, span.Tag("redis.pipeline_length"))
+	assert.Nil(span.Tag("redis.raw_command"))
 
 	mt.Reset()
 	pipeline.Expire("pipeline_counter", time.Hour)
@@ -87,8 +108,8 @@ func TestPipeline(t *testing.T) {
 	assert.Equal("redis.command", span.OperationName())
 	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
-	assert.Equal("expire pipeline_counter 3600: false\nexpire pipeline_counter_1 60: false\n", span.Tag(ext.ResourceName))
-	assert.Equal("2", span.Tag("redis.pipeline_length"))
+	assert.Equal("EXPIRE EXPIRE", span.Tag(ext.ResourceName))
+	assert.Equal(2, span.Tag("redis.pipeline_length"))
 }
 
 func TestChildSpan(t *testing.T) {
@@ -100,19 +121,24 @@ func TestChildSpan(t *testing.T) {
 	// Parent span
 	client := NewClient(opts, WithServiceName("my-redis"))
 	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent.span")
-	client = client.WithContext(ctx)
-	client.Set("test_key", "test_value", 0)
+	client.WithContext(ctx).Set("test_key", "test_value", 0)
+	// the client itself keeps its context
+	client.Get("test_key")
 	root.Finish()
 
 	spans := mt.FinishedSpans()
-	assert.Len(spans, 2)
+	assert.Len(spans, 3)
+	assert.Equal("GET", spans[1].Tag(ext.ResourceName))
+	assert.Zero(spans[1].ParentID())
 
 	var child, parent mocktracer.Span
 	for _, s := range spans {
 		// order of traces in buffer is not garanteed
 		switch s.OperationName() {
 		case "redis.command":
-			child = s
+			if s.Tag(ext.ResourceName) == "SET" {
+				child = s
+			}
 		case "parent.span":
 			parent = s
 		}
@@ -143,12 +169,12 @@ func TestMultipleCommands(t *testing.T) {
 	// Checking all commands were recorded
 	var commands [4]string
 	for i := 0; i < 4; i++ {
-		commands[i] = spans[i].Tag("redis.raw_command").(string)
+		commands[i] = spans[i].Tag(ext.ResourceName).(string)
 	}
-	assert.Contains(commands, "set test_key test_value: ")
-	assert.Contains(commands, "get test_key: ")
-	assert.Contains(commands, "incr int_key: 0")
-	assert.Contains(commands, "client list: ")
+	assert.Contains(commands, "SET")
+	assert.Contains(commands, "GET")
+	assert.Contains(commands, "INCR")
+	assert.Contains(commands, "CLIENT")
 }
 
 func TestError(t *testing.T) {
@@ -170,7 +196,7 @@ func TestError(t *testing.T) {
 		assert.Equal(err, span.Tag(ext.Error))
 		assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 		assert.Equal("6378", span.Tag(ext.TargetPort))
-		assert.Equal("get key: ", span.Tag("redis.raw_command"))
+		assert.Equal("GET", span.Tag(ext.ResourceName))
 	})
 
 	t.Run("nil", func(t *testing.T) {
@@ -191,6 +217,6 @@ func TestError(t *testing.T) {
 		assert.Empty(span.Tag(ext.Error))
 		assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
 		assert.Equal("6379", span.Tag(ext.TargetPort))
-		assert.Equal("get non_existent_key: ", span.Tag("redis.raw_command"))
+		assert.Equal("GET", span.Tag(ext.ResourceName))
 	})
 }
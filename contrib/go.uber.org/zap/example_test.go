@@ -0,0 +1,22 @@
+package zap_test
+
+import (
+	"context"
+
+	zaptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/go.uber.org/zap"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"go.uber.org/zap"
+)
+
+func Example() {
+	logger, _ := zap.NewProduction()
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+	defer span.Finish()
+
+	// Add the trace fields to a single entry...
+	logger.Info("handling request", zaptrace.TraceFields(ctx)...)
+
+	// ... or to all the entries of a logger.
+	logger.WithOptions(zaptrace.WrapCore(ctx)).Sugar().Infof("handling %s", "request")
+}
@@ -0,0 +1,41 @@
+// Package zap provides functions to correlate the logs of the go.uber.org/zap package (https://github.com/uber-go/zap)
+// with traces, by adding the IDs of the current trace and span to log entries.
+package zap // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/go.uber.org/zap"
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// TraceFields returns the "dd.trace_id" and "dd.span_id" fields holding the IDs
+// of the span found in ctx. If ctx contains no span, it returns nil.
+func TraceFields(ctx context.Context) []zap.Field {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{
+		zap.Uint64(ext.LogKeyTraceID, span.Context().TraceID()),
+		zap.Uint64(ext.LogKeySpanID, span.Context().SpanID()),
+	}
+}
+
+// WrapCore returns a zap.Option which adds the fields returned by TraceFields
+// to all the entries logged by a logger. It is meant to be used with the logger
+// at hand when handling a traced operation:
+//  logger.WithOptions(zaptrace.WrapCore(ctx)).Info("message")
+// If ctx contains no span, the logger is left untouched.
+func WrapCore(ctx context.Context) zap.Option {
+	fields := TraceFields(ctx)
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if fields == nil {
+			return core
+		}
+		return core.With(fields)
+	})
+}
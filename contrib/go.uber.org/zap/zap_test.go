@@ -0,0 +1,92 @@
+package zap
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTraceFields(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	t.Run("span", func(t *testing.T) {
+		assert := assert.New(t)
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		defer span.Finish()
+		assert.Equal([]zap.Field{
+			zap.Uint64("dd.trace_id", span.Context().TraceID()),
+			zap.Uint64("dd.span_id", span.Context().SpanID()),
+		}, TraceFields(ctx))
+	})
+
+	t.Run("no-span", func(t *testing.T) {
+		assert.Nil(t, TraceFields(context.Background()))
+		assert.Nil(t, TraceFields(nil))
+	})
+}
+
+func TestWrapCore(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	t.Run("span", func(t *testing.T) {
+		assert := assert.New(t)
+		core, logs := observer.New(zap.InfoLevel)
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		defer span.Finish()
+		zap.New(core).WithOptions(WrapCore(ctx)).Sugar().Infow("message", "key", "value")
+
+		entries := logs.All()
+		assert.Len(entries, 1)
+		assert.Equal(map[string]interface{}{
+			"dd.trace_id": span.Context().TraceID(),
+			"dd.span_id":  span.Context().SpanID(),
+			"key":         "value",
+		}, entries[0].ContextMap())
+	})
+
+	t.Run("no-span", func(t *testing.T) {
+		assert := assert.New(t)
+		core, logs := observer.New(zap.InfoLevel)
+		zap.New(core).WithOptions(WrapCore(context.Background())).Info("message")
+
+		entries := logs.All()
+		assert.Len(entries, 1)
+		assert.Empty(entries[0].ContextMap())
+	})
+}
+
+func TestTraceFieldsNoSpanAllocs(t *testing.T) {
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() { TraceFields(ctx) })
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkTraceFields(b *testing.B) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	b.Run("no-span", func(b *testing.B) {
+		ctx := context.Background()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			TraceFields(ctx)
+		}
+	})
+
+	b.Run("span", func(b *testing.B) {
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		defer span.Finish()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			TraceFields(ctx)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package redigo_test
+
+import (
+	"context"
+	"log"
+	"time"
+
+	redigotrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gomodule/redigo"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// To start tracing Redis commands, use the Dial function to create a connection,
+// passing in a service name of choice.
+func Example() {
+	c, err := redigotrace.Dial("tcp", "127.0.0.1:6379")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Emit spans per command by using your Redis connection as usual
+	c.Do("SET", "vehicle", "truck")
+
+	// Use a context to pass information down the call chain
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent.request",
+		tracer.ServiceName("web"),
+		tracer.ResourceName("/home"),
+	)
+
+	// The span of the command inherits from 'parent.request'
+	redigotrace.DoWithContext(c, ctx, "SET", "food", "cheese")
+	root.Finish()
+}
+
+// Alternatively, provide a redis URL to the DialURL function
+func Example_dialURL() {
+	c, err := redigotrace.DialURL("redis://127.0.0.1:6379/1")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Do("SET", "vehicle", "truck")
+}
+
+// Traced connections can be used by pools, when returned by their Dial function.
+func Example_pool() {
+	pool := &redis.Pool{
+		MaxIdle:     2,
+		IdleTimeout: time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redigotrace.Dial("tcp", "127.0.0.1:6379",
+				redigotrace.WithServiceName("my-redis-backend"),
+				redis.DialKeepAlive(time.Minute),
+			)
+		},
+	}
+
+	c := pool.Get()
+	defer c.Close()
+
+	// Pipelined commands emit a single span
+	c.Send("SET", "vehicle", "truck")
+	c.Send("GET", "vehicle")
+	c.Flush()
+	c.Receive()
+	c.Receive()
+}
@@ -0,0 +1,30 @@
+package redigo
+
+type dialConfig struct {
+	serviceName string
+	rawCommand  bool // whether to add the raw commands, holding their arguments, to spans
+}
+
+// DialOption represents an option that can be passed to Dial.
+type DialOption func(*dialConfig)
+
+func defaults(cfg *dialConfig) {
+	cfg.serviceName = "redis.conn"
+}
+
+// WithServiceName sets the given service name for the dialled connection.
+func WithServiceName(name string) DialOption {
+	return func(cfg *dialConfig) {
+		cfg.serviceName = name
+	}
+}
+
+// WithRawCommand enables or disables adding the raw commands sent to the server,
+// holding their arguments, as the "redis.raw_command" tag of spans. As arguments
+// may hold sensitive data, it is disabled by default, and only the number of
+// arguments is recorded.
+func WithRawCommand(enabled bool) DialOption {
+	return func(cfg *dialConfig) {
+		cfg.rawCommand = enabled
+	}
+}
@@ -0,0 +1,292 @@
+// Package redigo provides functions to trace the gomodule/redigo package (https://github.com/gomodule/redigo).
+package redigo // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/gomodule/redigo"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Conn is an implementation of the redis.Conn interface that supports tracing.
+// Commands sent using Do emit a span each, while those pipelined using Send
+// emit a single span, covering their Flush through the Receive of their last
+// reply. Conns may be returned by the Dial function of a redis.Pool.
+type Conn struct {
+	redis.Conn
+	*params
+
+	mu       sync.Mutex
+	pipeline *pipeline // the commands sent and not received yet, if any
+}
+
+// pipeline holds the state of the commands pipelined on a connection.
+type pipeline struct {
+	ctx     context.Context // the context of the first command, parent of the span
+	names   []string        // the names of the commands
+	raw     bytes.Buffer    // the raw commands, if enabled
+	pending int             // the number of replies not received yet
+	span    ddtrace.Span    // started on Flush
+	err     error           // the first error received
+}
+
+// params contains fields and metadata useful for command tracing
+type params struct {
+	config  *dialConfig
+	network string
+	host    string
+	port    string
+	db      string
+}
+
+// parseOptions parses a set of arbitrary options (which can be of type redis.DialOption
+// or the local DialOption) and returns the corresponding redis.DialOption set as well as
+// a configured dialConfig.
+func parseOptions(options ...interface{}) ([]redis.DialOption, *dialConfig) {
+	dialOpts := []redis.DialOption{}
+	cfg := new(dialConfig)
+	defaults(cfg)
+	for _, opt := range options {
+		switch o := opt.(type) {
+		case redis.DialOption:
+			dialOpts = append(dialOpts, o)
+		case DialOption:
+			o(cfg)
+		}
+	}
+	return dialOpts, cfg
+}
+
+// Dial dials into the network address and returns a traced redis.Conn.
+// The set of supported options must be either of type redis.DialOption or this package's DialOption.
+func Dial(network, address string, options ...interface{}) (redis.Conn, error) {
+	dialOpts, cfg := parseOptions(options...)
+	c, err := redis.Dial(network, address, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c, params: &params{cfg, network, host, port, ""}}, nil
+}
+
+// DialURL connects to a Redis server at the given URL using the Redis
+// URI scheme. URLs should follow the draft IANA specification for the
+// scheme (https://www.iana.org/assignments/uri-schemes/prov/redis).
+// The returned redis.Conn is traced, and its spans are tagged with the
+// database found in the URL, unlike those of the connections of Dial.
+func DialURL(rawurl string, options ...interface{}) (redis.Conn, error) {
+	dialOpts, cfg := parseOptions(options...)
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = u.Host
+		port = "6379"
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	db := strings.TrimPrefix(u.Path, "/")
+	if db == "" {
+		db = "0"
+	}
+	c, err := redis.DialURL(rawurl, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c, params: &params{cfg, "tcp", host, port, db}}, nil
+}
+
+// DoWithContext sends a command using c, as c.Do does. When c is a traced Conn, the span of
+// the command inherits from ctx. Other connections, such as those returned by a redis.Pool,
+// are sent the command with its arguments unchanged; to have the span of a command sent using
+// a pool of traced connections inherit from a context, pass it as the final argument of Do.
+func DoWithContext(c redis.Conn, ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	if tc, ok := c.(*Conn); ok {
+		return tc.do(ctx, commandName, args)
+	}
+	return c.Do(commandName, args...)
+}
+
+// newChildSpan creates a span inheriting from the given context. It adds to the span useful metadata about the traced Redis connection
+func (tc *Conn) newChildSpan(ctx context.Context) ddtrace.Span {
+	p := tc.params
+	span, _ := tracer.StartSpanFromContext(ctx, "redis.command",
+		tracer.SpanType(ext.SpanTypeRedis),
+		tracer.ServiceName(p.config.serviceName),
+	)
+	span.SetTag("out.network", p.network)
+	span.SetTag(ext.TargetPort, p.port)
+	span.SetTag(ext.TargetHost, p.host)
+	if p.db != "" {
+		span.SetTag("out.db", p.db)
+	}
+	return span
+}
+
+// contextArg removes the context passed as the final argument of a command from args, if any.
+func contextArg(args []interface{}) (context.Context, []interface{}) {
+	if n := len(args); n > 0 {
+		if ctx, ok := args[n-1].(context.Context); ok {
+			return ctx, args[:n-1]
+		}
+	}
+	return context.Background(), args
+}
+
+// Do wraps redis.Conn.Do. It sends a command to the Redis server and returns the received reply.
+// In the process it emits a span containing key information about the command sent.
+// When passed a context.Context as the final argument, Do will ensure that any span created
+// inherits from this context. The rest of the arguments are passed through to the Redis server unchanged.
+// As Do also receives the replies of the commands pipelined before it, it finishes their span.
+func (tc *Conn) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	ctx, args := contextArg(args)
+	return tc.do(ctx, commandName, args)
+}
+
+// do sends a command as Do does, its span inheriting from ctx.
+func (tc *Conn) do(ctx context.Context, commandName string, args []interface{}) (reply interface{}, err error) {
+	span := tc.newChildSpan(ctx)
+	defer func() {
+		span.Finish(tracer.WithError(err))
+		tc.finishPipeline(err)
+	}()
+
+	span.SetTag("redis.args_length", strconv.Itoa(len(args)))
+	if len(commandName) > 0 {
+		span.SetTag(ext.ResourceName, commandName)
+	} else {
+		// When the command argument to the Do method is "", then the Do method will flush the output buffer
+		// See https://godoc.org/github.com/gomodule/redigo/redis#hdr-Pipelining
+		span.SetTag(ext.ResourceName, "redigo.Conn.Flush")
+	}
+	if tc.config.rawCommand {
+		var b bytes.Buffer
+		writeCommand(&b, commandName, args)
+		span.SetTag("redis.raw_command", b.String())
+	}
+	tc.flushPipeline()
+	return tc.Conn.Do(commandName, args...)
+}
+
+// Send wraps redis.Conn.Send, pipelining the command. When passed a context.Context as
+// the final argument of the first command of a pipeline, its span will inherit from it.
+func (tc *Conn) Send(commandName string, args ...interface{}) error {
+	ctx, args := contextArg(args)
+	tc.mu.Lock()
+	p := tc.pipeline
+	if p == nil {
+		p = &pipeline{ctx: ctx}
+		tc.pipeline = p
+	}
+	p.names = append(p.names, commandName)
+	if tc.config.rawCommand {
+		if p.raw.Len() > 0 {
+			p.raw.WriteString("\n")
+		}
+		writeCommand(&p.raw, commandName, args)
+	}
+	p.pending++
+	tc.mu.Unlock()
+	return tc.Conn.Send(commandName, args...)
+}
+
+// Flush wraps redis.Conn.Flush, starting the span of the pipelined commands.
+func (tc *Conn) Flush() error {
+	tc.flushPipeline()
+	err := tc.Conn.Flush()
+	if err != nil {
+		tc.finishPipeline(err)
+	}
+	return err
+}
+
+// Receive wraps redis.Conn.Receive, finishing the span of the pipelined commands once
+// the reply of the last one was received. Replies received outside of pipelines, such as
+// the messages of subscriptions, are not traced.
+func (tc *Conn) Receive() (reply interface{}, err error) {
+	reply, err = tc.Conn.Receive()
+	tc.mu.Lock()
+	p := tc.pipeline
+	if p == nil {
+		tc.mu.Unlock()
+		return reply, err
+	}
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	p.pending--
+	done := p.pending <= 0
+	tc.mu.Unlock()
+	if done {
+		tc.finishPipeline(nil)
+	}
+	return reply, err
+}
+
+// flushPipeline starts the span of the pipelined commands, if there are any and it was not started yet.
+func (tc *Conn) flushPipeline() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	p := tc.pipeline
+	if p == nil || p.span != nil {
+		return
+	}
+	p.span = tc.newChildSpan(p.ctx)
+	p.span.SetTag(ext.ResourceName, strings.Join(p.names, " "))
+	p.span.SetTag("redis.pipeline_length", len(p.names))
+	if tc.config.rawCommand {
+		p.span.SetTag("redis.raw_command", p.raw.String())
+	}
+}
+
+// finishPipeline finishes the span of the pipelined commands, if any, with the first error
+// received or err.
+func (tc *Conn) finishPipeline(err error) {
+	tc.mu.Lock()
+	p := tc.pipeline
+	tc.pipeline = nil
+	tc.mu.Unlock()
+	if p == nil || p.span == nil {
+		return
+	}
+	if p.err != nil {
+		err = p.err
+	}
+	p.span.Finish(tracer.WithError(err))
+}
+
+// writeCommand writes the raw command sent to the server to b.
+func writeCommand(b *bytes.Buffer, commandName string, args []interface{}) {
+	b.WriteString(commandName)
+	for _, arg := range args {
+		b.WriteString(" ")
+		switch arg := arg.(type) {
+		case string:
+			b.WriteString(arg)
+		case int:
+			b.WriteString(strconv.Itoa(arg))
+		case int32:
+			b.WriteString(strconv.FormatInt(int64(arg), 10))
+		case int64:
+			b.WriteString(strconv.FormatInt(arg, 10))
+		case fmt.Stringer:
+			b.WriteString(arg.String())
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package redigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// integration reports whether the tests against a Redis server should run.
+var integration bool
+
+func TestMain(m *testing.M) {
+	_, integration = os.LookupEnv("INTEGRATION")
+	if !integration {
+		fmt.Println("--- SKIP: to enable integration test, set the INTEGRATION environment variable")
+	}
+	os.Exit(m.Run())
+}
+
+// fakeConn is a redis.Conn replying to commands with their name, or with the error
+// of its field err, if any.
+type fakeConn struct {
+	err     error
+	pending []string      // the replies of the commands sent, not received yet
+	args    []interface{} // the arguments of the last command sent
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName != "" {
+		c.Send(commandName, args...)
+	}
+	var (
+		reply interface{}
+		err   error
+	)
+	for len(c.pending) > 0 {
+		reply, err = c.Receive()
+	}
+	return reply, err
+}
+
+func (c *fakeConn) Send(commandName string, args ...interface{}) error {
+	c.pending = append(c.pending, commandName)
+	c.args = args
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("no reply")
+	}
+	reply := c.pending[0]
+	c.pending = c.pending[1:]
+	return reply, c.err
+}
+
+func newFakeConn(opts ...DialOption) (*Conn, *fakeConn) {
+	_, cfg := parseOptions(WithServiceName("my-service"))
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	fc := new(fakeConn)
+	return &Conn{Conn: fc, params: &params{cfg, "tcp", "127.0.0.1", "6379", "2"}}, fc
+}
+
+func TestDo(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c, _ := newFakeConn()
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	reply, err := DoWithContext(c, ctx, "SET", "vehicle", "truck")
+	assert.NoError(err)
+	assert.Equal("SET", reply)
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	span := spans[0]
+	assert.Equal("redis.command", span.OperationName())
+	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
+	assert.Equal("my-service", span.Tag(ext.ServiceName))
+	assert.Equal("SET", span.Tag(ext.ResourceName))
+	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
+	assert.Equal("6379", span.Tag(ext.TargetPort))
+	assert.Equal("2", span.Tag("out.db"))
+	assert.Equal("2", span.Tag("redis.args_length"))
+	assert.Nil(span.Tag("redis.raw_command"))
+	assert.Equal(root.Context().SpanID(), span.ParentID())
+}
+
+func TestDoWithContextUntraced(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c := new(fakeConn)
+	reply, err := DoWithContext(c, context.Background(), "SET", "vehicle", "truck")
+	assert.NoError(err)
+	assert.Equal("SET", reply)
+	assert.Equal([]interface{}{"vehicle", "truck"}, c.args)
+	assert.Len(mt.FinishedSpans(), 0)
+}
+
+func TestRawCommand(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c, _ := newFakeConn(WithRawCommand(true))
+	c.Do("SET", 1, "truck")
+	c.Send("GET", 1)
+	c.Send("INCR", "counter")
+	c.Flush()
+	c.Receive()
+	c.Receive()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("SET 1 truck", spans[0].Tag("redis.raw_command"))
+	assert.Equal("GET 1\nINCR counter", spans[1].Tag("redis.raw_command"))
+}
+
+func TestPipeline(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c, _ := newFakeConn()
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	assert.NoError(c.Send("SET", "vehicle", "truck", ctx))
+	assert.NoError(c.Send("GET", "vehicle"))
+	assert.NoError(c.Flush())
+	assert.Empty(mt.FinishedSpans())
+	reply, err := c.Receive()
+	assert.NoError(err)
+	assert.Equal("SET", reply)
+	assert.Empty(mt.FinishedSpans(), "the span should cover the last reply")
+	reply, err = c.Receive()
+	assert.NoError(err)
+	assert.Equal("GET", reply)
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	span := spans[0]
+	assert.Equal("redis.command", span.OperationName())
+	assert.Equal("SET GET", span.Tag(ext.ResourceName))
+	assert.Equal(2, span.Tag("redis.pipeline_length"))
+	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
+	assert.Equal(root.Context().SpanID(), span.ParentID())
+	assert.Nil(span.Tag(ext.Error))
+
+	// replies received outside of pipelines are not traced
+	mt.Reset()
+	c.Receive()
+	assert.Empty(mt.FinishedSpans())
+}
+
+func TestPipelineDo(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	// Do receives the replies of the pipelined commands
+	c, _ := newFakeConn()
+	c.Send("SET", "vehicle", "truck")
+	c.Send("GET", "vehicle")
+	reply, err := c.Do("")
+	assert.NoError(err)
+	assert.Equal("GET", reply)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("redigo.Conn.Flush", spans[0].Tag(ext.ResourceName))
+	assert.Equal("SET GET", spans[1].Tag(ext.ResourceName))
+}
+
+func TestPipelineError(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c, fc := newFakeConn()
+	fc.err = redis.Error("ERR unknown command")
+	c.Send("NOT_A_COMMAND")
+	c.Flush()
+	_, err := c.Receive()
+	assert.Equal(fc.err, err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal(fc.err, spans[0].Tag(ext.Error))
+}
+
+func TestClient(t *testing.T) {
+	if !integration {
+		t.Skip("to enable integration test, set the INTEGRATION environment variable")
+	}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	c, err := Dial("tcp", "127.0.0.1:6379", WithServiceName("my-service"))
+	assert.Nil(err)
+	c.Do("SET", 1, "truck")
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	span := spans[0]
+	assert.Equal("redis.command", span.OperationName())
+	assert.Equal("my-service", span.Tag(ext.ServiceName))
+	assert.Equal("SET", span.Tag(ext.ResourceName))
+	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
+	assert.Equal("6379", span.Tag(ext.TargetPort))
+}
+
+func TestPool(t *testing.T) {
+	if !integration {
+		t.Skip("to enable integration test, set the INTEGRATION environment variable")
+	}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	pool := &redis.Pool{
+		MaxIdle: 2,
+		Dial: func() (redis.Conn, error) {
+			return DialURL("redis://127.0.0.1:6379/1")
+		},
+	}
+	defer pool.Close()
+	c := pool.Get()
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	// the connections of pools are not traced ones, the context is passed to
+	// the traced connection they wrap as the final argument of Do
+	_, err := c.Do("SET", "vehicle", "truck", ctx)
+	assert.NoError(err)
+	c.Send("GET", "vehicle")
+	c.Send("GET", "vehicle")
+	c.Flush()
+	c.Receive()
+	c.Receive()
+	c.Close()
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Tag(ext.ResourceName).(string))
+	}
+	assert.Contains(names, "SET")
+	assert.Contains(names, "GET GET")
+	for _, s := range spans {
+		if s.Tag(ext.ResourceName) == "SET" {
+			assert.Equal(root.Context().SpanID(), s.ParentID())
+			assert.Equal("1", s.Tag("out.db"))
+		}
+	}
+}
@@ -65,6 +65,8 @@ func UnaryClientInterceptor(opts ...InterceptorOption) grpc.UnaryClientIntercept
 			p    peer.Peer
 		)
 		span, ctx = tracer.StartSpanFromContext(ctx, "grpc.client",
+			tracer.ServiceName(cfg.serviceName),
+			tracer.ResourceName(method),
 			tracer.Tag(tagMethod, method),
 			tracer.SpanType(ext.AppTypeRPC),
 		)
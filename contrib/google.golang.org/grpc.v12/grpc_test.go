@@ -57,12 +57,48 @@ func TestClient(t *testing.T) {
 	assert.Equal(clientSpan.Tag(ext.TargetHost), "127.0.0.1")
 	assert.Equal(clientSpan.Tag(ext.TargetPort), rig.port)
 	assert.Equal(clientSpan.Tag(tagCode), codes.OK.String())
+	assert.Equal(clientSpan.Tag(ext.ServiceName), "grpc")
+	assert.Equal(clientSpan.Tag(ext.ResourceName), "/grpc.Fixture/Ping")
 	assert.Equal(clientSpan.TraceID(), rootSpan.TraceID())
 	assert.Equal(serverSpan.Tag(ext.ServiceName), "grpc")
 	assert.Equal(serverSpan.Tag(ext.ResourceName), "/grpc.Fixture/Ping")
 	assert.Equal(serverSpan.TraceID(), rootSpan.TraceID())
 }
 
+func TestClientDefaultServiceName(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(false)
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	conn, err := grpc.Dial(rig.listener.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatalf("error dialing: %s", err)
+	}
+	defer conn.Close()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "a", tracer.ServiceName("b"))
+	_, err = NewFixtureClient(conn).Ping(ctx, &FixtureRequest{Name: "pass"})
+	assert.Nil(err)
+	span.Finish()
+
+	var clientSpan mocktracer.Span
+	for _, s := range mt.FinishedSpans() {
+		if s.OperationName() == "grpc.client" {
+			clientSpan = s
+		}
+	}
+	assert.NotNil(clientSpan)
+	assert.Equal("grpc.client", clientSpan.Tag(ext.ServiceName))
+}
+
 func TestChild(t *testing.T) {
 	assert := assert.New(t)
 	mt := mocktracer.Start()
@@ -2,13 +2,15 @@ package grpc
 
 import (
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	context "golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
-	"gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/internal/grpcutil"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -16,31 +18,99 @@ import (
 
 type clientStream struct {
 	grpc.ClientStream
-	cfg    *interceptorConfig
-	method string
+	cfg     *interceptorConfig
+	method  string
+	service string
+
+	// span is the span covering the whole stream. It is nil when
+	// stream call tracing is disabled.
+	span ddtrace.Span
+	once sync.Once
+
+	// serverStreams reports whether the server may send several messages on
+	// the stream. When it does not, the stream ends once its reply is received.
+	serverStreams bool
+
+	// mu is held by RecvMsg while it receives a message, and finishes the span
+	// if it ended the stream, which makes gRPC cancel the stream context. The
+	// goroutine finishing the span when that context is done holds it too, so
+	// that it doesn't mistake the end of the stream for a cancellation.
+	mu sync.Mutex
+
+	// sent and recv count the messages sent and received on the stream.
+	// gRPC does not allow concurrent calls to SendMsg, nor to RecvMsg, so
+	// they need no synchronization.
+	sent, recv int
+
+	// sentSize and recvSize sum the sizes of the messages sent and received
+	// on the stream, when using WithMessageSizes. They are accessed atomically
+	// because the span may be finished when the stream context is done.
+	sentSize, recvSize int64
+}
+
+// finish finishes the stream span, if any, using the given error to set
+// the gRPC code. Only the first call has any effect.
+func (cs *clientStream) finish(err error) {
+	if cs.span == nil {
+		return
+	}
+	cs.once.Do(func() {
+		if cs.cfg.messageSizes {
+			cs.span.SetTag(tagRequestSize, atomic.LoadInt64(&cs.sentSize))
+			cs.span.SetTag(tagResponseSize, atomic.LoadInt64(&cs.recvSize))
+		}
+		cs.span.SetTag(tagCode, statusCode(err).String())
+		finishWithError(cs.span, streamError(cs.cfg.filterError(err)), cs.cfg)
+	})
 }
 
 func (cs *clientStream) RecvMsg(m interface{}) (err error) {
 	if cs.cfg.traceStreamMessages {
-		span, _ := startSpanFromContext(cs.Context(), cs.method, "grpc.message", cs.cfg.clientServiceName())
+		span, _ := startSpanFromContext(cs.Context(), cs.cfg, cs.method, "grpc.message", cs.service)
 		if p, ok := peer.FromContext(cs.Context()); ok {
 			setSpanTargetFromPeer(span, *p)
 		}
-		defer span.Finish(withStreamError(err))
+		span.SetTag(tagMessageDirection, messageDirectionReceive)
+		span.SetTag(tagMessageIndex, cs.recv)
+		cs.recv++
+		defer func() { finishWithError(span, streamError(err), cs.cfg) }()
 	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	err = cs.ClientStream.RecvMsg(m)
+	if err == nil {
+		if n, ok := messageSize(cs.cfg, m); ok {
+			atomic.AddInt64(&cs.recvSize, int64(n))
+		}
+		if !cs.serverStreams {
+			// the reply of client streams ends them, as in CloseAndRecv
+			cs.finish(nil)
+		}
+	} else {
+		// io.EOF or any other error returned by RecvMsg marks the end of
+		// the stream.
+		cs.finish(err)
+	}
 	return err
 }
 
 func (cs *clientStream) SendMsg(m interface{}) (err error) {
 	if cs.cfg.traceStreamMessages {
-		span, _ := startSpanFromContext(cs.Context(), cs.method, "grpc.message", cs.cfg.clientServiceName())
+		span, _ := startSpanFromContext(cs.Context(), cs.cfg, cs.method, "grpc.message", cs.service)
 		if p, ok := peer.FromContext(cs.Context()); ok {
 			setSpanTargetFromPeer(span, *p)
 		}
-		defer span.Finish(withStreamError(err))
+		span.SetTag(tagMessageDirection, messageDirectionSend)
+		span.SetTag(tagMessageIndex, cs.sent)
+		cs.sent++
+		defer func() { finishWithError(span, streamError(err), cs.cfg) }()
 	}
 	err = cs.ClientStream.SendMsg(m)
+	if err == nil {
+		if n, ok := messageSize(cs.cfg, m); ok {
+			atomic.AddInt64(&cs.sentSize, int64(n))
+		}
+	}
 	return err
 }
 
@@ -53,16 +123,23 @@ func StreamClientInterceptor(opts ...InterceptorOption) grpc.StreamClientInterce
 		fn(cfg)
 	}
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		var stream grpc.ClientStream
+		if cfg.ignored(method) {
+			return streamer(injectSpanIntoContext(ctx, cfg), desc, cc, method, opts...)
+		}
+		var (
+			stream grpc.ClientStream
+			span   ddtrace.Span
+		)
 		if cfg.traceStreamCalls {
-			span, err := doClientRequest(ctx, cfg, method, opts,
+			var err error
+			span, err = doClientRequest(ctx, cfg, cc, method, opts,
 				func(ctx context.Context, opts []grpc.CallOption) error {
 					var err error
 					stream, err = streamer(ctx, desc, cc, method, opts...)
 					return err
 				})
 			if err != nil {
-				span.Finish(withStreamError(err))
+				finishWithError(span, streamError(cfg.filterError(err)), cfg)
 				return nil, err
 			}
 
@@ -71,18 +148,13 @@ func StreamClientInterceptor(opts ...InterceptorOption) grpc.StreamClientInterce
 			if p, ok := peer.FromContext(stream.Context()); ok {
 				setSpanTargetFromPeer(span, *p)
 			}
-
-			go func() {
-				<-stream.Context().Done()
-				span.Finish(withStreamError(stream.Context().Err()))
-			}()
 		} else {
 			// if call tracing is disabled, just call streamer, but still return
 			// a clientStream so that messages can be traced if enabled
 
 			// it's possible there's already a span on the context even though
 			// we're not tracing calls, so inject it if it's there
-			ctx = injectSpanIntoContext(ctx)
+			ctx = injectSpanIntoContext(ctx, cfg)
 
 			var err error
 			stream, err = streamer(ctx, desc, cc, method, opts...)
@@ -90,11 +162,28 @@ func StreamClientInterceptor(opts ...InterceptorOption) grpc.StreamClientInterce
 				return nil, err
 			}
 		}
-		return &clientStream{
+		cs := &clientStream{
 			ClientStream: stream,
 			cfg:          cfg,
 			method:       method,
-		}, nil
+			service:      cfg.clientServiceName(cc, method),
+			span:         span,
+
+			serverStreams: desc.ServerStreams,
+		}
+		if span != nil {
+			// streamer returns as soon as the stream is established, so the
+			// span is finished by the returned stream once RecvMsg reports
+			// the end of the stream, or when its context is done before that,
+			// as when the stream is abandoned.
+			go func() {
+				<-stream.Context().Done()
+				cs.mu.Lock()
+				defer cs.mu.Unlock()
+				cs.finish(stream.Context().Err())
+			}()
+		}
+		return cs, nil
 	}
 }
 
@@ -107,11 +196,18 @@ func UnaryClientInterceptor(opts ...InterceptorOption) grpc.UnaryClientIntercept
 		fn(cfg)
 	}
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		span, err := doClientRequest(ctx, cfg, method, opts,
+		if cfg.ignored(method) {
+			return invoker(injectSpanIntoContext(ctx, cfg), method, req, reply, cc, opts...)
+		}
+		span, err := doClientRequest(ctx, cfg, cc, method, opts,
 			func(ctx context.Context, opts []grpc.CallOption) error {
 				return invoker(ctx, method, req, reply, cc, opts...)
 			})
-		span.Finish(tracer.WithError(err))
+		setMessageSize(span, cfg, tagRequestSize, req)
+		if err == nil {
+			setMessageSize(span, cfg, tagResponseSize, reply)
+		}
+		finishWithError(span, cfg.filterError(err), cfg)
 		return err
 	}
 }
@@ -119,12 +215,16 @@ func UnaryClientInterceptor(opts ...InterceptorOption) grpc.UnaryClientIntercept
 // doClientRequest starts a new span and invokes the handler with the new context
 // and options. The span should be finished by the caller.
 func doClientRequest(
-	ctx context.Context, cfg *interceptorConfig, method string, opts []grpc.CallOption,
+	ctx context.Context, cfg *interceptorConfig, cc *grpc.ClientConn, method string, opts []grpc.CallOption,
 	handler func(ctx context.Context, opts []grpc.CallOption) error,
 ) (ddtrace.Span, error) {
 	// inject the trace id into the metadata
-	span, ctx := startSpanFromContext(ctx, method, "grpc.client", cfg.clientServiceName())
-	ctx = injectSpanIntoContext(ctx)
+	span, ctx := startSpanFromContext(ctx, cfg, method, cfg.spanName("grpc.client", method), cfg.clientServiceName(cc, method))
+	if cc != nil {
+		setSpanTargetFromConn(span, cc.Target())
+	}
+	modifySpan(ctx, span, cfg, method)
+	ctx = injectSpanIntoContext(ctx, cfg)
 
 	// fill in the peer so we can add it to the tags
 	var p peer.Peer
@@ -140,6 +240,39 @@ func doClientRequest(
 	return span, err
 }
 
+// setSpanTargetFromConn sets the target tags in a span based on the target a
+// gRPC client connection was dialed with, e.g. "dns:///host:port". These are
+// known even when the call fails before reaching any peer. The host and port
+// are later replaced by the ones of the peer, if any.
+func setSpanTargetFromConn(span ddtrace.Span, target string) {
+	authority, endpoint := parseTarget(target)
+	span.SetTag(ext.GRPCTarget, endpoint)
+	if authority != "" {
+		span.SetTag(ext.GRPCAuthority, authority)
+	}
+	if host, port, err := net.SplitHostPort(endpoint); err == nil {
+		if host != "" {
+			span.SetTag(ext.TargetHost, host)
+		}
+		span.SetTag(ext.TargetPort, port)
+	}
+}
+
+// parseTarget splits a gRPC dial target of the form "scheme://authority/endpoint"
+// into its authority and endpoint. Targets without a scheme are endpoints.
+func parseTarget(target string) (authority, endpoint string) {
+	i := strings.Index(target, "://")
+	if i < 0 {
+		return "", target
+	}
+	rest := target[i+len("://"):]
+	j := strings.Index(rest, "/")
+	if j < 0 {
+		return "", target
+	}
+	return rest[:j], rest[j+1:]
+}
+
 // setSpanTargetFromPeer sets the target tags in a span based on the gRPC peer.
 func setSpanTargetFromPeer(span ddtrace.Span, p peer.Peer) {
 	// if the peer was set, set the tags
@@ -156,7 +289,7 @@ func setSpanTargetFromPeer(span ddtrace.Span, p peer.Peer) {
 
 // injectSpanIntoContext injects the span associated with a context as gRPC metadata
 // if no span is associated with the context, just return the original context.
-func injectSpanIntoContext(ctx context.Context) context.Context {
+func injectSpanIntoContext(ctx context.Context, cfg *interceptorConfig) context.Context {
 	span, ok := tracer.SpanFromContext(ctx)
 	if !ok {
 		return ctx
@@ -168,7 +301,7 @@ func injectSpanIntoContext(ctx context.Context) context.Context {
 	} else {
 		md = metadata.MD{}
 	}
-	if err := tracer.Inject(span.Context(), grpcutil.MDCarrier(md)); err != nil {
+	if err := injectSpanContext(span.Context(), md, cfg); err != nil {
 		// in practice this error should never really happen
 		grpclog.Warningf("ddtrace: failed to inject the span context into the gRPC metadata: %v", err)
 	}
@@ -1,10 +1,13 @@
 package grpc_test
 
 import (
+	"fmt"
 	"log"
 	"net"
 
 	grpctrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/grpc"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 
 	"google.golang.org/grpc"
 )
@@ -46,3 +49,60 @@ func Example_server() {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
+
+func Example_statsHandler() {
+	// Alternatively, create stats handlers using the grpc trace package.
+	ln, err := net.Listen("tcp", ":50051")
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.StatsHandler(grpctrace.NewServerStatsHandler(grpctrace.WithServiceName("my-grpc-server"))))
+
+	// ... register your services
+
+	go s.Serve(ln)
+
+	// Dial in using the client stats handler.
+	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure(),
+		grpc.WithStatsHandler(grpctrace.NewClientStatsHandler(grpctrace.WithServiceName("my-grpc-client"))))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	// And continue using the connection as normal.
+}
+
+func Example_mocktracer() {
+	// In tests, start the mock tracer to record the spans created by the
+	// interceptors instead of sending them to an agent.
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(grpctrace.UnaryServerInterceptor(grpctrace.WithServiceName("my-grpc-server"))))
+
+	// ... register the service under test
+
+	go s.Serve(ln)
+	defer s.Stop()
+
+	// ... call the service, e.g. using a client connection dialed in with
+	// grpctrace.UnaryClientInterceptor
+
+	// Then check the spans which were finished.
+	for _, span := range mocktracer.SpansNamed(mt.FinishedSpans(), "grpc.server") {
+		if err := mocktracer.CheckTags(span, map[string]interface{}{
+			ext.ServiceName:  "my-grpc-server",
+			ext.ResourceName: "/my.Service/Ping",
+		}); err != nil {
+			fmt.Println(err)
+		}
+		if err := mocktracer.SpanError(span); err != nil {
+			fmt.Println("unexpected error:", err)
+		}
+	}
+}
@@ -4,38 +4,221 @@
 package grpc // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/grpc"
 
 import (
+	"fmt"
 	"io"
+	"net"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/internal/grpcutil"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	context "golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
-func startSpanFromContext(ctx context.Context, method, operation, service string) (ddtrace.Span, context.Context) {
+func startSpanFromContext(ctx context.Context, cfg *interceptorConfig, method, operation, service string) (ddtrace.Span, context.Context) {
 	opts := []ddtrace.StartSpanOption{
 		tracer.ServiceName(service),
-		tracer.ResourceName(method),
+		tracer.ResourceName(cfg.resourceName(method)),
 		tracer.Tag(tagMethod, method),
 		tracer.SpanType(ext.AppTypeRPC),
 	}
 	md, _ := metadata.FromIncomingContext(ctx) // nil is ok
-	if sctx, err := tracer.Extract(grpcutil.MDCarrier(md)); err == nil {
+	if sctx, err := extractSpanContext(md, cfg); err == nil {
 		opts = append(opts, tracer.ChildOf(sctx))
 	}
 	return tracer.StartSpanFromContext(ctx, operation, opts...)
 }
 
-// withStreamError returns a tracer.WithError finish option, disregarding OK, EOF and Canceled errors.
-func withStreamError(err error) tracer.FinishOption {
+// setMetadataTags sets the incoming metadata values selected by the
+// WithMetadataTags option as tags on the span.
+func setMetadataTags(ctx context.Context, span ddtrace.Span, cfg *interceptorConfig) {
+	if len(cfg.metadataTags) == 0 {
+		return
+	}
+	md, _ := metadata.FromIncomingContext(ctx) // nil is ok
+	for _, k := range cfg.metadataTags {
+		if vs := md[k]; len(vs) > 0 {
+			span.SetTag(tagMetadataPrefix+k, strings.Join(vs, ","))
+		}
+	}
+}
+
+// setPeerTags sets the address of the peer and the time remaining before the
+// deadline of ctx as tags on the span, if enabled using WithPeerTags.
+func setPeerTags(ctx context.Context, span ddtrace.Span, cfg *interceptorConfig) {
+	if !cfg.peerTags {
+		return
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, port, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			// not a host:port address, e.g. a unix socket
+			host = p.Addr.String()
+		}
+		span.SetTag(tagPeerAddress, host)
+		if port != "" {
+			span.SetTag(tagPeerPort, port)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		span.SetTag(tagDeadline, time.Until(deadline).Nanoseconds()/int64(time.Millisecond))
+	}
+}
+
+// modifySpan calls the function set using WithSpanModifier, if any. A panic
+// in it is logged and does not prevent the call from proceeding.
+func modifySpan(ctx context.Context, span ddtrace.Span, cfg *interceptorConfig, method string) {
+	if cfg.spanModifier == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			grpclog.Warningf("ddtrace: recovered from panic in span modifier: %v", r)
+		}
+	}()
+	cfg.spanModifier(ctx, span, method)
+}
+
+// messageSize returns the encoded size of m if message sizes are recorded and
+// m is a protocol buffer message.
+func messageSize(cfg *interceptorConfig, m interface{}) (int, bool) {
+	if !cfg.messageSizes {
+		return 0, false
+	}
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return 0, false
+	}
+	return proto.Size(pm), true
+}
+
+// setMessageSize sets the encoded size of m as the given tag on span, if it
+// should be recorded.
+func setMessageSize(span ddtrace.Span, cfg *interceptorConfig, tag string, m interface{}) {
+	if n, ok := messageSize(cfg, m); ok {
+		span.SetTag(tag, n)
+	}
+}
+
+// statusCode returns the gRPC code of err, treating io.EOF as codes.OK since it
+// signals the normal end of a stream.
+func statusCode(err error) codes.Code {
+	if err == io.EOF {
+		return codes.OK
+	}
+	if st, ok := errorStatus(err); ok {
+		return st.Code()
+	}
+	return status.Code(err)
+}
+
+// errorStatus returns the gRPC status carried by err. Context errors are
+// converted to their matching status.
+func errorStatus(err error) (*status.Status, bool) {
+	if st, ok := status.FromError(err); ok {
+		return st, true
+	}
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return status.FromContextError(err), true
+	}
+	return nil, false
+}
+
+// streamError returns err, disregarding OK, EOF and Canceled errors.
+func streamError(err error) error {
 	errcode := status.Code(err)
 	if err == io.EOF || errcode == codes.Canceled || errcode == codes.OK || err == context.Canceled {
-		err = nil
+		return nil
+	}
+	return err
+}
+
+// maxErrorDetailsSize is the maximum size in bytes of the error details tag.
+const maxErrorDetailsSize = 1024
+
+// finishWithError finishes span using the given options, marking it with err
+// if it is not nil. When err carries a gRPC status, the error type and message
+// are set to its code and message, and its details are recorded as JSON when
+// using WithErrorDetails.
+func finishWithError(span ddtrace.Span, err error, cfg *interceptorConfig, opts ...ddtrace.FinishOption) {
+	if err == nil {
+		span.Finish(opts...)
+		return
+	}
+	if cfg.noDebugStack {
+		// setting the error itself would also record the stack
+		span.SetTag(ext.Error, true)
+		span.SetTag(ext.ErrorMsg, err.Error())
+		span.SetTag(ext.ErrorType, reflect.TypeOf(err).String())
+	} else {
+		span.SetTag(ext.Error, err)
+	}
+	if st, ok := errorStatus(err); ok {
+		span.SetTag(ext.ErrorType, st.Code().String())
+		span.SetTag(ext.ErrorMsg, st.Message())
+		if cfg.errorDetails {
+			if details := errorDetails(st); details != "" {
+				span.SetTag(tagErrorDetails, details)
+			}
+		}
+	}
+	span.Finish(opts...)
+}
+
+// finishWithPanic finishes span, marking it with the value r recovered from a
+// panic in a handler, along with the stack unless using WithNoDebugStack.
+func finishWithPanic(span ddtrace.Span, r interface{}, cfg *interceptorConfig) {
+	span.SetTag(ext.Error, true)
+	span.SetTag(ext.ErrorMsg, fmt.Sprint(r))
+	span.SetTag(ext.ErrorType, "panic")
+	if !cfg.noDebugStack {
+		span.SetTag(ext.ErrorStack, string(debug.Stack()))
+	}
+	span.Finish()
+}
+
+// errorDetails returns the details of st as a JSON array, truncated to at most
+// maxErrorDetailsSize bytes on a rune boundary. Details which can not be decoded
+// are skipped.
+func errorDetails(st *status.Status) string {
+	var (
+		m     jsonpb.Marshaler
+		parts []string
+	)
+	for _, d := range st.Details() {
+		pm, ok := d.(proto.Message)
+		if !ok {
+			continue
+		}
+		s, err := m.MarshalToString(pm)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	details := "[" + strings.Join(parts, ",") + "]"
+	if len(details) > maxErrorDetailsSize {
+		n := maxErrorDetailsSize
+		for n > 0 && !utf8.RuneStart(details[n]) {
+			// don't split multi-byte characters, which would be invalid UTF-8
+			n--
+		}
+		details = details[:n]
 	}
-	return tracer.WithError(err)
+	return details
 }
@@ -2,20 +2,28 @@ package grpc
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	context "golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestClient(t *testing.T) {
@@ -60,6 +68,7 @@ func TestClient(t *testing.T) {
 
 	assert.Equal(clientSpan.Tag(ext.TargetHost), "127.0.0.1")
 	assert.Equal(clientSpan.Tag(ext.TargetPort), rig.port)
+	assert.Equal(clientSpan.Tag(ext.GRPCTarget), rig.listener.Addr().String())
 	assert.Equal(clientSpan.Tag(tagCode), codes.OK.String())
 	assert.Equal(clientSpan.TraceID(), rootSpan.TraceID())
 	assert.Equal(serverSpan.Tag(ext.ServiceName), "grpc")
@@ -125,6 +134,38 @@ func TestStreaming(t *testing.T) {
 				assert.Equal(t, "/grpc.Fixture/StreamPing", span.Tag(tagMethod),
 					"expected grpc method name to be set in span: %v", span)
 			}
+
+		}
+
+		// messages are indexed in the order they are sent or received, on
+		// each side of the stream
+		type stream struct {
+			client    bool
+			direction interface{}
+		}
+		messages := make(map[stream][]mocktracer.Span)
+		for _, span := range spans {
+			if span.OperationName() == "grpc.message" {
+				// only client spans are tagged with the target
+				k := stream{span.Tag(ext.TargetHost) != nil, span.Tag(tagMessageDirection)}
+				messages[k] = append(messages[k], span)
+			}
+		}
+		for k, msgs := range messages {
+			sort.Slice(msgs, func(i, j int) bool { return msgs[i].StartTime().Before(msgs[j].StartTime()) })
+			switch k.direction {
+			case messageDirectionSend:
+				assert.Len(t, msgs, 2)
+			case messageDirectionReceive:
+				// 2 receives and the final one returning io.EOF
+				assert.Len(t, msgs, 3)
+			default:
+				t.Errorf("unexpected message direction %v", k.direction)
+			}
+			for i, span := range msgs {
+				assert.Equal(t, i, span.Tag(tagMessageIndex),
+					"expected message index to be set in span: %v", span)
+			}
 		}
 	}
 
@@ -132,7 +173,7 @@ func TestStreaming(t *testing.T) {
 		mt := mocktracer.Start()
 		defer mt.Stop()
 
-		rig, err := newRig(true)
+		rig, err := newRig(true, WithStreamMessages(true))
 		if err != nil {
 			t.Fatalf("error setting up rig: %s", err)
 		}
@@ -159,7 +200,7 @@ func TestStreaming(t *testing.T) {
 		mt := mocktracer.Start()
 		defer mt.Stop()
 
-		rig, err := newRig(true, WithStreamMessages(false))
+		rig, err := newRig(true)
 		if err != nil {
 			t.Fatalf("error setting up rig: %s", err)
 		}
@@ -186,7 +227,7 @@ func TestStreaming(t *testing.T) {
 		mt := mocktracer.Start()
 		defer mt.Stop()
 
-		rig, err := newRig(true, WithStreamCalls(false))
+		rig, err := newRig(true, WithStreamCalls(false), WithStreamMessages(true))
 		if err != nil {
 			t.Fatalf("error setting up rig: %s", err)
 		}
@@ -210,6 +251,123 @@ func TestStreaming(t *testing.T) {
 	})
 }
 
+func TestStreamingError(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true, WithStreamMessages(false))
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "a",
+		tracer.ServiceName("b"),
+		tracer.ResourceName("c"))
+
+	stream, err := rig.client.StreamPing(ctx)
+	assert.NoError(err)
+	assert.NoError(stream.Send(&FixtureRequest{Name: "pass"}))
+	_, err = stream.Recv()
+	assert.NoError(err)
+
+	// the handler returns an error on the second message
+	assert.NoError(stream.Send(&FixtureRequest{Name: "invalid"}))
+	_, err = stream.Recv()
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	span.Finish()
+
+	waitForSpans(mt, 3, 5*time.Second)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+
+	var serverSpan, clientSpan, rootSpan mocktracer.Span
+	for _, s := range spans {
+		switch s.OperationName() {
+		case "grpc.server":
+			serverSpan = s
+		case "grpc.client":
+			clientSpan = s
+		case "a":
+			rootSpan = s
+		}
+	}
+	assert.NotNil(rootSpan)
+	assert.NotNil(serverSpan)
+	assert.NotNil(clientSpan)
+	assert.Equal(rootSpan.TraceID(), serverSpan.TraceID())
+	assert.Equal("/grpc.Fixture/StreamPing", serverSpan.Tag(ext.ResourceName))
+	err, _ = serverSpan.Tag(ext.Error).(error)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	assert.Equal(rootSpan.TraceID(), clientSpan.TraceID())
+	assert.Equal(codes.InvalidArgument.String(), clientSpan.Tag(tagCode))
+	err, _ = clientSpan.Tag(ext.Error).(error)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestStreamingCancelAfterEnd(t *testing.T) {
+	// clientSpan runs the stream and returns the finished client span once
+	// the caller cancelled the context of the stream, which ended without error.
+	clientSpan := func(t *testing.T, run func(ctx context.Context, rig *rig)) mocktracer.Span {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		rig, err := newRig(true, WithStreamMessages(false))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		run(ctx, rig)
+		cancel()
+
+		waitForSpans(mt, 2, 5*time.Second)
+		for _, s := range mt.FinishedSpans() {
+			if s.OperationName() == "grpc.client" {
+				return s
+			}
+		}
+		t.Fatal("no client span")
+		return nil
+	}
+
+	t.Run("bidi", func(t *testing.T) {
+		span := clientSpan(t, func(ctx context.Context, rig *rig) {
+			stream, err := rig.client.StreamPing(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, stream.Send(&FixtureRequest{Name: "pass"}))
+			_, err = stream.Recv()
+			assert.NoError(t, err)
+			assert.NoError(t, stream.CloseSend())
+			_, err = stream.Recv()
+			assert.Equal(t, io.EOF, err)
+		})
+		assert.Equal(t, codes.OK.String(), span.Tag(tagCode))
+		assert.Nil(t, span.Tag(ext.Error))
+	})
+
+	t.Run("client-stream", func(t *testing.T) {
+		span := clientSpan(t, func(ctx context.Context, rig *rig) {
+			// the server replies once to a single message, as a client
+			// streaming call would, and ends the call
+			desc := &grpc.StreamDesc{StreamName: "StreamPing", ClientStreams: true}
+			stream, err := rig.conn.NewStream(ctx, desc, "/grpc.Fixture/StreamPing")
+			assert.NoError(t, err)
+			assert.NoError(t, stream.SendMsg(&FixtureRequest{Name: "pass"}))
+			assert.NoError(t, stream.CloseSend())
+			var reply FixtureReply
+			assert.NoError(t, stream.RecvMsg(&reply))
+			assert.Equal(t, "passed", reply.Message)
+		})
+		assert.Equal(t, codes.OK.String(), span.Tag(tagCode))
+		assert.Nil(t, span.Tag(ext.Error))
+	})
+}
+
 func TestChild(t *testing.T) {
 	assert := assert.New(t)
 	mt := mocktracer.Start()
@@ -280,6 +438,7 @@ func TestPass(t *testing.T) {
 	assert.Equal(s.Tag(ext.ServiceName), "grpc")
 	assert.Equal(s.Tag(ext.ResourceName), "/grpc.Fixture/Ping")
 	assert.Equal(s.Tag(ext.SpanType), ext.AppTypeRPC)
+	assert.Equal(s.Tag(tagCode), codes.OK.String())
 	assert.True(s.FinishTime().Sub(s.StartTime()) > 0)
 }
 
@@ -304,6 +463,753 @@ func TestPreservesMetadata(t *testing.T) {
 		"existing metadata should be preserved")
 }
 
+func TestPreservesOutgoingMetadata(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true)
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	// simulate a server making a downstream call: the incoming metadata must
+	// not leak into the outgoing call, while the one set by the application
+	// must be kept alongside the trace context.
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("incoming-key", "x"))
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer token"))
+	span, ctx := tracer.StartSpanFromContext(ctx, "x")
+	_, err = rig.client.Ping(ctx, &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+	span.Finish()
+
+	md := rig.fixtureServer.lastRequestMetadata.Load().(metadata.MD)
+	assert.Equal([]string{"Bearer token"}, md.Get("authorization"))
+	assert.Empty(md.Get("incoming-key"))
+	assert.Equal([]string{strconv.FormatUint(span.Context().TraceID(), 10)}, md.Get(tracer.DefaultTraceIDHeader))
+	assert.Len(md.Get(tracer.DefaultParentIDHeader), 1)
+}
+
+func TestSamplingPriority(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true)
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "a",
+		tracer.Tag(ext.SamplingPriority, ext.PriorityUserReject))
+	_, err = rig.client.Ping(ctx, &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+	span.Finish()
+
+	md := rig.fixtureServer.lastRequestMetadata.Load().(metadata.MD)
+	assert.Equal([]string{"-1"}, md.Get(tracer.DefaultPriorityHeader))
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+	for _, s := range spans {
+		if s.OperationName() == "grpc.server" {
+			assert.Equal(ext.PriorityUserReject, s.Tag(ext.SamplingPriority))
+			return
+		}
+	}
+	t.Fatal("no server span")
+}
+
+func TestIgnoredMethods(t *testing.T) {
+	t.Run("unary", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true, WithIgnoredMethods("/grpc.Fixture/Ping"))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "a")
+		_, err = rig.client.Ping(ctx, &FixtureRequest{Name: "pass"})
+		assert.NoError(err)
+		span.Finish()
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal("a", spans[0].OperationName())
+
+		// the trace context is still passed through
+		md := rig.fixtureServer.lastRequestMetadata.Load().(metadata.MD)
+		assert.Equal([]string{fmt.Sprint(span.Context().TraceID())}, md.Get(tracer.DefaultTraceIDHeader))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true, WithIgnoredMethods("/grpc.Fixture/StreamPing"))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		stream, err := rig.client.StreamPing(context.Background())
+		assert.NoError(err)
+		assert.NoError(stream.Send(&FixtureRequest{Name: "pass"}))
+		_, err = stream.Recv()
+		assert.NoError(err)
+		assert.NoError(stream.CloseSend())
+		_, err = stream.Recv()
+		assert.Equal(io.EOF, err)
+
+		// the unary method is still traced
+		_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+		assert.NoError(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Equal("/grpc.Fixture/Ping", s.Tag(ext.ResourceName))
+		}
+	})
+}
+
+func TestMetadataTags(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	interceptor := UnaryServerInterceptor(WithMetadataTags("X-Namespace", "x-request-id", "x-missing"))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-namespace", "accelbyte",
+		"x-request-id", "1",
+		"x-request-id", "2",
+		"authorization", "secret",
+	))
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.Fixture/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	assert.NoError(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	tags := spans[0].Tags()
+	assert.Equal("accelbyte", tags["grpc.metadata.x-namespace"])
+	assert.Equal("1,2", tags["grpc.metadata.x-request-id"])
+	assert.NotContains(tags, "grpc.metadata.x-missing")
+	assert.NotContains(tags, "grpc.metadata.authorization")
+}
+
+func TestServerCode(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts  []InterceptorOption
+		err   error
+		code  codes.Code
+		isErr bool
+	}{
+		"ok": {
+			code: codes.OK,
+		},
+		"default": {
+			err:   status.Error(codes.NotFound, "not found"),
+			code:  codes.NotFound,
+			isErr: true,
+		},
+		"plain-error": {
+			err:   fmt.Errorf("plain"),
+			code:  codes.Unknown,
+			isErr: true,
+		},
+		"non-error": {
+			opts: []InterceptorOption{WithNonErrorCodes(codes.NotFound, codes.Canceled)},
+			err:  status.Error(codes.NotFound, "not found"),
+			code: codes.NotFound,
+		},
+		"canceled": {
+			opts: []InterceptorOption{WithNonErrorCodes(codes.NotFound, codes.Canceled)},
+			err:  status.FromContextError(context.Canceled).Err(),
+			code: codes.Canceled,
+		},
+		"raw-canceled": {
+			opts: []InterceptorOption{WithNonErrorCodes(codes.NotFound, codes.Canceled)},
+			err:  context.Canceled,
+			code: codes.Canceled,
+		},
+		"raw-deadline-exceeded": {
+			opts: []InterceptorOption{WithNonErrorCodes(codes.DeadlineExceeded)},
+			err:  context.DeadlineExceeded,
+			code: codes.DeadlineExceeded,
+		},
+		"other": {
+			opts:  []InterceptorOption{WithNonErrorCodes(codes.NotFound)},
+			err:   status.Error(codes.Internal, "internal"),
+			code:  codes.Internal,
+			isErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			interceptor := UnaryServerInterceptor(tt.opts...)
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.Fixture/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) { return nil, tt.err })
+			assert.Equal(tt.err, err)
+
+			spans := mt.FinishedSpans()
+			assert.Len(spans, 1)
+			assert.Equal(tt.code.String(), spans[0].Tag(tagCode))
+			if tt.isErr {
+				assert.Equal(tt.err, spans[0].Tag(ext.Error))
+			} else {
+				assert.Nil(spans[0].Tag(ext.Error))
+			}
+		})
+	}
+}
+
+func TestClientNonErrorCodes(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true, WithNonErrorCodes(codes.InvalidArgument))
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "invalid"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	stream, err := rig.client.StreamPing(context.Background())
+	assert.NoError(err)
+	assert.NoError(stream.Send(&FixtureRequest{Name: "invalid"}))
+	_, err = stream.Recv()
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	waitForSpans(mt, 4, 5*time.Second)
+	spans := mt.FinishedSpans()
+	var calls int
+	for _, s := range spans {
+		if s.OperationName() == "grpc.message" {
+			continue
+		}
+		calls++
+		assert.Equal(codes.InvalidArgument.String(), s.Tag(tagCode), s.OperationName())
+		assert.Nil(s.Tag(ext.Error), s.OperationName())
+	}
+	assert.Equal(4, calls)
+}
+
+func TestServiceNameFunc(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true, WithServiceNameFunc(func(cc *grpc.ClientConn, method string) string {
+		if strings.HasSuffix(method, "/StreamPing") {
+			return "" // fall back to the default
+		}
+		return "client-" + cc.Target()
+	}))
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	for _, s := range spans {
+		switch s.OperationName() {
+		case "grpc.client":
+			assert.Equal("client-"+rig.listener.Addr().String(), s.Tag(ext.ServiceName))
+		case "grpc.server":
+			assert.Equal("grpc", s.Tag(ext.ServiceName))
+		}
+	}
+
+	mt.Reset()
+	stream, err := rig.client.StreamPing(context.Background())
+	assert.NoError(err)
+	assert.NoError(stream.Send(&FixtureRequest{Name: "pass"}))
+	stream.CloseSend()
+	_, err = stream.Recv()
+	assert.NoError(err)
+	_, err = stream.Recv()
+	assert.Equal(io.EOF, err)
+
+	waitForSpans(mt, 7, 5*time.Second)
+	for _, s := range mt.FinishedSpans() {
+		assert.Equal("grpc", s.Tag(ext.ServiceName), s.OperationName())
+	}
+}
+
+func TestErrorTags(t *testing.T) {
+	withDetails := func(msg string) error {
+		st, err := status.New(codes.NotFound, "not found").WithDetails(&FixtureReply{Message: msg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st.Err()
+	}
+	for name, tt := range map[string]struct {
+		opts    []InterceptorOption
+		err     error
+		code    codes.Code
+		errType interface{}
+		errMsg  interface{}
+		details interface{}
+	}{
+		"status": {
+			err:     status.Error(codes.NotFound, "not found"),
+			code:    codes.NotFound,
+			errType: "NotFound",
+			errMsg:  "not found",
+		},
+		"details": {
+			opts:    []InterceptorOption{WithErrorDetails(true)},
+			err:     withDetails("missing"),
+			code:    codes.NotFound,
+			errType: "NotFound",
+			errMsg:  "not found",
+			details: `[{"message":"missing"}]`,
+		},
+		"details-disabled": {
+			err:     withDetails("missing"),
+			code:    codes.NotFound,
+			errType: "NotFound",
+			errMsg:  "not found",
+		},
+		"details-truncated": {
+			opts:    []InterceptorOption{WithErrorDetails(true)},
+			err:     withDetails(strings.Repeat("a", 2*maxErrorDetailsSize)),
+			code:    codes.NotFound,
+			errType: "NotFound",
+			errMsg:  "not found",
+			details: `[{"message":"` + strings.Repeat("a", maxErrorDetailsSize-len(`[{"message":"`)),
+		},
+		"details-truncated-multibyte": {
+			opts:    []InterceptorOption{WithErrorDetails(true)},
+			err:     withDetails(strings.Repeat("é", maxErrorDetailsSize)),
+			code:    codes.NotFound,
+			errType: "NotFound",
+			errMsg:  "not found",
+			// the prefix has an odd length, so that the last character fitting
+			// in maxErrorDetailsSize bytes would be split
+			details: `[{"message":"` + strings.Repeat("é", (maxErrorDetailsSize-len(`[{"message":"`))/2),
+		},
+		"plain-error": {
+			err:  fmt.Errorf("plain"),
+			code: codes.Unknown,
+		},
+		"deadline": {
+			err:     context.DeadlineExceeded,
+			code:    codes.DeadlineExceeded,
+			errType: "DeadlineExceeded",
+			errMsg:  context.DeadlineExceeded.Error(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			interceptor := UnaryServerInterceptor(tt.opts...)
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.Fixture/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) { return nil, tt.err })
+			assert.Equal(tt.err, err)
+
+			spans := mt.FinishedSpans()
+			assert.Len(spans, 1)
+			s := spans[0]
+			assert.Equal(tt.code.String(), s.Tag(tagCode))
+			assert.Equal(tt.err, s.Tag(ext.Error))
+			assert.Equal(tt.errType, s.Tag(ext.ErrorType))
+			assert.Equal(tt.errMsg, s.Tag(ext.ErrorMsg))
+			assert.Equal(tt.details, s.Tag(tagErrorDetails))
+			if details, ok := s.Tag(tagErrorDetails).(string); ok {
+				assert.True(utf8.ValidString(details))
+			}
+		})
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, tt := range []struct {
+		target, authority, endpoint string
+	}{
+		{"localhost:50051", "", "localhost:50051"},
+		{"dns:///localhost:50051", "", "localhost:50051"},
+		{"passthrough:///10.0.0.1:443", "", "10.0.0.1:443"},
+		{"dns://8.8.8.8/iam.svc:443", "8.8.8.8", "iam.svc:443"},
+		{"dns://invalid", "", "dns://invalid"},
+	} {
+		authority, endpoint := parseTarget(tt.target)
+		assert.Equal(t, tt.authority, authority, tt.target)
+		assert.Equal(t, tt.endpoint, endpoint, tt.target)
+	}
+}
+
+func TestTargetTags(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	// nothing listens on the port of a closed listener, so the call fails
+	// before reaching any peer.
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	li.Close()
+	target := "passthrough:///" + li.Addr().String()
+	conn, err := grpc.Dial(target, grpc.WithInsecure(), grpc.WithUnaryInterceptor(UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = NewFixtureClient(conn).Ping(context.Background(), &FixtureRequest{Name: "pass"})
+	assert.Equal(codes.Unavailable, status.Code(err))
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	s := spans[0]
+	_, port, _ := net.SplitHostPort(li.Addr().String())
+	assert.Equal(li.Addr().String(), s.Tag(ext.GRPCTarget))
+	assert.Nil(s.Tag(ext.GRPCAuthority))
+	assert.Equal("127.0.0.1", s.Tag(ext.TargetHost))
+	assert.Equal(port, s.Tag(ext.TargetPort))
+}
+
+func TestServerPanic(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.Fixture/Ping"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { panic("boom") }
+
+	t.Run("unary", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		interceptor := UnaryServerInterceptor()
+		assert.PanicsWithValue("boom", func() {
+			interceptor(context.Background(), nil, info, handler)
+		})
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		s := spans[0]
+		assert.Equal(true, s.Tag(ext.Error))
+		assert.Equal("boom", s.Tag(ext.ErrorMsg))
+		assert.Contains(s.Tag(ext.ErrorStack), "TestServerPanic")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		interceptor := StreamServerInterceptor()
+		assert.PanicsWithValue("boom", func() {
+			interceptor(nil, &testServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/grpc.Fixture/StreamPing"},
+				func(srv interface{}, stream grpc.ServerStream) error { panic("boom") })
+		})
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal("boom", spans[0].Tag(ext.ErrorMsg))
+	})
+
+	t.Run("no-debug-stack", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		interceptor := UnaryServerInterceptor(WithNoDebugStack())
+		assert.Panics(func() {
+			interceptor(context.Background(), nil, info, handler)
+		})
+		_, err := interceptor(context.Background(), nil, info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.Internal, "internal")
+			})
+		assert.Error(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Equal(true, s.Tag(ext.Error))
+			assert.Nil(s.Tag(ext.ErrorStack))
+		}
+		assert.Equal("boom", spans[0].Tag(ext.ErrorMsg))
+		assert.Equal("internal", spans[1].Tag(ext.ErrorMsg))
+	})
+}
+
+// testServerStream is a grpc.ServerStream only providing a context.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *testServerStream) Context() context.Context { return ss.ctx }
+
+func TestBaggage(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true)
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "a")
+	span.SetBaggageItem("User-ID", "42")
+	_, err = rig.client.Ping(ctx, &FixtureRequest{Name: "child"})
+	assert.NoError(err)
+	span.Finish()
+
+	md := rig.fixtureServer.lastRequestMetadata.Load().(metadata.MD)
+	assert.Equal([]string{"42"}, md.Get(tracer.DefaultBaggageHeaderPrefix+"user-id"))
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 4)
+	for _, s := range spans {
+		switch s.OperationName() {
+		case "grpc.server", "child":
+			// baggage keys are lower-cased when crossing process boundaries
+			baggage := map[string]string{}
+			s.Context().ForeachBaggageItem(func(k, v string) bool {
+				baggage[k] = v
+				return true
+			})
+			assert.Equal(map[string]string{"user-id": "42"}, baggage)
+		}
+	}
+}
+
+func TestSpanAndResourceNameFunc(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true,
+		WithSpanNameFunc(func(method string) string {
+			return "grpc." + strings.Split(method, "/")[1]
+		}),
+		WithResourceNameFunc(func(method string) string {
+			return strings.TrimPrefix(method, "/")
+		}),
+	)
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	for _, s := range spans {
+		assert.Equal("grpc.grpc.Fixture", s.OperationName())
+		assert.Equal("grpc.Fixture/Ping", s.Tag(ext.ResourceName))
+		assert.Equal("/grpc.Fixture/Ping", s.Tag(tagMethod))
+	}
+}
+
+func TestPeerTags(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(false, WithPeerTags(true))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err = rig.client.Ping(ctx, &FixtureRequest{Name: "pass"})
+		assert.NoError(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		s := spans[0]
+		assert.Equal("127.0.0.1", s.Tag(tagPeerAddress))
+		assert.NotEmpty(s.Tag(tagPeerPort))
+		deadline, ok := s.Tag(tagDeadline).(int64)
+		assert.True(ok)
+		assert.True(deadline > 0 && deadline <= 10000, deadline)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(false)
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+		assert.NoError(t, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Nil(t, spans[0].Tag(tagPeerAddress))
+		assert.Nil(t, spans[0].Tag(tagDeadline))
+	})
+
+	t.Run("no-peer", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		interceptor := UnaryServerInterceptor(WithPeerTags(true))
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.Fixture/Ping"},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+		assert.NoError(t, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Nil(t, spans[0].Tag(tagPeerAddress))
+		assert.Nil(t, spans[0].Tag(tagDeadline))
+	})
+}
+
+func TestSpanModifier(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(true, WithSpanModifier(func(ctx context.Context, span ddtrace.Span, method string) {
+		span.SetTag("shard", strings.Split(method, "/")[2])
+	}))
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	for _, s := range spans {
+		assert.Equal("Ping", s.Tag("shard"))
+	}
+
+	t.Run("panic", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true, WithSpanModifier(func(ctx context.Context, span ddtrace.Span, method string) {
+			panic("oops")
+		}))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		resp, err := rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+		assert.NoError(err)
+		assert.Equal("passed", resp.Message)
+		assert.Len(mt.FinishedSpans(), 2)
+	})
+}
+
+func TestMessageSizes(t *testing.T) {
+	reqSize := proto.Size(&FixtureRequest{Name: "pass"})
+	respSize := proto.Size(&FixtureReply{Message: "passed"})
+
+	t.Run("unary", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true, WithMessageSizes(true))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+		assert.NoError(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Equal(reqSize, s.Tag(tagRequestSize))
+			assert.Equal(respSize, s.Tag(tagResponseSize))
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true, WithMessageSizes(true), WithStreamMessages(false))
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		stream, err := rig.client.StreamPing(context.Background())
+		assert.NoError(err)
+		for i := 0; i < 2; i++ {
+			assert.NoError(stream.Send(&FixtureRequest{Name: "pass"}))
+			_, err = stream.Recv()
+			assert.NoError(err)
+		}
+		stream.CloseSend()
+		_, err = stream.Recv()
+		assert.Equal(io.EOF, err)
+
+		waitForSpans(mt, 2, 5*time.Second)
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.EqualValues(2*reqSize, s.Tag(tagRequestSize))
+			assert.EqualValues(2*respSize, s.Tag(tagResponseSize))
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true)
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		_, err = rig.client.Ping(context.Background(), &FixtureRequest{Name: "pass"})
+		assert.NoError(t, err)
+
+		for _, s := range mt.FinishedSpans() {
+			assert.Nil(t, s.Tag(tagRequestSize))
+			assert.Nil(t, s.Tag(tagResponseSize))
+		}
+	})
+}
+
 // fixtureServer a dummy implemenation of our grpc fixtureServer.
 type fixtureServer struct {
 	lastRequestMetadata atomic.Value
@@ -312,6 +1218,9 @@ type fixtureServer struct {
 func (s *fixtureServer) StreamPing(srv Fixture_StreamPingServer) error {
 	for {
 		msg, err := srv.Recv()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -337,6 +1246,8 @@ func (s *fixtureServer) Ping(ctx context.Context, in *FixtureRequest) (*FixtureR
 		span, _ := tracer.StartSpanFromContext(ctx, "child")
 		span.Finish()
 		return &FixtureReply{Message: "child"}, nil
+	case in.Name == "invalid":
+		return nil, status.Error(codes.InvalidArgument, "invalid")
 	case in.Name == "disabled":
 		if _, ok := tracer.SpanFromContext(ctx); ok {
 			panic("should be disabled")
@@ -1,8 +1,64 @@
 package grpc
 
+import (
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
 type interceptorConfig struct {
 	serviceName                           string
+	serviceNameFunc                       func(cc *grpc.ClientConn, fullMethod string) string
 	traceStreamCalls, traceStreamMessages bool
+	peerTags                              bool
+	messageSizes                          bool
+	errorDetails                          bool
+	noDebugStack                          bool
+	rate                                  float64
+	methodSampleRates                     map[string]float64
+	ignoredMethods                        map[string]struct{}
+	metadataTags                          []string
+	nonErrorCodes                         map[codes.Code]struct{}
+	propagationStyles                     []string
+	spanNameFunc, resourceNameFunc        func(fullMethod string) string
+	spanModifier                          func(ctx context.Context, span ddtrace.Span, fullMethod string)
+}
+
+// spanName returns the operation name for spans covering calls to the given
+// full method, using def unless WithSpanNameFunc was used.
+func (cfg *interceptorConfig) spanName(def, method string) string {
+	if cfg.spanNameFunc != nil {
+		return cfg.spanNameFunc(method)
+	}
+	return def
+}
+
+// resourceName returns the resource name for spans related to the given full
+// method. It defaults to the full method.
+func (cfg *interceptorConfig) resourceName(method string) string {
+	if cfg.resourceNameFunc != nil {
+		return cfg.resourceNameFunc(method)
+	}
+	return method
+}
+
+// filterError returns nil if the gRPC code of err, as tagged on spans, was
+// marked as not being an error using WithNonErrorCodes, and err otherwise.
+func (cfg *interceptorConfig) filterError(err error) error {
+	if _, ok := cfg.nonErrorCodes[statusCode(err)]; ok {
+		return nil
+	}
+	return err
+}
+
+// ignored reports whether the given full method should not be traced.
+func (cfg *interceptorConfig) ignored(method string) bool {
+	_, ok := cfg.ignoredMethods[method]
+	return ok
 }
 
 func (cfg *interceptorConfig) serverServiceName() string {
@@ -12,7 +68,15 @@ func (cfg *interceptorConfig) serverServiceName() string {
 	return cfg.serviceName
 }
 
-func (cfg *interceptorConfig) clientServiceName() string {
+// clientServiceName returns the service name of client spans covering calls
+// to the given full method through cc. The connection is nil for spans started
+// by stats handlers, in which case WithServiceNameFunc is not used.
+func (cfg *interceptorConfig) clientServiceName(cc *grpc.ClientConn, method string) string {
+	if cfg.serviceNameFunc != nil && cc != nil {
+		if name := cfg.serviceNameFunc(cc, method); name != "" {
+			return name
+		}
+	}
 	if cfg.serviceName == "" {
 		return "grpc.client"
 	}
@@ -26,7 +90,8 @@ type InterceptorOption func(*interceptorConfig)
 func defaults(cfg *interceptorConfig) {
 	// cfg.serviceName defaults are set in interceptors
 	cfg.traceStreamCalls = true
-	cfg.traceStreamMessages = true
+	cfg.propagationStyles = []string{propagationStyleDatadog}
+	cfg.rate = 1
 }
 
 // WithServiceName sets the given service name for the intercepted client.
@@ -36,6 +101,18 @@ func WithServiceName(name string) InterceptorOption {
 	}
 }
 
+// WithServiceNameFunc sets a function which returns the service name of client
+// spans, given the connection and the full method of the call. It allows
+// reporting calls to distinct backends as distinct services, for example based
+// on cc.Target(). When fn returns an empty string, the service name set using
+// WithServiceName, or "grpc.client", is used. It has no effect on server spans
+// and on client stats handlers.
+func WithServiceNameFunc(fn func(cc *grpc.ClientConn, fullMethod string) string) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.serviceNameFunc = fn
+	}
+}
+
 // WithStreamCalls enables or disables tracing of streaming calls.
 func WithStreamCalls(enabled bool) InterceptorOption {
 	return func(cfg *interceptorConfig) {
@@ -43,9 +120,154 @@ func WithStreamCalls(enabled bool) InterceptorOption {
 	}
 }
 
-// WithStreamMessages enables or disables tracing of streaming messages.
+// WithStreamMessages enables or disables tracing of streaming messages. When
+// enabled, each sent or received message results in a "grpc.message" span,
+// child of the stream span, tagged with its direction ("send" or "receive")
+// and with its index among the messages of that direction. It is disabled by
+// default, as long-lived streams would otherwise result in very large traces.
+// It has no effect on unary calls.
 func WithStreamMessages(enabled bool) InterceptorOption {
 	return func(cfg *interceptorConfig) {
 		cfg.traceStreamMessages = enabled
 	}
 }
+
+// WithIgnoredMethods specifies full methods (e.g. "/grpc.health.v1.Health/Check")
+// which should not be traced by the interceptors. Calls to these methods still
+// pass any existing trace context through to the handler or to the server.
+func WithIgnoredMethods(methods ...string) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		if cfg.ignoredMethods == nil {
+			cfg.ignoredMethods = make(map[string]struct{}, len(methods))
+		}
+		for _, m := range methods {
+			cfg.ignoredMethods[m] = struct{}{}
+		}
+	}
+}
+
+// WithMetadataTags specifies a set of incoming metadata keys which will be set
+// as tags on server spans, prefixed with "grpc.metadata.". Keys that are missing
+// from the request are skipped and multiple values are joined using a comma.
+// Only the given keys are ever recorded.
+func WithMetadataTags(keys ...string) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		for _, k := range keys {
+			cfg.metadataTags = append(cfg.metadataTags, strings.ToLower(k))
+		}
+	}
+}
+
+// WithNonErrorCodes specifies a set of gRPC codes which should not mark client
+// and server spans as errors. The codes are still recorded in the "grpc.code"
+// tag. By default, any error returned by the handler or the invoker is
+// considered an error.
+func WithNonErrorCodes(cs ...codes.Code) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		if cfg.nonErrorCodes == nil {
+			cfg.nonErrorCodes = make(map[codes.Code]struct{}, len(cs))
+		}
+		for _, c := range cs {
+			cfg.nonErrorCodes[c] = struct{}{}
+		}
+	}
+}
+
+// WithPropagationStyle sets the formats used to propagate span contexts through
+// gRPC metadata. Supported styles are "datadog", which is the default, and "b3".
+// Span contexts are injected using all the given styles and extracted using the
+// first one which is found, in the given order.
+func WithPropagationStyle(styles ...string) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.propagationStyles = make([]string, 0, len(styles))
+		for _, s := range styles {
+			cfg.propagationStyles = append(cfg.propagationStyles, strings.ToLower(s))
+		}
+	}
+}
+
+// WithSpanNameFunc sets a function which returns the operation name of the
+// spans covering calls to the given full method (e.g. "/grpc.Fixture/Ping").
+// By default, "grpc.server" and "grpc.client" are used. Message spans are
+// not affected.
+func WithSpanNameFunc(fn func(fullMethod string) string) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.spanNameFunc = fn
+	}
+}
+
+// WithResourceNameFunc sets a function which returns the resource name of the
+// spans related to the given full method. By default, the full method is used.
+func WithResourceNameFunc(fn func(fullMethod string) string) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.resourceNameFunc = fn
+	}
+}
+
+// WithPeerTags enables or disables tagging server spans with the address of the
+// peer and with the time remaining before the request deadline, if any, as
+// measured when the span starts.
+func WithPeerTags(enabled bool) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.peerTags = enabled
+	}
+}
+
+// WithSpanModifier sets a function which is called with every span covering a
+// call, right after it was started and before the handler or the invoker runs.
+// It can be used to set additional tags. Any panic in fn is recovered and logged.
+func WithSpanModifier(fn func(ctx context.Context, span ddtrace.Span, fullMethod string)) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.spanModifier = fn
+	}
+}
+
+// WithMessageSizes enables or disables recording the encoded size of request
+// and response messages on the spans covering calls. For streams, the sizes of
+// all messages are summed. Only protocol buffer messages are measured. It is
+// disabled by default, because computing the size has a cost.
+func WithMessageSizes(enabled bool) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.messageSizes = enabled
+	}
+}
+
+// WithErrorDetails enables or disables recording the details of the status of
+// failed calls as JSON in the "error.details" tag. The tag is truncated to 1KB.
+func WithErrorDetails(enabled bool) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.errorDetails = enabled
+	}
+}
+
+// WithSampleRate sets the rate, between 0 and 1, at which incoming calls are
+// traced by the server interceptors and stats handlers. Calls which are not
+// traced skip span creation altogether, but still receive the incoming metadata
+// unchanged. The decision is based on the incoming trace ID, when there is one.
+// By default, all calls are traced.
+func WithSampleRate(rate float64) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.rate = rate
+	}
+}
+
+// WithMethodSampleRates sets sample rates for specific full methods, overriding
+// the one set using WithSampleRate. See WithSampleRate for more details.
+func WithMethodSampleRates(rates map[string]float64) InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		if cfg.methodSampleRates == nil {
+			cfg.methodSampleRates = make(map[string]float64, len(rates))
+		}
+		for m, r := range rates {
+			cfg.methodSampleRates[m] = r
+		}
+	}
+}
+
+// WithNoDebugStack disables recording the stack trace of errors and of panics
+// recovered from handlers in the "error.stack" tag.
+func WithNoDebugStack() InterceptorOption {
+	return func(cfg *interceptorConfig) {
+		cfg.noDebugStack = true
+	}
+}
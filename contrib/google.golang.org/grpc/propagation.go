@@ -0,0 +1,125 @@
+package grpc
+
+import (
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/internal/grpcutil"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Propagation styles supported by WithPropagationStyle.
+const (
+	propagationStyleDatadog = "datadog"
+	propagationStyleB3      = "b3"
+)
+
+// B3 metadata keys, as per https://github.com/openzipkin/b3-propagation.
+const (
+	b3TraceIDHeader = "x-b3-traceid"
+	b3SpanIDHeader  = "x-b3-spanid"
+	b3SampledHeader = "x-b3-sampled"
+)
+
+// datadogHeaderPrefix prefixes the metadata keys of the Datadog style.
+const datadogHeaderPrefix = "x-datadog-"
+
+var (
+	// b3Propagator and datadogPropagator translate span contexts between the
+	// B3 and Datadog styles, as those of the active tracer, which may be the
+	// mock tracer, are always injected and extracted using Datadog metadata.
+	b3Propagator      = tracer.NewPropagator(&tracer.PropagatorConfig{Styles: []string{propagationStyleB3}})
+	datadogPropagator = tracer.NewPropagator(&tracer.PropagatorConfig{Styles: []string{propagationStyleDatadog}})
+)
+
+// extractSpanContext extracts a span context from the given metadata, using the
+// first configured propagation style which yields one. Contexts without any
+// trace ID, which only carry the origin of the trace, are used as a last resort.
+func extractSpanContext(md metadata.MD, cfg *interceptorConfig) (ddtrace.SpanContext, error) {
+	var fallback ddtrace.SpanContext
+	err := tracer.ErrSpanContextNotFound
+	for _, style := range cfg.propagationStyles {
+		var sctx ddtrace.SpanContext
+		switch style {
+		case propagationStyleDatadog:
+			sctx, err = tracer.Extract(grpcutil.MDCarrier(md))
+		case propagationStyleB3:
+			sctx, err = extractB3(md)
+		default:
+			continue
+		}
+		if err == nil {
+			if sctx.TraceID() != 0 {
+				return sctx, nil
+			}
+			if fallback == nil {
+				fallback = sctx
+			}
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, err
+}
+
+// extractB3 extracts a span context from the B3 values found in md. The values
+// are translated into Datadog ones so that the active tracer can extract them.
+func extractB3(md metadata.MD) (ddtrace.SpanContext, error) {
+	carrier, err := fromB3(md)
+	if err != nil {
+		return nil, err
+	}
+	return tracer.Extract(carrier)
+}
+
+// fromB3 translates the B3 values found in md into Datadog ones.
+func fromB3(md metadata.MD) (tracer.TextMapCarrier, error) {
+	sctx, err := b3Propagator.Extract(grpcutil.MDCarrier(md))
+	if err != nil {
+		return nil, err
+	}
+	carrier := tracer.TextMapCarrier{}
+	if err := datadogPropagator.Inject(sctx, carrier); err != nil {
+		return nil, err
+	}
+	return carrier, nil
+}
+
+// toB3 translates the Datadog values found in dd into B3 values in md. Nothing
+// is set when dd holds no span context.
+func toB3(dd, md metadata.MD) {
+	sctx, err := datadogPropagator.Extract(grpcutil.MDCarrier(dd))
+	if err != nil {
+		return
+	}
+	b3Propagator.Inject(sctx, grpcutil.MDCarrier(md))
+}
+
+// injectSpanContext injects the span context into md using all the configured
+// propagation styles.
+func injectSpanContext(sctx ddtrace.SpanContext, md metadata.MD, cfg *interceptorConfig) error {
+	dd := metadata.MD{}
+	if err := tracer.Inject(sctx, grpcutil.MDCarrier(dd)); err != nil {
+		return err
+	}
+	var datadog bool
+	for _, style := range cfg.propagationStyles {
+		switch style {
+		case propagationStyleDatadog:
+			datadog = true
+		case propagationStyleB3:
+			toB3(dd, md)
+		}
+	}
+	for k, vs := range dd {
+		if !datadog && strings.HasPrefix(k, datadogHeaderPrefix) {
+			continue
+		}
+		// anything else, such as baggage, is always propagated
+		md[k] = append(md[k], vs...)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package grpc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestFromB3(t *testing.T) {
+	for in, want := range map[string]struct {
+		traceID string
+		err     error
+	}{
+		"":                                 {"", tracer.ErrSpanContextNotFound},
+		"000000000000002a":                 {"42", nil},
+		"2a":                               {"42", nil},
+		"ffffffffffffffff":                 {"18446744073709551615", nil},
+		"463ac35c9f6413ad48485a3953bb6124": {"5208512171318403364", nil},
+		"xyz":                              {"", tracer.ErrSpanContextCorrupted},
+		"-1":                               {"", tracer.ErrSpanContextCorrupted},
+	} {
+		carrier, err := fromB3(metadata.Pairs(b3TraceIDHeader, in, b3SpanIDHeader, "a2fb4a1d1a96d312"))
+		assert.Equal(t, want.err, err, in)
+		assert.Equal(t, want.traceID, carrier[tracer.DefaultTraceIDHeader], in)
+	}
+}
+
+func TestPropagationStyle(t *testing.T) {
+	run := func(t *testing.T, opts ...InterceptorOption) (metadata.MD, []mocktracer.Span) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rig, err := newRig(true, opts...)
+		if err != nil {
+			t.Fatalf("error setting up rig: %s", err)
+		}
+		defer rig.Close()
+
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "a",
+			tracer.Tag(ext.SamplingPriority, ext.PriorityAutoKeep))
+		_, err = rig.client.Ping(ctx, &FixtureRequest{Name: "pass"})
+		assert.NoError(t, err)
+		span.Finish()
+
+		return rig.fixtureServer.lastRequestMetadata.Load().(metadata.MD), mt.FinishedSpans()
+	}
+
+	checkTrace := func(t *testing.T, spans []mocktracer.Span) {
+		assert.Len(t, spans, 3)
+		for _, s := range spans[1:] {
+			assert.Equal(t, spans[0].TraceID(), s.TraceID())
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		md, spans := run(t)
+		checkTrace(t, spans)
+		assert.Len(t, md.Get(tracer.DefaultTraceIDHeader), 1)
+		assert.Empty(t, md.Get(b3TraceIDHeader))
+	})
+
+	t.Run("b3", func(t *testing.T) {
+		md, spans := run(t, WithPropagationStyle("B3"))
+		checkTrace(t, spans)
+		assert.Empty(t, md.Get(tracer.DefaultTraceIDHeader))
+		assert.Empty(t, md.Get(tracer.DefaultParentIDHeader))
+		assert.Equal(t, []string{fmt.Sprintf("%016x", spans[0].TraceID())}, md.Get(b3TraceIDHeader))
+		assert.Len(t, md.Get(b3SpanIDHeader), 1)
+		assert.Equal(t, []string{"1"}, md.Get(b3SampledHeader))
+		for k := range md {
+			assert.False(t, strings.HasPrefix(k, "x-datadog-"), k)
+		}
+	})
+
+	t.Run("both", func(t *testing.T) {
+		md, spans := run(t, WithPropagationStyle("datadog", "b3"))
+		checkTrace(t, spans)
+		assert.Equal(t, []string{fmt.Sprint(spans[0].TraceID())}, md.Get(tracer.DefaultTraceIDHeader))
+		assert.Equal(t, []string{fmt.Sprintf("%016x", spans[0].TraceID())}, md.Get(b3TraceIDHeader))
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			b3TraceIDHeader, "463ac35c9f6413ad48485a3953bb6124",
+			b3SpanIDHeader, "a2fb4a1d1a96d312",
+			b3SampledHeader, "0",
+		))
+		info := &grpc.UnaryServerInfo{FullMethod: "/grpc.Fixture/Ping"}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+
+		// B3 is ignored by default
+		UnaryServerInterceptor()(ctx, nil, info, handler)
+		UnaryServerInterceptor(WithPropagationStyle("datadog", "b3"))(ctx, nil, info, handler)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal(uint64(0), spans[0].ParentID())
+		assert.Equal(uint64(0x48485a3953bb6124), spans[1].TraceID())
+		assert.Equal(uint64(0xa2fb4a1d1a96d312), spans[1].ParentID())
+		assert.Equal(ext.PriorityAutoReject, spans[1].Tag(ext.SamplingPriority))
+	})
+}
+
+func TestB3TraceIDHigh(t *testing.T) {
+	for name, tt := range map[string]struct {
+		traceID string
+		high    string // expected value of tracer.TraceIDHighHeader
+	}{
+		"128-bit": {"463ac35c9f6413ad48485a3953bb6124", "463ac35c9f6413ad"},
+		"64-bit":  {"48485a3953bb6124", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			carrier, err := fromB3(metadata.Pairs(
+				b3TraceIDHeader, tt.traceID,
+				b3SpanIDHeader, "a2fb4a1d1a96d312",
+			))
+			assert.NoError(err)
+			assert.Equal("5208512171318403364", carrier[tracer.DefaultTraceIDHeader])
+			assert.Equal(tt.high, carrier[tracer.TraceIDHighHeader])
+
+			// the trace ID is re-emitted as it was received
+			dd := metadata.MD{}
+			for k, v := range carrier {
+				dd[k] = []string{v}
+			}
+			md := metadata.MD{}
+			toB3(dd, md)
+			assert.Equal([]string{tt.traceID}, md.Get(b3TraceIDHeader))
+		})
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := fromB3(metadata.Pairs(
+			b3TraceIDHeader, "xyzac35c9f6413ad48485a3953bb6124",
+			b3SpanIDHeader, "a2fb4a1d1a96d312",
+		))
+		assert.Equal(t, tracer.ErrSpanContextCorrupted, err)
+	})
+}
+
+func TestB3OnlyMetadata(t *testing.T) {
+	assert := assert.New(t)
+	// the mock tracer propagates neither the origin nor the upper bits of
+	// trace IDs
+	tracer.Start(tracer.WithAgentAddr("127.0.0.1:1"))
+	defer tracer.Stop()
+
+	sctx, err := tracer.Extract(tracer.TextMapCarrier{
+		tracer.DefaultTraceIDHeader:  "5208512171318403364",
+		tracer.DefaultParentIDHeader: "2",
+		tracer.TraceIDHighHeader:     "463ac35c9f6413ad",
+		"x-datadog-origin":           "synthetics",
+	})
+	assert.NoError(err)
+	span := tracer.StartSpan("grpc.client", tracer.ChildOf(sctx))
+	span.SetBaggageItem("item", "x")
+	cfg := new(interceptorConfig)
+	defaults(cfg)
+	WithPropagationStyle("b3")(cfg)
+	md := metadata.MD{}
+	assert.NoError(injectSpanContext(span.Context(), md, cfg))
+
+	assert.Equal([]string{"463ac35c9f6413ad48485a3953bb6124"}, md.Get(b3TraceIDHeader))
+	assert.Equal([]string{"x"}, md.Get(tracer.DefaultBaggageHeaderPrefix+"item"))
+	for k := range md {
+		assert.False(strings.HasPrefix(k, "x-datadog-"), k)
+	}
+}
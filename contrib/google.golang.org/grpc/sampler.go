@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/internal/grpcutil"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// knuthFactor is used to hash trace IDs, same as the tracer and the agent.
+const knuthFactor = uint64(1111111111111111111)
+
+// sampleRate returns the rate at which calls to the given full method are traced.
+func (cfg *interceptorConfig) sampleRate(method string) float64 {
+	if rate, ok := cfg.methodSampleRates[method]; ok {
+		return rate
+	}
+	return cfg.rate
+}
+
+// sampled reports whether a span should be created for the incoming call to the
+// given full method. The decision is based on the incoming trace ID when there
+// is one, so that all the services taking part in a trace agree, and is random
+// otherwise.
+func (cfg *interceptorConfig) sampled(ctx context.Context, method string) bool {
+	rate := cfg.sampleRate(method)
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if id, ok := incomingTraceID(md, cfg); ok {
+			return id*knuthFactor < uint64(rate*math.MaxUint64)
+		}
+	}
+	return rand.Float64() < rate
+}
+
+// incomingTraceID returns the trace ID found in md, using the first configured
+// propagation style which yields one.
+func incomingTraceID(md metadata.MD, cfg *interceptorConfig) (uint64, bool) {
+	mdc := grpcutil.MDCarrier(md)
+	for _, style := range cfg.propagationStyles {
+		switch style {
+		case propagationStyleDatadog:
+			if id, err := strconv.ParseUint(mdc.Get(tracer.DefaultTraceIDHeader), 10, 64); err == nil && id != 0 {
+				return id, true
+			}
+		case propagationStyleB3:
+			if sctx, err := b3Propagator.Extract(mdc); err == nil {
+				return sctx.TraceID(), true
+			}
+		}
+	}
+	return 0, false
+}
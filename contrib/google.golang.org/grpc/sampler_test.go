@@ -0,0 +1,81 @@
+package grpc
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSampled(t *testing.T) {
+	withTraceID := func(id uint64) context.Context {
+		md := metadata.Pairs(tracer.DefaultTraceIDHeader, strconv.FormatUint(id, 10))
+		return metadata.NewIncomingContext(context.Background(), md)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		cfg := new(interceptorConfig)
+		defaults(cfg)
+		assert.True(t, cfg.sampled(context.Background(), "/grpc.Fixture/Ping"))
+	})
+
+	t.Run("trace-id", func(t *testing.T) {
+		assert := assert.New(t)
+		cfg := new(interceptorConfig)
+		defaults(cfg)
+		rate := 0.5
+		WithSampleRate(rate)(cfg)
+
+		var kept int
+		for id := uint64(1); id <= 1000; id++ {
+			ctx := withTraceID(id)
+			want := id*knuthFactor < uint64(rate*math.MaxUint64)
+			assert.Equal(want, cfg.sampled(ctx, "/grpc.Fixture/Ping"), id)
+			// the decision is the same for all calls of a trace
+			assert.Equal(want, cfg.sampled(ctx, "/grpc.Fixture/Ping"), id)
+			if want {
+				kept++
+			}
+		}
+		assert.InDelta(500, kept, 100)
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		assert := assert.New(t)
+		cfg := new(interceptorConfig)
+		defaults(cfg)
+		WithSampleRate(0)(cfg)
+		WithMethodSampleRates(map[string]float64{"/grpc.Fixture/StreamPing": 1})(cfg)
+
+		assert.False(cfg.sampled(withTraceID(1), "/grpc.Fixture/Ping"))
+		assert.True(cfg.sampled(withTraceID(1), "/grpc.Fixture/StreamPing"))
+	})
+}
+
+func TestSampleRate(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rig, err := newRig(false, WithMethodSampleRates(map[string]float64{"/grpc.Fixture/Ping": 0}))
+	if err != nil {
+		t.Fatalf("error setting up rig: %s", err)
+	}
+	defer rig.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), tracer.DefaultTraceIDHeader, "1234")
+	resp, err := rig.client.Ping(ctx, &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+	assert.Equal("passed", resp.Message)
+	assert.Empty(mt.FinishedSpans())
+
+	// the propagation metadata reaches the handler unchanged
+	md := rig.fixtureServer.lastRequestMetadata.Load().(metadata.MD)
+	assert.Equal([]string{"1234"}, md.Get(tracer.DefaultTraceIDHeader))
+}
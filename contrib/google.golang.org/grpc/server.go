@@ -4,7 +4,6 @@ import (
 	context "golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 type serverStream struct {
@@ -12,6 +11,16 @@ type serverStream struct {
 	cfg    *interceptorConfig
 	method string
 	ctx    context.Context
+
+	// sent and recv count the messages sent and received on the stream.
+	// gRPC does not allow concurrent calls to SendMsg, nor to RecvMsg, so
+	// they need no synchronization.
+	sent, recv int
+
+	// sentSize and recvSize sum the sizes of the messages sent and received
+	// on the stream, when using WithMessageSizes. They are read once the
+	// handler returns.
+	sentSize, recvSize int
 }
 
 // Context returns the ServerStream Context.
@@ -28,19 +37,35 @@ func (ss *serverStream) Context() context.Context {
 
 func (ss *serverStream) RecvMsg(m interface{}) (err error) {
 	if ss.cfg.traceStreamMessages {
-		span, _ := startSpanFromContext(ss.ctx, ss.method, "grpc.message", ss.cfg.serverServiceName())
-		defer span.Finish(withStreamError(err))
+		span, _ := startSpanFromContext(ss.ctx, ss.cfg, ss.method, "grpc.message", ss.cfg.serverServiceName())
+		span.SetTag(tagMessageDirection, messageDirectionReceive)
+		span.SetTag(tagMessageIndex, ss.recv)
+		ss.recv++
+		defer func() { finishWithError(span, streamError(err), ss.cfg) }()
 	}
 	err = ss.ServerStream.RecvMsg(m)
+	if err == nil {
+		if n, ok := messageSize(ss.cfg, m); ok {
+			ss.recvSize += n
+		}
+	}
 	return err
 }
 
 func (ss *serverStream) SendMsg(m interface{}) (err error) {
 	if ss.cfg.traceStreamMessages {
-		span, _ := startSpanFromContext(ss.ctx, ss.method, "grpc.message", ss.cfg.serverServiceName())
-		defer span.Finish(withStreamError(err))
+		span, _ := startSpanFromContext(ss.ctx, ss.cfg, ss.method, "grpc.message", ss.cfg.serverServiceName())
+		span.SetTag(tagMessageDirection, messageDirectionSend)
+		span.SetTag(tagMessageIndex, ss.sent)
+		ss.sent++
+		defer func() { finishWithError(span, streamError(err), ss.cfg) }()
 	}
 	err = ss.ServerStream.SendMsg(m)
+	if err == nil {
+		if n, ok := messageSize(ss.cfg, m); ok {
+			ss.sentSize += n
+		}
+	}
 	return err
 }
 
@@ -51,27 +76,45 @@ func StreamServerInterceptor(opts ...InterceptorOption) grpc.StreamServerInterce
 	for _, fn := range opts {
 		fn(cfg)
 	}
-	if cfg.serviceName == "" {
-		cfg.serviceName = "grpc.server"
-	}
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
-		ctx := ss.Context()
+		if cfg.ignored(info.FullMethod) || !cfg.sampled(ss.Context(), info.FullMethod) {
+			return handler(srv, ss)
+		}
+		stream := &serverStream{
+			ServerStream: ss,
+			cfg:          cfg,
+			method:       info.FullMethod,
+			ctx:          ss.Context(),
+		}
 
 		// if we've enabled call tracing, create a span
 		if cfg.traceStreamCalls {
 			var span ddtrace.Span
-			span, ctx = startSpanFromContext(ctx, info.FullMethod, "grpc.server", cfg.serviceName)
-			defer span.Finish(withStreamError(err))
+			span, stream.ctx = startSpanFromContext(stream.ctx, cfg, info.FullMethod, cfg.spanName("grpc.server", info.FullMethod), cfg.serverServiceName())
+			setMetadataTags(stream.ctx, span, cfg)
+			setPeerTags(stream.ctx, span, cfg)
+			modifySpan(stream.ctx, span, cfg, info.FullMethod)
+			// err has to be read when the handler returns, not when the
+			// defer statement is evaluated.
+			defer func() {
+				if r := recover(); r != nil {
+					// finish the span, but leave the handling of the panic
+					// as it would be without tracing
+					finishWithPanic(span, r, cfg)
+					panic(r)
+				}
+				if cfg.messageSizes {
+					span.SetTag(tagRequestSize, stream.recvSize)
+					span.SetTag(tagResponseSize, stream.sentSize)
+				}
+				span.SetTag(tagCode, statusCode(err).String())
+				finishWithError(span, streamError(cfg.filterError(err)), cfg)
+			}()
 		}
 
-		// call the original handler with a new stream, which traces each send
-		// and recv if message tracing is enabled
-		err = handler(srv, &serverStream{
-			ServerStream: ss,
-			cfg:          cfg,
-			method:       info.FullMethod,
-			ctx:          ctx,
-		})
+		// call the original handler with the wrapped stream, which traces each
+		// send and recv if message tracing is enabled
+		err = handler(srv, stream)
 
 		return err
 	}
@@ -85,9 +128,28 @@ func UnaryServerInterceptor(opts ...InterceptorOption) grpc.UnaryServerIntercept
 		fn(cfg)
 	}
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		span, ctx := startSpanFromContext(ctx, info.FullMethod, "grpc.server", cfg.serverServiceName())
+		if cfg.ignored(info.FullMethod) || !cfg.sampled(ctx, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		span, ctx := startSpanFromContext(ctx, cfg, info.FullMethod, cfg.spanName("grpc.server", info.FullMethod), cfg.serverServiceName())
+		setMetadataTags(ctx, span, cfg)
+		setPeerTags(ctx, span, cfg)
+		modifySpan(ctx, span, cfg, info.FullMethod)
+		setMessageSize(span, cfg, tagRequestSize, req)
+		defer func() {
+			if r := recover(); r != nil {
+				// finish the span, but leave the handling of the panic as
+				// it would be without tracing
+				finishWithPanic(span, r, cfg)
+				panic(r)
+			}
+		}()
 		resp, err := handler(ctx, req)
-		span.Finish(tracer.WithError(err))
+		if err == nil {
+			setMessageSize(span, cfg, tagResponseSize, resp)
+		}
+		span.SetTag(tagCode, statusCode(err).String())
+		finishWithError(span, cfg.filterError(err), cfg)
 		return resp, err
 	}
 }
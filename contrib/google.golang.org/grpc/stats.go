@@ -0,0 +1,109 @@
+package grpc
+
+import (
+	"sync/atomic"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+)
+
+// NewServerStatsHandler returns a gRPC server stats.Handler to trace RPC calls,
+// as an alternative to the server interceptors. It accepts the same options.
+// It can be registered using grpc.StatsHandler.
+func NewServerStatsHandler(opts ...InterceptorOption) stats.Handler {
+	cfg := new(interceptorConfig)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return &statsHandler{cfg: cfg}
+}
+
+// NewClientStatsHandler returns a gRPC client stats.Handler to trace RPC calls,
+// as an alternative to the client interceptors. It accepts the same options.
+// It can be registered using grpc.WithStatsHandler.
+func NewClientStatsHandler(opts ...InterceptorOption) stats.Handler {
+	cfg := new(interceptorConfig)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return &statsHandler{cfg: cfg, client: true}
+}
+
+// statsHandler implements stats.Handler for both clients and servers.
+type statsHandler struct {
+	cfg    *interceptorConfig
+	client bool
+}
+
+var _ stats.Handler = (*statsHandler)(nil)
+
+type rpcStatsKey struct{}
+
+// rpcStats holds the state of a traced RPC. It is stored in the RPC context.
+type rpcStats struct {
+	span           ddtrace.Span
+	sent, received int64 // payload bytes, accessed atomically
+}
+
+// TagRPC implements stats.Handler. It starts the span of the RPC.
+func (h *statsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	if h.cfg.ignored(info.FullMethodName) {
+		if h.client {
+			return injectSpanIntoContext(ctx, h.cfg)
+		}
+		return ctx
+	}
+	if !h.client && !h.cfg.sampled(ctx, info.FullMethodName) {
+		return ctx
+	}
+	var span ddtrace.Span
+	if h.client {
+		span, ctx = startSpanFromContext(ctx, h.cfg, info.FullMethodName, h.cfg.spanName("grpc.client", info.FullMethodName), h.cfg.clientServiceName(nil, info.FullMethodName))
+		modifySpan(ctx, span, h.cfg, info.FullMethodName)
+		ctx = injectSpanIntoContext(ctx, h.cfg)
+	} else {
+		span, ctx = startSpanFromContext(ctx, h.cfg, info.FullMethodName, h.cfg.spanName("grpc.server", info.FullMethodName), h.cfg.serverServiceName())
+		setMetadataTags(ctx, span, h.cfg)
+		setPeerTags(ctx, span, h.cfg)
+		modifySpan(ctx, span, h.cfg, info.FullMethodName)
+	}
+	return context.WithValue(ctx, rpcStatsKey{}, &rpcStats{span: span})
+}
+
+// HandleRPC implements stats.Handler. It records the payload sizes of the RPC
+// and finishes its span upon completion.
+func (h *statsHandler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	st, ok := ctx.Value(rpcStatsKey{}).(*rpcStats)
+	if !ok {
+		return
+	}
+	switch rs := rs.(type) {
+	case *stats.OutHeader:
+		if h.client && rs.RemoteAddr != nil {
+			setSpanTargetFromPeer(st.span, peer.Peer{Addr: rs.RemoteAddr})
+		}
+	case *stats.InPayload:
+		atomic.AddInt64(&st.received, int64(rs.Length))
+	case *stats.OutPayload:
+		atomic.AddInt64(&st.sent, int64(rs.Length))
+	case *stats.End:
+		st.span.SetTag(tagCode, statusCode(rs.Error).String())
+		st.span.SetTag(tagBytesSent, atomic.LoadInt64(&st.sent))
+		st.span.SetTag(tagBytesReceived, atomic.LoadInt64(&st.received))
+		finishWithError(st.span, h.cfg.filterError(rs.Error), h.cfg, tracer.FinishTime(rs.EndTime))
+	}
+}
+
+// TagConn implements stats.Handler.
+func (h *statsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (h *statsHandler) HandleConn(_ context.Context, _ stats.ConnStats) {}
@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatsHandler(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	server := grpc.NewServer(grpc.StatsHandler(NewServerStatsHandler(WithServiceName("grpc"))))
+	RegisterFixtureServer(server, new(fixtureServer))
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(li.Addr().String())
+	go server.Serve(li)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(li.Addr().String(),
+		grpc.WithInsecure(),
+		grpc.WithStatsHandler(NewClientStatsHandler(WithServiceName("grpc-client"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := NewFixtureClient(conn)
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "a")
+	_, err = client.Ping(ctx, &FixtureRequest{Name: "pass"})
+	assert.NoError(err)
+	_, err = client.Ping(ctx, &FixtureRequest{Name: "invalid"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+	span.Finish()
+
+	waitForSpans(mt, 5, 5*time.Second)
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 5)
+
+	var servers, clients []mocktracer.Span
+	for _, s := range spans {
+		switch s.OperationName() {
+		case "grpc.server":
+			servers = append(servers, s)
+		case "grpc.client":
+			clients = append(clients, s)
+		}
+	}
+	assert.Len(servers, 2)
+	assert.Len(clients, 2)
+	for _, s := range append(servers, clients...) {
+		assert.Equal(span.Context().TraceID(), s.TraceID())
+		assert.Equal("/grpc.Fixture/Ping", s.Tag(ext.ResourceName))
+		assert.Equal(ext.AppTypeRPC, s.Tag(ext.SpanType))
+		if s.Tag(tagCode) == codes.OK.String() {
+			assert.Nil(s.Tag(ext.Error))
+			assert.True(s.Tag(tagBytesSent).(int64) > 0)
+			assert.True(s.Tag(tagBytesReceived).(int64) > 0)
+		} else {
+			assert.Equal(codes.InvalidArgument.String(), s.Tag(tagCode))
+			assert.NotNil(s.Tag(ext.Error))
+		}
+	}
+	for _, s := range servers {
+		assert.Equal("grpc", s.Tag(ext.ServiceName))
+	}
+	for _, s := range clients {
+		assert.Equal("grpc-client", s.Tag(ext.ServiceName))
+		assert.Equal("127.0.0.1", s.Tag(ext.TargetHost))
+		assert.Equal(port, s.Tag(ext.TargetPort))
+	}
+}
@@ -4,4 +4,40 @@ package grpc
 const (
 	tagMethod = "grpc.method"
 	tagCode   = "grpc.code"
+
+	// tagMessageIndex holds the position of a message within the stream,
+	// counted separately for sent and received messages.
+	tagMessageIndex = "grpc.message.index"
+
+	// tagMessageDirection holds whether a message was sent or received.
+	tagMessageDirection = "grpc.message.direction"
+
+	// tagMetadataPrefix prefixes the tags holding incoming metadata values
+	// selected using WithMetadataTags.
+	tagMetadataPrefix = "grpc.metadata."
+
+	// tagBytesSent and tagBytesReceived hold the total payload size of the
+	// messages sent and received during an RPC, as reported to stats handlers.
+	tagBytesSent     = "grpc.bytes_sent"
+	tagBytesReceived = "grpc.bytes_received"
+
+	// Tags set on server spans when using WithPeerTags.
+	tagPeerAddress = "grpc.peer.address"
+	tagPeerPort    = "grpc.peer.port"
+	tagDeadline    = "grpc.request.deadline_ms"
+
+	// tagRequestSize and tagResponseSize hold the encoded size of the request
+	// and response messages, summed over streams, when using WithMessageSizes.
+	tagRequestSize  = "grpc.request.size"
+	tagResponseSize = "grpc.response.size"
+
+	// tagErrorDetails holds the JSON encoded details of the status of failed
+	// calls when using WithErrorDetails.
+	tagErrorDetails = "error.details"
+)
+
+// Values of the tagMessageDirection tag.
+const (
+	messageDirectionSend    = "send"
+	messageDirectionReceive = "receive"
 )
@@ -3,6 +3,8 @@ package grpcutil
 import (
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc/metadata"
 )
@@ -55,3 +57,48 @@ func TestMDCarrierForeachKey(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, want, got)
 }
+
+func TestMDCarrierPropagation(t *testing.T) {
+	p := tracer.NewPropagator(nil)
+
+	t.Run("max-uint64", func(t *testing.T) {
+		assert := assert.New(t)
+		md := metadata.Pairs(
+			tracer.DefaultTraceIDHeader, "18446744073709551615",
+			tracer.DefaultParentIDHeader, "18446744073709551614",
+		)
+		sctx, err := p.Extract(MDCarrier(md))
+		assert.NoError(err)
+		assert.Equal(uint64(18446744073709551615), sctx.TraceID())
+		assert.Equal(uint64(18446744073709551614), sctx.SpanID())
+
+		out := metadata.MD{}
+		assert.NoError(p.Inject(sctx, MDCarrier(out)))
+		assert.Equal([]string{"18446744073709551615"}, out[tracer.DefaultTraceIDHeader])
+		assert.Equal([]string{"18446744073709551614"}, out[tracer.DefaultParentIDHeader])
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		// IDs are unsigned, so that negative ones are corrupted
+		md := metadata.Pairs(
+			tracer.DefaultTraceIDHeader, "-1",
+			tracer.DefaultParentIDHeader, "2",
+		)
+		_, err := p.Extract(MDCarrier(md))
+		assert.Equal(t, tracer.ErrSpanContextCorrupted, err)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		md := metadata.Pairs(
+			tracer.DefaultTraceIDHeader, "abc",
+			tracer.DefaultParentIDHeader, "2",
+		)
+		_, err := p.Extract(MDCarrier(md))
+		assert.Equal(t, tracer.ErrSpanContextCorrupted, err)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := p.Extract(MDCarrier(metadata.MD{}))
+		assert.Equal(t, tracer.ErrSpanContextNotFound, err)
+	})
+}
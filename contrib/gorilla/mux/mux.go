@@ -1,4 +1,6 @@
 // Package mux provides tracing functions for tracing the gorilla/mux package (https://github.com/gorilla/mux).
+//
+// It supports gorilla/mux v1.5.0 or later.
 package mux // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
 
 import (
@@ -81,12 +83,19 @@ func NewRouter(opts ...RouterOption) *Router {
 // ServeHTTP dispatches the request to the handler
 // whose pattern most closely matches the request URL.
 // We only need to rewrite this function to be able to trace
-// all the incoming requests to the underlying multiplexer
+// all the incoming requests to the underlying multiplexer.
+// The resource of the spans is the method of the request followed
+// by the path template of the matched route, such as "GET /players/{id}",
+// or by the path of the request if no route matched it.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.config.ignoreRequest != nil && r.config.ignoreRequest(req) {
+		r.Router.ServeHTTP(w, req)
+		return
+	}
 	var (
 		match    mux.RouteMatch
 		spanopts []ddtrace.StartSpanOption
-		route    = "unknown"
+		route    = req.URL.Path
 	)
 	// get the resource associated to this request
 	if r.Match(req, &match) && match.Route != nil {
@@ -32,13 +32,13 @@ func TestHttpTracer(t *testing.T) {
 			code:         http.StatusNotFound,
 			method:       "GET",
 			url:          "/not_a_real_route",
-			resourceName: "GET unknown",
+			resourceName: "GET /not_a_real_route",
 		},
 		{
 			code:         http.StatusMethodNotAllowed,
 			method:       "POST",
 			url:          "/405",
-			resourceName: "POST unknown",
+			resourceName: "POST /405",
 		},
 		{
 			code:         http.StatusInternalServerError,
@@ -47,8 +47,26 @@ func TestHttpTracer(t *testing.T) {
 			resourceName: "GET /500",
 			errorStr:     "500: Internal Server Error",
 		},
+		{
+			code:         http.StatusOK,
+			method:       "GET",
+			url:          "/players/6ac3fd",
+			resourceName: "GET /players/{id}",
+		},
+		{
+			code:         http.StatusOK,
+			method:       "GET",
+			url:          "/api/teams/42/players",
+			resourceName: "GET /api/teams/{team}/players",
+		},
+		{
+			code:         http.StatusNotFound,
+			method:       "GET",
+			url:          "/api/not_a_real_route",
+			resourceName: "GET /api/not_a_real_route",
+		},
 	} {
-		t.Run(http.StatusText(ht.code), func(t *testing.T) {
+		t.Run(ht.url, func(t *testing.T) {
 			assert := assert.New(t)
 			mt := mocktracer.Start()
 			defer mt.Stop()
@@ -108,6 +126,44 @@ func TestSpanOptions(t *testing.T) {
 	assert.Equal(2, spans[0].Tag(ext.SamplingPriority))
 }
 
+func TestIgnoreRequest(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	mux := NewRouter(WithIgnoreRequest(func(r *http.Request) bool {
+		return r.URL.Path == "/health"
+	}))
+	mux.Handle("/health", okHandler())
+	mux.Handle("/200", okHandler())
+	for _, url := range []string{"/health", "/200"} {
+		r := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		assert.Equal(http.StatusOK, w.Code)
+	}
+
+	spans := mt.FinishedSpans()
+	assert.Equal(1, len(spans))
+	assert.Equal("GET /200", spans[0].Tag(ext.ResourceName))
+}
+
+func TestNoNotFoundHandler(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	mux := NewRouter()
+	mux.Handle("/200", okHandler())
+	r := httptest.NewRequest("GET", "/players/6ac3fd", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Equal(1, len(spans))
+	assert.Equal("GET /players/6ac3fd", spans[0].Tag(ext.ResourceName))
+	assert.Equal("404", spans[0].Tag(ext.HTTPCode))
+}
+
 // TestImplementingMethods is a regression tests asserting that all the mux.Router methods
 // returning the router will return the modified traced version of it and not the original
 // router.
@@ -123,6 +179,9 @@ func router() http.Handler {
 	mux.Handle("/200", okHandler())
 	mux.Handle("/500", errorHandler(http.StatusInternalServerError))
 	mux.Handle("/405", okHandler()).Methods("GET")
+	mux.Handle("/players/{id}", okHandler())
+	api := mux.PathPrefix("/api").Subrouter()
+	api.Handle("/teams/{team}/players", okHandler())
 	mux.NotFoundHandler = errorHandler(http.StatusNotFound)
 	mux.MethodNotAllowedHandler = errorHandler(http.StatusMethodNotAllowed)
 	return mux
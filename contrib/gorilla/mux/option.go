@@ -1,10 +1,15 @@
 package mux
 
-import "gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+import (
+	"net/http"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
 
 type routerConfig struct {
-	serviceName string
-	spanOpts    []ddtrace.StartSpanOption // additional span options to be applied
+	serviceName   string
+	spanOpts      []ddtrace.StartSpanOption // additional span options to be applied
+	ignoreRequest func(*http.Request) bool  // reports whether a request should not be traced
 }
 
 // RouterOption represents an option that can be passed to NewRouter.
@@ -28,3 +33,11 @@ func WithSpanOptions(opts ...ddtrace.StartSpanOption) RouterOption {
 		cfg.spanOpts = opts
 	}
 }
+
+// WithIgnoreRequest specifies a function which reports whether the given request
+// should not be traced, such as the requests of health checks.
+func WithIgnoreRequest(fn func(r *http.Request) bool) RouterOption {
+	return func(cfg *routerConfig) {
+		cfg.ignoreRequest = fn
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql/quantize"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -185,7 +186,7 @@ func testExec(cfg *Config) func(*testing.T) {
 
 		var span mocktracer.Span
 		for _, s := range spans {
-			if s.OperationName() == cfg.ExpectName && s.Tag(ext.ResourceName) == query {
+			if s.OperationName() == cfg.ExpectName && s.Tag(ext.ResourceName) == quantize.SQL(query) {
 				span = s
 			}
 		}
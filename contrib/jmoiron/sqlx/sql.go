@@ -1,6 +1,7 @@
 // Package sqlx provides functions to trace the jmoiron/sqlx package (https://github.com/jmoiron/sqlx).
-// To enable tracing, first use one of the "Register*" functions to register the sql driver that
-// you will be using, then continue using the package as you normally would.
+// To enable tracing, open databases using the functions of this package, then continue using the
+// package as you normally would. The sql driver that you will be using is registered with the
+// database/sql integration the first time it is opened, if it was not already using its Register.
 //
 // For more information on registering and why this needs to happen, please check the
 // github.com/DataDog/dd-trace-go/contrib/database/sql package.
@@ -8,37 +9,63 @@
 package sqlx // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/jmoiron/sqlx"
 
 import (
+	"database/sql"
+
 	sqltraced "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// register registers the driver named driverName with the database/sql integration, unless it
+// already is, finding it by opening the data source with database/sql, which does not connect
+// to the database. Concurrent calls register it once, as Register has no effect afterwards.
+func register(driverName, dataSourceName string, opts ...sqltraced.RegisterOption) error {
+	if sqltraced.Registered(driverName) {
+		return nil
+	}
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	sqltraced.Register(driverName, db.Driver(), opts...)
+	return nil
+}
+
 // Open opens a new (traced) connection to the database using the given driver and source.
-// Note that the driver must formerly be registered using database/sql integration's Register.
-func Open(driverName, dataSourceName string) (*sqlx.DB, error) {
+// The options are passed to the database/sql integration's Register, unless the driver was
+// formerly registered.
+func Open(driverName, dataSourceName string, opts ...sqltraced.RegisterOption) (*sqlx.DB, error) {
+	if err := register(driverName, dataSourceName, opts...); err != nil {
+		return nil, err
+	}
 	db, err := sqltraced.Open(driverName, dataSourceName)
 	if err != nil {
 		return nil, err
 	}
-	return sqlx.NewDb(db, driverName), nil
+	return NewDb(db, driverName), nil
+}
+
+// NewDb returns a new sqlx DB wrapper for a pre-existing *sql.DB. The calls made through it are
+// traced if db was opened using the database/sql integration, such as with its Open function.
+func NewDb(db *sql.DB, driverName string) *sqlx.DB {
+	return sqlx.NewDb(db, driverName)
 }
 
 // MustOpen is the same as Open, but panics on error.
-// To get tracing, the driver must be formerly registered using the database/sql integration's
-// Register.
-func MustOpen(driverName, dataSourceName string) (*sqlx.DB, error) {
-	db, err := sqltraced.Open(driverName, dataSourceName)
+func MustOpen(driverName, dataSourceName string, opts ...sqltraced.RegisterOption) (*sqlx.DB, error) {
+	db, err := Open(driverName, dataSourceName, opts...)
 	if err != nil {
 		panic(err)
 	}
-	return sqlx.NewDb(db, driverName), nil
+	return db, nil
 }
 
 // Connect connects to the data source using the given driver.
-// To get tracing, the driver must be formerly registered using the database/sql integration's
-// Register.
-func Connect(driverName, dataSourceName string) (*sqlx.DB, error) {
-	db, err := Open(driverName, dataSourceName)
+// The options are passed to the database/sql integration's Register, unless the driver was
+// formerly registered.
+func Connect(driverName, dataSourceName string, opts ...sqltraced.RegisterOption) (*sqlx.DB, error) {
+	db, err := Open(driverName, dataSourceName, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -51,10 +78,10 @@ func Connect(driverName, dataSourceName string) (*sqlx.DB, error) {
 }
 
 // MustConnect connects to a database and panics on error.
-// To get tracing, the driver must be formerly registered using the database/sql integration's
-// Register.
-func MustConnect(driverName, dataSourceName string) *sqlx.DB {
-	db, err := Connect(driverName, dataSourceName)
+// The options are passed to the database/sql integration's Register, unless the driver was
+// formerly registered.
+func MustConnect(driverName, dataSourceName string, opts ...sqltraced.RegisterOption) *sqlx.DB {
+	db, err := Connect(driverName, dataSourceName, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,163 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+
+	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	sql.Register("fakesqlx", fakeDriver{})
+	sql.Register("fakesqlx-concurrent", fakeDriver{})
+}
+
+// fakeDriver is a driver whose queries all return the same single user,
+// without preparing statements.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("statements are not supported")
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions are not supported") }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct{ done bool }
+
+func (*fakeRows) Columns() []string { return []string{"id", "name"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	dest[1] = "gopher"
+	return nil
+}
+
+type user struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestCalls(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	// the driver is not registered with the database/sql integration beforehand
+	db, err := Open("fakesqlx", "", sqltrace.WithServiceName("fake-db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	var u user
+	assert.NoError(db.GetContext(ctx, &u, "SELECT id, name FROM users WHERE id = ?", 1))
+	assert.Equal(user{ID: 1, Name: "gopher"}, u)
+	var users []user
+	assert.NoError(db.SelectContext(ctx, &users, "SELECT id, name FROM users"))
+	assert.Equal([]user{{ID: 1, Name: "gopher"}}, users)
+	_, err = db.NamedExecContext(ctx, "UPDATE users SET name = :name WHERE id = :id", u)
+	assert.NoError(err)
+	parent.Finish()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 4)
+	for i, resource := range []string{
+		"SELECT id, name FROM users WHERE id = ?",
+		"SELECT id, name FROM users",
+		"UPDATE users SET name = ? WHERE id = ?",
+	} {
+		s := spans[i]
+		assert.Equal("fakesqlx.query", s.OperationName())
+		assert.Equal("fake-db", s.Tag(ext.ServiceName))
+		assert.Equal(ext.SpanTypeSQL, s.Tag(ext.SpanType))
+		assert.Equal(resource, s.Tag(ext.ResourceName))
+		assert.Equal(parent.Context().SpanID(), s.ParentID())
+	}
+}
+
+func TestNewDb(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	sqltrace.Register("fakesqlx-newdb", fakeDriver{})
+	sdb, err := sqltrace.Open("fakesqlx-newdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewDb(sdb, "fakesqlx-newdb")
+	defer db.Close()
+
+	parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	var u user
+	assert.NoError(db.GetContext(ctx, &u, "SELECT id, name FROM users WHERE id = ?", 1))
+	assert.Equal(user{ID: 1, Name: "gopher"}, u)
+	parent.Finish()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("fakesqlx-newdb.query", spans[0].OperationName())
+	assert.Equal(parent.Context().SpanID(), spans[0].ParentID())
+}
+
+func TestOpenRegistered(t *testing.T) {
+	// the driver is only known to the database/sql integration, so that
+	// finding it by name would fail
+	sqltrace.Register("fakesqlx-traced", fakeDriver{})
+	db, err := Open("fakesqlx-traced", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	assert.NoError(t, db.Ping())
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	_, err := Open("unknown", "")
+	assert.Error(t, err)
+}
+
+func TestOpenConcurrent(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := Open("fakesqlx-concurrent", "")
+			if assert.NoError(t, err) {
+				db.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,16 +1,23 @@
 // Package httprouter provides functions to trace the julienschmidt/httprouter package (https://github.com/julienschmidt/httprouter).
+//
+// It supports julienschmidt/httprouter v1.1.0 or later.
 package httprouter // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/julienschmidt/httprouter"
 
 import (
 	"net/http"
-	"strings"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/httputil"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// Router is a traced version of httprouter.Router.
+// Router is a traced version of httprouter.Router. The resources of its spans
+// are the method of the requests followed by the pattern of the matched route,
+// such as "GET /api/users/:id", or by the path of the requests if no route
+// matched them. Only the routes registered through the methods of Router, and
+// not those of the embedded httprouter.Router, have their pattern known.
 type Router struct {
 	*httprouter.Router
 	config *routerConfig
@@ -28,12 +35,70 @@ func New(opts ...RouterOption) *Router {
 
 // ServeHTTP implements http.Handler.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// get the resource associated to this request
-	route := req.URL.Path
-	_, ps, _ := r.Router.Lookup(req.Method, route)
-	for _, param := range ps {
-		route = strings.Replace(route, param.Value, ":"+param.Key, 1)
-	}
-	resource := req.Method + " " + route
+	// the resource is replaced by the route pattern once a route matched, the
+	// path is kept for the requests served by the NotFound, MethodNotAllowed
+	// and PanicHandler handlers of the router
+	resource := req.Method + " " + req.URL.Path
 	httputil.TraceAndServe(r.Router, w, req, r.config.serviceName, resource)
 }
+
+// Handle registers a new request handle with the given path and method.
+func (r *Router) Handle(method, path string, handle httprouter.Handle) {
+	resource := method + " " + path
+	r.Router.Handle(method, path, func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		r.tagRoute(req, resource, ps)
+		handle(w, req, ps)
+	})
+}
+
+// Handler registers the http.Handler handler as a request handle with the given
+// path and method. The params of its routes are never added to the spans.
+func (r *Router) Handler(method, path string, handler http.Handler) {
+	resource := method + " " + path
+	r.Router.Handler(method, path, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.tagRoute(req, resource, nil)
+		handler.ServeHTTP(w, req)
+	}))
+}
+
+// HandlerFunc registers the http.HandlerFunc handler as a request handle with
+// the given path and method. The params of its routes are never added to the spans.
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handler(method, path, handler)
+}
+
+// GET is a shortcut for r.Handle("GET", path, handle).
+func (r *Router) GET(path string, handle httprouter.Handle) { r.Handle("GET", path, handle) }
+
+// HEAD is a shortcut for r.Handle("HEAD", path, handle).
+func (r *Router) HEAD(path string, handle httprouter.Handle) { r.Handle("HEAD", path, handle) }
+
+// OPTIONS is a shortcut for r.Handle("OPTIONS", path, handle).
+func (r *Router) OPTIONS(path string, handle httprouter.Handle) { r.Handle("OPTIONS", path, handle) }
+
+// POST is a shortcut for r.Handle("POST", path, handle).
+func (r *Router) POST(path string, handle httprouter.Handle) { r.Handle("POST", path, handle) }
+
+// PUT is a shortcut for r.Handle("PUT", path, handle).
+func (r *Router) PUT(path string, handle httprouter.Handle) { r.Handle("PUT", path, handle) }
+
+// PATCH is a shortcut for r.Handle("PATCH", path, handle).
+func (r *Router) PATCH(path string, handle httprouter.Handle) { r.Handle("PATCH", path, handle) }
+
+// DELETE is a shortcut for r.Handle("DELETE", path, handle).
+func (r *Router) DELETE(path string, handle httprouter.Handle) { r.Handle("DELETE", path, handle) }
+
+// tagRoute sets the resource of the span serving req to the one of its matched
+// route, adding the params of the route as tags if the router was configured to.
+func (r *Router) tagRoute(req *http.Request, resource string, ps httprouter.Params) {
+	span, ok := tracer.SpanFromContext(req.Context())
+	if !ok {
+		return
+	}
+	span.SetTag(ext.ResourceName, resource)
+	if r.config.paramTags {
+		for _, p := range ps {
+			span.SetTag(paramTagPrefix+p.Key, p.Value)
+		}
+	}
+}
@@ -64,10 +64,98 @@ func TestHttpTracer500(t *testing.T) {
 	assert.Equal("500: Internal Server Error", s.Tag(ext.Error).(error).Error())
 }
 
+func TestRoutePattern(t *testing.T) {
+	for _, tt := range []struct {
+		url, resource string
+		code          int
+	}{
+		{url: "/api/users/1", resource: "GET /api/users/:id", code: 200},
+		{url: "/api/v1/users/1", resource: "GET /api/v1/users/:id", code: 200},
+		{url: "/files/a/b.txt", resource: "GET /files/*filepath", code: 200},
+		{url: "/handler/42", resource: "GET /handler/:n", code: 200},
+		{url: "/not_found/42", resource: "GET /not_found/42", code: 404},
+		{url: "/panic", resource: "GET /panic", code: 500},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			assert := assert.New(t)
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			r := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			router().ServeHTTP(w, r)
+			assert.Equal(tt.code, w.Code)
+
+			spans := mt.FinishedSpans()
+			assert.Equal(1, len(spans))
+			assert.Equal(tt.resource, spans[0].Tag(ext.ResourceName))
+			assert.Equal(tt.url, spans[0].Tag(ext.HTTPURL))
+			assert.Nil(spans[0].Tag(paramTagPrefix + "id"))
+		})
+	}
+}
+
+func TestParamTags(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := New(WithParamTags())
+	router.GET("/api/users/:id/posts/:post", handler200)
+	r := httptest.NewRequest("GET", "/api/users/1/posts/2", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	spans := mt.FinishedSpans()
+	assert.Equal(1, len(spans))
+	assert.Equal("GET /api/users/:id/posts/:post", spans[0].Tag(ext.ResourceName))
+	assert.Equal("1", spans[0].Tag("httprouter.param.id"))
+	assert.Equal("2", spans[0].Tag("httprouter.param.post"))
+}
+
+func BenchmarkRouter(b *testing.B) {
+	// the tracer is not started, so that only the overhead of the
+	// router is measured, and not the one of sending spans
+	for name, h := range map[string]http.Handler{
+		"untraced": func() http.Handler {
+			router := httprouter.New()
+			router.GET("/api/users/:id", handler200)
+			return router
+		}(),
+		"traced": func() http.Handler {
+			router := New()
+			router.GET("/api/users/:id", handler200)
+			return router
+		}(),
+	} {
+		b.Run(name, func(b *testing.B) {
+			r := httptest.NewRequest("GET", "/api/users/1", nil)
+			w := httptest.NewRecorder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
 func router() http.Handler {
 	router := New(WithServiceName("my-service"))
 	router.GET("/200", handler200)
 	router.GET("/500", handler500)
+	router.GET("/api/users/:id", handler200)
+	router.GET("/api/v1/users/:id", handler200)
+	router.GET("/files/*filepath", handler200)
+	router.HandlerFunc("GET", "/handler/:n", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK\n"))
+	})
+	router.GET("/panic", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		panic("boom")
+	})
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, _ interface{}) {
+		http.Error(w, "panic!", http.StatusInternalServerError)
+	}
 	return router
 }
 
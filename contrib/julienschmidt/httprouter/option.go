@@ -1,6 +1,12 @@
 package httprouter
 
-type routerConfig struct{ serviceName string }
+// paramTagPrefix prefixes the keys of the route params added as tags to spans.
+const paramTagPrefix = "httprouter.param."
+
+type routerConfig struct {
+	serviceName string
+	paramTags   bool // whether to add the route params to the spans
+}
 
 // RouterOption represents an option that can be passed to New.
 type RouterOption func(*routerConfig)
@@ -15,3 +21,12 @@ func WithServiceName(name string) RouterOption {
 		cfg.serviceName = name
 	}
 }
+
+// WithParamTags adds the params of the matched routes to the spans, as tags
+// named "httprouter.param.<name>". As the values of params are often user
+// input or identifiers, they are not added by default.
+func WithParamTags() RouterOption {
+	return func(cfg *routerConfig) {
+		cfg.paramTags = true
+	}
+}
@@ -0,0 +1,76 @@
+// Package echo provides functions to trace the labstack/echo package (https://github.com/labstack/echo).
+//
+// It supports labstack/echo v3.1.0 or later.
+package echo // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/labstack/echo"
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/labstack/echo"
+)
+
+// Middleware returns echo middleware which traces incoming requests. The
+// resource of the spans is the method of the requests followed by their
+// registered route, such as "GET /users/:id", or by their path if no route
+// matched them. Errors returned by handlers, using the code of those of type
+// *echo.HTTPError as status, mark the spans as errors if their status does.
+func Middleware(opts ...Option) echo.MiddlewareFunc {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			if cfg.ignoreRequest != nil && cfg.ignoreRequest(c) {
+				return next(c)
+			}
+			route := c.Path()
+			if route == "" {
+				route = request.URL.Path
+			}
+			spanopts := append([]ddtrace.StartSpanOption{
+				tracer.ServiceName(cfg.serviceName),
+				tracer.ResourceName(request.Method + " " + route),
+				tracer.SpanType(ext.SpanTypeWeb),
+				tracer.Tag(ext.HTTPMethod, request.Method),
+				tracer.Tag(ext.HTTPURL, request.URL.Path),
+			}, cfg.spanOpts...)
+			if spanctx, err := tracer.Extract(tracer.HTTPHeadersCarrier(request.Header)); err == nil {
+				spanopts = append(spanopts, tracer.ChildOf(spanctx))
+			}
+			span, ctx := tracer.StartSpanFromContext(request.Context(), "http.request", spanopts...)
+			defer span.Finish()
+
+			// pass the span through the request context
+			c.SetRequest(request.WithContext(ctx))
+
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				// returned errors are only written by the error handler of echo
+				// once all middleware returned, so the response does not hold
+				// their status yet
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			span.SetTag(ext.HTTPCode, strconv.Itoa(status))
+			if cfg.isStatusError(status) {
+				if err == nil {
+					err = fmt.Errorf("%d: %s", status, http.StatusText(status))
+				}
+				span.SetTag(ext.Error, err)
+			}
+			return err
+		}
+	}
+}
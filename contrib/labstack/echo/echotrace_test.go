@@ -0,0 +1,178 @@
+package echo
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace200(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := echo.New()
+	router.Use(Middleware(WithServiceName("foobar")))
+	router.GET("/user/:id", func(c echo.Context) error {
+		_, ok := tracer.SpanFromContext(c.Request().Context())
+		assert.True(ok)
+		return c.String(200, c.Param("id"))
+	})
+	r := httptest.NewRequest("GET", "/user/123", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(200, w.Code)
+	assert.Equal("123", w.Body.String())
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	span := spans[0]
+	assert.Equal("http.request", span.OperationName())
+	assert.Equal(ext.SpanTypeWeb, span.Tag(ext.SpanType))
+	assert.Equal("foobar", span.Tag(ext.ServiceName))
+	assert.Equal("GET /user/:id", span.Tag(ext.ResourceName))
+	assert.Equal("200", span.Tag(ext.HTTPCode))
+	assert.Equal("GET", span.Tag(ext.HTTPMethod))
+	assert.Equal("/user/123", span.Tag(ext.HTTPURL))
+	assert.Nil(span.Tag(ext.Error))
+}
+
+func TestErrors(t *testing.T) {
+	wantErr := errors.New("oh no")
+	for _, tt := range []struct {
+		name    string
+		handler echo.HandlerFunc
+		opts    []Option
+		code    int
+		err     string
+	}{
+		{
+			name:    "error",
+			handler: func(c echo.Context) error { return wantErr },
+			code:    500,
+			err:     "oh no",
+		},
+		{
+			name:    "http-error",
+			handler: func(c echo.Context) error { return echo.NewHTTPError(503, "unavailable") },
+			code:    503,
+			err:     echo.NewHTTPError(503, "unavailable").Error(),
+		},
+		{
+			name:    "not-found",
+			handler: func(c echo.Context) error { return echo.ErrNotFound },
+			code:    404,
+		},
+		{
+			name:    "not-found-error",
+			handler: func(c echo.Context) error { return echo.ErrNotFound },
+			opts: []Option{WithStatusCheck(func(status int) bool {
+				return status >= 400
+			})},
+			code: 404,
+			err:  echo.ErrNotFound.Error(),
+		},
+		{
+			name:    "written",
+			handler: func(c echo.Context) error { return c.String(502, "bad gateway") },
+			code:    502,
+			err:     "502: Bad Gateway",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			router := echo.New()
+			router.Use(Middleware(tt.opts...))
+			router.GET("/err", tt.handler)
+			r := httptest.NewRequest("GET", "/err", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(tt.code, w.Code)
+
+			spans := mt.FinishedSpans()
+			assert.Len(spans, 1)
+			span := spans[0]
+			assert.Equal(strconv.Itoa(tt.code), span.Tag(ext.HTTPCode))
+			if tt.err == "" {
+				assert.Nil(span.Tag(ext.Error))
+			} else {
+				assert.Equal(tt.err, span.Tag(ext.Error).(error).Error())
+			}
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := echo.New()
+	router.Use(Middleware())
+	r := httptest.NewRequest("GET", "/not_a_real_route", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(404, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("echo", spans[0].Tag(ext.ServiceName))
+	assert.Equal("404", spans[0].Tag(ext.HTTPCode))
+	assert.Nil(spans[0].Tag(ext.Error))
+}
+
+func TestPropagation(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	r := httptest.NewRequest("GET", "/user/123", nil)
+	w := httptest.NewRecorder()
+
+	pspan := tracer.StartSpan("test")
+	tracer.Inject(pspan.Context(), tracer.HTTPHeadersCarrier(r.Header))
+
+	router := echo.New()
+	router.Use(Middleware())
+	router.GET("/user/:id", func(c echo.Context) error {
+		span, ok := tracer.SpanFromContext(c.Request().Context())
+		assert.True(ok)
+		assert.Equal(span.(mocktracer.Span).ParentID(), pspan.(mocktracer.Span).SpanID())
+		return nil
+	})
+	router.ServeHTTP(w, r)
+}
+
+func TestIgnoreRequest(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	router := echo.New()
+	router.Use(Middleware(WithIgnoreRequest(func(c echo.Context) bool {
+		return c.Path() == "/health"
+	})))
+	router.GET("/health", func(c echo.Context) error { return c.NoContent(200) })
+	router.GET("/200", func(c echo.Context) error { return c.NoContent(200) })
+	for _, url := range []string{"/health", "/200"} {
+		r := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(200, w.Code)
+	}
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("GET /200", spans[0].Tag(ext.ResourceName))
+}
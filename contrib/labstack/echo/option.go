@@ -0,0 +1,59 @@
+package echo
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+
+	"github.com/labstack/echo"
+)
+
+type config struct {
+	serviceName   string
+	spanOpts      []ddtrace.StartSpanOption // additional span options to be applied
+	ignoreRequest func(c echo.Context) bool // reports whether a request should not be traced
+	isStatusError func(status int) bool     // reports whether a status marks a span as an error
+}
+
+// Option represents an option that can be passed to Middleware.
+type Option func(*config)
+
+func defaults(cfg *config) {
+	cfg.serviceName = "echo"
+	cfg.isStatusError = isServerError
+}
+
+// isServerError reports whether status is the one of a server error.
+func isServerError(status int) bool {
+	return status >= 500 && status < 600
+}
+
+// WithServiceName sets the given service name for the spans of the middleware.
+func WithServiceName(name string) Option {
+	return func(cfg *config) {
+		cfg.serviceName = name
+	}
+}
+
+// WithSpanOptions applies the given set of options to the spans started
+// by the middleware.
+func WithSpanOptions(opts ...ddtrace.StartSpanOption) Option {
+	return func(cfg *config) {
+		cfg.spanOpts = opts
+	}
+}
+
+// WithIgnoreRequest specifies a function which reports whether the request of
+// c should not be traced, such as the requests of health checks.
+func WithIgnoreRequest(fn func(c echo.Context) bool) Option {
+	return func(cfg *config) {
+		cfg.ignoreRequest = fn
+	}
+}
+
+// WithStatusCheck specifies a function which reports whether the given status
+// of a response, or the code of an *echo.HTTPError returned by a handler, marks
+// its span as an error. By default, only 5xx statuses do.
+func WithStatusCheck(fn func(status int) bool) Option {
+	return func(cfg *config) {
+		cfg.isStatusError = fn
+	}
+}
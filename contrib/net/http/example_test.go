@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 func Example() {
@@ -21,3 +22,14 @@ func Example_withServiceName() {
 	})
 	http.ListenAndServe(":8080", mux)
 }
+
+func ExampleWrapHandler() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// child spans can be started from the span of the request
+		span, _ := tracer.StartSpanFromContext(r.Context(), "users.lookup")
+		defer span.Finish()
+		w.Write([]byte("Hello World!\n"))
+	})
+	http.Handle("/users", httptrace.WrapHandler(handler, "my-service", "GET /users"))
+	http.ListenAndServe(":8080", nil)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/httputil"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 )
 
 // ServeMux is an HTTP request multiplexer that traces all the incoming requests.
@@ -39,8 +40,23 @@ func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // WrapHandler wraps an http.Handler with tracing using the given service and resource.
-func WrapHandler(h http.Handler, service, resource string) http.Handler {
+func WrapHandler(h http.Handler, service, resource string, opts ...Option) http.Handler {
+	cfg := new(config)
+	for _, fn := range opts {
+		fn(cfg)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		httputil.TraceAndServe(h, w, req, service, resource)
+		httputil.TraceAndServe(h, w, req, service, resource, cfg.spanOpts...)
 	})
 }
+
+// TraceAndServe serves the request r using h, tracing it as a web request of
+// the given service and resource. The span is tagged with the method, the path
+// and the status code of the request, it is marked as an error on 5xx status
+// codes, and it continues the distributed trace found in the request headers,
+// if any. It is made available to h through the context of the request, so
+// that child spans can be started from it. The given span options are applied
+// to it.
+func TraceAndServe(h http.Handler, w http.ResponseWriter, r *http.Request, service, resource string, spanOpts ...ddtrace.StartSpanOption) {
+	httputil.TraceAndServe(h, w, r, service, resource, spanOpts...)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 func TestHttpTracer200(t *testing.T) {
@@ -104,3 +105,57 @@ func handler200(w http.ResponseWriter, r *http.Request) {
 func handler500(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "500!", http.StatusInternalServerError)
 }
+
+func TestWrapHandlerOptions(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	assert := assert.New(t)
+
+	handler := WrapHandler(http.HandlerFunc(handler500), "my-service", "my-resource",
+		WithSpanOptions(tracer.Tag("team", "payments")))
+	r := httptest.NewRequest("POST", "/charge?amount=10", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(500, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	s := spans[0]
+	assert.Equal("payments", s.Tag("team"))
+	assert.Equal("POST", s.Tag(ext.HTTPMethod))
+	assert.Equal("/charge", s.Tag(ext.HTTPURL))
+	assert.Equal("500", s.Tag(ext.HTTPCode))
+	assert.Equal(ext.SpanTypeWeb, s.Tag(ext.SpanType))
+	assert.Equal("500: Internal Server Error", s.Tag(ext.Error).(error).Error())
+}
+
+func TestTraceAndServe(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	assert := assert.New(t)
+
+	parent := tracer.StartSpan("client.request")
+	r := httptest.NewRequest("GET", "/users", nil)
+	err := tracer.Inject(parent.Context(), tracer.HTTPHeadersCarrier(r.Header))
+	assert.NoError(err)
+	w := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		child, _ := tracer.StartSpanFromContext(r.Context(), "db.query")
+		child.Finish()
+		w.WriteHeader(http.StatusNotFound)
+	})
+	TraceAndServe(handler, w, r, "my-service", "GET /users")
+	parent.Finish()
+	assert.Equal(404, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+	child, server := spans[0], spans[1]
+	assert.Equal("db.query", child.OperationName())
+	assert.Equal(server.SpanID(), child.ParentID())
+	assert.Equal("http.request", server.OperationName())
+	assert.Equal(parent.Context().TraceID(), server.TraceID())
+	assert.Equal(parent.Context().SpanID(), server.ParentID())
+	assert.Equal("404", server.Tag(ext.HTTPCode))
+	assert.Nil(server.Tag(ext.Error), "4xx status codes are not errors")
+}
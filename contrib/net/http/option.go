@@ -22,6 +22,19 @@ func WithServiceName(name string) MuxOption {
 	}
 }
 
+type config struct{ spanOpts []ddtrace.StartSpanOption }
+
+// Option represents an option that can be passed to WrapHandler.
+type Option func(*config)
+
+// WithSpanOptions sets options to apply to the spans started for the requests,
+// such as tags.
+func WithSpanOptions(opts ...ddtrace.StartSpanOption) Option {
+	return func(cfg *config) {
+		cfg.spanOpts = append(cfg.spanOpts, opts...)
+	}
+}
+
 // A RoundTripperBeforeFunc can be used to modify a span before an http
 // RoundTrip is made.
 type RoundTripperBeforeFunc func(*http.Request, ddtrace.Span)
@@ -31,8 +44,9 @@ type RoundTripperBeforeFunc func(*http.Request, ddtrace.Span)
 type RoundTripperAfterFunc func(*http.Response, ddtrace.Span)
 
 type roundTripperConfig struct {
-	before RoundTripperBeforeFunc
-	after  RoundTripperAfterFunc
+	before        RoundTripperBeforeFunc
+	after         RoundTripperAfterFunc
+	resourceNamer func(*http.Request) string
 }
 
 // A RoundTripperOption represents an option that can be passed to
@@ -54,3 +68,13 @@ func WithAfter(f RoundTripperAfterFunc) RoundTripperOption {
 		cfg.after = f
 	}
 }
+
+// WithResourceNamer sets a function returning the resource name of the span of
+// a request, such as "GET /users/:id", which should not contain any variable
+// part of its URL to keep the number of resources low. The default resource
+// name is "http.request".
+func WithResourceNamer(fn func(req *http.Request) string) RoundTripperOption {
+	return func(cfg *roundTripperConfig) {
+		cfg.resourceNamer = fn
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
@@ -19,43 +20,63 @@ type roundTripper struct {
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (res *http.Response, err error) {
-	span, _ := tracer.StartSpanFromContext(req.Context(), "http.request",
+	resource := defaultResourceName
+	if rt.cfg.resourceNamer != nil {
+		resource = rt.cfg.resourceNamer(req)
+	}
+	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeHTTP),
-		tracer.ResourceName(defaultResourceName),
+		tracer.ResourceName(resource),
 		tracer.Tag(ext.HTTPMethod, req.Method),
 		tracer.Tag(ext.HTTPURL, req.URL.Path),
-	)
+		tracer.Tag(ext.TargetHost, req.URL.Hostname()),
+	}
+	if port := req.URL.Port(); port != "" {
+		opts = append(opts, tracer.Tag(ext.TargetPort, port))
+	}
+	span, _ := tracer.StartSpanFromContext(req.Context(), "http.request", opts...)
+	var spanErr error // the error of the span, which may not be returned
 	defer func() {
 		if rt.cfg.after != nil {
 			rt.cfg.after(res, span)
 		}
-		span.Finish(tracer.WithError(err))
+		span.Finish(tracer.WithError(spanErr))
 	}()
 	if rt.cfg.before != nil {
 		rt.cfg.before(req, span)
 	}
-	// inject the span context into the http request
-	err = tracer.Inject(span.Context(), tracer.HTTPHeadersCarrier(req.Header))
-	if err != nil {
+	// RoundTrippers must not modify the request, inject the span context into
+	// the headers of a copy of it
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r2.Header[k] = append([]string(nil), v...)
+	}
+	if err := tracer.Inject(span.Context(), tracer.HTTPHeadersCarrier(r2.Header)); err != nil {
 		// this should never happen
 		fmt.Fprintf(os.Stderr, "failed to inject http headers for round tripper: %v\n", err)
 	}
-	res, err = rt.base.RoundTrip(req)
+	res, err = rt.base.RoundTrip(r2)
 	if err != nil {
 		span.SetTag("http.errors", err.Error())
+		spanErr = err
 	} else {
 		span.SetTag(ext.HTTPCode, strconv.Itoa(res.StatusCode))
-		// treat 5XX as errors
+		// treat 5XX as errors, the response is still returned to the caller
 		if res.StatusCode/100 == 5 {
 			span.SetTag("http.errors", res.Status)
-			err = errors.New(res.Status)
+			spanErr = errors.New(res.Status)
 		}
 	}
 	return res, err
 }
 
 // WrapRoundTripper returns a new RoundTripper which traces all requests sent
-// over the transport.
+// over the transport, as children of the span found in their context, if any.
+// The span context is propagated in the headers of a copy of each request, so
+// the requests of the caller are never modified. Network errors and responses
+// with a 5xx status code mark the spans as errors.
 func WrapRoundTripper(rt http.RoundTripper, opts ...RoundTripperOption) http.RoundTripper {
 	cfg := new(roundTripperConfig)
 	for _, opt := range opts {
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -56,6 +57,113 @@ func TestRoundTripper(t *testing.T) {
 	assert.Equal(t, "200", s1.Tag(ext.HTTPCode))
 	assert.Equal(t, "GET", s1.Tag(ext.HTTPMethod))
 	assert.Equal(t, "/hello/world", s1.Tag(ext.HTTPURL))
+	assert.Equal(t, "127.0.0.1", s1.Tag(ext.TargetHost))
+	assert.NotEmpty(t, s1.Tag(ext.TargetPort))
 	assert.Equal(t, true, s1.Tag("CalledBefore"))
 	assert.Equal(t, true, s1.Tag("CalledAfter"))
 }
+
+// roundTripperFunc is an http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestRoundTripperRequestUnmodified(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	var sent *http.Request
+	rt := WrapRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: 200, Status: "200 OK"}, nil
+	}))
+	req, err := http.NewRequest("GET", "http://example.com/path", nil)
+	assert.NoError(t, err)
+	req.Header.Set("X-Custom", "value")
+	_, err = rt.RoundTrip(req)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.Header{"X-Custom": []string{"value"}}, req.Header)
+	assert.NotEmpty(t, sent.Header.Get(tracer.DefaultTraceIDHeader))
+	assert.Equal(t, "value", sent.Header.Get("X-Custom"))
+}
+
+func TestRoundTripperNoContext(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rt := WrapRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Status: "200 OK"}, nil
+	}))
+	u, _ := http.NewRequest("GET", "http://example.com:8080/path", nil)
+	// a request created without a context, unlike with http.NewRequest
+	req := &http.Request{Method: "GET", URL: u.URL, Header: http.Header{}}
+	_, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "example.com", spans[0].Tag(ext.TargetHost))
+	assert.Equal(t, "8080", spans[0].Tag(ext.TargetPort))
+}
+
+func TestRoundTripperErrors(t *testing.T) {
+	t.Run("5xx", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		rt := WrapRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 503, Status: "503 Service Unavailable"}, nil
+		}))
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		res, err := rt.RoundTrip(req)
+		// the response is returned to the caller, and only the span is an error
+		assert.NoError(t, err)
+		assert.Equal(t, 503, res.StatusCode)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "503", spans[0].Tag(ext.HTTPCode))
+		assert.Equal(t, "503 Service Unavailable", spans[0].Tag("http.errors"))
+		assert.EqualError(t, spans[0].Tag(ext.Error).(error), "503 Service Unavailable")
+	})
+
+	t.Run("network", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		netErr := errors.New("connection refused")
+		rt := WrapRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, netErr
+		}))
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		_, err := rt.RoundTrip(req)
+		assert.Equal(t, netErr, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "connection refused", spans[0].Tag("http.errors"))
+		assert.Equal(t, netErr, spans[0].Tag(ext.Error))
+	})
+}
+
+func TestRoundTripperResourceNamer(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	rt := WrapRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Status: "200 OK"}, nil
+	}), WithResourceNamer(func(req *http.Request) string {
+		return req.Method + " /users/:id"
+	}))
+	req, _ := http.NewRequest("GET", "http://example.com/users/42", nil)
+	_, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /users/:id", spans[0].Tag(ext.ResourceName))
+	assert.Equal(t, "/users/42", spans[0].Tag(ext.HTTPURL))
+}
@@ -0,0 +1,21 @@
+package logrus_test
+
+import (
+	"context"
+
+	logrustrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/sirupsen/logrus"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Example() {
+	// Add the hook to the logger.
+	logrus.AddHook(&logrustrace.Hook{})
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+	defer span.Finish()
+
+	// Log entries having a span in their context are correlated with the trace.
+	logrus.WithContext(ctx).Info("handling request")
+}
@@ -0,0 +1,35 @@
+// Package logrus provides a hook for the sirupsen/logrus package (https://github.com/sirupsen/logrus),
+// which adds the IDs of the current trace and span to log entries, allowing to correlate logs and traces.
+package logrus // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/sirupsen/logrus"
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus.Hook which adds the IDs of the span found in the context of
+// log entries as the "dd.trace_id" and "dd.span_id" fields. The context is set
+// using the WithContext method of loggers and entries. Entries having no span
+// in their context are left untouched.
+type Hook struct{}
+
+var _ logrus.Hook = (*Hook)(nil)
+
+// Levels implements logrus.Hook.
+func (*Hook) Levels() []logrus.Level { return logrus.AllLevels }
+
+// Fire implements logrus.Hook.
+func (*Hook) Fire(e *logrus.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	span, ok := tracer.SpanFromContext(e.Context)
+	if !ok {
+		return nil
+	}
+	e.Data[ext.LogKeyTraceID] = span.Context().TraceID()
+	e.Data[ext.LogKeySpanID] = span.Context().SpanID()
+	return nil
+}
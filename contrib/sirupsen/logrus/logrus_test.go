@@ -0,0 +1,93 @@
+package logrus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLogger() (*logrus.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.AddHook(&Hook{})
+	return logger, &buf
+}
+
+func TestHook(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	t.Run("span", func(t *testing.T) {
+		assert := assert.New(t)
+		logger, buf := newLogger()
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		logger.WithContext(ctx).WithField("key", "value").Info("message")
+		span.Finish()
+
+		var fields map[string]interface{}
+		assert.NoError(json.Unmarshal(buf.Bytes(), &fields))
+		assert.Equal(float64(span.Context().TraceID()), fields["dd.trace_id"])
+		assert.Equal(float64(span.Context().SpanID()), fields["dd.span_id"])
+		assert.Equal("value", fields["key"])
+	})
+
+	for name, ctx := range map[string]context.Context{
+		"no-context": nil,
+		"no-span":    context.Background(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			logger, buf := newLogger()
+			entry := logrus.NewEntry(logger)
+			if ctx != nil {
+				entry = entry.WithContext(ctx)
+			}
+			entry.Info("message")
+
+			var fields map[string]interface{}
+			assert.NoError(json.Unmarshal(buf.Bytes(), &fields))
+			assert.NotContains(fields, "dd.trace_id")
+			assert.NotContains(fields, "dd.span_id")
+		})
+	}
+}
+
+func TestHookNoContextAllocs(t *testing.T) {
+	e := logrus.NewEntry(logrus.New())
+	hook := &Hook{}
+	allocs := testing.AllocsPerRun(100, func() { hook.Fire(e) })
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkHook(b *testing.B) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	hook := &Hook{}
+
+	b.Run("no-context", func(b *testing.B) {
+		e := logrus.NewEntry(logrus.New())
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			hook.Fire(e)
+		}
+	})
+
+	b.Run("span", func(b *testing.B) {
+		span, ctx := tracer.StartSpanFromContext(context.Background(), "web.request")
+		defer span.Finish()
+		e := logrus.NewEntry(logrus.New()).WithContext(ctx)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			hook.Fire(e)
+		}
+	})
+}
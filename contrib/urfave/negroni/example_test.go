@@ -0,0 +1,23 @@
+package negroni_test
+
+import (
+	"net/http"
+
+	negronitrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/urfave/negroni"
+
+	"github.com/urfave/negroni"
+)
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Hello World!\n"))
+}
+
+func Example() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+
+	n := negroni.New()
+	n.Use(negronitrace.New(negronitrace.WithServiceName("web")))
+	n.UseHandler(mux)
+	http.ListenAndServe(":8080", n)
+}
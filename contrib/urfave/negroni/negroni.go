@@ -0,0 +1,70 @@
+// Package negroni provides functions to trace the urfave/negroni package (https://github.com/urfave/negroni).
+//
+// It supports urfave/negroni v0.2.0 or later.
+package negroni // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/urfave/negroni"
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/urfave/negroni"
+)
+
+// Middleware is a negroni middleware tracing the requests it serves.
+type Middleware struct {
+	config *config
+}
+
+// New returns a new middleware tracing requests with the global tracer.
+func New(opts ...Option) *Middleware {
+	cfg := new(config)
+	defaults(cfg)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return &Middleware{config: cfg}
+}
+
+// ServeHTTP implements negroni.Handler. It serves the request using next,
+// passing it the span through the context of the request.
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if m.config.ignoreRequest != nil && m.config.ignoreRequest(r) {
+		next(w, r)
+		return
+	}
+	opts := append([]ddtrace.StartSpanOption{
+		tracer.SpanType(ext.SpanTypeWeb),
+		tracer.ServiceName(m.config.serviceName),
+		tracer.ResourceName(m.config.resourceNamer(r)),
+		tracer.Tag(ext.HTTPMethod, r.Method),
+		tracer.Tag(ext.HTTPURL, r.URL.Path),
+	}, m.config.spanOpts...)
+	if spanctx, err := tracer.Extract(tracer.HTTPHeadersCarrier(r.Header)); err == nil {
+		opts = append(opts, tracer.ChildOf(spanctx))
+	}
+	span, ctx := tracer.StartSpanFromContext(r.Context(), "http.request", opts...)
+	defer span.Finish()
+
+	// negroni hands a negroni.ResponseWriter to its middleware, which is only
+	// missing when the middleware is used on its own
+	rw, ok := w.(negroni.ResponseWriter)
+	if !ok {
+		rw = negroni.NewResponseWriter(w)
+	}
+	next(rw, r.WithContext(ctx))
+
+	status := rw.Status()
+	if status == 0 {
+		// nothing was written, which net/http responds to with a 200
+		status = http.StatusOK
+	}
+	span.SetTag(ext.HTTPCode, strconv.Itoa(status))
+	if status >= 500 && status < 600 {
+		span.SetTag(ext.Error, fmt.Errorf("%d: %s", status, http.StatusText(status)))
+	}
+}
@@ -0,0 +1,135 @@
+package negroni
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/negroni"
+)
+
+func TestMiddleware(t *testing.T) {
+	for _, ht := range []struct {
+		url, code, err string
+	}{
+		{url: "/200", code: "200"},
+		{url: "/empty", code: "200"},
+		{url: "/404", code: "404"},
+		{url: "/500", code: "500", err: "500: Internal Server Error"},
+	} {
+		t.Run(ht.url, func(t *testing.T) {
+			assert := assert.New(t)
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			r := httptest.NewRequest("GET", ht.url, nil)
+			w := httptest.NewRecorder()
+			server(New(WithServiceName("my-service"))).ServeHTTP(w, r)
+
+			spans := mt.FinishedSpans()
+			assert.Len(spans, 1)
+			s := spans[0]
+			assert.Equal("http.request", s.OperationName())
+			assert.Equal(ext.SpanTypeWeb, s.Tag(ext.SpanType))
+			assert.Equal("my-service", s.Tag(ext.ServiceName))
+			assert.Equal("GET "+ht.url, s.Tag(ext.ResourceName))
+			assert.Equal(ht.code, s.Tag(ext.HTTPCode))
+			assert.Equal("GET", s.Tag(ext.HTTPMethod))
+			assert.Equal(ht.url, s.Tag(ext.HTTPURL))
+			if ht.err == "" {
+				assert.Nil(s.Tag(ext.Error))
+			} else {
+				assert.Equal(ht.err, s.Tag(ext.Error).(error).Error())
+			}
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	r := httptest.NewRequest("GET", "/child", nil)
+	w := httptest.NewRecorder()
+	pspan := tracer.StartSpan("test")
+	tracer.Inject(pspan.Context(), tracer.HTTPHeadersCarrier(r.Header))
+	server(New()).ServeHTTP(w, r)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	// the span of the handler finishes first
+	assert.Equal("child", spans[0].OperationName())
+	assert.Equal(spans[1].SpanID(), spans[0].ParentID())
+	assert.Equal(pspan.(mocktracer.Span).SpanID(), spans[1].ParentID())
+	assert.Equal("negroni.router", spans[1].Tag(ext.ServiceName))
+}
+
+func TestOptions(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	m := New(
+		WithResourceNamer(func(r *http.Request) string {
+			return r.Method + " /users/:id"
+		}),
+		WithIgnoreRequest(func(r *http.Request) bool {
+			return r.URL.Path == "/health"
+		}),
+	)
+	for _, url := range []string{"/health", "/users/42"} {
+		r := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server(m).ServeHTTP(w, r)
+		assert.Equal(200, w.Code)
+	}
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("GET /users/:id", spans[0].Tag(ext.ResourceName))
+	assert.Equal("/users/42", spans[0].Tag(ext.HTTPURL))
+}
+
+func TestWithoutNegroni(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	r := httptest.NewRequest("GET", "/404", nil)
+	w := httptest.NewRecorder()
+	New().ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	assert.Equal(404, w.Code)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("404", spans[0].Tag(ext.HTTPCode))
+}
+
+func server(m *Middleware) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/200", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK\n"))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/500", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "500!", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/child", func(w http.ResponseWriter, r *http.Request) {
+		span, _ := tracer.StartSpanFromContext(r.Context(), "child")
+		span.Finish()
+	})
+	n := negroni.New()
+	n.Use(m)
+	n.UseHandler(mux)
+	return n
+}
@@ -0,0 +1,60 @@
+package negroni
+
+import (
+	"net/http"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
+
+type config struct {
+	serviceName   string
+	spanOpts      []ddtrace.StartSpanOption // additional span options to be applied
+	resourceNamer func(*http.Request) string
+	ignoreRequest func(*http.Request) bool // reports whether a request should not be traced
+}
+
+// Option represents an option that can be passed to New.
+type Option func(*config)
+
+func defaults(cfg *config) {
+	cfg.serviceName = "negroni.router"
+	cfg.resourceNamer = defaultResourceNamer
+}
+
+// defaultResourceNamer names resources after the method and path of requests.
+func defaultResourceNamer(r *http.Request) string {
+	return r.Method + " " + r.URL.Path
+}
+
+// WithServiceName sets the given service name for the middleware.
+func WithServiceName(name string) Option {
+	return func(cfg *config) {
+		cfg.serviceName = name
+	}
+}
+
+// WithSpanOptions applies the given set of options to the spans started
+// by the middleware.
+func WithSpanOptions(opts ...ddtrace.StartSpanOption) Option {
+	return func(cfg *config) {
+		cfg.spanOpts = opts
+	}
+}
+
+// WithResourceNamer specifies a function returning the resource name of the
+// span of the given request, such as "GET /users/:id", which should not
+// contain any variable part of its URL. By default, resources are named after
+// the method and path of requests.
+func WithResourceNamer(fn func(r *http.Request) string) Option {
+	return func(cfg *config) {
+		cfg.resourceNamer = fn
+	}
+}
+
+// WithIgnoreRequest specifies a function which reports whether the given request
+// should not be traced, such as the requests of health checks.
+func WithIgnoreRequest(fn func(r *http.Request) bool) Option {
+	return func(cfg *config) {
+		cfg.ignoreRequest = fn
+	}
+}
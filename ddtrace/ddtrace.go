@@ -34,11 +34,18 @@ type Tracer interface {
 // timestamps and other metadata. A Tracer is used to create hierarchies of
 // spans in a request, buffer and submit them to the server.
 type Span interface {
-	// SetTag sets a key/value pair as metadata on the span.
+	// SetTag sets a key/value pair as metadata on the span. Numeric and
+	// boolean values are stored as metrics, all others as strings. Setting
+	// ext.Error to an error marks the span as erroneous without finishing it,
+	// recording the error's message, type and a stack trace of the call site.
+	// Tags set once the span is finished, such as by asynchronous work which
+	// outlives it, are ignored.
 	SetTag(key string, value interface{})
 
 	// SetOperationName sets the operation name for this span. An operation name should be
 	// a representative name for a group of spans (e.g. "grpc.server" or "http.request").
+	// Like tags, it may be changed until the span is finished, e.g. by a handler once it
+	// learns more about the operation than the middleware which started the span.
 	SetOperationName(operationName string)
 
 	// BaggageItem returns the baggage item held by the given key.
@@ -88,6 +95,15 @@ type FinishConfig struct {
 	// Error holds an optional error that should be set on the span before
 	// finishing.
 	Error error
+
+	// NoDebugStack will prevent any set errors from generating an attached stack trace tag.
+	NoDebugStack bool
+
+	// StackFrames specifies the number of stack frames to be attached in spans that finish with errors.
+	StackFrames uint
+
+	// SkipStackFrames specifies the offset at which to start reporting stack frames from the stack.
+	SkipStackFrames uint
 }
 
 // StartSpanConfig holds the configuration for starting a new span. It is usually passed
@@ -105,4 +121,9 @@ type StartSpanConfig struct {
 	// Tags holds a set of key/value pairs that should be set as metadata on the
 	// new span.
 	Tags map[string]interface{}
+
+	// FollowsFrom reports that the new span follows from Parent instead of
+	// being its child: it belongs to the same trace, but is not awaited by
+	// it, such as work handed off to a background goroutine or a queue.
+	FollowsFrom bool
 }
@@ -24,6 +24,11 @@ func TestSpec(t *testing.T) {
 		SQLQuery, "sql.query",
 		HTTPURL, "http.url",
 		Environment, "env",
+		Version, "version",
+		GRPCTarget, "grpc.target",
+		GRPCAuthority, "grpc.authority",
+		LogKeyTraceID, "dd.trace_id",
+		LogKeySpanID, "dd.span_id",
 	}
 	if len(tests)%2 != 0 {
 		t.Fatal("uneven test count")
@@ -0,0 +1,11 @@
+package ext
+
+const (
+	// GRPCTarget is the tag name used for the endpoint a gRPC client
+	// connection is dialed to, without its naming scheme and authority.
+	GRPCTarget = "grpc.target"
+
+	// GRPCAuthority is the tag name used for the authority part of the
+	// target of a gRPC client connection, such as the DNS server to use.
+	GRPCAuthority = "grpc.authority"
+)
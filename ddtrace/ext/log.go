@@ -0,0 +1,11 @@
+package ext
+
+const (
+	// LogKeyTraceID is the log field key holding the ID of the current trace,
+	// used to correlate logs and traces.
+	LogKeyTraceID = "dd.trace_id"
+
+	// LogKeySpanID is the log field key holding the ID of the current span,
+	// used to correlate logs and traces.
+	LogKeySpanID = "dd.span_id"
+)
@@ -10,6 +10,9 @@ const (
 	TargetPort = "out.port"
 
 	// SamplingPriority is the tag that marks the sampling priority of a span.
+	// Setting it on any span sets the priority of the whole trace, which is
+	// propagated along with it. For example, setting it to PriorityUserKeep
+	// keeps the trace regardless of the sampling rate.
 	SamplingPriority = "sampling.priority"
 
 	// SQLType sets the sql type tag.
@@ -34,10 +37,12 @@ const (
 	// SpanType defines the Span type (web, db, cache).
 	SpanType = "span.type"
 
-	// ServiceName defines the Service name for this Span.
+	// ServiceName defines the Service name for this Span. Spans started as its
+	// children afterwards inherit it, unless they are given their own.
 	ServiceName = "service.name"
 
-	// ResourceName defines the Resource name for the Span.
+	// ResourceName defines the Resource name for the Span. Like any tag, it may
+	// be set until the span finishes, e.g. once the matched route is known.
 	ResourceName = "resource.name"
 
 	// Error specifies the error tag. It's value is usually of type "error".
@@ -55,6 +60,9 @@ const (
 	// Environment specifies the environment to use with a trace.
 	Environment = "env"
 
+	// Version specifies the version of the service to use with a trace.
+	Version = "version"
+
 	// DBApplication indicates the application using the database.
 	DBApplication = "db.application"
 	// DBName indicates the database name.
@@ -2,31 +2,44 @@ package internal // import "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 )
 
 var (
-	mu           sync.RWMutex   // guards globalTracer
-	globalTracer ddtrace.Tracer = &NoopTracer{}
+	mu           sync.Mutex   // serializes the replacements of globalTracer
+	globalTracer atomic.Value // holds a *tracerHolder
 )
 
-// SetGlobalTracer sets the global tracer to t.
+func init() {
+	globalTracer.Store(&tracerHolder{&NoopTracer{}})
+}
+
+// tracerHolder wraps the global tracer, so that values of the same type are
+// always stored into globalTracer.
+type tracerHolder struct {
+	tracer ddtrace.Tracer
+}
+
+// SetGlobalTracer sets the global tracer to t and stops the one it replaces. It
+// is safe to call concurrently with GetGlobalTracer: callers obtain either the
+// previous tracer or t. The previous tracer is stopped once it was replaced, so
+// that starting spans is not blocked meanwhile.
 func SetGlobalTracer(t ddtrace.Tracer) {
 	mu.Lock()
-	defer mu.Unlock()
+	old := globalTracer.Load().(*tracerHolder).tracer
+	globalTracer.Store(&tracerHolder{t})
+	mu.Unlock()
 	if !Testing {
 		// avoid infinite loop when calling (*mocktracer.Tracer).Stop
-		globalTracer.Stop()
+		old.Stop()
 	}
-	globalTracer = t
 }
 
 // GetGlobalTracer returns the currently active tracer.
 func GetGlobalTracer() ddtrace.Tracer {
-	mu.RLock()
-	defer mu.RUnlock()
-	return globalTracer
+	return globalTracer.Load().(*tracerHolder).tracer
 }
 
 // Testing is set to true when the mock tracer is active. It usually signifies that we are in a test
@@ -0,0 +1,68 @@
+package mocktracer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+)
+
+// SpansNamed returns the spans out of the given ones which have the given
+// operation name, in the same order.
+func SpansNamed(spans []Span, name string) []Span {
+	var named []Span
+	for _, s := range spans {
+		if s.OperationName() == name {
+			named = append(named, s)
+		}
+	}
+	return named
+}
+
+// CheckTags returns an error describing the tags of the span s which differ from
+// the expected ones, or nil if it holds all of them. A nil expected value checks
+// that the tag is not set. Tags of s which are not expected are ignored.
+func CheckTags(s Span, want map[string]interface{}) error {
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := s.Tags()
+	for _, k := range keys {
+		v, ok := tags[k]
+		switch {
+		case want[k] == nil && ok:
+			return fmt.Errorf("span %q: tag %q: expected unset, got %#v", s.OperationName(), k, v)
+		case want[k] != nil && !ok:
+			return fmt.Errorf("span %q: tag %q: expected %#v, got unset", s.OperationName(), k, want[k])
+		case !reflect.DeepEqual(v, want[k]):
+			return fmt.Errorf("span %q: tag %q: expected %#v, got %#v", s.OperationName(), k, want[k], v)
+		}
+	}
+	return nil
+}
+
+// SpanError returns the error which the span s was marked with, either by
+// finishing it with tracer.WithError or by setting the ext.Error tag, or nil if
+// it was not marked as an error.
+func SpanError(s Span) error {
+	switch v := s.Tag(ext.Error).(type) {
+	case nil:
+		return nil
+	case error:
+		return v
+	case bool:
+		if !v {
+			return nil
+		}
+		if msg, ok := s.Tag(ext.ErrorMsg).(string); ok {
+			return errors.New(msg)
+		}
+		return errors.New("error")
+	default:
+		return fmt.Errorf("%v", v)
+	}
+}
@@ -0,0 +1,72 @@
+package mocktracer
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpansNamed(t *testing.T) {
+	mt := Start()
+	defer mt.Stop()
+
+	a := tracer.StartSpan("a")
+	b := tracer.StartSpan("b")
+	a2 := tracer.StartSpan("a")
+	a.Finish()
+	b.Finish()
+	a2.Finish()
+
+	spans := SpansNamed(mt.FinishedSpans(), "a")
+	assert.Len(t, spans, 2)
+	assert.Equal(t, a.Context().SpanID(), spans[0].SpanID())
+	assert.Equal(t, a2.Context().SpanID(), spans[1].SpanID())
+	assert.Empty(t, SpansNamed(mt.FinishedSpans(), "c"))
+}
+
+func TestCheckTags(t *testing.T) {
+	s := basicSpan("http.request")
+	s.SetTag(ext.HTTPCode, "200")
+	s.SetTag("count", 3)
+
+	assert := assert.New(t)
+	assert.NoError(CheckTags(s, map[string]interface{}{
+		ext.HTTPCode: "200",
+		"count":      3,
+		ext.Error:    nil,
+	}))
+	assert.EqualError(CheckTags(s, map[string]interface{}{ext.HTTPCode: "500"}),
+		`span "http.request": tag "http.status_code": expected "500", got "200"`)
+	assert.EqualError(CheckTags(s, map[string]interface{}{"count": 3.0}),
+		`span "http.request": tag "count": expected 3, got 3`)
+	assert.EqualError(CheckTags(s, map[string]interface{}{ext.HTTPURL: "/"}),
+		`span "http.request": tag "http.url": expected "/", got unset`)
+	assert.EqualError(CheckTags(s, map[string]interface{}{"count": nil}),
+		`span "http.request": tag "count": expected unset, got 3`)
+}
+
+func TestSpanError(t *testing.T) {
+	assert := assert.New(t)
+
+	s := basicSpan("ok")
+	s.Finish()
+	assert.NoError(SpanError(s))
+
+	err := errors.New("boom")
+	s = basicSpan("finished-with-error")
+	s.Finish(tracer.WithError(err))
+	assert.Equal(err, SpanError(s))
+
+	s = basicSpan("tagged")
+	s.SetTag(ext.Error, true)
+	s.SetTag(ext.ErrorMsg, "bad request")
+	assert.EqualError(SpanError(s), "bad request")
+
+	s = basicSpan("tagged-false")
+	s.SetTag(ext.Error, false)
+	assert.NoError(SpanError(s))
+}
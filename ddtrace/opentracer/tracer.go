@@ -41,11 +41,23 @@ func (t *opentracer) StartSpan(operationName string, options ...opentracing.Star
 		o.Apply(&sso)
 	}
 	opts := []ddtrace.StartSpanOption{tracer.StartTime(sso.StartTime)}
+	var parent ddtrace.StartSpanOption
 	for _, ref := range sso.References {
-		if v, ok := ref.ReferencedContext.(ddtrace.SpanContext); ok && ref.Type == opentracing.ChildOfRef {
-			opts = append(opts, tracer.ChildOf(v))
+		v, ok := ref.ReferencedContext.(ddtrace.SpanContext)
+		if !ok {
+			continue
+		}
+		if ref.Type == opentracing.ChildOfRef {
+			parent = tracer.ChildOf(v)
 			break // can only have one parent
 		}
+		if ref.Type == opentracing.FollowsFromRef && parent == nil {
+			// used unless a parent is also referenced
+			parent = tracer.FollowsFrom(v)
+		}
+	}
+	if parent != nil {
+		opts = append(opts, parent)
 	}
 	for k, v := range sso.Tags {
 		opts = append(opts, tracer.Tag(k, v))
@@ -60,11 +72,11 @@ func (t *opentracer) StartSpan(operationName string, options ...opentracing.Star
 func (t *opentracer) Inject(ctx opentracing.SpanContext, format interface{}, carrier interface{}) error {
 	sctx, ok := ctx.(ddtrace.SpanContext)
 	if !ok {
-		return opentracing.ErrUnsupportedFormat
+		return opentracing.ErrInvalidSpanContext
 	}
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
-		return t.Tracer.Inject(sctx, carrier)
+		return translateError(t.Tracer.Inject(sctx, carrier))
 	default:
 		return opentracing.ErrUnsupportedFormat
 	}
@@ -74,8 +86,29 @@ func (t *opentracer) Inject(ctx opentracing.SpanContext, format interface{}, car
 func (t *opentracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
 	switch format {
 	case opentracing.TextMap, opentracing.HTTPHeaders:
-		return t.Tracer.Extract(carrier)
+		sctx, err := t.Tracer.Extract(carrier)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		return sctx, nil
 	default:
 		return nil, opentracing.ErrUnsupportedFormat
 	}
 }
+
+// translateError translates the propagation errors returned by the Datadog
+// tracer into their Opentracing equivalents.
+func translateError(err error) error {
+	switch err {
+	case tracer.ErrInvalidCarrier:
+		return opentracing.ErrInvalidCarrier
+	case tracer.ErrInvalidSpanContext:
+		return opentracing.ErrInvalidSpanContext
+	case tracer.ErrSpanContextCorrupted:
+		return opentracing.ErrSpanContextCorrupted
+	case tracer.ErrSpanContextNotFound:
+		return opentracing.ErrSpanContextNotFound
+	default:
+		return err
+	}
+}
@@ -1,11 +1,14 @@
 package opentracer
 
 import (
+	"net/http"
 	"testing"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +21,79 @@ func TestStart(t *testing.T) {
 	assert.True(ok)
 	assert.Equal(ott.Tracer, dd)
 }
+
+func TestInjectExtract(t *testing.T) {
+	ot := New()
+	defer tracer.Stop()
+
+	t.Run("roundtrip", func(t *testing.T) {
+		assert := assert.New(t)
+		sp := ot.StartSpan("web.request")
+		sp.SetBaggageItem("user", "bob")
+		carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+		assert.NoError(ot.Inject(sp.Context(), opentracing.HTTPHeaders, carrier))
+
+		sctx, err := ot.Extract(opentracing.HTTPHeaders, carrier)
+		assert.NoError(err)
+		child := ot.StartSpan("db.query", opentracing.ChildOf(sctx))
+		assert.Equal(sp.(*span).Context().(ddtrace.SpanContext).TraceID(), child.(*span).Context().(ddtrace.SpanContext).TraceID())
+		assert.Equal("bob", child.BaggageItem("user"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := assert.New(t)
+		sp := ot.StartSpan("web.request")
+		carrier := opentracing.TextMapCarrier{}
+
+		assert.Equal(opentracing.ErrUnsupportedFormat, ot.Inject(sp.Context(), opentracing.Binary, carrier))
+		assert.Equal(opentracing.ErrInvalidCarrier, ot.Inject(sp.Context(), opentracing.TextMap, "carrier"))
+		assert.Equal(opentracing.ErrInvalidSpanContext, ot.Inject(nil, opentracing.TextMap, carrier))
+
+		_, err := ot.Extract(opentracing.Binary, carrier)
+		assert.Equal(opentracing.ErrUnsupportedFormat, err)
+		_, err = ot.Extract(opentracing.TextMap, "carrier")
+		assert.Equal(opentracing.ErrInvalidCarrier, err)
+		_, err = ot.Extract(opentracing.TextMap, carrier)
+		assert.Equal(opentracing.ErrSpanContextNotFound, err)
+		_, err = ot.Extract(opentracing.TextMap, opentracing.TextMapCarrier{tracer.DefaultTraceIDHeader: "x", tracer.DefaultParentIDHeader: "1"})
+		assert.Equal(opentracing.ErrSpanContextCorrupted, err)
+	})
+}
+
+// configTracer records the configuration of the spans it starts.
+type configTracer struct {
+	ddtrace.Tracer
+	cfg ddtrace.StartSpanConfig
+}
+
+func (t *configTracer) StartSpan(_ string, opts ...ddtrace.StartSpanOption) ddtrace.Span {
+	t.cfg = ddtrace.StartSpanConfig{}
+	for _, fn := range opts {
+		fn(&t.cfg)
+	}
+	return internal.NoopSpan{}
+}
+
+func TestStartSpanReferences(t *testing.T) {
+	parent := internal.NoopSpanContext{}
+	other := &configTracer{}
+	ot := &opentracer{Tracer: other}
+
+	t.Run("child-of", func(t *testing.T) {
+		ot.StartSpan("op", opentracing.ChildOf(parent))
+		assert.Equal(t, parent, other.cfg.Parent)
+		assert.False(t, other.cfg.FollowsFrom)
+	})
+
+	t.Run("follows-from", func(t *testing.T) {
+		ot.StartSpan("op", opentracing.FollowsFrom(parent))
+		assert.Equal(t, parent, other.cfg.Parent)
+		assert.True(t, other.cfg.FollowsFrom)
+	})
+
+	t.Run("both", func(t *testing.T) {
+		ot.StartSpan("op", opentracing.FollowsFrom(parent), opentracing.ChildOf(parent))
+		assert.Equal(t, parent, other.cfg.Parent)
+		assert.False(t, other.cfg.FollowsFrom)
+	})
+}
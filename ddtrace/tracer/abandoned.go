@@ -0,0 +1,81 @@
+package tracer
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultAbandonedSpanTimeout is the default age after which open spans are
+// reported as abandoned, in debug mode.
+const defaultAbandonedSpanTimeout = 10 * time.Minute
+
+// spanRegistry tracks the open spans of a tracer, to report those which are
+// never finished. Spans are removed from it when they finish.
+type spanRegistry struct {
+	mu    sync.Mutex
+	spans map[*span]bool // open spans, true once reported
+}
+
+func newSpanRegistry() *spanRegistry {
+	return &spanRegistry{spans: make(map[*span]bool)}
+}
+
+// add adds the started span s to the registry.
+func (r *spanRegistry) add(s *span) {
+	r.mu.Lock()
+	r.spans[s] = false
+	r.mu.Unlock()
+}
+
+// remove removes the finished span s from the registry.
+func (r *spanRegistry) remove(s *span) {
+	r.mu.Lock()
+	delete(r.spans, s)
+	r.mu.Unlock()
+}
+
+// report logs the spans which were started more than timeout before now and
+// are still open, unless they were already reported. It returns the number of
+// spans it logged.
+func (r *spanRegistry) report(now time.Time, timeout time.Duration) int {
+	var abandoned []*span
+	r.mu.Lock()
+	for s, reported := range r.spans {
+		// the start of spans doesn't change, it is read without their lock
+		if reported || time.Duration(now.UnixNano()-s.Start) < timeout {
+			continue
+		}
+		r.spans[s] = true
+		abandoned = append(abandoned, s)
+	}
+	r.mu.Unlock()
+	// spans are locked once the registry is released, as finishing spans
+	// remove themselves from it with their lock held
+	var n int
+	for _, s := range abandoned {
+		s.RLock()
+		if !s.finished {
+			age := time.Duration(now.UnixNano() - s.Start)
+			logf("%sspan %q (resource: %q, trace: %d, span: %d) was not finished after %s", warnPrefix, s.Name, s.Resource, s.TraceID, s.SpanID, age)
+			n++
+		}
+		s.RUnlock()
+	}
+	return n
+}
+
+// reportAbandonedSpans periodically reports the spans which are still open once
+// the given timeout expired, until the tracer stops.
+func (t *tracer) reportAbandonedSpans(timeout time.Duration) {
+	defer t.wg.Done()
+	ticker := getClock().NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			t.openSpans.report(now, timeout)
+		case <-t.stopped:
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package tracer
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// warnings returns the lines of tl which were logged as warnings.
+func warnings(tl *testLogger) []string {
+	var lines []string
+	for _, l := range tl.Lines() {
+		if strings.HasPrefix(l, warnPrefix) {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func TestSpanRegistry(t *testing.T) {
+	assert := assert.New(t)
+	tl := new(testLogger)
+	SetLogger(tl)
+	defer SetLogger(nil)
+
+	r := newSpanRegistry()
+	now := time.Now()
+	leaked := newBasicSpan("leaked")
+	leaked.Resource = "/leak"
+	leaked.Start = now.Add(-time.Hour).UnixNano()
+	recent := newBasicSpan("recent")
+	recent.Start = now.UnixNano()
+	r.add(leaked)
+	r.add(recent)
+
+	assert.Equal(1, r.report(now, time.Minute))
+	lines := warnings(tl)
+	assert.Len(lines, 1)
+	assert.Contains(lines[0], `span "leaked" (resource: "/leak"`)
+	assert.Contains(lines[0], "was not finished after 1h0m0s")
+
+	// spans are reported once
+	assert.Equal(0, r.report(now.Add(time.Second), time.Minute))
+	assert.Empty(warnings(tl))
+
+	r.remove(leaked)
+	r.remove(recent)
+	assert.Empty(r.spans)
+}
+
+func TestTracerAbandonedSpans(t *testing.T) {
+	tl := new(testLogger)
+	SetLogger(tl)
+	defer SetLogger(nil)
+	defer SetDebug(false)
+
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, stop := startTestTracer(WithDebugMode(true), WithAbandonedSpanTimeout(20*time.Millisecond))
+		defer stop()
+
+		leaked := tracer.StartSpan("leaked", ResourceName("/leak"))
+		finished := tracer.StartSpan("finished")
+		finished.Finish()
+		tracer.openSpans.mu.Lock()
+		assert.Len(tracer.openSpans.spans, 1)
+		tracer.openSpans.mu.Unlock()
+
+		deadline := time.After(5 * time.Second)
+		var lines []string
+		for len(lines) == 0 {
+			select {
+			case <-deadline:
+				t.Fatal("abandoned span was not reported")
+			case <-time.After(10 * time.Millisecond):
+				lines = warnings(tl)
+			}
+		}
+		assert.Len(lines, 1)
+		assert.Contains(lines[0], `span "leaked" (resource: "/leak"`)
+
+		leaked.Finish()
+		tracer.openSpans.mu.Lock()
+		assert.Empty(tracer.openSpans.spans)
+		tracer.openSpans.mu.Unlock()
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		tracer, _, stop := startTestTracer(WithDebugMode(true), WithAbandonedSpanTimeout(0))
+		defer stop()
+		assert.Nil(t, tracer.openSpans)
+	})
+
+	t.Run("no-debug", func(t *testing.T) {
+		tracer, _, stop := startTestTracer()
+		defer stop()
+		assert.Nil(t, tracer.openSpans)
+		span := tracer.StartSpan("op").(*span)
+		assert.Nil(t, span.registry)
+		span.Finish()
+	})
+}
+
+func TestSpanRegistryConcurrentFinish(t *testing.T) {
+	tl := new(testLogger)
+	SetLogger(tl)
+	defer SetLogger(nil)
+	defer SetDebug(false)
+	tracer, _, stop := startAsyncTestTracer(WithDebugMode(true), WithAbandonedSpanTimeout(time.Hour))
+	defer stop()
+	// finishing and reporting spans have to run in parallel
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	done := make(chan struct{})
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				// all spans are abandoned a year from now
+				tracer.openSpans.report(time.Now().Add(24*365*time.Hour), time.Hour)
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				tracer.StartSpan("web.request").Finish()
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-reported
+}
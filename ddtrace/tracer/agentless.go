@@ -0,0 +1,287 @@
+package tracer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// agentlessPath is the path of the traces endpoint of the Datadog intake.
+	agentlessPath = "/api/v0.2/traces"
+
+	// agentlessHTTPTimeout is the timeout of the requests sent to the intake,
+	// which is further away than an agent.
+	agentlessHTTPTimeout = 10 * time.Second
+
+	// maxRetryAfter bounds the time waited before retrying a request which the
+	// intake rate limited, whatever its Retry-After header asks for.
+	maxRetryAfter = 10 * time.Second
+
+	// apiKeyHeader is the header holding the API key which authenticates the
+	// requests sent to the intake.
+	apiKeyHeader = "DD-Api-Key"
+)
+
+// agentlessTransport is a transport sending traces directly to the Datadog
+// intake rather than to an agent, encoded in its protobuf format. As the intake
+// does not respond with sampling rates, traces are kept using the default rate
+// of the priority sampler.
+type agentlessTransport struct {
+	url      string // the URL of the traces endpoint of the intake
+	apiKey   string
+	hostname string // the hostname of the payloads, if any
+	env      string // the environment of the payloads, if any
+	client   *http.Client
+
+	retryInterval time.Duration // the backoff before the first retry, growing fivefold up to maxRetryInterval
+
+	// sleep waits between retries, returning false when stop is closed first.
+	sleep func(d time.Duration, stop <-chan struct{}) bool
+}
+
+// newAgentlessTransport returns an agentlessTransport sending traces to the
+// intake of the given Datadog site, such as "datadoghq.com", using apiKey.
+func newAgentlessTransport(site, apiKey string) *agentlessTransport {
+	return &agentlessTransport{
+		url:    "https://trace.agent." + site + agentlessPath,
+		apiKey: apiKey,
+		client: &http.Client{
+			// see newHTTPTransportWithDialer for why the default transport is not used
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			Timeout: agentlessHTTPTimeout,
+		},
+		retryInterval: retryInterval,
+		sleep:         sleep,
+	}
+}
+
+// send encodes the traces of p in the format of the intake and sends them,
+// retrying with an exponential backoff when the intake can not be reached or
+// responds with a server error. Rate limited requests are retried once the
+// delay found in the Retry-After header of the response expired. Requests are no
+// longer retried once stop is closed. As there are no sampling rates in the
+// responses, it responds with an empty set of them.
+func (t *agentlessTransport) send(p *payload, stop <-chan struct{}) (body io.ReadCloser, err error) {
+	var traces spanLists
+	if err := msgp.Decode(p, &traces); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(encodeTracePayload(t.hostname, t.env, traces)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	backoff := t.retryInterval
+	for i := 0; ; i++ {
+		wait, retry, err := t.sendOnce(buf.Bytes())
+		if err == nil {
+			return ioutil.NopCloser(strings.NewReader("{}")), nil
+		}
+		if !retry || i == maxRetries {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = backoff
+			if backoff *= 5; backoff > maxRetryInterval {
+				backoff = maxRetryInterval
+			}
+		}
+		if !t.sleep(wait, stop) {
+			return nil, err
+		}
+	}
+}
+
+// sendOnce makes a single attempt at sending the gzipped payload. When it fails,
+// retry reports whether the error is temporary, and wait how long the intake
+// asked to wait before retrying, if it did.
+func (t *agentlessTransport) sendOnce(payload []byte) (wait time.Duration, retry bool, err error) {
+	req, err := http.NewRequest("POST", t.url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot create http request: %v", err)
+	}
+	req.Header.Set(apiKeyHeader, t.apiKey)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Datadog-Meta-Lang", "go")
+	req.Header.Set("Datadog-Meta-Lang-Version", strings.TrimPrefix(runtime.Version(), "go"))
+	req.Header.Set("Datadog-Meta-Tracer-Version", tracerVersion)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	code := resp.StatusCode
+	switch {
+	case code == http.StatusTooManyRequests:
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			wait = time.Duration(s) * time.Second
+			if wait > maxRetryAfter {
+				wait = maxRetryAfter
+			}
+		}
+		return wait, true, fmt.Errorf("intake rate limited the request (Status: %s)", http.StatusText(code))
+	case code >= 400:
+		return 0, code >= 500, fmt.Errorf("intake rejected the request (Status: %s)", http.StatusText(code))
+	}
+	return 0, false, nil
+}
+
+// encodeTracePayload encodes the given traces as a TracePayload message of the
+// protobuf format of the intake.
+func encodeTracePayload(hostname, env string, traces spanLists) []byte {
+	var b protoBuffer
+	b.string(1, hostname)
+	b.string(2, env)
+	for _, trace := range traces {
+		if len(trace) == 0 {
+			continue
+		}
+		b.message(3, func(b *protoBuffer) { encodeAPITrace(b, trace) })
+	}
+	return b.buf
+}
+
+// encodeAPITrace encodes trace as an APITrace message.
+func encodeAPITrace(b *protoBuffer, trace spanList) {
+	start, end := trace[0].Start, trace[0].Start+trace[0].Duration
+	for _, s := range trace {
+		if s.Start < start {
+			start = s.Start
+		}
+		if s.Start+s.Duration > end {
+			end = s.Start + s.Duration
+		}
+	}
+	b.uint(1, trace[0].TraceID)
+	for _, s := range trace {
+		b.message(2, func(b *protoBuffer) { encodeSpan(b, s) })
+	}
+	b.uint(6, uint64(start))
+	b.uint(7, uint64(end))
+}
+
+// encodeSpan encodes s as a Span message.
+func encodeSpan(b *protoBuffer, s *span) {
+	b.string(1, s.Service)
+	b.string(2, s.Name)
+	b.string(3, s.Resource)
+	b.uint(4, s.TraceID)
+	b.uint(5, s.SpanID)
+	b.uint(6, s.ParentID)
+	b.uint(7, uint64(s.Start))
+	b.uint(8, uint64(s.Duration))
+	b.uint(9, uint64(s.Error))
+	// map entries are sorted, so that payloads are deterministic
+	keys := make([]string, 0, len(s.Meta))
+	for k := range s.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := s.Meta[k]
+		b.message(10, func(b *protoBuffer) {
+			b.string(1, k)
+			b.string(2, v)
+		})
+	}
+	keys = keys[:0]
+	for k := range s.Metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := s.Metrics[k]
+		b.message(11, func(b *protoBuffer) {
+			b.string(1, k)
+			b.double(2, v)
+		})
+	}
+	b.string(12, s.Type)
+}
+
+// protoBuffer encodes protobuf messages. Fields holding zero values are
+// omitted, as in proto3.
+type protoBuffer struct {
+	buf []byte
+}
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.buf = append(b.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	b.buf = append(b.buf, byte(v))
+}
+
+func (b *protoBuffer) tag(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint encodes an integer field. Negative signed values are encoded as their
+// two's complement, as protobuf does for int32 and int64.
+func (b *protoBuffer) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	b.tag(field, wireBytes)
+	b.varint(uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+func (b *protoBuffer) double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireFixed64)
+	bits := math.Float64bits(v)
+	for i := uint(0); i < 64; i += 8 {
+		b.buf = append(b.buf, byte(bits>>i))
+	}
+}
+
+// message encodes an embedded message field, whose fields are encoded by fn.
+func (b *protoBuffer) message(field int, fn func(b *protoBuffer)) {
+	var m protoBuffer
+	fn(&m)
+	b.tag(field, wireBytes)
+	b.varint(uint64(len(m.buf)))
+	b.buf = append(b.buf, m.buf...)
+}
@@ -0,0 +1,243 @@
+package tracer
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// protoFields decodes the protobuf message b into its fields, by number. Varint
+// fields are decoded as uint64, fixed64 ones as float64 and others as []byte.
+func protoFields(t *testing.T, b []byte) map[int][]interface{} {
+	fields := make(map[int][]interface{})
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("malformed tag")
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("malformed varint of field %d", field)
+			}
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case wireFixed64:
+			fields[field] = append(fields[field], math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				t.Fatalf("malformed length of field %d", field)
+			}
+			fields[field] = append(fields[field], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return fields
+}
+
+func TestEncodeTracePayload(t *testing.T) {
+	assert := assert.New(t)
+	root := &span{
+		Name:     "web.request",
+		Service:  "api",
+		Resource: "/users",
+		Type:     "web",
+		TraceID:  300,
+		SpanID:   300,
+		Start:    1000,
+		Duration: 500,
+		Meta:     map[string]string{"http.method": "GET", "env": "prod"},
+		Metrics:  map[string]float64{"_sampling_priority_v1": 1},
+	}
+	child := &span{
+		Name:     "db.query",
+		Service:  "db",
+		TraceID:  300,
+		SpanID:   301,
+		ParentID: 300,
+		Start:    1100,
+		Duration: 600,
+		Error:    1,
+	}
+	payload := protoFields(t, encodeTracePayload("host", "prod", spanLists{{root, child}, {}}))
+	assert.Equal([]interface{}{[]byte("host")}, payload[1])
+	assert.Equal([]interface{}{[]byte("prod")}, payload[2])
+	if !assert.Len(payload[3], 1, "empty traces are skipped") {
+		return
+	}
+
+	trace := protoFields(t, payload[3][0].([]byte))
+	assert.Equal([]interface{}{uint64(300)}, trace[1])
+	assert.Equal([]interface{}{uint64(1000)}, trace[6])
+	assert.Equal([]interface{}{uint64(1700)}, trace[7])
+	if !assert.Len(trace[2], 2) {
+		return
+	}
+
+	s := protoFields(t, trace[2][0].([]byte))
+	assert.Equal([]interface{}{[]byte("api")}, s[1])
+	assert.Equal([]interface{}{[]byte("web.request")}, s[2])
+	assert.Equal([]interface{}{[]byte("/users")}, s[3])
+	assert.Equal([]interface{}{uint64(300)}, s[4])
+	assert.Equal([]interface{}{uint64(300)}, s[5])
+	assert.Nil(s[6], "zero values are omitted")
+	assert.Equal([]interface{}{uint64(1000)}, s[7])
+	assert.Equal([]interface{}{uint64(500)}, s[8])
+	assert.Nil(s[9])
+	assert.Equal([]interface{}{[]byte("web")}, s[12])
+	if assert.Len(s[10], 2) {
+		entry := protoFields(t, s[10][0].([]byte))
+		assert.Equal([]interface{}{[]byte("env")}, entry[1])
+		assert.Equal([]interface{}{[]byte("prod")}, entry[2])
+		entry = protoFields(t, s[10][1].([]byte))
+		assert.Equal([]interface{}{[]byte("http.method")}, entry[1])
+	}
+	if assert.Len(s[11], 1) {
+		entry := protoFields(t, s[11][0].([]byte))
+		assert.Equal([]interface{}{[]byte("_sampling_priority_v1")}, entry[1])
+		assert.Equal([]interface{}{float64(1)}, entry[2])
+	}
+
+	s = protoFields(t, trace[2][1].([]byte))
+	assert.Equal([]interface{}{uint64(300)}, s[6])
+	assert.Equal([]interface{}{uint64(1)}, s[9])
+}
+
+func TestAgentlessTransport(t *testing.T) {
+	const apiKey = "0123456789abcdef"
+	var (
+		codes    []int // the status codes of the next responses
+		requests []*http.Request
+		bodies   [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		zr, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		b, err := ioutil.ReadAll(zr)
+		assert.NoError(t, err)
+		bodies = append(bodies, b)
+		code := http.StatusOK
+		if len(codes) > 0 {
+			code, codes = codes[0], codes[1:]
+		}
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "2")
+		}
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	var slept []time.Duration
+	newTransport := func() *agentlessTransport {
+		requests, bodies, slept = nil, nil, nil
+		transport := newAgentlessTransport("datadoghq.com", apiKey)
+		transport.url = srv.URL + agentlessPath
+		transport.sleep = func(d time.Duration, _ <-chan struct{}) bool {
+			slept = append(slept, d)
+			return true
+		}
+		transport.hostname, transport.env = "host", "prod"
+		return transport
+	}
+	send := func(transport *agentlessTransport) error {
+		p, err := encode(getTestTrace(2, 3))
+		assert.NoError(t, err)
+		body, err := transport.send(p, nil)
+		if err == nil {
+			rates, err := ioutil.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, "{}", string(rates))
+		}
+		return err
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.NoError(send(newTransport()))
+		if !assert.Len(requests, 1) {
+			return
+		}
+		r := requests[0]
+		assert.Equal(agentlessPath, r.URL.Path)
+		assert.Equal(apiKey, r.Header.Get(apiKeyHeader))
+		assert.Equal("application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal("gzip", r.Header.Get("Content-Encoding"))
+		payload := protoFields(t, bodies[0])
+		assert.Equal([]interface{}{[]byte("host")}, payload[1])
+		assert.Equal([]interface{}{[]byte("prod")}, payload[2])
+		assert.Len(payload[3], 2)
+	})
+
+	t.Run("rate-limited", func(t *testing.T) {
+		assert := assert.New(t)
+		codes = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+		assert.NoError(send(newTransport()))
+		assert.Len(requests, 3)
+		assert.Equal([]time.Duration{2 * time.Second, retryInterval}, slept)
+		assert.Equal(bodies[0], bodies[2])
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		assert := assert.New(t)
+		codes = []int{http.StatusTooManyRequests}
+		transport := newTransport()
+		transport.sleep = sleep
+		p, err := encode(getTestTrace(2, 3))
+		assert.NoError(err)
+		stop := make(chan struct{})
+		close(stop)
+		start := time.Now()
+		_, err = transport.send(p, stop)
+		assert.EqualError(err, "intake rate limited the request (Status: Too Many Requests)")
+		assert.Len(requests, 1)
+		assert.True(time.Since(start) < 2*time.Second, "should not wait for Retry-After")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := assert.New(t)
+		codes = []int{http.StatusForbidden}
+		err := send(newTransport())
+		assert.EqualError(err, "intake rejected the request (Status: Forbidden)")
+		assert.Len(requests, 1, "client errors are not retried")
+
+		codes = []int{500, 500, 500, 500}
+		err = send(newTransport())
+		assert.Error(err)
+		assert.Len(requests, maxRetries+1)
+
+		transport := newTransport()
+		transport.url = "http://127.0.0.1:0" + agentlessPath
+		err = send(transport)
+		assert.Error(err)
+		assert.NotContains(err.Error(), apiKey)
+	})
+}
+
+func TestAgentlessEndpoint(t *testing.T) {
+	os.Setenv(envEnvVar, "ci")
+	defer os.Unsetenv(envEnvVar)
+	tracer := newTracer(WithAgentlessEndpoint("datadoghq.eu", "key"))
+	defer tracer.Stop()
+	transport, ok := tracer.config.transport.(*agentlessTransport)
+	if assert.True(t, ok) {
+		assert.Equal(t, "https://trace.agent.datadoghq.eu/api/v0.2/traces", transport.url)
+		assert.Equal(t, "key", transport.apiKey)
+		assert.Equal(t, "ci", transport.env)
+	}
+}
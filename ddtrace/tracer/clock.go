@@ -0,0 +1,70 @@
+package tracer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// clock is the source of time of the tracer. It provides the timestamps of
+// spans, the tickers of periodic tasks such as flushing, and the times which
+// age-based logic such as rate limiting compares against. Tests replace it
+// using setClock to control time instead of sleeping.
+type clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTicker returns a ticker delivering the time every d.
+	NewTicker(d time.Duration) ticker
+}
+
+// ticker delivers the ticks of a clock, like time.Ticker.
+type ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker. No more ticks are delivered after Stop returns.
+	Stop()
+}
+
+// realClock is the clock of the system, implemented by the time package.
+type realClock struct{}
+
+// Now implements clock.
+func (realClock) Now() time.Time { return time.Now() }
+
+// NewTicker implements clock.
+func (realClock) NewTicker(d time.Duration) ticker { return realTicker{time.NewTicker(d)} }
+
+// realTicker is a ticker of the realClock.
+type realTicker struct{ t *time.Ticker }
+
+// C implements ticker.
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+
+// Stop implements ticker.
+func (t realTicker) Stop() { t.t.Stop() }
+
+// clockHolder wraps the current clock, because atomic.Value requires all of
+// its values to be of the same concrete type.
+type clockHolder struct{ clock }
+
+// currentClock holds the clock read by the tracer.
+var currentClock = func() *atomic.Value {
+	var v atomic.Value
+	v.Store(clockHolder{realClock{}})
+	return &v
+}()
+
+// getClock returns the clock read by the tracer.
+func getClock() clock {
+	return currentClock.Load().(clockHolder).clock
+}
+
+// setClock replaces the clock read by the tracer with c, returning a function
+// which restores the previous one. It is meant to be used by tests, and should
+// be called before starting the tracer whose tickers should use c.
+func setClock(c clock) (restore func()) {
+	old := getClock()
+	currentClock.Store(clockHolder{c})
+	return func() { currentClock.Store(clockHolder{old}) }
+}
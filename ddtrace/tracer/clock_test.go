@@ -0,0 +1,133 @@
+package tracer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock whose time only changes when it is advanced, delivering
+// the ticks which became due to its tickers.
+type fakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled when tickers are created
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker implements clock.
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{
+		c:    make(chan time.Time, 1),
+		d:    d,
+		next: c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the time of the clock forward by d, delivering the ticks which
+// became due. Like time.Ticker, tickers drop the ticks of slow receivers.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		t.mu.Lock()
+		for !t.stopped && !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.d)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// WaitTickers blocks until at least n tickers were created by the clock.
+func (c *fakeClock) WaitTickers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.tickers) < n {
+		c.cond.Wait()
+	}
+}
+
+// fakeTicker is a ticker of a fakeClock.
+type fakeTicker struct {
+	c chan time.Time
+	d time.Duration
+
+	mu      sync.Mutex
+	next    time.Time // the time of the next tick
+	stopped bool
+}
+
+// C implements ticker.
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+// Stop implements ticker.
+func (t *fakeTicker) Stop() {
+	t.mu.Lock()
+	t.stopped = true
+	t.mu.Unlock()
+}
+
+func TestFakeClock(t *testing.T) {
+	assert := assert.New(t)
+	c := newFakeClock()
+	start := c.Now()
+	tk := c.NewTicker(time.Second)
+	c.WaitTickers(1)
+
+	c.Advance(999 * time.Millisecond)
+	assert.Equal(start.Add(999*time.Millisecond), c.Now())
+	select {
+	case <-tk.C():
+		t.Fatal("unexpected tick")
+	default:
+	}
+
+	c.Advance(3 * time.Second)
+	assert.Equal(start.Add(time.Second), <-tk.C())
+	select {
+	case <-tk.C():
+		t.Fatal("ticks of slow receivers should be dropped")
+	default:
+	}
+
+	tk.Stop()
+	c.Advance(time.Hour)
+	select {
+	case <-tk.C():
+		t.Fatal("unexpected tick after Stop")
+	default:
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	c := newFakeClock()
+	restore := setClock(c)
+	assert.Equal(t, c.Now().UnixNano(), now())
+	restore()
+	assert.Equal(t, realClock{}, getClock())
+}
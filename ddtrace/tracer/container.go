@@ -0,0 +1,66 @@
+package tracer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+)
+
+// containerIDHeader is the header in which the ID of the container of the
+// application is sent to the agent, which uses it to tag the traces.
+const containerIDHeader = "Datadog-Container-ID"
+
+// cgroupPath is the path of the file listing the control groups of the process.
+const cgroupPath = "/proc/self/cgroup"
+
+const (
+	uuidSource      = "[0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12}"
+	containerSource = "[0-9a-f]{64}"
+	taskSource      = "[0-9a-f]{32}-\\d+"
+)
+
+var (
+	// cgroupLineRe matches the lines of a cgroup file, capturing their path.
+	// Lines of cgroup v2 have an empty list of controllers.
+	cgroupLineRe = regexp.MustCompile(`^\d+:[^:]*:(.+)$`)
+
+	// containerIDRe matches the last element of the path of a cgroup holding
+	// a container, capturing its ID. Besides plain IDs, it matches the systemd
+	// units of Docker and containerd, such as docker-<id>.scope, the task IDs
+	// of ECS Fargate and the UUIDs of other runtimes.
+	containerIDRe = regexp.MustCompile(fmt.Sprintf(`(%s|%s|%s)(?:\.scope)?$`, uuidSource, containerSource, taskSource))
+)
+
+// containerID is the ID of the container of the application, or empty if it
+// could not be found, e.g. because it does not run in a container.
+var containerID = readContainerID(cgroupPath)
+
+// parseContainerID returns the first container ID found in the cgroup file
+// read from r, or an empty string if there is none.
+func parseContainerID(r io.Reader) string {
+	scn := bufio.NewScanner(r)
+	for scn.Scan() {
+		m := cgroupLineRe.FindStringSubmatch(scn.Text())
+		if m == nil {
+			continue
+		}
+		if id := containerIDRe.FindStringSubmatch(path.Base(m[1])); id != nil {
+			return id[1]
+		}
+	}
+	return ""
+}
+
+// readContainerID returns the container ID found in the cgroup file at fpath,
+// or an empty string if there is none or the file can not be read.
+func readContainerID(fpath string) string {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return parseContainerID(f)
+}
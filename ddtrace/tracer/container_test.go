@@ -0,0 +1,129 @@
+package tracer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContainerID(t *testing.T) {
+	for name, tt := range map[string]struct {
+		in, id string
+	}{
+		"docker": {
+			in: `13:name=systemd:/docker/3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860
+12:pids:/docker/3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860
+11:hugetlb:/docker/3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860`,
+			id: "3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860",
+		},
+		"docker-systemd": {
+			in: `1:name=systemd:/system.slice/docker-cde7c2bab394630a42d73dc610b9c57415dced996106665d427f6d0566594411.scope`,
+			id: "cde7c2bab394630a42d73dc610b9c57415dced996106665d427f6d0566594411",
+		},
+		"containerd": {
+			in: `11:devices:/system.slice/containerd.service/kubepods-besteffort-pod1e5d0b2c_4e7c_4a3f_8cf1_6c35a1f3d3e4.slice:cri-containerd:` +
+				`0a1fc3fe9a2e9b1b1a7d6f1cb3c1b1c8f7d6e5a4b3c2d1e0f9a8b7c6d5e4f3a2`,
+			id: "0a1fc3fe9a2e9b1b1a7d6f1cb3c1b1c8f7d6e5a4b3c2d1e0f9a8b7c6d5e4f3a2",
+		},
+		"containerd-scope": {
+			in: `0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod2d3da189_6407_48e3_9ab6_78188d75e609.slice/` +
+				`cri-containerd-7b8952daecf4c0e44bbcefe1b5c5ebc7b4839d4eefeccefe694709d3809b6199.scope`,
+			id: "7b8952daecf4c0e44bbcefe1b5c5ebc7b4839d4eefeccefe694709d3809b6199",
+		},
+		"cgroup-v2": {
+			in: `0::/system.slice/docker-a3a5e1c0cf3f7b2a4f1e2d3c4b5a69788796a5b4c3d2e1f0a9b8c7d6e5f4a3b2.scope`,
+			id: "a3a5e1c0cf3f7b2a4f1e2d3c4b5a69788796a5b4c3d2e1f0a9b8c7d6e5f4a3b2",
+		},
+		"kubernetes": {
+			in: `11:perf_event:/kubepods/besteffort/pod3d274242-8ee0-11e9-a8a6-1e68d864ef1a/3e74d3fd9db4c9dd921ae05c2502fb984d0cde1b36e581b13f79c639da4518a1
+10:pids:/kubepods/besteffort/pod3d274242-8ee0-11e9-a8a6-1e68d864ef1a/3e74d3fd9db4c9dd921ae05c2502fb984d0cde1b36e581b13f79c639da4518a1`,
+			id: "3e74d3fd9db4c9dd921ae05c2502fb984d0cde1b36e581b13f79c639da4518a1",
+		},
+		"kubernetes-systemd": {
+			in: `1:name=systemd:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod2d3da189_6407_48e3_9ab6_78188d75e609.slice/` +
+				`docker-7b8952daecf4c0e44bbcefe1b5c5ebc7b4839d4eefeccefe694709d3809b6199.scope`,
+			id: "7b8952daecf4c0e44bbcefe1b5c5ebc7b4839d4eefeccefe694709d3809b6199",
+		},
+		"ecs": {
+			in: `9:perf_event:/ecs/haissam-ecs-classic/5a0d5ceddf6c44c1928d367a815d890f/38fac3e99302b3622be089dd41e7ccf38aff368a86cc339972075136ee2710ce`,
+			id: "38fac3e99302b3622be089dd41e7ccf38aff368a86cc339972075136ee2710ce",
+		},
+		"fargate": {
+			in: `11:hugetlb:/ecs/55091c13-b8cf-4801-b527-f4601742204d/432624d2150b349fe35ba397284dea788c2bf66b885d14dfc1569b01890ca7da`,
+			id: "432624d2150b349fe35ba397284dea788c2bf66b885d14dfc1569b01890ca7da",
+		},
+		"fargate-task": {
+			in: `1:name=systemd:/ecs/34dc0b5e626f2c5c4c5170e34b10e765-1234567890`,
+			id: "34dc0b5e626f2c5c4c5170e34b10e765-1234567890",
+		},
+		"truncated-uuid": {
+			in: `1:name=systemd:/system.slice/garden.service/garden/6f265890-5165-7fab-6b52-18d1`,
+			id: "",
+		},
+		"pcf": {
+			in: `1:name=systemd:/system.slice/garden.service/garden/6f265890-5165-4fab-6b52-18d1ab7c5fe3`,
+			id: "6f265890-5165-4fab-6b52-18d1ab7c5fe3",
+		},
+		"host": {
+			in: `12:pids:/user.slice/user-1000.slice/session-2.scope
+0::/init.scope`,
+			id: "",
+		},
+		"cgroup-namespace": {
+			in: `0::/`,
+			id: "",
+		},
+		"empty": {},
+		"malformed": {
+			in: "not a cgroup file\n" + strings.Repeat("3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860", 2),
+			id: "",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.id, parseContainerID(strings.NewReader(tt.in)))
+		})
+	}
+}
+
+func TestReadContainerID(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "cgroup")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "cgroup")
+	id := "3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860"
+	assert.NoError(ioutil.WriteFile(fpath, []byte("1:name=systemd:/docker/"+id+"\n"), 0644))
+	assert.Equal(id, readContainerID(fpath))
+	assert.Equal("", readContainerID(filepath.Join(dir, "missing")))
+}
+
+func TestContainerIDHeader(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	defer func(id string) { containerID = id }(containerID)
+	send := func() *http.Request {
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(t, err)
+		body, err := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://")).send(p, nil)
+		assert.NoError(t, err)
+		body.Close()
+		return <-received
+	}
+
+	containerID = "3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860"
+	assert.Equal(t, containerID, send().Header.Get(containerIDHeader))
+
+	containerID = ""
+	_, ok := send().Header[containerIDHeader]
+	assert.False(t, ok)
+}
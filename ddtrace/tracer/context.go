@@ -1,7 +1,12 @@
 package tracer
 
 import (
+	"bytes"
 	"context"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
@@ -33,10 +38,139 @@ func SpanFromContext(ctx context.Context) (Span, bool) {
 // StartSpanFromContext returns a new span with the given operation name and options. If a span
 // is found in the context, it will be used as the parent of the resulting span. If the ChildOf
 // option is passed, the span from context will take precedence over it as the parent span.
+// When the tracer was started using WithProfilerLabels, the returned context is also given
+// pprof labels identifying the span.
 func StartSpanFromContext(ctx context.Context, operationName string, opts ...StartSpanOption) (Span, context.Context) {
 	if s, ok := SpanFromContext(ctx); ok {
 		opts = append(opts, ChildOf(s.Context()))
 	}
 	s := StartSpan(operationName, opts...)
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok && t.config.profilerLabels {
+		if sp, ok := s.(*span); ok {
+			ctx = startProfilerLabels(ctx, sp)
+		}
+	}
 	return s, ContextWithSpan(ctx, s)
 }
+
+// pprof label keys set by StartSpanFromContext.
+const (
+	traceIDLabel  = "dd.trace_id"
+	spanIDLabel   = "dd.span_id"
+	spanNameLabel = "span.name"
+)
+
+// startProfilerLabels returns a copy of ctx holding the pprof labels of s, which
+// are also set on the current goroutine until s finishes.
+func startProfilerLabels(ctx context.Context, s *span) context.Context {
+	// the labels of the goroutine are assumed to be those of ctx, as it is
+	// usually the context of the calling goroutine
+	l := &profilerLabels{
+		goroutine: goroutineID(),
+		restore:   ctx,
+	}
+	ctx = pprof.WithLabels(ctx, pprof.Labels(
+		traceIDLabel, strconv.FormatUint(s.TraceID, 10),
+		spanIDLabel, strconv.FormatUint(s.SpanID, 10),
+		spanNameLabel, s.Name,
+	))
+	l.ctx = ctx
+	goroutineLabelsMu.Lock()
+	l.prev = goroutineLabels[l.goroutine]
+	goroutineLabels[l.goroutine] = l
+	goroutineLabelsMu.Unlock()
+	setGoroutineLabels(ctx)
+	s.Lock()
+	s.pprofLabels = l
+	s.Unlock()
+	return ctx
+}
+
+// profilerLabels holds the pprof labels which a span set on the goroutine
+// which started it.
+type profilerLabels struct {
+	goroutine uint64          // the ID of the goroutine
+	ctx       context.Context // the labels of the span
+	restore   context.Context // the labels of the goroutine before they were set
+
+	// prev holds the labels of the span which was started before on the same
+	// goroutine, and which these replaced, if any.
+	prev *profilerLabels
+
+	// finished is true once the span finished.
+	finished bool
+}
+
+var (
+	// goroutineLabelsMu guards goroutineLabels and the profilerLabels it holds.
+	goroutineLabelsMu sync.Mutex
+
+	// goroutineLabels holds the labels of the last span started on each
+	// goroutine, by ID, as long as the goroutine has open spans with labels.
+	goroutineLabels = make(map[uint64]*profilerLabels)
+
+	// setGoroutineLabels sets the labels of the current goroutine; it is
+	// replaced in tests.
+	setGoroutineLabels = pprof.SetGoroutineLabels
+)
+
+// finish restores the labels which the goroutine had before the span set them,
+// or those of the last open span it started, as the span finishes. It does so
+// only when called by that goroutine and once the spans started after the span
+// on it have finished too, as the labels of goroutines can only be set by them.
+// Spans finished by other goroutines thus leave their labels on the goroutine
+// which started them, until it finishes another span having labels.
+func (l *profilerLabels) finish() {
+	goroutineLabelsMu.Lock()
+	defer goroutineLabelsMu.Unlock()
+	l.finished = true
+	if goroutineLabels[l.goroutine] != l {
+		// a span started later on the goroutine is open, its labels remain
+		return
+	}
+	restore, prev := l.restore, l.prev
+	for prev != nil && prev.finished {
+		// spans finished out of order, or by other goroutines
+		restore, prev = prev.restore, prev.prev
+	}
+	if prev != nil {
+		goroutineLabels[l.goroutine] = prev
+		restore = prev.ctx
+	} else {
+		delete(goroutineLabels, l.goroutine)
+	}
+	if goroutineID() == l.goroutine {
+		setGoroutineLabels(restore)
+	}
+}
+
+// goroutineID returns the ID of the calling goroutine, as found in the header
+// of its stack trace, e.g. "goroutine 18 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// TraceIDFromContext returns the ID of the trace of the span contained in the
+// given context, or 0 if it contains no span. It may be used to correlate logs
+// and traces.
+func TraceIDFromContext(ctx context.Context) uint64 {
+	if s, ok := SpanFromContext(ctx); ok {
+		return s.Context().TraceID()
+	}
+	return 0
+}
+
+// SpanIDFromContext returns the ID of the span contained in the given context,
+// or 0 if it contains no span. It may be used to correlate logs and traces.
+func SpanIDFromContext(ctx context.Context) uint64 {
+	if s, ok := SpanFromContext(ctx); ok {
+		return s.Context().SpanID()
+	}
+	return 0
+}
@@ -2,9 +2,13 @@ package tracer
 
 import (
 	"context"
+	"runtime/pprof"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 )
 
@@ -69,3 +73,135 @@ func TestStartSpanFromContext(t *testing.T) {
 	assert.Equal("gin", got.Service)
 	assert.Equal("/", got.Resource)
 }
+
+func TestStartSpanFromContextOptions(t *testing.T) {
+	assert := assert.New(t)
+	_, _, stop := startTestTracer(WithServiceName("backend"))
+	defer stop()
+
+	start := time.Now().Add(-time.Hour)
+	s, ctx := StartSpanFromContext(
+		context.Background(),
+		"db.query",
+		ResourceName("SELECT 1"),
+		SpanType(ext.SpanTypeSQL),
+		Tag("db.instance", "users"),
+		StartTime(start),
+	)
+	got := s.(*span)
+	assert.Equal("backend", got.Service) // default kept
+	assert.Equal("SELECT 1", got.Resource)
+	assert.Equal(ext.SpanTypeSQL, got.Type)
+	assert.Equal("users", got.Meta["db.instance"])
+	assert.Equal(start.UnixNano(), got.Start)
+
+	// children take their own options, and do not inherit tags
+	child, _ := StartSpanFromContext(ctx, "db.fetch", ServiceName("postgres"))
+	assert.Equal(got.SpanID, child.(*span).ParentID)
+	assert.Equal("postgres", child.(*span).Service)
+	assert.NotContains(child.(*span).Meta, "db.instance")
+
+	child.Finish()
+	s.Finish()
+	assert.True(got.Duration >= time.Hour.Nanoseconds())
+}
+
+func TestIDsFromContext(t *testing.T) {
+	assert := assert.New(t)
+	_, _, stop := startTestTracer()
+	defer stop()
+
+	assert.Zero(TraceIDFromContext(context.Background()))
+	assert.Zero(SpanIDFromContext(context.Background()))
+
+	root, ctx := StartSpanFromContext(context.Background(), "web.request")
+	child, ctx := StartSpanFromContext(ctx, "db.query")
+	assert.Equal(root.Context().TraceID(), TraceIDFromContext(ctx))
+	assert.Equal(child.Context().SpanID(), SpanIDFromContext(ctx))
+}
+
+func TestStartSpanFromContextProfilerLabels(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		_, _, stop := startTestTracer(WithProfilerLabels(true))
+		defer stop()
+
+		root, ctx := StartSpanFromContext(context.Background(), "web.request")
+		child, cctx := StartSpanFromContext(ctx, "db.query")
+		labels := map[string]string{}
+		pprof.ForLabels(cctx, func(k, v string) bool {
+			labels[k] = v
+			return true
+		})
+		assert.Equal(map[string]string{
+			traceIDLabel:  strconv.FormatUint(root.Context().TraceID(), 10),
+			spanIDLabel:   strconv.FormatUint(child.Context().SpanID(), 10),
+			spanNameLabel: "db.query",
+		}, labels)
+		child.Finish()
+		root.Finish()
+
+		var set []context.Context
+		defer func(fn func(context.Context)) { setGoroutineLabels = fn }(setGoroutineLabels)
+		setGoroutineLabels = func(ctx context.Context) { set = append(set, ctx) }
+		spanID := func(ctx context.Context) string {
+			v, _ := pprof.Label(ctx, spanIDLabel)
+			return v
+		}
+
+		t.Run("in-order", func(t *testing.T) {
+			set = nil
+			root, ctx := StartSpanFromContext(context.Background(), "web.request")
+			child, _ := StartSpanFromContext(ctx, "db.query")
+			child.Finish()
+			root.Finish()
+			assert.Len(set, 4)
+			// finishing the child restores the labels of its parent
+			assert.Equal(strconv.FormatUint(root.Context().SpanID(), 10), spanID(set[2]))
+			assert.Equal(context.Background(), set[3])
+			assert.Empty(goroutineLabels)
+		})
+
+		t.Run("out-of-order", func(t *testing.T) {
+			set = nil
+			root, ctx := StartSpanFromContext(context.Background(), "web.request")
+			child, _ := StartSpanFromContext(ctx, "db.query")
+			root.Finish()
+			assert.Len(set, 2) // the labels of the child remain
+			child.Finish()
+			assert.Len(set, 3)
+			assert.Equal(context.Background(), set[2])
+			assert.Empty(goroutineLabels)
+		})
+
+		t.Run("other-goroutine", func(t *testing.T) {
+			set = nil
+			root, ctx := StartSpanFromContext(context.Background(), "web.request")
+			child, _ := StartSpanFromContext(ctx, "db.query")
+			done := make(chan struct{})
+			go func() {
+				child.Finish()
+				close(done)
+			}()
+			<-done
+			// the labels of the finishing goroutine are left untouched
+			assert.Len(set, 2)
+			root.Finish()
+			assert.Len(set, 3)
+			assert.Equal(context.Background(), set[2])
+			assert.Empty(goroutineLabels)
+		})
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		_, _, stop := startTestTracer()
+		defer stop()
+
+		s, ctx := StartSpanFromContext(context.Background(), "web.request")
+		defer s.Finish()
+		_, ok := pprof.Label(ctx, spanIDLabel)
+		assert.False(ok)
+		assert.Nil(s.(*span).pprofLabels)
+	})
+}
@@ -1,23 +1,79 @@
 package tracer
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
+	"time"
 )
 
 var errorPrefix = fmt.Sprintf("Datadog Tracer Error (%s): ", tracerVersion)
 
+// The kinds of the errors passed to the handler set using WithErrorHandler.
+var (
+	// ErrTransport is the kind of the errors which occur when sending traces
+	// to the agent or reading its response.
+	ErrTransport = errors.New("transport error")
+
+	// ErrBufferFull is the kind of the errors reported when traces are dropped
+	// because a buffer of the tracer is full.
+	ErrBufferFull = errors.New("buffer full")
+
+	// ErrEncoding is the kind of the errors which occur when encoding traces.
+	ErrEncoding = errors.New("encoding error")
+)
+
+// Error is an error which occurred in the tracer, as passed to the handler set
+// using WithErrorHandler.
+type Error struct {
+	// Kind is the kind of the error: ErrTransport, ErrBufferFull or ErrEncoding.
+	Kind error
+
+	// Err is the error which occurred.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string { return e.Err.Error() }
+
+// newError returns err, as pushed by the tracer, wrapped in an Error of the
+// matching kind.
+func newError(err error) *Error {
+	kind := ErrTransport
+	switch e := err.(type) {
+	case *traceEncodingError:
+		kind = ErrEncoding
+	case *spanBufferFullError:
+		kind = ErrBufferFull
+	case *dataLossError:
+		if e.context == errPayloadQueueFull || e.context == errPayloadBacklogFull {
+			kind = ErrBufferFull
+		}
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// errPayloadQueueFull is the context of the dataLossErrors reported when traces
+// are dropped because the payload queue is full.
+var errPayloadQueueFull = errors.New("payload queue full, dropping trace")
+
+// errPayloadBacklogFull is the context of the dataLossErrors reported when
+// traces are dropped because too many of them are waiting for a payload to be
+// sent to the agent.
+var errPayloadBacklogFull = errors.New("too many traces waiting for the agent, dropping trace")
+
 type traceEncodingError struct{ context error }
 
 func (e *traceEncodingError) Error() string {
 	return fmt.Sprintf("error encoding trace: %s", e.context)
 }
 
-type spanBufferFullError struct{}
+type spanBufferFullError struct {
+	limit int // the maximum number of spans of the trace
+}
 
 func (e *spanBufferFullError) Error() string {
-	return fmt.Sprintf("trace span cap (%d) reached, dropping trace", traceMaxSize)
+	return fmt.Sprintf("trace span cap (%d) reached, dropping new spans of the trace", e.limit)
 }
 
 type dataLossError struct {
@@ -29,6 +85,12 @@ func (e *dataLossError) Error() string {
 	return fmt.Sprintf("lost traces (count: %d), error: %v", e.count, e.context)
 }
 
+type ratesDecodingError struct{ context error }
+
+func (e *ratesDecodingError) Error() string {
+	return fmt.Sprintf("error decoding the sample rates sent by the agent: %v", e.context)
+}
+
 type errorSummary struct {
 	Count   int
 	Example string
@@ -53,17 +115,38 @@ func aggregateErrors(errChan <-chan error) map[string]errorSummary {
 	}
 }
 
-// logErrors logs the errors, preventing log file flooding, when there
-// are many messages, it caps them and shows a quick summary.
-// As of today it only logs using standard golang log package, but
-// later we could send those stats to agent // TODO(ufoot).
-func logErrors(errChan <-chan error) {
+// errorLogInterval is the minimum interval between two messages logged about
+// errors of the same kind, so that an agent outage does not flood the logs.
+const errorLogInterval = time.Minute
+
+// errorLogger logs the errors of the tracer, preventing log file flooding: when
+// there are many messages, it caps them and shows a quick summary, and logs
+// errors of each kind at most once per errorLogInterval. The zero value is ready
+// for use. It is not safe for concurrent use.
+type errorLogger struct {
+	last       map[string]time.Time    // the last time errors of each kind were logged
+	suppressed map[string]errorSummary // the errors which were not logged since
+}
+
+// logErrors logs the errors found in errChan, as of now.
+func (l *errorLogger) logErrors(errChan <-chan error, now time.Time) {
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+		l.suppressed = make(map[string]errorSummary)
+	}
 	errs := aggregateErrors(errChan)
-	for _, v := range errs {
+	for key, v := range errs {
+		v.Count += l.suppressed[key].Count
+		if last, ok := l.last[key]; ok && now.Sub(last) < errorLogInterval {
+			l.suppressed[key] = v
+			continue
+		}
+		delete(l.suppressed, key)
+		l.last[key] = now
 		var repeat string
 		if v.Count > 1 {
 			repeat = " (repeated " + strconv.Itoa(v.Count) + " times)"
 		}
-		log.Println(errorPrefix + v.Example + repeat)
+		logf("%s%s%s", errorPrefix, v.Example, repeat)
 	}
 }
@@ -3,6 +3,7 @@ package tracer
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,3 +37,35 @@ func TestAggregateErrors(t *testing.T) {
 		},
 	}, errs)
 }
+
+func TestErrorLogger(t *testing.T) {
+	assert := assert.New(t)
+	tl := new(testLogger)
+	SetLogger(tl)
+	defer SetLogger(nil)
+
+	var l errorLogger
+	errChan := make(chan error, 10)
+	now := time.Now()
+	logAt := func(d time.Duration, errs ...error) {
+		for _, err := range errs {
+			errChan <- err
+		}
+		l.logErrors(errChan, now.Add(d))
+	}
+	lost := &dataLossError{count: 1, context: errors.New("agent down")}
+
+	logAt(0, lost, lost)
+	assert.Equal([]string{errorPrefix + "lost traces (count: 1), error: agent down (repeated 2 times)"}, tl.Lines())
+
+	// errors of the same kind are suppressed for a minute, others are not
+	logAt(time.Second, lost, &ratesDecodingError{context: errors.New("EOF")})
+	logAt(30*time.Second, lost)
+	assert.Equal([]string{errorPrefix + "error decoding the sample rates sent by the agent: EOF"}, tl.Lines())
+
+	// the suppressed errors are accounted for once logged
+	logAt(time.Minute, lost)
+	assert.Equal([]string{errorPrefix + "lost traces (count: 1), error: agent down (repeated 3 times)"}, tl.Lines())
+	logAt(time.Minute + time.Second)
+	assert.Empty(tl.Lines())
+}
@@ -3,6 +3,9 @@ package tracer
 import (
 	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 )
@@ -32,3 +35,65 @@ func Example() {
 		log.Fatal(err)
 	}
 }
+
+// messageHeaders holds the headers of a message sent through a queue.
+type messageHeaders []struct{ Key, Value string }
+
+// Set implements TextMapWriter.
+func (h *messageHeaders) Set(key, val string) {
+	*h = append(*h, struct{ Key, Value string }{key, val})
+}
+
+// ForeachKey implements TextMapReader.
+func (h messageHeaders) ForeachKey(handler func(key, val string) error) error {
+	for _, kv := range h {
+		if err := handler(kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// An example demonstrating how to propagate a trace through the headers of
+// queued messages, by implementing the TextMapWriter and TextMapReader interfaces.
+// TextMapCarrier and HTTPHeadersCarrier may be used with map[string]string and
+// http.Header values.
+func Example_textMap() {
+	Start()
+	defer Stop()
+
+	// The producer injects the span context into the message headers.
+	span := StartSpan("queue.produce")
+	var headers messageHeaders
+	if err := Inject(span.Context(), &headers); err != nil {
+		log.Fatal(err)
+	}
+	span.Finish()
+
+	// ... send the message, which the consumer then receives
+
+	// The consumer extracts it, continuing the trace.
+	var opts []StartSpanOption
+	if sctx, err := Extract(headers); err == nil {
+		opts = append(opts, ChildOf(sctx))
+	}
+	child := StartSpan("queue.consume", opts...)
+	child.Finish()
+}
+
+// An example demonstrating how to stop the tracer from a signal handler, so
+// that the spans which were finished before shutting down are not lost.
+func Example_signal() {
+	Start()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		// Stop sends all the buffered spans to the agent before returning.
+		Stop()
+		os.Exit(0)
+	}()
+
+	// ... run the application
+}
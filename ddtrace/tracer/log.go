@@ -0,0 +1,78 @@
+package tracer
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Logger is implemented by any destination of the log messages of the tracer,
+// such as *log.Logger. It must be safe for concurrent use.
+type Logger interface {
+	// Printf logs a message, formatting it like fmt.Printf.
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger logs using the standard logger of the log package.
+type stdLogger struct{}
+
+// Printf implements Logger.
+func (stdLogger) Printf(format string, v ...interface{}) { log.Printf(format, v...) }
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = stdLogger{} // guarded by loggerMu
+
+	// debugMode is 1 when debug messages are logged; accessed atomically.
+	debugMode int32
+)
+
+// debugPrefix prefixes the debug messages of the tracer.
+var debugPrefix = fmt.Sprintf("Datadog Tracer Debug (%s): ", tracerVersion)
+
+// warnPrefix prefixes the messages logged in debug mode about probable misuses
+// of the tracer.
+var warnPrefix = fmt.Sprintf("Datadog Tracer Warning (%s): ", tracerVersion)
+
+// SetLogger sets the destination of the log messages of the tracer. By default,
+// they are written using the standard logger of the log package, which is also
+// restored when l is nil.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = stdLogger{}
+	}
+	loggerMu.Lock()
+	logger = l
+	loggerMu.Unlock()
+}
+
+// SetDebug enables or disables debug mode, in which span creations, trace
+// completions and flushes are logged. It may also be enabled when starting the
+// tracer, using WithDebugMode or the DD_TRACE_DEBUG environment variable.
+func SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debugMode, v)
+}
+
+// debugEnabled reports whether debug mode is enabled. Callers should check it
+// before calling debugf, to spare formatting its arguments.
+func debugEnabled() bool { return atomic.LoadInt32(&debugMode) == 1 }
+
+// logf logs a message using the configured Logger.
+func logf(format string, v ...interface{}) {
+	loggerMu.RLock()
+	l := logger
+	loggerMu.RUnlock()
+	l.Printf(format, v...)
+}
+
+// debugf logs a debug message when debug mode is enabled.
+func debugf(format string, v ...interface{}) {
+	if debugEnabled() {
+		logf(debugPrefix+format, v...)
+	}
+}
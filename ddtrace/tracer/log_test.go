@@ -0,0 +1,96 @@
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testLogger records the lines logged by the tracer.
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (tl *testLogger) Printf(format string, v ...interface{}) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.lines = append(tl.lines, fmt.Sprintf(format, v...))
+}
+
+// Lines returns the logged lines and resets them.
+func (tl *testLogger) Lines() []string {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	lines := tl.lines
+	tl.lines = nil
+	return lines
+}
+
+func TestSetLogger(t *testing.T) {
+	assert := assert.New(t)
+	tl := new(testLogger)
+	SetLogger(tl)
+	logf("%s%s", errorPrefix, "message")
+	assert.Equal([]string{errorPrefix + "message"}, tl.Lines())
+
+	SetLogger(nil)
+	assert.Equal(stdLogger{}, logger)
+	logf("%s%s", errorPrefix, "message")
+	assert.Empty(tl.Lines())
+}
+
+func TestDebug(t *testing.T) {
+	tl := new(testLogger)
+	SetLogger(tl)
+	defer SetLogger(nil)
+
+	t.Run("disabled", func(t *testing.T) {
+		tracer, _, stop := startTestTracer()
+		defer stop()
+		tracer.StartSpan("web.request").Finish()
+		tracer.forceFlush()
+		assert.Empty(t, tl.Lines())
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		SetDebug(true)
+		defer SetDebug(false)
+		tracer, _, stop := startTestTracer()
+		defer stop()
+		tracer.StartSpan("web.request").Finish()
+		tracer.forceFlush()
+		lines := tl.Lines()
+		assert.Len(lines, 4)
+		for _, line := range lines {
+			assert.True(strings.HasPrefix(line, debugPrefix), line)
+		}
+		assert.Contains(lines[0], `started span "web.request"`)
+		assert.Contains(lines[1], `finished span "web.request"`)
+		assert.Contains(lines[2], `adding span to payload: name="web.request" service="tracer.test"`)
+		assert.Contains(lines[3], "sending payload: size:")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv(debugEnvVar, "true")
+		defer os.Unsetenv(debugEnvVar)
+		defer SetDebug(false)
+		var c config
+		defaults(&c)
+		assert.True(c.debug)
+		tracer := newTracer(withTransport(newDummyTransport()))
+		defer tracer.Stop()
+		assert.True(debugEnabled())
+
+		os.Setenv(debugEnvVar, "invalid")
+		var c2 config
+		defaults(&c2)
+		assert.False(c2.debug)
+	})
+}
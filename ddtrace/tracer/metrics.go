@@ -0,0 +1,169 @@
+package tracer
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDogstatsdAddr is the default address of the DogStatsD server.
+const defaultDogstatsdAddr = "localhost:8125"
+
+// maxStatsdPacketSize is the maximum size of the packets sent to DogStatsD,
+// which keeps them under the MTU of most networks.
+const maxStatsdPacketSize = 1432
+
+// statsdClient sends metrics to a DogStatsD server, batching them into packets
+// of up to maxStatsdPacketSize bytes.
+type statsdClient struct {
+	conn net.Conn
+	tags string // the tags of the metrics, in the DogStatsD format
+	buf  bytes.Buffer
+
+	// failed is true once sending the metrics failed, so that errors are only
+	// logged once. UDP writes alternate between failing and succeeding while
+	// nothing listens, so it is not reset.
+	failed bool
+}
+
+// newStatsdClient returns a statsdClient sending to the DogStatsD server found
+// at addr, tagging metrics with the given tags.
+func newStatsdClient(addr string, tags ...string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdClient{
+		conn: conn,
+		tags: "|#" + strings.Join(tags, ","),
+	}, nil
+}
+
+// gauge adds a gauge to the current packet.
+func (c *statsdClient) gauge(name string, value float64) {
+	c.add(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+// count adds a count to the current packet.
+func (c *statsdClient) count(name string, value uint64) {
+	c.add(name, strconv.FormatUint(value, 10), "c")
+}
+
+// add adds a metric to the current packet, using the DogStatsD format. The
+// packet is sent first if the metric would not fit in it.
+func (c *statsdClient) add(name, value, typ string) {
+	size := len(name) + 1 + len(value) + 1 + len(typ) + len(c.tags)
+	if c.buf.Len() > 0 && c.buf.Len()+1+size > maxStatsdPacketSize {
+		c.flush()
+	}
+	if c.buf.Len() > 0 {
+		c.buf.WriteByte('\n')
+	}
+	c.buf.WriteString(name)
+	c.buf.WriteByte(':')
+	c.buf.WriteString(value)
+	c.buf.WriteByte('|')
+	c.buf.WriteString(typ)
+	c.buf.WriteString(c.tags)
+}
+
+// flush sends the current packet. Metrics which can not be sent are dropped.
+func (c *statsdClient) flush() {
+	if c.buf.Len() == 0 {
+		return
+	}
+	if _, err := c.conn.Write(c.buf.Bytes()); err != nil {
+		if !c.failed {
+			logf("%sfailed to send metrics to %s: %v", errorPrefix, c.conn.RemoteAddr(), err)
+		}
+		c.failed = true
+	}
+	c.buf.Reset()
+}
+
+// reportRuntimeMetrics reports runtime metrics at the given interval until
+// the tracer is stopped.
+func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
+	defer t.wg.Done()
+	c, err := newStatsdClient(t.config.dogstatsdAddr, "lang:go", "service:"+t.config.serviceName)
+	if err != nil {
+		logf("%sruntime metrics disabled: %v", errorPrefix, err)
+		return
+	}
+	defer c.conn.Close()
+	ticker := getClock().NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			reportRuntimeMetrics(c)
+		case <-t.stopped:
+			return
+		}
+	}
+}
+
+// reportRuntimeMetrics samples the runtime and sends the resulting gauges
+// using c.
+func reportRuntimeMetrics(c *statsdClient) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	c.gauge("runtime.go.num_cpu", float64(runtime.NumCPU()))
+	c.gauge("runtime.go.num_goroutine", float64(runtime.NumGoroutine()))
+	c.gauge("runtime.go.mem_stats.heap_alloc", float64(ms.HeapAlloc))
+	c.gauge("runtime.go.mem_stats.heap_sys", float64(ms.HeapSys))
+	c.gauge("runtime.go.mem_stats.num_gc", float64(ms.NumGC))
+	c.gauge("runtime.go.mem_stats.pause_total_ns", float64(ms.PauseTotalNs))
+	if ms.NumGC > 0 {
+		c.gauge("runtime.go.mem_stats.last_pause_ns", float64(ms.PauseNs[(ms.NumGC+255)%256]))
+	}
+	c.flush()
+}
+
+// reportHealthMetrics reports the health metrics of the tracer at the given
+// interval until the tracer is stopped.
+func (t *tracer) reportHealthMetrics(interval time.Duration) {
+	defer t.wg.Done()
+	tags := []string{"service:" + t.config.serviceName}
+	if t.config.env != "" {
+		tags = append(tags, "env:"+t.config.env)
+	}
+	c, err := newStatsdClient(t.config.dogstatsdAddr, tags...)
+	if err != nil {
+		logf("%shealth metrics disabled: %v", errorPrefix, err)
+		return
+	}
+	defer c.conn.Close()
+	ticker := getClock().NewTicker(interval)
+	defer ticker.Stop()
+	var last Statistics
+	for {
+		select {
+		case <-ticker.C():
+			last = t.sendHealthMetrics(c, last)
+		case <-t.stopped:
+			return
+		}
+	}
+}
+
+// sendHealthMetrics sends the health metrics of the tracer using c. Counters
+// are sent as counts since the previous report, whose statistics are given. It
+// returns the current statistics.
+func (t *tracer) sendHealthMetrics(c *statsdClient, prev Statistics) Statistics {
+	cur := t.stats.snapshot()
+	c.count("datadog.tracer.spans_started", cur.SpansStarted-prev.SpansStarted)
+	c.count("datadog.tracer.spans_finished", cur.SpansFinished-prev.SpansFinished)
+	c.count("datadog.tracer.spans_dropped", cur.SpansDropped-prev.SpansDropped)
+	c.count("datadog.tracer.traces_limited", cur.TracesLimited-prev.TracesLimited)
+	c.count("datadog.tracer.traces_flushed", cur.TracesFlushed-prev.TracesFlushed)
+	c.count("datadog.tracer.flush.errors", cur.FlushErrors-prev.FlushErrors)
+	c.count("datadog.tracer.flush.bytes", cur.BytesSent-prev.BytesSent)
+	c.gauge("datadog.tracer.queue.fill_ratio", float64(len(t.payloadQueue))/float64(cap(t.payloadQueue)))
+	c.flush()
+	return cur
+}
@@ -0,0 +1,190 @@
+package tracer
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withRuntimeMetricsInterval sets the runtime metrics interval, bypassing the
+// minimum enforced by WithRuntimeMetrics.
+func withRuntimeMetricsInterval(d time.Duration) StartOption {
+	return func(c *config) {
+		c.runtimeMetricsInterval = d
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	assert := assert.New(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+
+	tracer := newTracer(
+		withTransport(newDummyTransport()),
+		WithServiceName("api"),
+		WithDogstatsdAddress(conn.LocalAddr().String()),
+		withRuntimeMetricsInterval(10*time.Millisecond),
+	)
+	defer tracer.Stop()
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(err)
+	lines := strings.Split(string(buf[:n]), "\n")
+	names := make(map[string]bool)
+	for _, line := range lines {
+		assert.True(strings.HasSuffix(line, "|g|#lang:go,service:api"), line)
+		names[line[:strings.Index(line, ":")]] = true
+	}
+	for _, name := range []string{
+		"runtime.go.num_cpu",
+		"runtime.go.num_goroutine",
+		"runtime.go.mem_stats.heap_alloc",
+		"runtime.go.mem_stats.pause_total_ns",
+	} {
+		assert.True(names[name], name)
+	}
+}
+
+func TestRuntimeMetricsStop(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := conn.LocalAddr().String()
+	conn.Close() // unreachable
+
+	tracer := newTracer(
+		withTransport(newDummyTransport()),
+		WithDogstatsdAddress(addr),
+		withRuntimeMetricsInterval(time.Millisecond),
+	)
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		tracer.Stop() // waits for the reporting goroutine
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("tracer did not stop")
+	}
+}
+
+func TestRuntimeMetricsOptions(t *testing.T) {
+	assert := assert.New(t)
+	var c config
+	defaults(&c)
+	assert.Zero(c.runtimeMetricsInterval)
+	assert.Equal("localhost:8125", c.dogstatsdAddr)
+	WithRuntimeMetrics(time.Millisecond)(&c)
+	assert.Zero(c.runtimeMetricsInterval)
+	WithRuntimeMetrics(10 * time.Second)(&c)
+	assert.Equal(10*time.Second, c.runtimeMetricsInterval)
+
+	// an invalid address disables reporting
+	tracer := newTracer(withTransport(newDummyTransport()), WithDogstatsdAddress("localhost:port"), WithRuntimeMetrics(time.Second))
+	tracer.Stop()
+}
+
+func TestStatsdClient(t *testing.T) {
+	assert := assert.New(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+
+	c, err := newStatsdClient(conn.LocalAddr().String(), "service:api", "env:prod")
+	assert.NoError(err)
+	defer c.conn.Close()
+	for i := 0; i < 100; i++ {
+		c.count("datadog.tracer.spans_started", uint64(i))
+	}
+	c.gauge("datadog.tracer.queue.fill_ratio", 0.5)
+	c.flush()
+	c.flush() // nothing left to send
+
+	var lines []string
+	buf := make([]byte, 65536)
+	for len(lines) < 101 {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(err) {
+			return
+		}
+		assert.True(n <= maxStatsdPacketSize, "packet of %d bytes", n)
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	assert.Len(lines, 101)
+	assert.Equal("datadog.tracer.spans_started:0|c|#service:api,env:prod", lines[0])
+	assert.Equal("datadog.tracer.spans_started:99|c|#service:api,env:prod", lines[99])
+	assert.Equal("datadog.tracer.queue.fill_ratio:0.5|g|#service:api,env:prod", lines[100])
+}
+
+func TestHealthMetrics(t *testing.T) {
+	assert := assert.New(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+	clock := newFakeClock()
+	defer setClock(clock)()
+
+	tracer, _, stop := startTestTracer(
+		WithServiceName("api"),
+		WithEnv("prod"),
+		WithDogstatsdAddress(conn.LocalAddr().String()),
+		WithHealthMetrics(time.Minute),
+	)
+	defer stop()
+	clock.WaitTickers(2) // flush and health metrics
+
+	read := func() map[string]string {
+		buf := make([]byte, maxStatsdPacketSize)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(err)
+		metrics := make(map[string]string)
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			assert.True(strings.HasSuffix(line, "|#service:api,env:prod"), line)
+			i := strings.Index(line, ":")
+			metrics[line[:i]] = strings.TrimSuffix(line[i+1:], "|#service:api,env:prod")
+		}
+		return metrics
+	}
+
+	root := tracer.StartSpan("web.request")
+	tracer.StartSpan("db.query", ChildOf(root.Context())).Finish()
+	root.Finish()
+	clock.Advance(time.Minute)
+	metrics := read()
+	assert.Equal("2|c", metrics["datadog.tracer.spans_started"])
+	assert.Equal("2|c", metrics["datadog.tracer.spans_finished"])
+	assert.Equal("0|c", metrics["datadog.tracer.spans_dropped"])
+	assert.Equal("0|c", metrics["datadog.tracer.flush.errors"])
+	assert.Equal("0|g", metrics["datadog.tracer.queue.fill_ratio"])
+
+	// counts are reset after each report
+	tracer.StartSpan("web.request").Finish()
+	clock.Advance(time.Minute)
+	metrics = read()
+	assert.Equal("1|c", metrics["datadog.tracer.spans_started"])
+	assert.Equal("1|c", metrics["datadog.tracer.spans_finished"])
+}
+
+func TestHealthMetricsOptions(t *testing.T) {
+	assert := assert.New(t)
+	var c config
+	defaults(&c)
+	assert.Zero(c.healthMetricsInterval)
+	WithHealthMetrics(time.Millisecond)(&c)
+	assert.Zero(c.healthMetricsInterval)
+	WithHealthMetrics(10 * time.Second)(&c)
+	assert.Equal(10*time.Second, c.healthMetricsInterval)
+
+	// an invalid address disables reporting
+	tracer := newTracer(withTransport(newDummyTransport()), WithDogstatsdAddress("localhost:port"), WithHealthMetrics(time.Second))
+	tracer.Stop()
+}
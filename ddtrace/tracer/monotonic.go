@@ -0,0 +1,14 @@
+package tracer
+
+import "time"
+
+// monotonicBase is the reference of the readings of the monotonic clock.
+var monotonicBase = time.Now()
+
+// monotonicNow returns the number of nanoseconds elapsed since monotonicBase,
+// as measured by the monotonic clock. Unlike now, its readings are not affected
+// by changes of the wall clock, e.g. when it is stepped by NTP, so they are used
+// to measure the duration of spans.
+var monotonicNow = func() int64 {
+	return int64(getClock().Now().Sub(monotonicBase))
+}
@@ -1,8 +1,15 @@
 package tracer
 
 import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -17,10 +24,14 @@ type config struct {
 	// serviceName specifies the name of this application.
 	serviceName string
 
+	// env and version specify the environment of the application and the
+	// version of the service, set on spans unless empty.
+	env, version string
+
 	// sampler specifies the sampler that will be used for sampling traces.
 	sampler Sampler
 
-	// agentAddr specifies the hostname and  of the agent where the traces
+	// agentAddr specifies the hostname and port of the agent where the traces
 	// are sent to.
 	agentAddr string
 
@@ -31,8 +42,93 @@ type config struct {
 	// transport specifies the Transport interface which will be used to send data to the agent.
 	transport transport
 
+	// agentlessSite and agentlessAPIKey, when the latter is set, are the Datadog
+	// site and API key used to send traces directly to the intake.
+	agentlessSite, agentlessAPIKey string
+
+	// logOutput, when set, is the writer to which traces are written as JSON
+	// instead of being sent to the agent.
+	logOutput io.Writer
+
+	// proxyURL, when set, is the URL of the proxy through which the agent is
+	// reached, instead of the one found in the environment.
+	proxyURL *url.URL
+
+	// tlsConfig, when set, enables TLS for the connections to the agent.
+	tlsConfig *tls.Config
+
+	// httpClient, when set, is the HTTP client used to send data to the agent.
+	httpClient *http.Client
+
+	// httpTimeout, when set, is the timeout of the requests sent to the agent
+	// using the default HTTP client.
+	httpTimeout time.Duration
+
 	// propagator propagates span context cross-process
 	propagator Propagator
+
+	// flushInterval specifies the interval at which traces are flushed to the agent.
+	flushInterval time.Duration
+
+	// payloadQueueSize specifies the number of finished traces which may be
+	// waiting to be added onto the payload before new ones are dropped.
+	payloadQueueSize int
+
+	// payloadSizeLimit specifies the payload size in bytes which triggers a flush.
+	payloadSizeLimit int
+
+	// expvarStats, when true, publishes the tracer statistics using expvar.
+	expvarStats bool
+
+	// partialFlushMinSpans specifies the number of finished spans in an incomplete
+	// trace which triggers flushing them; 0 disables partial flushing.
+	partialFlushMinSpans int
+
+	// tagLimits bounds the tags held by each span.
+	tagLimits tagLimits
+
+	// reportHostname, when true, sets the hostname on root spans.
+	reportHostname bool
+
+	// hostname, pid and runtimeVersion are captured when the tracer starts and
+	// set on root spans; hostname is empty when it is not reported.
+	hostname       string
+	pid            int
+	runtimeVersion string
+
+	// runtimeMetricsInterval specifies the interval at which runtime metrics
+	// are reported; 0 disables them.
+	runtimeMetricsInterval time.Duration
+
+	// healthMetricsInterval specifies the interval at which the health metrics
+	// of the tracer are reported; 0 disables them.
+	healthMetricsInterval time.Duration
+
+	// dogstatsdAddr specifies the address of the DogStatsD server to which
+	// runtime and health metrics are sent.
+	dogstatsdAddr string
+
+	// retryMaxBytes specifies the size of the largest payload which is retained
+	// to be sent again when sending it to the agent fails.
+	retryMaxBytes int
+
+	// profilerLabels, when true, sets pprof labels identifying the spans started
+	// using StartSpanFromContext.
+	profilerLabels bool
+
+	// flushCallbacks are called after each attempt to send traces to the agent.
+	flushCallbacks []func(FlushStats)
+
+	// errorHandler is passed the errors of the tracer instead of logging them,
+	// if not nil.
+	errorHandler func(error)
+
+	// maxSpansPerTrace is the maximum number of spans of a trace.
+	maxSpansPerTrace int
+
+	// abandonedSpanTimeout specifies the age after which spans which are still
+	// open are reported, in debug mode; 0 disables it.
+	abandonedSpanTimeout time.Duration
 }
 
 // StartOption represents a function that can be provided as a parameter to Start.
@@ -41,17 +137,150 @@ type StartOption func(*config)
 // defaults sets the default values for a config.
 func defaults(c *config) {
 	c.serviceName = filepath.Base(os.Args[0])
+	if v := strings.TrimSpace(os.Getenv(serviceEnvVar)); v != "" {
+		c.serviceName = v
+	}
+	c.globalTags = tagsFromEnv()
 	c.sampler = NewAllSampler()
-	c.agentAddr = defaultAddress
+	if rules, err := samplingRulesFromEnv(); err != nil {
+		logf("%s%v", errorPrefix, err)
+	} else if rules != nil {
+		c.sampler = NewRuleSampler(rules, 1)
+	}
+	if v, err := strconv.ParseBool(os.Getenv(debugEnvVar)); err == nil {
+		c.debug = v
+	}
+	c.env = os.Getenv(envEnvVar)
+	c.version = os.Getenv(versionEnvVar)
+	c.agentAddr = agentAddrFromEnv()
+	c.flushInterval = flushInterval
+	c.payloadQueueSize = payloadQueueSize
+	c.payloadSizeLimit = payloadSizeLimit
+	c.retryMaxBytes = payloadMaxLimit
+	c.partialFlushMinSpans = partialFlushMinSpans
+	c.dogstatsdAddr = defaultDogstatsdAddr
+	c.reportHostname = true
+	c.abandonedSpanTimeout = defaultAbandonedSpanTimeout
+	c.maxSpansPerTrace = traceMaxSize
+	c.tagLimits = tagLimits{
+		maxTags:        defaultMaxTagsPerSpan,
+		maxValueLength: defaultMaxTagValueLength,
+	}
+}
+
+// partialFlushMinSpans is the default number of finished spans which triggers
+// a partial flush of a trace.
+const partialFlushMinSpans = 500
+
+// defaultSocketAPM is the path of the Unix domain socket which is used to reach
+// the agent when no address is configured, if it exists.
+var defaultSocketAPM = "/var/run/datadog/apm.socket"
+
+const (
+	// debugEnvVar is the environment variable enabling debug mode, when true.
+	debugEnvVar = "DD_TRACE_DEBUG"
+
+	// serviceEnvVar is the environment variable holding the default service
+	// name.
+	serviceEnvVar = "DD_SERVICE"
+
+	// tagsEnvVar is the environment variable holding global tags, as a comma
+	// separated list of key:value pairs.
+	tagsEnvVar = "DD_TAGS"
+
+	// envEnvVar is the environment variable holding the environment of the
+	// application.
+	envEnvVar = "DD_ENV"
+
+	// versionEnvVar is the environment variable holding the version of the
+	// service.
+	versionEnvVar = "DD_VERSION"
+)
+
+const (
+	// agentHostEnvVar is the environment variable holding the agent hostname.
+	agentHostEnvVar = "DD_AGENT_HOST"
+
+	// agentPortEnvVar is the environment variable holding the agent port.
+	agentPortEnvVar = "DD_TRACE_AGENT_PORT"
+
+	// lambdaEnvVar is the environment variable holding the name of the function,
+	// set when running on AWS Lambda.
+	lambdaEnvVar = "AWS_LAMBDA_FUNCTION_NAME"
+)
+
+// tagsFromEnv returns the global tags found in tagsEnvVar, or nil if there are
+// none. Entries which are not key:value pairs are skipped.
+func tagsFromEnv() map[string]interface{} {
+	v := os.Getenv(tagsEnvVar)
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	tags := make(map[string]interface{})
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.IndexByte(entry, ':')
+		if i <= 0 || strings.TrimSpace(entry[:i]) == "" {
+			logf("%sinvalid %s entry %q, expected key:value", errorPrefix, tagsEnvVar, entry)
+			continue
+		}
+		tags[strings.TrimSpace(entry[:i])] = strings.TrimSpace(entry[i+1:])
+	}
+	return tags
+}
+
+// agentAddrFromEnv returns the agent address found in agentHostEnvVar and
+// agentPortEnvVar. Values which are empty or invalid fall back to the defaults.
+// When neither is set and the socket found at defaultSocketAPM exists, it is used
+// instead of TCP.
+func agentAddrFromEnv() string {
+	host := strings.TrimSpace(os.Getenv(agentHostEnvVar))
+	if host == "" && strings.TrimSpace(os.Getenv(agentPortEnvVar)) == "" {
+		if _, err := os.Stat(defaultSocketAPM); err == nil {
+			return unixAddrPrefix + defaultSocketAPM
+		}
+	}
+	// accept IPv6 literals both with and without brackets
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		host = defaultHostname
+	}
+	port := strings.TrimSpace(os.Getenv(agentPortEnvVar))
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		if port != "" {
+			logf("%sinvalid %s %q, using %s", errorPrefix, agentPortEnvVar, port, defaultPort)
+		}
+		port = defaultPort
+	}
+	return net.JoinHostPort(host, port)
 }
 
 // WithDebugMode enables debug mode on the tracer, resulting in more verbose logging.
+// It is enabled by default when the DD_TRACE_DEBUG environment variable is true.
+// In debug mode, spans which are not finished after some time are also reported,
+// see WithAbandonedSpanTimeout, and SetDebug.
 func WithDebugMode(enabled bool) StartOption {
 	return func(c *config) {
 		c.debug = enabled
 	}
 }
 
+// WithAbandonedSpanTimeout sets the age after which spans which were not finished
+// are logged as abandoned, once each, when the tracer is started in debug mode.
+// The default is 10 minutes, and values lower than or equal to zero disable the
+// detection.
+func WithAbandonedSpanTimeout(timeout time.Duration) StartOption {
+	return func(c *config) {
+		if timeout < 0 {
+			timeout = 0
+		}
+		c.abandonedSpanTimeout = timeout
+	}
+}
+
 // WithPropagator sets an alternative propagator to be used by the tracer.
 func WithPropagator(p Propagator) StartOption {
 	return func(c *config) {
@@ -59,23 +288,312 @@ func WithPropagator(p Propagator) StartOption {
 	}
 }
 
-// WithServiceName sets the default service name to be used with the tracer.
+// WithServiceName sets the default service name to be used with the tracer. It
+// takes precedence over the DD_SERVICE environment variable, which otherwise
+// defaults to the name of the program.
 func WithServiceName(name string) StartOption {
 	return func(c *config) {
 		c.serviceName = name
 	}
 }
 
+// WithEnv sets the environment of the application, such as "prod" or "staging",
+// which is set as the "env" tag on all spans. It takes precedence over the DD_ENV
+// environment variable.
+func WithEnv(env string) StartOption {
+	return func(c *config) {
+		c.env = env
+	}
+}
+
+// WithServiceVersion sets the version of the service, which is set as the
+// "version" tag on the spans of the service set using WithServiceName. It takes
+// precedence over the DD_VERSION environment variable.
+func WithServiceVersion(version string) StartOption {
+	return func(c *config) {
+		c.version = version
+	}
+}
+
 // WithAgentAddr sets the address where the agent is located. The default is
-// localhost:8126. It should contain both host and port.
+// localhost:8126, or the one specified by the DD_AGENT_HOST and DD_TRACE_AGENT_PORT
+// environment variables. It should contain both host and port. Addresses starting
+// with "unix://" are treated as the path of a Unix domain socket. Addresses may
+// also be URLs starting with "http://" or "https://", the latter enabling TLS.
 func WithAgentAddr(addr string) StartOption {
 	return func(c *config) {
 		c.agentAddr = addr
 	}
 }
 
+// WithHTTPClient sets the HTTP client used to send data to the agent, such as
+// one going through a proxy or using TLS. Its settings are used as is, so that
+// WithHTTPTimeout does not apply to it. It can not be used to reach agents
+// listening on Unix domain sockets.
+func WithHTTPClient(client *http.Client) StartOption {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// WithAgentlessEndpoint sends traces directly to the intake of the given Datadog
+// site, such as "datadoghq.com" or "datadoghq.eu", authenticated with apiKey,
+// rather than to an agent, e.g. from short-lived CI jobs where running one is
+// not practical. Payloads are compressed, and rate limited requests are retried
+// as the intake asks. As it does not provide sampling rates, traces are kept
+// unless samplers decide otherwise. Errors are reported like those of the agent
+// connection, and the API key is never logged.
+func WithAgentlessEndpoint(site, apiKey string) StartOption {
+	return func(c *config) {
+		c.agentlessSite = site
+		c.agentlessAPIKey = apiKey
+	}
+}
+
+// WithLogOutput writes traces to w rather than sending them to the agent, as
+// single-line JSON objects, one per trace, in the format which the Datadog
+// forwarder ingests from logs. It is meant for serverless environments, such as
+// AWS Lambda where it is enabled by default, writing to the standard output,
+// unless an agent address is configured. Flush writes the buffered traces
+// before returning, so that they can be drained before the function is frozen.
+func WithLogOutput(w io.Writer) StartOption {
+	return func(c *config) {
+		c.logOutput = w
+	}
+}
+
+// WithProxyURL sets the URL of the HTTP proxy through which the agent is reached.
+// By default, the proxy is read from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables, as described by http.ProxyFromEnvironment, except for
+// agents on localhost, which are always reached directly. It does not apply to
+// Unix domain sockets, nor to the HTTP client set with WithHTTPClient.
+func WithProxyURL(u *url.URL) StartOption {
+	return func(c *config) {
+		c.proxyURL = u
+	}
+}
+
+// WithTLSConfig enables TLS for the connections to the agent, using cfg, which
+// may hold custom root CAs or client certificates. It also applies to agent
+// addresses starting with "https://". It does not apply to Unix domain sockets,
+// nor to the HTTP client set with WithHTTPClient.
+func WithTLSConfig(cfg *tls.Config) StartOption {
+	return func(c *config) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithHTTPTimeout sets the timeout of the requests sent to the agent using the
+// default HTTP client. The default is one second, and values lower than or equal
+// to zero are ignored.
+func WithHTTPTimeout(timeout time.Duration) StartOption {
+	return func(c *config) {
+		if timeout > 0 {
+			c.httpTimeout = timeout
+		}
+	}
+}
+
+// WithUDS sets the path of the Unix domain socket on which the agent listens.
+// It is a shorthand for using WithAgentAddr with the "unix://" prefix.
+func WithUDS(path string) StartOption {
+	return WithAgentAddr(unixAddrPrefix + path)
+}
+
+// WithFlushInterval sets the interval at which traces are flushed to the agent.
+// The default is 2 seconds. Intervals shorter than 100 milliseconds are ignored.
+func WithFlushInterval(d time.Duration) StartOption {
+	return func(c *config) {
+		if d >= minFlushInterval {
+			c.flushInterval = d
+		}
+	}
+}
+
+// WithQueueSize sets the number of finished traces which may be buffered while
+// waiting to be encoded, after which new traces are dropped. The default is 1000.
+// Values lower than 1 are ignored.
+func WithQueueSize(n int) StartOption {
+	return func(c *config) {
+		if n > 0 {
+			c.payloadQueueSize = n
+		}
+	}
+}
+
+// WithPayloadSizeLimit sets the size in bytes which, once reached by the encoded
+// traces, triggers a flush to the agent ahead of the flush interval. The default
+// is 4.75MB. Values lower than 1 or higher than 9.5MB are ignored.
+func WithPayloadSizeLimit(n int) StartOption {
+	return func(c *config) {
+		if n > 0 && n <= payloadMaxLimit {
+			c.payloadSizeLimit = n
+		}
+	}
+}
+
+// WithExpvarStats publishes the statistics returned by Stats using the expvar
+// package, under the name "datadog.tracer".
+func WithExpvarStats() StartOption {
+	return func(c *config) {
+		c.expvarStats = true
+	}
+}
+
+// WithRetryMaxBytes sets the size in bytes of the largest payload which is kept
+// to be sent again when the agent can not be reached or responds with a server
+// error. Larger payloads are dropped on the first failure. The default of 9.5MB
+// allows retrying all payloads, while 0 disables retries.
+func WithRetryMaxBytes(n int) StartOption {
+	return func(c *config) {
+		if n >= 0 {
+			c.retryMaxBytes = n
+		}
+	}
+}
+
+// WithPartialFlushing sets the number of finished spans after which the spans
+// of a trace are sent to the agent, without waiting for the rest of the trace to
+// finish. The agent reassembles them using the shared trace ID. This bounds the
+// memory used by long-running traces having many spans. The default is 500, and
+// values lower than 1 disable partial flushing.
+func WithPartialFlushing(minSpans int) StartOption {
+	return func(c *config) {
+		if minSpans < 0 {
+			minSpans = 0
+		}
+		c.partialFlushMinSpans = minSpans
+	}
+}
+
+// WithHostnameReporting sets whether the hostname of the machine is set on root
+// spans, under the "_dd.hostname" tag. It is reported by default, and may be
+// disabled in privacy-sensitive environments.
+func WithHostnameReporting(enabled bool) StartOption {
+	return func(c *config) {
+		c.reportHostname = enabled
+	}
+}
+
+// WithProfilerLabels enables labelling the CPU profiles of the program with the
+// trace ID, span ID and operation name of the spans started using
+// StartSpanFromContext. The labels are set on the returned context, as well as
+// on the calling goroutine until the span finishes, when its previous labels
+// are restored. Goroutines can only set their own labels: a span finished by
+// another goroutine leaves its labels on the one which started it, until that
+// goroutine finishes a span started before it. Labels can be used to filter
+// profiles, e.g. "go tool pprof -tagfocus".
+func WithProfilerLabels(enabled bool) StartOption {
+	return func(c *config) {
+		c.profilerLabels = enabled
+	}
+}
+
+// WithFlushCallback registers fn to be called after each attempt to send the
+// buffered traces to the agent, with the outcome of the attempt. It may be given
+// several times to register several callbacks. Callbacks are called in order by
+// the goroutine flushing the traces, which they should not block; those which
+// panic are recovered from.
+func WithFlushCallback(fn func(FlushStats)) StartOption {
+	return func(c *config) {
+		if fn != nil {
+			c.flushCallbacks = append(c.flushCallbacks, fn)
+		}
+	}
+}
+
+// WithErrorHandler sets fn to be passed the errors which occur in the tracer, such
+// as failures to send traces to the agent, instead of logging them. The errors are
+// of type *Error, whose Kind allows telling them apart. The handler is called by a
+// goroutine of its own, one error at a time; when it can not keep up, the oldest
+// errors are dropped, so that it never slows down the tracer. Panics are recovered
+// from. Passing nil restores the logging of the errors.
+func WithErrorHandler(fn func(error)) StartOption {
+	return func(c *config) {
+		c.errorHandler = fn
+	}
+}
+
+// WithMaxSpansPerTrace sets the maximum number of spans of a trace, so that code
+// starting spans in a loop can not exhaust the memory. Once it is reached, new
+// spans of the trace are dropped: they can be used as usual, but are not sent,
+// and their children are dropped too. This is reported once per trace, and the
+// number of dropped spans is set on its root span, or, when using partial
+// flushing, on the first span of each part sent once the root was, as the count
+// of the spans dropped so far. The default is 100000, and
+// values lower than 1 are ignored.
+func WithMaxSpansPerTrace(n int) StartOption {
+	return func(c *config) {
+		if n > 0 {
+			c.maxSpansPerTrace = n
+		}
+	}
+}
+
+// WithMaxTagsPerSpan sets the maximum number of string tags held by a span.
+// Tags set once it is reached are dropped, while existing ones can still be
+// updated. The default is 256, and values lower than 1 remove the limit.
+func WithMaxTagsPerSpan(n int) StartOption {
+	return func(c *config) {
+		if n < 0 {
+			n = 0
+		}
+		c.tagLimits.maxTags = n
+	}
+}
+
+// WithMaxTagValueLength sets the maximum length, in runes, of string tag values.
+// Longer values are truncated and ended with an ellipsis, and the span gets a
+// "_dd.truncated.<key>" metric holding the original length. The default is 5000,
+// and values lower than 1 remove the limit.
+func WithMaxTagValueLength(n int) StartOption {
+	return func(c *config) {
+		if n < 0 {
+			n = 0
+		}
+		c.tagLimits.maxValueLength = n
+	}
+}
+
+// WithRuntimeMetrics enables reporting Go runtime metrics, such as the number of
+// goroutines, the heap size and the GC pauses, at the given interval. They are
+// sent as gauges to the DogStatsD server, tagged with the service name. Intervals
+// lower than one second are ignored.
+func WithRuntimeMetrics(interval time.Duration) StartOption {
+	return func(c *config) {
+		if interval >= time.Second {
+			c.runtimeMetricsInterval = interval
+		}
+	}
+}
+
+// WithHealthMetrics enables reporting the health metrics of the tracer at the
+// given interval: the numbers of spans started, finished and dropped, of traces
+// limited and flushed, of flush errors and bytes sent since the previous report,
+// named like datadog.tracer.spans_started, and the fill ratio of the queue of
+// finished traces. They are sent to the DogStatsD server, tagged with the service
+// name and environment. Intervals lower than one second are ignored.
+func WithHealthMetrics(interval time.Duration) StartOption {
+	return func(c *config) {
+		if interval >= time.Second {
+			c.healthMetricsInterval = interval
+		}
+	}
+}
+
+// WithDogstatsdAddress sets the address of the DogStatsD server to which runtime
+// and health metrics are sent. The default is localhost:8125.
+func WithDogstatsdAddress(addr string) StartOption {
+	return func(c *config) {
+		c.dogstatsdAddr = addr
+	}
+}
+
 // WithGlobalTag sets a key/value pair which will be set as a tag on all spans
-// created by tracer. This option may be used multiple times.
+// created by tracer. This option may be used multiple times. Tags set on a
+// span using the same key take precedence over the global value. Global tags
+// may also be given in the DD_TAGS environment variable, as a comma separated
+// list of key:value pairs, over which this option takes precedence.
 func WithGlobalTag(k string, v interface{}) StartOption {
 	return func(c *config) {
 		if c.globalTags == nil {
@@ -86,7 +604,9 @@ func WithGlobalTag(k string, v interface{}) StartOption {
 }
 
 // WithSampler sets the given sampler to be used with the tracer. By default
-// an all-permissive sampler is used.
+// an all-permissive sampler is used, unless sampling rules are specified in
+// the DD_TRACE_SAMPLING_RULES environment variable (see NewRuleSampler). It may be
+// replaced once the tracer is started using SetSampler.
 func WithSampler(s Sampler) StartOption {
 	return func(c *config) {
 		c.sampler = s
@@ -109,6 +629,7 @@ func Tag(k string, v interface{}) StartSpanOption {
 }
 
 // ServiceName sets the given service name on the started span. For example "http.server".
+// By default, spans have the service of their parent, or the one of the tracer.
 func ServiceName(name string) StartSpanOption {
 	return Tag(ext.ServiceName, name)
 }
@@ -133,8 +654,20 @@ func ChildOf(ctx ddtrace.SpanContext) StartSpanOption {
 	}
 }
 
+// FollowsFrom tells StartSpan to use the given context as the origin of the
+// created span, which runs asynchronously to it, such as work handed off to a
+// background goroutine or a queue. The span belongs to the same trace, but its
+// parent's spans are flushed without waiting for it to finish, as they would
+// otherwise be held for as long as the asynchronous work runs.
+func FollowsFrom(ctx ddtrace.SpanContext) StartSpanOption {
+	return func(cfg *ddtrace.StartSpanConfig) {
+		cfg.Parent = ctx
+		cfg.FollowsFrom = true
+	}
+}
+
 // StartTime sets a custom time as the start time for the created span. By
-// default a span is started using the creation time.
+// default, or when t is zero, a span is started using the creation time.
 func StartTime(t time.Time) StartSpanOption {
 	return func(cfg *ddtrace.StartSpanConfig) {
 		cfg.StartTime = t
@@ -147,7 +680,9 @@ func StartTime(t time.Time) StartSpanOption {
 type FinishOption = ddtrace.FinishOption
 
 // FinishTime sets the given time as the finishing time for the span. By default,
-// the current time is used.
+// or when t is zero, the current time is used. Together with StartTime, it
+// allows recording spans after the fact. A span finished before its start time
+// is given a zero duration.
 func FinishTime(t time.Time) FinishOption {
 	return func(cfg *ddtrace.FinishConfig) {
 		cfg.FinishTime = t
@@ -156,8 +691,28 @@ func FinishTime(t time.Time) FinishOption {
 
 // WithError marks the span as having had an error. It uses the information from
 // err to set tags such as the error message, error type and stack trace.
+// A nil err leaves the span as it is, keeping an error which it was marked with
+// earlier by setting the ext.Error tag, e.g. by a middleware while it was running.
 func WithError(err error) FinishOption {
 	return func(cfg *ddtrace.FinishConfig) {
 		cfg.Error = err
 	}
 }
+
+// NoDebugStack prevents any error presented using the WithError finishing option
+// from generating a stack trace. This is useful in situations where errors are frequent
+// and performance is critical.
+func NoDebugStack() FinishOption {
+	return func(cfg *ddtrace.FinishConfig) {
+		cfg.NoDebugStack = true
+	}
+}
+
+// StackFrames limits the number of stack frames included into erroneous spans to n, starting from skip.
+// By default, up to 32 frames are included, starting at the call site of Finish.
+func StackFrames(n, skip uint) FinishOption {
+	return func(cfg *ddtrace.FinishConfig) {
+		cfg.StackFrames = n
+		cfg.SkipStackFrames = skip
+	}
+}
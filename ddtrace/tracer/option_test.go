@@ -1,7 +1,18 @@
 package tracer
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +30,9 @@ func TestTracerOptionsDefaults(t *testing.T) {
 	assert.Equal(float64(1), c.sampler.(RateSampler).Rate())
 	assert.Equal("tracer.test", c.serviceName)
 	assert.Equal("localhost:8126", c.agentAddr)
+	assert.Equal(2*time.Second, c.flushInterval)
+	assert.Equal(1000, c.payloadQueueSize)
+	assert.Equal(int(payloadSizeLimit), c.payloadSizeLimit)
 }
 
 func TestTracerOptions(t *testing.T) {
@@ -30,6 +44,8 @@ func TestTracerOptions(t *testing.T) {
 		WithGlobalTag("k", "v"),
 		WithDebugMode(true),
 	)
+	defer SetDebug(false)
+	assert.True(debugEnabled())
 	c := tracer.config
 	assert.Equal(float64(0.5), c.sampler.(RateSampler).Rate())
 	assert.Equal("api-intake", c.serviceName)
@@ -38,3 +54,302 @@ func TestTracerOptions(t *testing.T) {
 	assert.Equal("v", c.globalTags["k"])
 	assert.True(c.debug)
 }
+
+func TestTracerBufferOptions(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(
+			WithFlushInterval(time.Second),
+			WithQueueSize(10),
+			WithPayloadSizeLimit(1024),
+			WithRetryMaxBytes(0),
+		)
+		defer tracer.Stop()
+		assert.Equal(time.Second, tracer.config.flushInterval)
+		assert.Equal(10, tracer.config.payloadQueueSize)
+		assert.Equal(10, cap(tracer.payloadQueue))
+		assert.Equal(1024, tracer.config.payloadSizeLimit)
+		assert.Equal(0, tracer.config.transport.(*httpTransport).retryMaxBytes)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		var c config
+		defaults(&c)
+		for _, fn := range []StartOption{
+			WithFlushInterval(time.Millisecond),
+			WithQueueSize(0),
+			WithPayloadSizeLimit(-1),
+			WithPayloadSizeLimit(payloadMaxLimit + 1),
+		} {
+			fn(&c)
+		}
+		assert.Equal(flushInterval, c.flushInterval)
+		assert.Equal(payloadQueueSize, c.payloadQueueSize)
+		assert.Equal(int(payloadSizeLimit), c.payloadSizeLimit)
+	})
+}
+
+func TestTracerEnvVersion(t *testing.T) {
+	t.Run("options", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(
+			withTransport(newDummyTransport()),
+			WithServiceName("orders"),
+			WithEnv("prod"),
+			WithServiceVersion("1.2.3"),
+		)
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		assert.Equal("prod", root.Meta[ext.Environment])
+		assert.Equal("1.2.3", root.Meta[ext.Version])
+
+		// spans of other services are only given the environment
+		child := tracer.StartSpan("redis.command", ChildOf(root.Context()), ServiceName("redis")).(*span)
+		assert.Equal("prod", child.Meta[ext.Environment])
+		assert.NotContains(child.Meta, ext.Version)
+
+		// span tags take precedence
+		span := tracer.StartSpan("web.request", Tag(ext.Environment, "test"), Tag(ext.Version, "2.0")).(*span)
+		assert.Equal("test", span.Meta[ext.Environment])
+		assert.Equal("2.0", span.Meta[ext.Version])
+	})
+
+	t.Run("env", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv(envEnvVar, "staging")
+		os.Setenv(versionEnvVar, "0.1")
+		defer os.Unsetenv(envEnvVar)
+		defer os.Unsetenv(versionEnvVar)
+
+		tracer := newTracer(withTransport(newDummyTransport()))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		assert.Equal("staging", root.Meta[ext.Environment])
+		assert.Equal("0.1", root.Meta[ext.Version])
+
+		// options take precedence
+		tracer2 := newTracer(withTransport(newDummyTransport()), WithEnv("prod"), WithServiceVersion("1.0"))
+		defer tracer2.Stop()
+		assert.Equal("prod", tracer2.config.env)
+		assert.Equal("1.0", tracer2.config.version)
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		tracer := newTracer(withTransport(newDummyTransport()))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		assert.NotContains(t, root.Meta, ext.Environment)
+		assert.NotContains(t, root.Meta, ext.Version)
+	})
+}
+
+func TestServiceFromEnv(t *testing.T) {
+	defer os.Unsetenv(serviceEnvVar)
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv(serviceEnvVar, "orders")
+		tracer := newTracer(withTransport(newDummyTransport()))
+		defer tracer.Stop()
+		assert.Equal(t, "orders", tracer.StartSpan("web.request").(*span).Service)
+	})
+
+	t.Run("option", func(t *testing.T) {
+		os.Setenv(serviceEnvVar, "orders")
+		tracer := newTracer(withTransport(newDummyTransport()), WithServiceName("billing"))
+		defer tracer.Stop()
+		assert.Equal(t, "billing", tracer.StartSpan("web.request").(*span).Service)
+	})
+
+	t.Run("blank", func(t *testing.T) {
+		os.Setenv(serviceEnvVar, " ")
+		var c config
+		defaults(&c)
+		assert.Equal(t, "tracer.test", c.serviceName)
+	})
+}
+
+func TestTagsFromEnv(t *testing.T) {
+	defer os.Unsetenv(tagsEnvVar)
+
+	t.Run("parse", func(t *testing.T) {
+		assert := assert.New(t)
+		tl := new(testLogger)
+		SetLogger(tl)
+		defer SetLogger(nil)
+		os.Setenv(tagsEnvVar, "team:payments, region : eu-west-1,url:http://host:80,,novalue,:empty,empty:")
+		assert.Equal(map[string]interface{}{
+			"team":   "payments",
+			"region": "eu-west-1",
+			"url":    "http://host:80",
+			"empty":  "",
+		}, tagsFromEnv())
+		assert.Equal([]string{
+			errorPrefix + `invalid DD_TAGS entry "novalue", expected key:value`,
+			errorPrefix + `invalid DD_TAGS entry ":empty", expected key:value`,
+		}, tl.Lines())
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		os.Unsetenv(tagsEnvVar)
+		assert.Nil(t, tagsFromEnv())
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv(tagsEnvVar, "team:payments,region:eu-west-1")
+		tracer := newTracer(withTransport(newDummyTransport()), WithGlobalTag("team", "billing"))
+		defer tracer.Stop()
+		s := tracer.StartSpan("web.request", Tag("region", "us-east-1")).(*span)
+		assert.Equal("billing", s.Meta["team"])
+		assert.Equal("us-east-1", s.Meta["region"])
+		assert.Equal("eu-west-1", tracer.StartSpan("web.request").(*span).Meta["region"])
+	})
+}
+
+func TestTracerTagLimitOptions(t *testing.T) {
+	assert := assert.New(t)
+	var c config
+	defaults(&c)
+	assert.Equal(tagLimits{maxTags: 256, maxValueLength: 5000}, c.tagLimits)
+	WithMaxTagsPerSpan(10)(&c)
+	WithMaxTagValueLength(100)(&c)
+	assert.Equal(tagLimits{maxTags: 10, maxValueLength: 100}, c.tagLimits)
+	WithMaxTagsPerSpan(-1)(&c)
+	WithMaxTagValueLength(0)(&c)
+	assert.Equal(tagLimits{}, c.tagLimits)
+
+	tracer := newTracer(WithMaxTagsPerSpan(1), WithMaxTagValueLength(2))
+	defer tracer.Stop()
+	span := tracer.StartSpan("web.request", Tag("a", "abc"), Tag("b", "b")).(*span)
+	assert.Equal(tagLimits{maxTags: 1, maxValueLength: 2}, span.limits)
+	var userTags int
+	for _, k := range []string{"a", "b"} {
+		if _, ok := span.Meta[k]; ok {
+			userTags++
+		}
+	}
+	assert.Equal(1, userTags)
+}
+
+func TestAgentAddrFromEnv(t *testing.T) {
+	defer os.Unsetenv(agentHostEnvVar)
+	defer os.Unsetenv(agentPortEnvVar)
+
+	for _, tt := range []struct {
+		host, port string
+		addr       string
+	}{
+		{"", "", "localhost:8126"},
+		{"ddagent.consul.local", "", "ddagent.consul.local:8126"},
+		{"", "58126", "localhost:58126"},
+		{"10.0.0.1", "58126", "10.0.0.1:58126"},
+		{"::1", "58126", "[::1]:58126"},
+		{"[fe80::1]", "", "[fe80::1]:8126"},
+		{" ddagent ", " 58126 ", "ddagent:58126"},
+		{"ddagent", "port", "ddagent:8126"},
+		{"ddagent", "0", "ddagent:8126"},
+		{"ddagent", "65536", "ddagent:8126"},
+	} {
+		t.Run(tt.addr, func(t *testing.T) {
+			os.Setenv(agentHostEnvVar, tt.host)
+			os.Setenv(agentPortEnvVar, tt.port)
+			assert.Equal(t, tt.addr, agentAddrFromEnv())
+		})
+	}
+
+	t.Run("precedence", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv(agentHostEnvVar, "ddagent.consul.local")
+		os.Setenv(agentPortEnvVar, "58126")
+
+		var c config
+		defaults(&c)
+		assert.Equal("ddagent.consul.local:58126", c.agentAddr)
+
+		tracer := newTracer(WithAgentAddr("localhost:9126"))
+		defer tracer.Stop()
+		assert.Equal("localhost:9126", tracer.config.agentAddr)
+		assert.Equal("http://localhost:9126/v0.4/traces", tracer.config.transport.(*httpTransport).traceURL)
+	})
+}
+
+func TestAgentAddrUDS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(old string) { defaultSocketAPM = old }(defaultSocketAPM)
+	defaultSocketAPM = filepath.Join(dir, "apm.socket")
+
+	t.Run("missing", func(t *testing.T) {
+		assert.Equal(t, defaultAddress, agentAddrFromEnv())
+	})
+
+	assert.NoError(t, ioutil.WriteFile(defaultSocketAPM, nil, 0644))
+
+	t.Run("detected", func(t *testing.T) {
+		assert.Equal(t, "unix://"+defaultSocketAPM, agentAddrFromEnv())
+	})
+
+	t.Run("env", func(t *testing.T) {
+		os.Setenv(agentHostEnvVar, "ddagent")
+		defer os.Unsetenv(agentHostEnvVar)
+		assert.Equal(t, "ddagent:8126", agentAddrFromEnv())
+	})
+
+	t.Run("option", func(t *testing.T) {
+		tracer := newTracer(WithUDS("/tmp/agent.socket"))
+		defer tracer.Stop()
+		assert.Equal(t, "unix:///tmp/agent.socket", tracer.config.agentAddr)
+		assert.Equal(t, "http://localhost/v0.4/traces", tracer.config.transport.(*httpTransport).traceURL)
+	})
+}
+
+// countingRoundTripper counts the requests it forwards to the default transport.
+type countingRoundTripper struct{ requests int32 }
+
+func (rt *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&rt.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHTTPClient(t *testing.T) {
+	t.Run("custom", func(t *testing.T) {
+		assert := assert.New(t)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		}))
+		defer srv.Close()
+		rt := new(countingRoundTripper)
+		client := &http.Client{Transport: rt, Timeout: 5 * time.Second}
+		tracer := newTracer(
+			WithAgentAddr(strings.TrimPrefix(srv.URL, "http://")),
+			WithHTTPClient(client),
+			WithHTTPTimeout(time.Minute),
+		)
+		internal.SetGlobalTracer(tracer)
+		defer func() {
+			internal.SetGlobalTracer(&internal.NoopTracer{})
+			tracer.Stop()
+		}()
+		assert.Equal(client, tracer.config.transport.(*httpTransport).client)
+
+		tracer.StartSpan("web.request").Finish()
+		tracer.forceFlush()
+		assert.EqualValues(1, atomic.LoadInt32(&rt.requests))
+		assert.Equal(5*time.Second, client.Timeout)
+		assert.Equal(rt, client.Transport)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		tracer := newTracer(WithHTTPTimeout(100 * time.Millisecond))
+		defer tracer.Stop()
+		assert.Equal(t, 100*time.Millisecond, tracer.config.transport.(*httpTransport).client.Timeout)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		tracer := newTracer(WithHTTPTimeout(-time.Second))
+		defer tracer.Stop()
+		assert.Equal(t, defaultHTTPTimeout, tracer.config.transport.(*httpTransport).client.Timeout)
+	})
+}
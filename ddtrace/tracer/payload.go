@@ -35,8 +35,14 @@ type payload struct {
 	// count specifies the number of items in the stream.
 	count uint64
 
+	// spans specifies the number of spans held by the items in the stream.
+	spans uint64
+
 	// buf holds the sequence of msgpack-encoded items.
 	buf bytes.Buffer
+
+	// roff specifies the current read position on buf.
+	roff int
 }
 
 var _ io.Reader = (*payload)(nil)
@@ -56,6 +62,7 @@ func (p *payload) push(t spanList) error {
 		return err
 	}
 	p.count++
+	p.spans += uint64(len(t))
 	p.updateHeader()
 	return nil
 }
@@ -65,19 +72,33 @@ func (p *payload) itemCount() int {
 	return int(p.count)
 }
 
+// spanCount returns the number of spans held by the items in the payload.
+func (p *payload) spanCount() int {
+	return int(p.spans)
+}
+
 // size returns the payload size in bytes. After the first read the value becomes
 // inaccurate by up to 8 bytes.
 func (p *payload) size() int {
-	return p.buf.Len() + len(p.header) - p.off
+	return p.buf.Len() - p.roff + len(p.header) - p.off
 }
 
 // reset resets the internal buffer, counter and read offset.
 func (p *payload) reset() {
 	p.off = 8
+	p.roff = 0
 	p.count = 0
+	p.spans = 0
 	p.buf.Reset()
 }
 
+// rewind moves the read position back to the start of the stream, allowing
+// the payload to be read again.
+func (p *payload) rewind() {
+	p.roff = 0
+	p.updateHeader()
+}
+
 // https://github.com/msgpack/msgpack/blob/master/spec.md#array-format-family
 const (
 	msgpackArrayFix byte = 144  // up to 15 items
@@ -112,5 +133,13 @@ func (p *payload) Read(b []byte) (n int, err error) {
 		p.off += n
 		return n, nil
 	}
-	return p.buf.Read(b)
+	if p.roff >= p.buf.Len() {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n = copy(b, p.buf.Bytes()[p.roff:])
+	p.roff += n
+	return n, nil
 }
@@ -2,6 +2,7 @@ package tracer
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"strconv"
 	"strings"
@@ -71,6 +72,64 @@ func TestPayloadDecode(t *testing.T) {
 	}
 }
 
+// TestPayloadWireFormat ensures that the payload is encoded using the field
+// names expected by the agent.
+func TestPayloadWireFormat(t *testing.T) {
+	assert := assert.New(t)
+	s := newSpan("http.request", "web", "/home", 1, 2, 3)
+	s.Type = "web"
+	s.Start = 10
+	s.Duration = 20
+	s.Error = 1
+	s.Meta["key"] = "value"
+	s.Metrics["metric"] = 1.5
+	p := newPayload()
+	assert.NoError(p.push(spanList{s}))
+
+	var buf bytes.Buffer
+	_, err := msgp.CopyToJSON(&buf, p)
+	assert.NoError(err)
+	var got [][]map[string]interface{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &got))
+	assert.Len(got, 1)
+	assert.Len(got[0], 1)
+	assert.Equal(map[string]interface{}{
+		"name":      "http.request",
+		"service":   "web",
+		"resource":  "/home",
+		"type":      "web",
+		"start":     float64(10),
+		"duration":  float64(20),
+		"meta":      map[string]interface{}{"key": "value"},
+		"metrics":   map[string]interface{}{"metric": 1.5},
+		"span_id":   float64(1),
+		"trace_id":  float64(2),
+		"parent_id": float64(3),
+		"error":     float64(1),
+	}, got[0][0])
+}
+
+// BenchmarkPayloadEncode benchmarks encoding a batch of 1000 spans and reports
+// the size of the resulting payload.
+func BenchmarkPayloadEncode(b *testing.B) {
+	trace := make(spanList, 1000)
+	for i := range trace {
+		s := newSpan("http.request", "web", "/home", uint64(i+1), 1, uint64(i))
+		s.Meta["http.url"] = "/home"
+		s.Meta["http.status_code"] = "200"
+		s.Metrics["_sampling_priority_v1"] = 1
+		trace[i] = s
+	}
+	p := newPayload()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.reset()
+		p.push(trace)
+	}
+	b.ReportMetric(float64(p.size()), "bytes/payload")
+}
+
 func BenchmarkPayloadThroughput(b *testing.B) {
 	b.Run("10K", benchmarkPayloadThroughput(1))
 	b.Run("100K", benchmarkPayloadThroughput(10))
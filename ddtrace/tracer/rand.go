@@ -2,49 +2,52 @@ package tracer
 
 import (
 	cryptorand "crypto/rand"
-	"log"
+	"encoding/binary"
+	"hash/fnv"
 	"math"
-	"math/big"
-	"math/rand"
-	"sync"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
-// random holds a thread-safe source of random numbers.
-var random *rand.Rand
+// random holds a lock-free source of random span and trace IDs.
+var random = newIDSource()
 
-func init() {
-	var seed int64
-	n, err := cryptorand.Int(cryptorand.Reader, big.NewInt(math.MaxInt64))
-	if err == nil {
-		seed = n.Int64()
-	} else {
-		log.Printf("%scannot generate random seed: %v; using current time\n", errorPrefix, err)
-		seed = time.Now().UnixNano()
-	}
-	random = rand.New(&safeSource{
-		source: rand.NewSource(seed),
-	})
+// idSource generates IDs using the SplitMix64 algorithm. Its state is advanced
+// atomically, so that it can be shared by all goroutines without locking.
+type idSource struct {
+	state uint64
 }
 
-// safeSource holds a thread-safe implementation of rand.Source64.
-type safeSource struct {
-	source rand.Source
-	sync.Mutex
-}
-
-func (rs *safeSource) Int63() int64 {
-	rs.Lock()
-	n := rs.source.Int63()
-	rs.Unlock()
-
-	return n
+// newIDSource returns an idSource seeded from crypto/rand. When it is not
+// available, the seed is derived from the current time, the process ID and
+// the hostname, so that processes started at the same instant on different
+// hosts are still given distinct seeds.
+func newIDSource() *idSource {
+	var b [8]byte
+	_, err := cryptorand.Read(b[:])
+	if err == nil {
+		return &idSource{state: binary.LittleEndian.Uint64(b[:])}
+	}
+	logf("%scannot generate random seed: %v; using current time, pid and hostname", errorPrefix, err)
+	h := fnv.New64a()
+	hostname, _ := os.Hostname()
+	h.Write([]byte(hostname))
+	seed := uint64(time.Now().UnixNano()) ^ uint64(os.Getpid())<<32 ^ h.Sum64()
+	return &idSource{state: seed}
 }
 
-func (rs *safeSource) Uint64() uint64 { return uint64(rs.Int63()) }
-
-func (rs *safeSource) Seed(seed int64) {
-	rs.Lock()
-	rs.Seed(seed)
-	rs.Unlock()
+// Uint64 returns a non-zero random ID. IDs are 63 bits long, so that they remain
+// valid when read as signed integers by other tracers.
+func (s *idSource) Uint64() uint64 {
+	for {
+		// See http://xoshiro.di.unimi.it/splitmix64.c
+		z := atomic.AddUint64(&s.state, 0x9e3779b97f4a7c15)
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z = (z ^ (z >> 31)) & math.MaxInt64
+		if z != 0 {
+			return z
+		}
+	}
 }
@@ -0,0 +1,114 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDSourceUnique(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	const n = 4000000
+	src := newIDSource()
+	seen := make(map[uint64]struct{}, n)
+	var bits [63]int
+	for i := 0; i < n; i++ {
+		id := src.Uint64()
+		if id == 0 || id > math.MaxInt64 {
+			t.Fatalf("invalid ID %d", id)
+		}
+		if _, ok := seen[id]; ok {
+			t.Fatalf("duplicate ID %d after %d IDs", id, i)
+		}
+		seen[id] = struct{}{}
+		for b := range bits {
+			if id&(1<<uint(b)) != 0 {
+				bits[b]++
+			}
+		}
+	}
+	// each bit should be set in half of the IDs; a deviation of 1% is
+	// about 40 standard deviations away
+	for b, c := range bits {
+		assert.InDelta(t, 0.5, float64(c)/n, 0.01, "bit %d", b)
+	}
+}
+
+func TestIDSourceConcurrent(t *testing.T) {
+	const (
+		goroutines = 8
+		perRoutine = 10000
+	)
+	src := newIDSource()
+	ids := make(chan uint64, goroutines*perRoutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perRoutine; j++ {
+				ids <- src.Uint64()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[uint64]struct{})
+	for id := range ids {
+		seen[id] = struct{}{}
+	}
+	assert.Len(t, seen, goroutines*perRoutine)
+}
+
+func TestIDSourceSeed(t *testing.T) {
+	// sources created at the same time yield different IDs
+	assert.NotEqual(t, newIDSource().Uint64(), newIDSource().Uint64())
+}
+
+// lockedSource is the mutex-guarded math/rand source previously used to
+// generate IDs, kept as a baseline for benchmarks.
+type lockedSource struct {
+	sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.Lock()
+	n := s.source.Int63()
+	s.Unlock()
+	return uint64(n)
+}
+
+func BenchmarkIDSource(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		src  interface{ Uint64() uint64 }
+	}{
+		{"splitmix64", newIDSource()},
+		{"locked-rand", &lockedSource{source: rand.NewSource(1)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					bm.src.Uint64()
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkStartSpanParallel(b *testing.B) {
+	tracer := newTracer(withTransport(newDummyTransport()))
+	defer tracer.Stop()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tracer.StartSpan("bench.span")
+		}
+	})
+}
@@ -1,21 +1,34 @@
 package tracer
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"math"
+	"os"
+	"regexp"
 	"sync"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 )
 
-// Sampler is the generic interface of any sampler. It must be safe for concurrent use.
+// Sampler is the generic interface of any sampler. It is called once for each
+// root span, after its start options are applied, and its decision applies to
+// the whole trace: spans of unsampled traces are not sent and setting their tags
+// is a no-op. It may be called from many goroutines at once, so it must be safe
+// for concurrent use.
 type Sampler interface {
 	// Sample returns true if the given span should be sampled.
 	Sample(span Span) bool
 }
 
 // RateSampler is a sampler implementation which randomly selects spans using a
-// provided rate. For example, a rate of 0.75 will permit 75% of the spans.
-// RateSampler implementations should be safe for concurrent use.
+// provided rate. For example, a rate of 0.75 will permit 75% of the spans. The
+// rate is recorded on the sampled root spans, so that the backend can correct
+// the counts of traces accordingly. RateSampler implementations should be safe
+// for concurrent use.
 type RateSampler interface {
 	Sampler
 
@@ -64,9 +77,295 @@ func (r *rateSampler) Sample(spn ddtrace.Span) bool {
 		return false
 	}
 	r.RLock()
-	defer r.RUnlock()
-	if r.rate < 1 {
-		return s.TraceID*knuthFactor < uint64(r.rate*math.MaxUint64)
+	rate := r.rate
+	r.RUnlock()
+	if rate >= 1 {
+		return true
+	}
+	if s.TraceID*knuthFactor >= uint64(rate*math.MaxUint64) {
+		return false
 	}
+	// record the rate used for the decision, which may be changed meanwhile
+	s.Lock()
+	if !s.finished {
+		// we don't touch finished span as they might be flushing
+		s.Metrics[sampleRateMetricKey] = rate
+	}
+	s.Unlock()
 	return true
 }
+
+// SamplingRule specifies the sample rate applied to the root spans matching it.
+// Fields left empty match all spans.
+type SamplingRule struct {
+	// Service is the service name of the matching spans.
+	Service string
+
+	// Name matches the operation name of the spans.
+	Name *regexp.Regexp
+
+	// Resource matches the resource name of the spans.
+	Resource *regexp.Regexp
+
+	// Rate is the sample rate, between 0 and 1, applied to the matching spans.
+	Rate float64
+}
+
+// match reports whether the span s matches the rule. The span must be locked.
+func (r *SamplingRule) match(s *span) bool {
+	if r.Service != "" && r.Service != s.Service {
+		return false
+	}
+	if r.Name != nil && !r.Name.MatchString(s.Name) {
+		return false
+	}
+	if r.Resource != nil && !r.Resource.MatchString(s.Resource) {
+		return false
+	}
+	return true
+}
+
+// ruleSampler samples spans using the rate of the first rule they match.
+type ruleSampler struct {
+	rules []SamplingRule
+	rate  float64 // used when no rule matches
+}
+
+// NewRuleSampler returns a sampler which samples root spans using the rate of
+// the first of the given rules they match, or defaultRate when none does. The
+// applied rate is recorded on the sampled spans, like with a RateSampler, along
+// with the rate of the rule which matched, if any.
+//
+// When the DD_TRACE_SAMPLING_RULES environment variable is set, the tracer
+// uses a rule sampler by default, with the rules it holds as a JSON array:
+//
+//	[{"service": "orders", "name": "http\\..*", "sample_rate": 0.1}]
+//
+// There, names and resources are regular expressions which must match fully.
+func NewRuleSampler(rules []SamplingRule, defaultRate float64) Sampler {
+	return &ruleSampler{rules: rules, rate: defaultRate}
+}
+
+// Sample returns true if the given span should be sampled.
+func (rs *ruleSampler) Sample(spn ddtrace.Span) bool {
+	s, ok := spn.(*span)
+	if !ok {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	rate, matched := rs.rate, false
+	for i := range rs.rules {
+		if rs.rules[i].match(s) {
+			rate, matched = rs.rules[i].Rate, true
+			break
+		}
+	}
+	if rate < 1 && s.TraceID*knuthFactor >= uint64(rate*math.MaxUint64) {
+		return false
+	}
+	if s.finished {
+		// we don't touch finished span as they might be flushing
+		return true
+	}
+	if rate < 1 {
+		s.Metrics[sampleRateMetricKey] = rate
+	}
+	if matched {
+		s.Metrics[rulePSRKey] = rate
+	}
+	return true
+}
+
+// rulePSRKey is the metric key holding the sample rate of the sampling rule
+// which matched a root span.
+const rulePSRKey = "_dd.rule_psr"
+
+// samplingRulesEnvVar is the environment variable holding sampling rules as JSON.
+const samplingRulesEnvVar = "DD_TRACE_SAMPLING_RULES"
+
+// samplingRulesFromEnv returns the sampling rules found in samplingRulesEnvVar,
+// as described in NewRuleSampler.
+func samplingRulesFromEnv() ([]SamplingRule, error) {
+	v := os.Getenv(samplingRulesEnvVar)
+	if v == "" {
+		return nil, nil
+	}
+	var jsonRules []struct {
+		Service  string   `json:"service"`
+		Name     string   `json:"name"`
+		Resource string   `json:"resource"`
+		Rate     *float64 `json:"sample_rate"`
+	}
+	if err := json.Unmarshal([]byte(v), &jsonRules); err != nil {
+		return nil, fmt.Errorf("%s: %v", samplingRulesEnvVar, err)
+	}
+	rules := make([]SamplingRule, 0, len(jsonRules))
+	for i, jr := range jsonRules {
+		if jr.Rate == nil || *jr.Rate < 0 || *jr.Rate > 1 {
+			return nil, fmt.Errorf("%s: rule %d: sample_rate must be between 0 and 1", samplingRulesEnvVar, i)
+		}
+		rule := SamplingRule{Service: jr.Service, Rate: *jr.Rate}
+		var err error
+		if rule.Name, err = compileFullMatch(jr.Name); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", samplingRulesEnvVar, i, err)
+		}
+		if rule.Resource, err = compileFullMatch(jr.Resource); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", samplingRulesEnvVar, i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// compileFullMatch compiles a regular expression which must match whole
+// strings. It returns nil for empty expressions.
+func compileFullMatch(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// samplingPriorityRateKey is the metric key holding the sample rate used to
+// set the sampling priority of a root span.
+const samplingPriorityRateKey = "_sampling_priority_rate_v1"
+
+// prioritySampler holds the per-service sample rates sent by the agent, and
+// uses them to set the sampling priority of root spans.
+type prioritySampler struct {
+	mu          sync.RWMutex
+	rates       map[string]float64
+	defaultRate float64
+}
+
+func newPrioritySampler() *prioritySampler {
+	return &prioritySampler{
+		rates:       make(map[string]float64),
+		defaultRate: 1,
+	}
+}
+
+// defaultRateKey is the key of the rate which applies to services the agent
+// has not sent any specific rate for.
+const defaultRateKey = "service:,env:"
+
+// readRatesJSON reads the rates from the JSON body of an agent response, such
+// as {"rate_by_service": {"service:orders,env:prod": 0.5}}, and closes it.
+func (ps *prioritySampler) readRatesJSON(rc io.ReadCloser) error {
+	defer rc.Close()
+	var payload struct {
+		Rates map[string]float64 `json:"rate_by_service"`
+	}
+	if err := json.NewDecoder(rc).Decode(&payload); err != nil {
+		return err
+	}
+	if payload.Rates == nil {
+		// agents not supporting priority sampling
+		return nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.rates = payload.Rates
+	if v, ok := ps.rates[defaultRateKey]; ok {
+		ps.defaultRate = v
+		delete(ps.rates, defaultRateKey)
+	}
+	return nil
+}
+
+// getRate returns the sample rate applying to the span s. The span must be locked.
+func (ps *prioritySampler) getRate(s *span) float64 {
+	key := "service:" + s.Service + ",env:" + s.Meta[ext.Environment]
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	if rate, ok := ps.rates[key]; ok {
+		return rate
+	}
+	return ps.defaultRate
+}
+
+// apply sets the sampling priority of the root span s, along with the rate
+// used to decide it.
+func (ps *prioritySampler) apply(s *span) {
+	s.Lock()
+	defer s.Unlock()
+	if s.finished {
+		// we don't touch finished span as they might be flushing
+		return
+	}
+	rate := ps.getRate(s)
+	if rate >= 1 || s.TraceID*knuthFactor < uint64(rate*math.MaxUint64) {
+		s.setTagNumeric(ext.SamplingPriority, ext.PriorityAutoKeep)
+	} else {
+		s.setTagNumeric(ext.SamplingPriority, ext.PriorityAutoReject)
+	}
+	s.Metrics[samplingPriorityRateKey] = rate
+}
+
+// limitRateKey is the metric key holding the effective rate at which root
+// spans were let through by the rate limiter, used to correct trace counts.
+const limitRateKey = "_dd.limit_psr"
+
+// rateLimiter is a token bucket limiting the number of traces kept per second.
+// It is safe for concurrent use.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  float64   // the number of tokens added per second, also the bucket size
+	tokens float64   // the number of available tokens
+	last   time.Time // the last time tokens were added
+
+	// the number of allowed and seen traces during the current and previous
+	// one second windows, used to compute the effective rate
+	window                time.Time
+	allowed, seen         float64
+	prevAllowed, prevSeen float64
+}
+
+// newRateLimiter returns a rateLimiter letting through n traces per second,
+// allowing bursts of up to n traces.
+func newRateLimiter(n float64) *rateLimiter {
+	now := getClock().Now()
+	return &rateLimiter{
+		limit:  n,
+		tokens: n,
+		last:   now,
+		window: now,
+	}
+}
+
+// allow reports whether a trace may be kept, along with the effective rate at
+// which traces were let through during the last two seconds.
+func (r *rateLimiter) allow() (ok bool, rate float64) {
+	return r.allowAt(getClock().Now())
+}
+
+// allowAt is like allow, at the given time. Times use the monotonic clock, so
+// that wall clock changes do not affect the limit.
+func (r *rateLimiter) allowAt(now time.Time) (ok bool, rate float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d := now.Sub(r.last); d > 0 {
+		r.tokens += d.Seconds() * r.limit
+		if r.tokens > r.limit {
+			r.tokens = r.limit
+		}
+		r.last = now
+	}
+	if d := now.Sub(r.window); d >= time.Second {
+		if d < 2*time.Second {
+			r.prevAllowed, r.prevSeen = r.allowed, r.seen
+		} else {
+			r.prevAllowed, r.prevSeen = 0, 0
+		}
+		r.allowed, r.seen = 0, 0
+		r.window = now
+	}
+	r.seen++
+	if r.tokens >= 1 {
+		r.tokens--
+		r.allowed++
+		ok = true
+	}
+	return ok, (r.allowed + r.prevAllowed) / (r.seen + r.prevSeen)
+}
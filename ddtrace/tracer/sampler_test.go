@@ -1,8 +1,17 @@
 package tracer
 
 import (
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 
 	"github.com/stretchr/testify/assert"
@@ -29,6 +38,76 @@ func TestRateSamplerFinishedSpan(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestRateSamplerSampleRate(t *testing.T) {
+	// keptAt reports whether a root span is kept at the given rate.
+	keptAt := func(sp *span, rate float64) bool {
+		return sp.TraceID*knuthFactor < uint64(rate*math.MaxUint64)
+	}
+
+	t.Run("roots", func(t *testing.T) {
+		assert := assert.New(t)
+		rs := NewRateSampler(0.5)
+		tracer := newTracer(WithSampler(rs))
+		defer tracer.Stop()
+
+		var kept int
+		for i := 0; i < 100; i++ {
+			root := tracer.StartSpan("http.request").(*span)
+			if !root.context.sampled {
+				assert.NotContains(root.Metrics, sampleRateMetricKey)
+				continue
+			}
+			kept++
+			assert.Equal(0.5, root.Metrics[sampleRateMetricKey])
+			child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+			assert.NotContains(child.Metrics, sampleRateMetricKey)
+		}
+		assert.True(kept > 0)
+
+		rs.SetRate(0.25)
+		for i := 0; i < 100; i++ {
+			if root := tracer.StartSpan("http.request").(*span); root.context.sampled {
+				assert.Equal(0.25, root.Metrics[sampleRateMetricKey])
+			}
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		tracer := newTracer(WithSampler(NewAllSampler()))
+		defer tracer.Stop()
+		assert.NotContains(t, tracer.StartSpan("http.request").(*span).Metrics, sampleRateMetricKey)
+	})
+
+	t.Run("changing", func(t *testing.T) {
+		assert := assert.New(t)
+		rs := NewRateSampler(0.2)
+		tracer := newTracer(WithSampler(rs))
+		defer tracer.Stop()
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				rs.SetRate([]float64{0.2, 0.8}[i%2])
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			root := tracer.StartSpan("http.request").(*span)
+			if !root.context.sampled {
+				continue
+			}
+			// the recorded rate is the one which the decision was taken with
+			rate := root.Metrics[sampleRateMetricKey]
+			assert.Contains([]float64{0.2, 0.8}, rate)
+			assert.True(keptAt(root, rate))
+		}
+	})
+}
+
 func TestRateSamplerSetting(t *testing.T) {
 	assert := assert.New(t)
 	rs := NewRateSampler(1)
@@ -36,3 +115,311 @@ func TestRateSamplerSetting(t *testing.T) {
 	rs.SetRate(0.5)
 	assert.Equal(float64(0.5), rs.Rate())
 }
+
+func TestRuleSampler(t *testing.T) {
+	rules := []SamplingRule{
+		{Service: "orders", Name: regexp.MustCompile(`^health\.`), Rate: 0},
+		{Service: "orders", Rate: 1},
+		{Resource: regexp.MustCompile(`^GET /slow`), Rate: 0.5},
+	}
+
+	t.Run("match", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(WithSampler(NewRuleSampler(rules, 0)))
+
+		sp := tracer.StartSpan("health.ping", ServiceName("orders")).(*span)
+		assert.False(sp.context.sampled)
+
+		sp = tracer.StartSpan("http.request", ServiceName("orders")).(*span)
+		assert.True(sp.context.sampled)
+		assert.NotContains(sp.Metrics, sampleRateMetricKey)
+		assert.Equal(1.0, sp.Metrics[rulePSRKey])
+
+		// no rule matches, the default rate applies
+		sp = tracer.StartSpan("http.request", ServiceName("users")).(*span)
+		assert.False(sp.context.sampled)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		tracer := newTracer(WithSampler(NewRuleSampler(rules, 1)))
+		sp := tracer.StartSpan("http.request", ServiceName("users")).(*span)
+		assert.True(t, sp.context.sampled)
+		assert.NotContains(t, sp.Metrics, rulePSRKey)
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(WithSampler(NewRuleSampler(rules, 0)))
+
+		var kept int
+		for i := 0; i < 1000; i++ {
+			sp := tracer.StartSpan("http.request", ResourceName("GET /slow")).(*span)
+			if sp.context.sampled {
+				kept++
+				assert.Equal(0.5, sp.Metrics[sampleRateMetricKey])
+				assert.Equal(0.5, sp.Metrics[rulePSRKey])
+			} else {
+				assert.NotContains(sp.Metrics, sampleRateMetricKey)
+			}
+		}
+		assert.InDelta(500, kept, 100)
+	})
+
+	t.Run("child", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(WithSampler(NewRuleSampler(rules, 0)))
+
+		root := tracer.StartSpan("http.request", ServiceName("orders")).(*span)
+		// the decision is only taken for root spans
+		child := tracer.StartSpan("health.check", ChildOf(root.Context())).(*span)
+		assert.True(child.context.sampled)
+	})
+}
+
+func TestSamplingRulesFromEnv(t *testing.T) {
+	defer os.Unsetenv(samplingRulesEnvVar)
+
+	t.Run("unset", func(t *testing.T) {
+		os.Unsetenv(samplingRulesEnvVar)
+		rules, err := samplingRulesFromEnv()
+		assert.NoError(t, err)
+		assert.Nil(t, rules)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv(samplingRulesEnvVar, `[
+			{"service": "orders", "name": "health\\..*", "sample_rate": 0.01},
+			{"resource": "GET /.*", "sample_rate": 1}
+		]`)
+		rules, err := samplingRulesFromEnv()
+		assert.NoError(err)
+		assert.Len(rules, 2)
+		assert.Equal("orders", rules[0].Service)
+		assert.True(rules[0].Name.MatchString("health.ping"))
+		assert.False(rules[0].Name.MatchString("x.health.ping"))
+		assert.Nil(rules[0].Resource)
+		assert.Equal(0.01, rules[0].Rate)
+		assert.True(rules[1].Resource.MatchString("GET /users"))
+
+		// the tracer uses them by default
+		tracer := newTracer()
+		sp := tracer.StartSpan("http.request", ServiceName("orders"), ResourceName("POST /")).(*span)
+		assert.True(sp.context.sampled)
+		_, ok := tracer.config.sampler.(*ruleSampler)
+		assert.True(ok)
+	})
+
+	for name, v := range map[string]string{
+		"json":    `{`,
+		"no-rate": `[{"service": "orders"}]`,
+		"rate":    `[{"service": "orders", "sample_rate": 2}]`,
+		"regexp":  `[{"name": "(", "sample_rate": 1}]`,
+	} {
+		t.Run("invalid-"+name, func(t *testing.T) {
+			os.Setenv(samplingRulesEnvVar, v)
+			_, err := samplingRulesFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPrioritySampler(t *testing.T) {
+	t.Run("read-rates", func(t *testing.T) {
+		assert := assert.New(t)
+		ps := newPrioritySampler()
+		err := ps.readRatesJSON(ioutil.NopCloser(strings.NewReader(
+			`{"rate_by_service":{"service:orders,env:prod":0.5,"service:,env:":0.8}}`,
+		)))
+		assert.NoError(err)
+		assert.Equal(map[string]float64{"service:orders,env:prod": 0.5}, ps.rates)
+		assert.Equal(0.8, ps.defaultRate)
+
+		// responses without rates leave them unchanged
+		err = ps.readRatesJSON(ioutil.NopCloser(strings.NewReader(`{}`)))
+		assert.NoError(err)
+		assert.Equal(0.8, ps.defaultRate)
+
+		err = ps.readRatesJSON(ioutil.NopCloser(strings.NewReader(`{`)))
+		assert.Error(err)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		assert := assert.New(t)
+		ps := newPrioritySampler()
+		ps.rates = map[string]float64{
+			"service:orders,env:prod": 0,
+			"service:users,env:":      1,
+		}
+		ps.defaultRate = 0
+
+		s := newSpan("http.request", "orders", "/", 1, 1, 0)
+		s.Meta[ext.Environment] = "prod"
+		ps.apply(s)
+		assert.EqualValues(ext.PriorityAutoReject, s.Metrics[samplingPriorityKey])
+		assert.EqualValues(0, s.Metrics[samplingPriorityRateKey])
+		assert.Equal(ext.PriorityAutoReject, s.context.samplingPriority())
+
+		s = newSpan("http.request", "users", "/", 1, 1, 0)
+		ps.apply(s)
+		assert.EqualValues(ext.PriorityAutoKeep, s.Metrics[samplingPriorityKey])
+		assert.EqualValues(1, s.Metrics[samplingPriorityRateKey])
+	})
+
+	t.Run("agent-rates", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer()
+		defer stop()
+
+		root := tracer.newRootSpan("http.request", "orders", "/")
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[samplingPriorityKey])
+		root.Finish()
+
+		// the rates are updated with each flush
+		transport.setRates(`{"rate_by_service":{"service:orders,env:":0}}`)
+		tracer.forceFlush()
+
+		root = tracer.newRootSpan("http.request", "orders", "/")
+		assert.EqualValues(ext.PriorityAutoReject, root.Metrics[samplingPriorityKey])
+		assert.EqualValues(0, root.Metrics[samplingPriorityRateKey])
+		child := tracer.newChildSpan("db.query", root)
+		assert.Equal(ext.PriorityAutoReject, child.context.samplingPriority())
+		root.Finish()
+		child.Finish()
+
+		// other services use the default rate
+		root = tracer.newRootSpan("http.request", "users", "/")
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[samplingPriorityKey])
+		root.Finish()
+
+		transport.setRates(`{"rate_by_service":{"service:orders,env:":1}}`)
+		tracer.forceFlush()
+		root = tracer.newRootSpan("http.request", "orders", "/")
+		assert.EqualValues(ext.PriorityAutoKeep, root.Metrics[samplingPriorityKey])
+
+		// propagated priorities are kept
+		sctx, err := tracer.Extract(TextMapCarrier(map[string]string{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "2",
+		}))
+		assert.NoError(err)
+		s := tracer.StartSpan("http.request", ChildOf(sctx), ServiceName("orders")).(*span)
+		assert.EqualValues(ext.PriorityUserKeep, s.Metrics[samplingPriorityKey])
+		assert.NotContains(s.Metrics, samplingPriorityRateKey)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("burst", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newRateLimiter(10)
+		now := r.last
+		var allowed int
+		for i := 0; i < 100; i++ {
+			if ok, _ := r.allowAt(now); ok {
+				allowed++
+			}
+		}
+		assert.Equal(10, allowed)
+
+		// tokens are refilled at the limit rate
+		ok, _ := r.allowAt(now.Add(50 * time.Millisecond))
+		assert.False(ok)
+		ok, _ = r.allowAt(now.Add(100 * time.Millisecond))
+		assert.True(ok)
+		ok, _ = r.allowAt(now.Add(100 * time.Millisecond))
+		assert.False(ok)
+	})
+
+	t.Run("steady", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newRateLimiter(100)
+		now := r.last
+		var allowed int
+		var rate float64
+		// 1000 traces per second during 10 seconds
+		for i := 0; i < 10000; i++ {
+			var ok bool
+			if ok, rate = r.allowAt(now.Add(time.Duration(i) * time.Millisecond)); ok {
+				allowed++
+			}
+		}
+		assert.InDelta(100*10+100, allowed, 10) // plus the initial burst
+		assert.InDelta(0.1, rate, 0.01)
+	})
+
+	t.Run("rate-window", func(t *testing.T) {
+		assert := assert.New(t)
+		r := newRateLimiter(1)
+		now := r.last
+		_, rate := r.allowAt(now)
+		assert.Equal(1.0, rate)
+		_, rate = r.allowAt(now)
+		assert.Equal(0.5, rate)
+		// the previous window still counts
+		_, rate = r.allowAt(now.Add(1500 * time.Millisecond))
+		assert.Equal(2.0/3, rate)
+		// windows older than two seconds no longer count
+		_, rate = r.allowAt(now.Add(5 * time.Second))
+		assert.Equal(1.0, rate)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		r := newRateLimiter(1000)
+		var (
+			wg      sync.WaitGroup
+			allowed int64
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					if ok, _ := r.allow(); ok {
+						atomic.AddInt64(&allowed, 1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		// the bucket holds 1000 tokens, plus the few refilled meanwhile
+		assert.True(t, allowed >= 1000 && allowed < 2000, "allowed %d", allowed)
+	})
+}
+
+func TestTracerMaxTracesPerSecond(t *testing.T) {
+	assert := assert.New(t)
+	tracer, transport, stop := startTestTracer()
+	defer stop()
+
+	SetMaxTracesPerSecond(2)
+	for i := 0; i < 5; i++ {
+		root := tracer.StartSpan("web.request")
+		tracer.StartSpan("db.query", ChildOf(root.Context())).Finish()
+		root.Finish()
+	}
+	tracer.forceFlush()
+	traces := transport.Traces()
+	assert.Len(traces, 2)
+	for _, trace := range traces {
+		assert.Len(trace, 2)
+		assert.Contains(trace[0].Metrics, limitRateKey)
+		assert.NotContains(trace[1].Metrics, limitRateKey)
+	}
+	// the rate is the one at the time the trace was kept
+	assert.Equal(1.0, traces[1][0].Metrics[limitRateKey])
+	assert.Equal(uint64(3), tracer.stats.snapshot().TracesLimited)
+
+	// unsampled traces do not consume tokens
+	SetMaxTracesPerSecond(1)
+	SetSampler(NewRateSampler(0))
+	tracer.StartSpan("web.request").Finish()
+	SetSampler(NewAllSampler())
+	tracer.StartSpan("web.request").Finish()
+	tracer.forceFlush()
+	assert.Len(transport.Traces(), 1)
+
+	SetMaxTracesPerSecond(0)
+	assert.Nil(tracer.limiter)
+}
@@ -3,10 +3,11 @@
 package tracer
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"reflect"
-	"runtime/debug"
-	"strings"
+	"runtime"
 	"sync"
 	"time"
 
@@ -50,6 +51,24 @@ type span struct {
 
 	finished bool         `msg:"-"` // true if the span has been submitted to a tracer.
 	context  *spanContext `msg:"-"` // span propagation context
+	limits   tagLimits    `msg:"-"` // bounds for the tags held in Meta
+
+	// pprofLabels holds the pprof labels which the span set on the goroutine
+	// which started it, to restore its previous ones when it finishes; nil if
+	// none were set.
+	pprofLabels *profilerLabels `msg:"-"`
+
+	registry *spanRegistry `msg:"-"` // the registry of open spans holding this span, if any
+
+	// startMonotonic is the reading of monotonicNow when the span started, or
+	// 0 if it was given an explicit start time.
+	startMonotonic int64 `msg:"-"`
+}
+
+// tagLimits bounds the string tags of a span. Zero values mean no limit.
+type tagLimits struct {
+	maxTags        int // maximum number of entries in Meta
+	maxValueLength int // maximum length of a value, in runes
 }
 
 // Context yields the SpanContext for this Span. Note that the return
@@ -58,8 +77,9 @@ type span struct {
 func (s *span) Context() ddtrace.SpanContext { return s.context }
 
 // SetBaggageItem sets a key/value pair as baggage on the span. Baggage items
-// are propagated down to descendant spans and injected cross-process. Use with
-// care as it adds extra load onto your tracing layer.
+// are propagated down to descendant spans and injected cross-process. They are
+// also sent to the agent as tags prefixed with "baggage.", unless a tag with the
+// same key was set. Use with care as it adds extra load onto your tracing layer.
 func (s *span) SetBaggageItem(key, val string) {
 	s.context.setBaggageItem(key, val)
 }
@@ -72,6 +92,10 @@ func (s *span) BaggageItem(key string) string {
 
 // SetTag adds a set of key/value metadata to the span.
 func (s *span) SetTag(key string, value interface{}) {
+	if !s.context.sampled {
+		// the span will not be sent, spare the work
+		return
+	}
 	s.Lock()
 	defer s.Unlock()
 	// We don't lock spans when flushing, so we could have a data race when
@@ -81,7 +105,7 @@ func (s *span) SetTag(key string, value interface{}) {
 		return
 	}
 	if key == ext.Error {
-		s.setTagError(value)
+		s.setTagError(value, &errorConfig{})
 		return
 	}
 	if v, ok := value.(string); ok {
@@ -92,14 +116,81 @@ func (s *span) SetTag(key string, value interface{}) {
 		s.setTagNumeric(key, v)
 		return
 	}
+	if v, ok := value.(bool); ok {
+		// booleans are stored as metrics, 1 for true and 0 for false
+		if v {
+			s.setTagNumeric(key, 1)
+		} else {
+			s.setTagNumeric(key, 0)
+		}
+		return
+	}
 	// not numeric, not a string and not an error, the likelihood of this
 	// happening is close to zero, but we should nevertheless account for it.
-	s.Meta[key] = fmt.Sprint(value)
+	s.setMeta(key, fmt.Sprint(value))
+}
+
+// setMeta sets a meta entry, enforcing the span's tag limits: values are
+// truncated to the maximum length and new keys are dropped once the maximum
+// number of entries is reached. This method is not safe for concurrent use.
+func (s *span) setMeta(key, v string) {
+	if _, ok := s.Meta[key]; !ok && s.limits.maxTags > 0 && len(s.Meta) >= s.limits.maxTags {
+		return
+	}
+	if n := s.limits.maxValueLength; n > 0 {
+		if tv, length, ok := truncate(v, n); ok {
+			v = tv
+			s.Metrics[truncatedTagPrefix+key] = float64(length)
+		}
+	}
+	s.meta()[key] = v
+}
+
+// meta returns the Meta map of s, which is only allocated on the first write,
+// so that spans without string tags do not allocate it. This method is not safe
+// for concurrent use.
+func (s *span) meta() map[string]string {
+	if s.Meta == nil {
+		s.Meta = make(map[string]string)
+	}
+	return s.Meta
+}
+
+// ellipsis ends truncated tag values.
+const ellipsis = "…"
+
+// truncate shortens v to n runes, the last of which is an ellipsis, reporting
+// whether it did so along with the original length of v in runes. It never
+// splits a multibyte character.
+func truncate(v string, n int) (tv string, length int, ok bool) {
+	if len(v) <= n {
+		// v can not have more runes than bytes
+		return v, 0, false
+	}
+	var cut int
+	for i := range v {
+		if length == n-1 {
+			cut = i
+		}
+		length++
+	}
+	if length <= n {
+		return v, 0, false
+	}
+	return v[:cut] + ellipsis, length, true
+}
+
+// errorConfig holds customization options for setting error tags.
+type errorConfig struct {
+	noDebugStack bool
+	stackFrames  uint
+	stackSkip    uint
 }
 
 // setTagError sets the error tag. It accounts for various valid scenarios.
+// The stack trace starts at the caller of the method calling setTagError.
 // This method is not safe for concurrent use.
-func (s *span) setTagError(value interface{}) {
+func (s *span) setTagError(value interface{}, cfg *errorConfig) {
 	switch v := value.(type) {
 	case bool:
 		// bool value as per Opentracing spec.
@@ -112,9 +203,12 @@ func (s *span) setTagError(value interface{}) {
 		// if anyone sets an error value as the tag, be nice here
 		// and provide all the benefits.
 		s.Error = 1
-		s.Meta[ext.ErrorMsg] = v.Error()
-		s.Meta[ext.ErrorType] = reflect.TypeOf(v).String()
-		s.Meta[ext.ErrorStack] = string(debug.Stack())
+		s.setMeta(ext.ErrorMsg, v.Error())
+		s.setMeta(ext.ErrorType, reflect.TypeOf(v).String())
+		if !cfg.noDebugStack {
+			// skip setTagError and its caller
+			s.setMeta(ext.ErrorStack, takeStacktrace(cfg.stackFrames, cfg.stackSkip+2))
+		}
 	case nil:
 		// no error
 		s.Error = 0
@@ -135,7 +229,7 @@ func (s *span) setTagString(key, v string) {
 	case ext.SpanType:
 		s.Type = v
 	default:
-		s.Meta[key] = v
+		s.setMeta(key, v)
 	}
 }
 
@@ -156,26 +250,80 @@ func (s *span) setTagNumeric(key string, v float64) {
 // of its part of the tracing session.
 func (s *span) Finish(opts ...ddtrace.FinishOption) {
 	var cfg ddtrace.FinishConfig
-	for _, fn := range opts {
-		fn(&cfg)
+	if len(opts) > 0 {
+		// spans are mostly finished without options, avoid allocating then
+		cfg = newFinishConfig(opts)
 	}
 	var t int64
-	if cfg.FinishTime.IsZero() {
+	if cfg.FinishTime.IsZero() && s.startMonotonic != 0 {
+		// measure the duration with the monotonic clock, so that it can not
+		// be skewed by changes of the wall clock since the span started
+		t = s.Start + monotonicNow() - s.startMonotonic
+	} else if cfg.FinishTime.IsZero() {
 		t = now()
 	} else {
 		t = cfg.FinishTime.UnixNano()
 	}
-	if cfg.Error != nil {
-		s.SetTag(ext.Error, cfg.Error)
+	if cfg.Error != nil && s.context.sampled {
+		s.Lock()
+		if !s.finished {
+			s.setTagError(cfg.Error, &errorConfig{
+				noDebugStack: cfg.NoDebugStack,
+				stackFrames:  cfg.StackFrames,
+				stackSkip:    cfg.SkipStackFrames,
+			})
+		}
+		s.Unlock()
 	}
 	s.finish(t)
 }
 
+// newFinishConfig returns the configuration resulting from the given options.
+func newFinishConfig(opts []ddtrace.FinishOption) ddtrace.FinishConfig {
+	cfg := new(ddtrace.FinishConfig)
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	return *cfg
+}
+
+// defaultStackLength specifies the default maximum number of frames captured
+// in the stack traces of errors.
+const defaultStackLength = 32
+
+// takeStacktrace returns a stack trace of at most n frames (defaultStackLength
+// if zero), starting at the caller of takeStacktrace and skipping the given
+// number of frames.
+func takeStacktrace(n, skip uint) string {
+	if n == 0 {
+		n = defaultStackLength
+	}
+	pcs := make([]uintptr, n)
+	// +2 to exclude runtime.Callers and takeStacktrace
+	numFrames := runtime.Callers(2+int(skip), pcs)
+	if numFrames == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	frames := runtime.CallersFrames(pcs[:numFrames])
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&buf, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
 // SetOperationName sets or changes the operation name.
 func (s *span) SetOperationName(operationName string) {
 	s.Lock()
 	defer s.Unlock()
-
+	if s.finished {
+		// the span may be flushing, see SetTag
+		return
+	}
 	s.Name = operationName
 }
 
@@ -191,41 +339,145 @@ func (s *span) finish(finishTime int64) {
 	}
 	if s.Duration == 0 {
 		s.Duration = finishTime - s.Start
+		if s.Duration < 0 {
+			// the finish time precedes the start time, which is kept so that
+			// the span remains in place in its trace
+			s.meta()[negativeDurationKey] = time.Duration(s.Duration).String()
+			if debugEnabled() {
+				debugf("span %q finished %s before it started, setting its duration to 0", s.Name, time.Duration(-s.Duration))
+			}
+			s.Duration = 0
+		}
 	}
 	s.finished = true
-
+	if s.registry != nil {
+		s.registry.remove(s)
+	}
+	if s.pprofLabels != nil {
+		s.pprofLabels.finish()
+	}
+	if debugEnabled() {
+		debugf("finished span %q (trace: %d, span: %d, duration: %s)", s.Name, s.TraceID, s.SpanID, time.Duration(s.Duration))
+	}
 	if !s.context.sampled {
 		// not sampled
 		return
 	}
+	s.context.ForeachBaggageItem(func(k, v string) bool {
+		if _, ok := s.Meta[baggageTagPrefix+k]; !ok {
+			s.setMeta(baggageTagPrefix+k, v)
+		}
+		return true
+	})
 	s.context.finish()
 }
 
-// String returns a human readable representation of the span. Not for
-// production, just debugging.
+// String returns a one-line summary of the span, for debugging purposes. The
+// duration is omitted until the span finishes.
 func (s *span) String() string {
-	lines := []string{
-		fmt.Sprintf("Name: %s", s.Name),
-		fmt.Sprintf("Service: %s", s.Service),
-		fmt.Sprintf("Resource: %s", s.Resource),
-		fmt.Sprintf("TraceID: %d", s.TraceID),
-		fmt.Sprintf("SpanID: %d", s.SpanID),
-		fmt.Sprintf("ParentID: %d", s.ParentID),
-		fmt.Sprintf("Start: %s", time.Unix(0, s.Start)),
-		fmt.Sprintf("Duration: %s", time.Duration(s.Duration)),
-		fmt.Sprintf("Error: %d", s.Error),
-		fmt.Sprintf("Type: %s", s.Type),
-		"Tags:",
+	s.RLock()
+	defer s.RUnlock()
+	return s.summary()
+}
+
+// summary returns the summary of the span returned by String. It must be called
+// with the lock of s held, or once s is finished.
+func (s *span) summary() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "name=%q service=%q resource=%q trace_id=%d span_id=%d parent_id=%d", s.Name, s.Service, s.Resource, s.TraceID, s.SpanID, s.ParentID)
+	if s.finished {
+		fmt.Fprintf(&b, " duration=%s", time.Duration(s.Duration))
 	}
+	fmt.Fprintf(&b, " error=%t", s.Error != 0)
+	return b.String()
+}
+
+// MarshalJSON implements json.Marshaler, for debugging purposes. The span is
+// encoded with the field names of the payloads sent to the agent, except that
+// its start time is formatted as RFC 3339 and its duration is expressed in
+// milliseconds, and omitted until the span finishes.
+func (s *span) MarshalJSON() ([]byte, error) {
 	s.RLock()
-	for key, val := range s.Meta {
-		lines = append(lines, fmt.Sprintf("\t%s:%s", key, val))
+	defer s.RUnlock()
+	v := struct {
+		Name     string             `json:"name"`
+		Service  string             `json:"service"`
+		Resource string             `json:"resource"`
+		Type     string             `json:"type,omitempty"`
+		Start    string             `json:"start"`
+		Duration *float64           `json:"duration,omitempty"`
+		Meta     map[string]string  `json:"meta,omitempty"`
+		Metrics  map[string]float64 `json:"metrics,omitempty"`
+		SpanID   uint64             `json:"span_id"`
+		TraceID  uint64             `json:"trace_id"`
+		ParentID uint64             `json:"parent_id"`
+		Error    int32              `json:"error"`
+	}{
+		Name:     s.Name,
+		Service:  s.Service,
+		Resource: s.Resource,
+		Type:     s.Type,
+		Start:    time.Unix(0, s.Start).UTC().Format(time.RFC3339Nano),
+		Meta:     s.Meta,
+		Metrics:  s.Metrics,
+		SpanID:   s.SpanID,
+		TraceID:  s.TraceID,
+		ParentID: s.ParentID,
+		Error:    s.Error,
 	}
-	for key, val := range s.Metrics {
-		lines = append(lines, fmt.Sprintf("\t%s:%f", key, val))
+	if s.finished {
+		ms := float64(s.Duration) / float64(time.Millisecond)
+		v.Duration = &ms
 	}
-	s.RUnlock()
-	return strings.Join(lines, "\n")
+	return json.Marshal(v)
 }
 
-const samplingPriorityKey = "_sampling_priority_v1"
+const (
+	samplingPriorityKey = "_sampling_priority_v1"
+
+	// originKey is the meta key holding the origin of a trace, such as
+	// "synthetics", as propagated by the upstream services.
+	originKey = "_dd.origin"
+
+	// traceIDHighKey is the meta key holding the upper 64 bits of 128-bit
+	// trace IDs, set on process-level root spans.
+	traceIDHighKey = "_dd.p.tid"
+
+	// followsFromKey is the meta key holding the ID of the span which a span
+	// started using FollowsFrom follows from.
+	followsFromKey = "_dd.follows_from"
+
+	// droppedSpansKey is the meta key holding the number of spans of a trace
+	// which were dropped because it reached its maximum number of spans, set
+	// on its root span.
+	droppedSpansKey = "_dd.trace.dropped_spans"
+
+	// negativeDurationKey is the meta key holding the duration of a span which
+	// was finished before its start time, in which case its duration is zero.
+	negativeDurationKey = "_dd.negative_duration"
+
+	// baggageTagPrefix prefixes the meta keys holding the baggage items of a
+	// span, which are set when it finishes.
+	baggageTagPrefix = "baggage."
+
+	// hostnameKey is the meta key holding the hostname of the machine, set on
+	// process-level root spans.
+	hostnameKey = "_dd.hostname"
+
+	// languageKey and runtimeVersionKey are the meta keys holding the language
+	// and the Go version of the process, set on process-level root spans.
+	languageKey       = "language"
+	runtimeVersionKey = "runtime.version"
+
+	// truncatedTagPrefix prefixes the metric keys holding the original length,
+	// in runes, of tag values which were truncated.
+	truncatedTagPrefix = "_dd.truncated."
+
+	// defaultMaxTagsPerSpan is the default maximum number of string tags held
+	// by a span.
+	defaultMaxTagsPerSpan = 256
+
+	// defaultMaxTagValueLength is the default maximum length of string tag
+	// values, in runes.
+	defaultMaxTagValueLength = 5000
+)
@@ -1,9 +1,15 @@
 package tracer
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 
@@ -41,6 +47,41 @@ func TestSpanBaggage(t *testing.T) {
 	assert.Equal("value", span.BaggageItem("key"))
 }
 
+func TestSpanBaggageTags(t *testing.T) {
+	assert := assert.New(t)
+	tracer := newTracer(withTransport(newDummyTransport()))
+	defer tracer.Stop()
+
+	root := tracer.StartSpan("web.request").(*span)
+	root.SetBaggageItem("customer.tier", "gold")
+	root.SetBaggageItem("region", "eu")
+	root.SetTag("baggage.region", "us")
+	child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+	assert.Equal("gold", child.BaggageItem("customer.tier"))
+	child.SetBaggageItem("query", "select")
+	assert.Empty(root.BaggageItem("query"), "children don't change the baggage of their parent")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child.SetBaggageItem(fmt.Sprintf("item.%d", i), "x")
+			child.BaggageItem("customer.tier")
+		}(i)
+	}
+	wg.Wait()
+	child.Finish()
+	root.Finish()
+
+	assert.Equal("gold", root.Meta["baggage.customer.tier"])
+	assert.Equal("us", root.Meta["baggage.region"], "tags take precedence")
+	assert.NotContains(root.Meta, "baggage.query")
+	assert.Equal("gold", child.Meta["baggage.customer.tier"])
+	assert.Equal("select", child.Meta["baggage.query"])
+	assert.Equal("x", child.Meta["baggage.item.9"])
+}
+
 func TestSpanContext(t *testing.T) {
 	assert := assert.New(t)
 
@@ -54,6 +95,93 @@ func TestSpanOperationName(t *testing.T) {
 	span := newBasicSpan("web.request")
 	span.SetOperationName("http.request")
 	assert.Equal("http.request", span.Name)
+
+	span.Finish()
+	span.SetOperationName("grpc.server")
+	assert.Equal("http.request", span.Name)
+}
+
+func TestSpanRenameWhileFinishing(t *testing.T) {
+	tracer, transport, stop := startAsyncTestTracer()
+	defer stop()
+
+	for i := 0; i < 100; i++ {
+		span := tracer.StartSpan("web.request").(*span)
+		finished := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rename := func() {
+				span.SetOperationName("http.request")
+				span.SetTag(ext.ResourceName, "GET /users/:id")
+			}
+			rename()
+			<-finished
+			rename() // while flushing
+		}()
+		go func() {
+			defer wg.Done()
+			span.Finish()
+			close(finished)
+			tracer.forceFlush()
+		}()
+		wg.Wait()
+	}
+	tracer.forceFlush()
+	traces := transport.Traces()
+	assert.Len(t, traces, 100)
+	for _, trace := range traces {
+		// changes are either applied before finishing or discarded
+		assert.Contains(t, []string{"web.request", "http.request"}, trace[0].Name)
+		assert.Contains(t, []string{"web.request", "GET /users/:id"}, trace[0].Resource)
+	}
+}
+
+func TestSpanSetTagWhileFlushing(t *testing.T) {
+	tracer, transport, stop := startAsyncTestTracer()
+	defer stop()
+
+	for i := 0; i < 100; i++ {
+		root := tracer.StartSpan("web.request").(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		finished := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			// async work tagging spans which may have been finished
+			defer wg.Done()
+			tag := func(sp *span) {
+				sp.SetTag("key", "value")
+				sp.SetTag("count", 1)
+				sp.SetTag(ext.Error, errors.New("abc"))
+				sp.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+				sp.SetBaggageItem("user", "bob")
+			}
+			tag(child)
+			<-finished
+			tag(root)
+			tag(child)
+		}()
+		go func() {
+			defer wg.Done()
+			child.Finish(WithError(errors.New("def")))
+			root.Finish()
+			close(finished)
+			tracer.forceFlush()
+		}()
+		wg.Wait()
+	}
+	tracer.forceFlush()
+	traces := transport.Traces()
+	assert.Len(t, traces, 100)
+	for _, trace := range traces {
+		assert.Len(t, trace, 2)
+		// the root was finished before being tagged
+		assert.Equal(t, "web.request", trace[0].Name)
+		assert.NotContains(t, trace[0].Meta, "key")
+		assert.EqualValues(t, 0, trace[0].Error)
+	}
 }
 
 func TestSpanFinish(t *testing.T) {
@@ -102,6 +230,99 @@ func TestSpanFinishWithTime(t *testing.T) {
 	assert.Equal(duration, span.Duration)
 }
 
+func TestSpanFinishWithTimeBeforeStart(t *testing.T) {
+	assert := assert.New(t)
+	tracer, transport, stop := startTestTracer()
+	defer stop()
+
+	start := time.Now()
+	span := tracer.StartSpan("batch.job", StartTime(start)).(*span)
+	span.Finish(FinishTime(start.Add(-time.Second)))
+	assert.EqualValues(0, span.Duration)
+	assert.Equal("-1s", span.Meta[negativeDurationKey])
+
+	// only the first finish is taken into account
+	span.Finish(FinishTime(start.Add(time.Second)))
+	assert.EqualValues(0, span.Duration)
+	tracer.forceFlush()
+	assert.Len(transport.Traces(), 1)
+}
+
+func TestSpanFinishMonotonic(t *testing.T) {
+	defer func(wall, monotonic func() int64) {
+		now, monotonicNow = wall, monotonic
+	}(now, monotonicNow)
+	var wallClock, monotonicClock int64 = time.Now().UnixNano(), 1
+	now = func() int64 { return wallClock }
+	monotonicNow = func() int64 { return monotonicClock }
+	tracer, _, stop := startTestTracer()
+	defer stop()
+
+	t.Run("clock-stepped-back", func(t *testing.T) {
+		assert := assert.New(t)
+		span := tracer.StartSpan("web.request").(*span)
+		wallClock -= int64(time.Hour)
+		monotonicClock += int64(5 * time.Millisecond)
+		span.Finish()
+		assert.Equal(int64(5*time.Millisecond), span.Duration)
+		assert.NotContains(span.Meta, negativeDurationKey)
+	})
+
+	t.Run("clock-stepped-forward", func(t *testing.T) {
+		assert := assert.New(t)
+		span := tracer.StartSpan("web.request").(*span)
+		wallClock += 3 * int64(time.Hour)
+		monotonicClock += int64(time.Second)
+		span.Finish()
+		assert.Equal(int64(time.Second), span.Duration)
+	})
+
+	t.Run("start-time", func(t *testing.T) {
+		// without a monotonic start, the wall clock is used
+		assert := assert.New(t)
+		span := tracer.StartSpan("web.request", StartTime(time.Unix(0, wallClock))).(*span)
+		wallClock += int64(time.Minute)
+		monotonicClock += int64(time.Second)
+		span.Finish()
+		assert.Equal(int64(time.Minute), span.Duration)
+	})
+
+	t.Run("finish-time", func(t *testing.T) {
+		assert := assert.New(t)
+		span := tracer.StartSpan("web.request").(*span)
+		monotonicClock += int64(time.Second)
+		span.Finish(FinishTime(time.Unix(0, span.Start).Add(time.Minute)))
+		assert.Equal(int64(time.Minute), span.Duration)
+	})
+}
+
+func TestSpanRetroactive(t *testing.T) {
+	assert := assert.New(t)
+	tracer, _, stop := startTestTracer()
+	defer stop()
+
+	start := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	span := tracer.StartSpan("batch.job", StartTime(start)).(*span)
+	span.Finish(FinishTime(start.Add(time.Minute)))
+	assert.Equal(start.UnixNano(), span.Start)
+	assert.Equal(time.Minute.Nanoseconds(), span.Duration)
+	assert.NotContains(span.Meta, negativeDurationKey)
+}
+
+func TestSpanZeroTimes(t *testing.T) {
+	assert := assert.New(t)
+	tracer, _, stop := startTestTracer()
+	defer stop()
+
+	before := time.Now().UnixNano()
+	span := tracer.StartSpan("web.request", StartTime(time.Time{})).(*span)
+	span.Finish(FinishTime(time.Time{}))
+	after := time.Now().UnixNano()
+	assert.True(span.Start >= before && span.Start <= after)
+	assert.True(span.Duration >= 0 && span.Start+span.Duration <= after)
+	assert.NotContains(span.Meta, negativeDurationKey)
+}
+
 func TestSpanFinishWithError(t *testing.T) {
 	assert := assert.New(t)
 
@@ -115,6 +336,85 @@ func TestSpanFinishWithError(t *testing.T) {
 	assert.NotEmpty(span.Meta[ext.ErrorStack])
 }
 
+func TestSpanSetErrorThenFinish(t *testing.T) {
+	err := errors.New("internal error")
+	for name, opts := range map[string][]FinishOption{
+		"no-options": nil,
+		"nil-error":  {WithError(nil)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			span := newBasicSpan("web.request")
+			span.SetTag(ext.Error, err)
+			span.SetTag(ext.HTTPCode, "500") // the span keeps running
+			span.Finish(opts...)
+
+			assert.Equal(int32(1), span.Error)
+			assert.Equal("internal error", span.Meta[ext.ErrorMsg])
+			assert.Equal("*errors.errorString", span.Meta[ext.ErrorType])
+			assert.NotEmpty(span.Meta[ext.ErrorStack])
+			assert.Equal("500", span.Meta[ext.HTTPCode])
+		})
+	}
+}
+
+func TestSpanFinishWithErrorStack(t *testing.T) {
+	err := errors.New("test error")
+
+	t.Run("call-site", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(err))
+		stack := span.Meta[ext.ErrorStack]
+		assert.True(t, strings.HasPrefix(stack, "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.TestSpanFinishWithErrorStack.func1\n"), stack)
+		assert.NotContains(t, stack, "(*span).Finish")
+		assert.NotContains(t, stack, "takeStacktrace")
+	})
+
+	t.Run("set-tag", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.SetTag(ext.Error, err)
+		stack := span.Meta[ext.ErrorStack]
+		assert.True(t, strings.HasPrefix(stack, "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.TestSpanFinishWithErrorStack.func2\n"), stack)
+		assert.NotContains(t, stack, "(*span).SetTag")
+	})
+
+	t.Run("no-debug-stack", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(err), NoDebugStack())
+		assert.Equal(t, int32(1), span.Error)
+		assert.Equal(t, "test error", span.Meta[ext.ErrorMsg])
+		assert.Equal(t, "*errors.errorString", span.Meta[ext.ErrorType])
+		assert.NotContains(t, span.Meta, ext.ErrorStack)
+	})
+
+	t.Run("frames", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish(WithError(err), StackFrames(2, 1))
+		stack := span.Meta[ext.ErrorStack]
+		assert.Equal(t, 2, strings.Count(stack, "\n\t"), stack)
+		assert.NotContains(t, stack, "TestSpanFinishWithErrorStack")
+	})
+
+	t.Run("default-frames", func(t *testing.T) {
+		var recurse func(n int) string
+		recurse = func(n int) string {
+			if n == 0 {
+				return takeStacktrace(0, 0)
+			}
+			return recurse(n - 1)
+		}
+		assert.Equal(t, defaultStackLength, strings.Count(recurse(2*defaultStackLength), "\n\t"))
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		span := newBasicSpan("web.request")
+		span.Finish()
+		span.Finish(WithError(err))
+		assert.Equal(t, int32(0), span.Error)
+		assert.NotContains(t, span.Meta, ext.ErrorStack)
+	})
+}
+
 func TestSpanSetTag(t *testing.T) {
 	assert := assert.New(t)
 
@@ -125,6 +425,15 @@ func TestSpanSetTag(t *testing.T) {
 	span.SetTag("tagInt", 1234)
 	assert.Equal(float64(1234), span.Metrics["tagInt"])
 
+	span.SetTag("tagInt8", int8(12))
+	assert.Equal(float64(12), span.Metrics["tagInt8"])
+
+	span.SetTag("tagBool", true)
+	assert.Equal(float64(1), span.Metrics["tagBool"])
+	span.SetTag("tagBool", false)
+	assert.Equal(float64(0), span.Metrics["tagBool"])
+	assert.NotContains(span.Meta, "tagBool")
+
 	span.SetTag("tagStruct", struct{ A, B int }{1, 2})
 	assert.Equal("{1 2}", span.Meta["tagStruct"])
 
@@ -150,6 +459,148 @@ func TestSpanSetTag(t *testing.T) {
 	assert.Equal(float64(2), span.Metrics[samplingPriorityKey])
 }
 
+func TestSpanSetTagLazyMeta(t *testing.T) {
+	assert := assert.New(t)
+	tracer, _, stop := startTestTracer()
+	defer stop()
+
+	root := tracer.StartSpan("web.request")
+	child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+	child.SetTag("tagInt", 1234)
+	assert.Nil(child.Meta)
+
+	child.SetTag("component", "tracer")
+	assert.Equal(map[string]string{"component": "tracer"}, child.Meta)
+}
+
+func TestSpanTagLimits(t *testing.T) {
+	t.Run("max-tags", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		span.limits.maxTags = 2
+		span.SetTag("a", "1")
+		span.SetTag("b", "2")
+		span.SetTag("c", "3")
+		span.SetTag("a", "4")
+		span.SetTag("num", 5)
+		assert.Equal(map[string]string{"a": "4", "b": "2"}, span.Meta)
+		assert.Equal(float64(5), span.Metrics["num"])
+	})
+
+	t.Run("max-value-length", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		span.limits.maxValueLength = 5
+		span.SetTag("short", "abcde")
+		span.SetTag("long", "abcdefgh")
+		span.SetTag("struct", struct{ A, B int }{123, 456})
+		assert.Equal("abcde", span.Meta["short"])
+		assert.NotContains(span.Metrics, truncatedTagPrefix+"short")
+		assert.Equal("abcd…", span.Meta["long"])
+		assert.Equal(float64(8), span.Metrics[truncatedTagPrefix+"long"])
+		assert.Equal("{123…", span.Meta["struct"])
+	})
+
+	t.Run("max-value-length-runes", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		span.limits.maxValueLength = 3
+		span.SetTag("empty", "")
+		span.SetTag("boundary", "日本語")
+		span.SetTag("over", "日本語の")
+		span.SetTag("type", errors.New("日本語の"))
+		assert.Equal("", span.Meta["empty"])
+		assert.Equal("日本語", span.Meta["boundary"])
+		assert.Equal("日本…", span.Meta["over"])
+		assert.Equal("日本…", span.Meta["type"])
+		assert.Equal(map[string]float64{
+			truncatedTagPrefix + "over": 4,
+			truncatedTagPrefix + "type": 4,
+		}, span.Metrics)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		span.limits.maxValueLength = 10
+		span.Finish(WithError(errors.New(strings.Repeat("x", 100))))
+		assert.Equal(strings.Repeat("x", 9)+"…", span.Meta[ext.ErrorMsg])
+		assert.Equal(10, utf8.RuneCountInString(span.Meta[ext.ErrorStack]))
+	})
+
+	t.Run("baggage", func(t *testing.T) {
+		assert := assert.New(t)
+		span := newBasicSpan("web.request")
+		span.limits.maxValueLength = 3
+		span.SetBaggageItem("item", "value")
+		span.Finish()
+		assert.Equal("va…", span.Meta[baggageTagPrefix+"item"])
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDummyTransport()))
+		defer tracer.Stop()
+		span := tracer.StartSpan("web.request").(*span)
+		for i := 0; i < 2*defaultMaxTagsPerSpan; i++ {
+			span.SetTag(fmt.Sprintf("tag%d", i), strings.Repeat("x", 2*defaultMaxTagValueLength))
+		}
+		assert.Len(span.Meta, defaultMaxTagsPerSpan)
+		for _, v := range span.Meta {
+			assert.True(utf8.RuneCountInString(v) <= defaultMaxTagValueLength)
+		}
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		in     string
+		n      int
+		out    string
+		length int
+	}{
+		{"", 3, "", 0},
+		{"abc", 3, "abc", 0},
+		{"abcd", 3, "ab…", 4},
+		{"abcd", 1, "…", 4},
+		{"héllo", 5, "héllo", 0},        // 6 bytes, 5 runes
+		{"héllo wörld", 5, "héll…", 11}, // never split é or ö
+		{"日本語のテキスト", 4, "日本語…", 8},      // 3 bytes per rune
+		{"😀😀😀😀", 2, "😀…", 4},            // 4 bytes per rune
+		{"ab\xffcdef", 4, "ab\xff…", 7}, // invalid bytes count as a rune each
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			out, length, ok := truncate(tt.in, tt.n)
+			assert.Equal(t, tt.out, out)
+			assert.Equal(t, tt.length, length)
+			assert.Equal(t, tt.length > 0, ok)
+			if ok {
+				assert.Equal(t, tt.n, utf8.RuneCountInString(out))
+			}
+			if utf8.ValidString(tt.in) {
+				assert.True(t, utf8.ValidString(out))
+			}
+		})
+	}
+}
+
+func TestSpanSetTagConcurrent(t *testing.T) {
+	span := newBasicSpan("web.request")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			span.SetTag(fmt.Sprintf("bool.%d", i), true)
+			span.SetTag(fmt.Sprintf("int.%d", i), i)
+			span.SetTag(fmt.Sprintf("str.%d", i), "value")
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, span.Metrics, 20)
+	assert.Len(t, span.Meta, 10)
+}
+
 func TestSpanSetDatadogTags(t *testing.T) {
 	assert := assert.New(t)
 
@@ -174,12 +625,60 @@ func TestSpanStart(t *testing.T) {
 
 func TestSpanString(t *testing.T) {
 	assert := assert.New(t)
-	tracer := newTracer(withTransport(newDefaultTransport()))
-	span := tracer.newRootSpan("pylons.request", "pylons", "/")
-	// don't bother checking the contents, just make sure it works.
-	assert.NotEqual("", span.String())
+	span := newBasicSpan("pylons.request")
+	span.Service = "pylons"
+	span.Resource = "/"
+	span.TraceID, span.SpanID, span.ParentID = 1, 2, 3
+	assert.Equal(`name="pylons.request" service="pylons" resource="/" trace_id=1 span_id=2 parent_id=3 error=false`, span.String())
+
+	span.Error = 1
+	span.Duration = int64(1500 * time.Microsecond)
+	span.finished = true
+	assert.Equal(`name="pylons.request" service="pylons" resource="/" trace_id=1 span_id=2 parent_id=3 duration=1.5ms error=true`, span.String())
+}
+
+func TestSpanMarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+	span := newBasicSpan("pylons.request")
+	span.Service = "pylons"
+	span.Resource = "/"
+	span.Start = time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC).UnixNano()
+	span.TraceID, span.SpanID = 1, 1
+	span.Meta["k"] = "v"
+
+	b, err := json.Marshal(span)
+	assert.NoError(err)
+	assert.Equal(`{"name":"pylons.request","service":"pylons","resource":"/","start":"2018-01-01T10:00:00Z","meta":{"k":"v"},"span_id":1,"trace_id":1,"parent_id":0,"error":0}`, string(b))
+
+	span.Duration = int64(1500 * time.Microsecond)
+	span.finished = true
+	b, err = json.Marshal(span)
+	assert.NoError(err)
+	assert.Contains(string(b), `"start":"2018-01-01T10:00:00Z","duration":1.5,`)
+}
+
+func TestSpanStringConcurrent(t *testing.T) {
+	tracer, _, stop := startTestTracer()
+	defer stop()
+	span := tracer.StartSpan("pylons.request").(*span)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			span.SetTag("key", i)
+			span.SetTag(ext.ResourceName, strconv.Itoa(i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = span.String()
+			_, _ = json.Marshal(span)
+		}
+	}()
+	wg.Wait()
 	span.Finish()
-	assert.NotEqual("", span.String())
 }
 
 func TestSpanSetMetric(t *testing.T) {
@@ -187,15 +686,17 @@ func TestSpanSetMetric(t *testing.T) {
 	tracer := newTracer(withTransport(newDefaultTransport()))
 	span := tracer.newRootSpan("pylons.request", "pylons", "/")
 
-	// check the map is properly initialized
+	// check the map is properly initialized, root spans already hold
+	// the sampling priority metrics
+	n := len(span.Metrics)
 	span.SetTag("bytes", 1024.42)
-	assert.Equal(1, len(span.Metrics))
+	assert.Equal(n+1, len(span.Metrics))
 	assert.Equal(1024.42, span.Metrics["bytes"])
 
 	// operating on a finished span is a no-op
 	span.Finish()
 	span.SetTag("finished.test", 1337)
-	assert.Equal(1, len(span.Metrics))
+	assert.Equal(n+1, len(span.Metrics))
 	assert.Equal(0.0, span.Metrics["finished.test"])
 }
 
@@ -282,9 +783,10 @@ func TestSpanSamplingPriority(t *testing.T) {
 	assert := assert.New(t)
 	tracer := newTracer(withTransport(newDefaultTransport()))
 
+	// root spans are given a priority by default
 	span := tracer.newRootSpan("my.name", "my.service", "my.resource")
-	_, ok := span.Metrics[samplingPriorityKey]
-	assert.False(ok)
+	assert.EqualValues(ext.PriorityAutoKeep, span.Metrics[samplingPriorityKey])
+	assert.EqualValues(1, span.Metrics[samplingPriorityRateKey])
 
 	for _, priority := range []int{
 		ext.PriorityUserReject,
@@ -310,6 +812,24 @@ func TestSpanSamplingPriority(t *testing.T) {
 	}
 }
 
+func BenchmarkSetTagError(b *testing.B) {
+	err := errors.New("test error")
+	for _, bm := range []struct {
+		name string
+		opts []FinishOption
+	}{
+		{"stack", []FinishOption{WithError(err)}},
+		{"no-stack", []FinishOption{WithError(err), NoDebugStack()}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				newBasicSpan("bench.span").Finish(bm.opts...)
+			}
+		})
+	}
+}
+
 func BenchmarkSetTagMetric(b *testing.B) {
 	span := newBasicSpan("bench.span")
 	keys := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -1,6 +1,7 @@
 package tracer
 
 import (
+	"strconv"
 	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -24,6 +25,11 @@ type spanContext struct {
 
 	traceID uint64
 	spanID  uint64
+	origin  string // the origin of the trace, e.g. "synthetics"; immutable
+
+	// traceIDHigh holds the upper 64 bits of 128-bit trace IDs, which are
+	// propagated but not otherwise used; immutable
+	traceIDHigh uint64
 
 	mu          sync.RWMutex // guards below fields
 	baggage     map[string]string
@@ -35,7 +41,8 @@ type spanContext struct {
 // span. If the provided parent is not nil, the context will inherit the trace,
 // baggage and other values from it. This method also pushes the span into the
 // new context's trace and as a result, it should not be called multiple times
-// for the same span.
+// for the same span. It returns nil if the trace already holds its maximum number
+// of spans, in which case the span is dropped.
 func newSpanContext(span *span, parent *spanContext) *spanContext {
 	context := &spanContext{
 		traceID: span.TraceID,
@@ -52,6 +59,8 @@ func newSpanContext(span *span, parent *spanContext) *spanContext {
 		context.sampled = parent.sampled
 		context.hasPriority = parent.hasSamplingPriority()
 		context.priority = parent.samplingPriority()
+		context.origin = parent.origin
+		context.traceIDHigh = parent.traceIDHigh
 		parent.ForeachBaggageItem(func(k, v string) bool {
 			context.setBaggageItem(k, v)
 			return true
@@ -59,12 +68,39 @@ func newSpanContext(span *span, parent *spanContext) *spanContext {
 	}
 	if context.trace == nil {
 		context.trace = newTrace()
+		if context.hasPriority {
+			// the priority was set on a root span or propagated cross-process
+			context.trace.setSamplingPriority(context.priority)
+		}
 	}
 	// put span in context's trace
-	context.trace.push(span)
+	if !context.trace.push(span) {
+		return nil
+	}
 	return context
 }
 
+// newFollowsFromContext creates a new SpanContext for the given span, which
+// follows from the one of parent. It inherits the values of parent, like the
+// context of a child span would, but is given a new trace buffer, which is
+// flushed independently of the one of parent.
+func newFollowsFromContext(span *span, parent *spanContext) *spanContext {
+	from := &spanContext{
+		traceID:     parent.traceID,
+		spanID:      parent.spanID,
+		sampled:     parent.sampled,
+		origin:      parent.origin,
+		traceIDHigh: parent.traceIDHigh,
+		priority:    parent.samplingPriority(),
+		hasPriority: parent.hasSamplingPriority(),
+	}
+	parent.ForeachBaggageItem(func(k, v string) bool {
+		from.setBaggageItem(k, v)
+		return true
+	})
+	return newSpanContext(span, from)
+}
+
 // SpanID implements ddtrace.SpanContext.
 func (c *spanContext) SpanID() uint64 { return c.spanID }
 
@@ -82,20 +118,37 @@ func (c *spanContext) ForeachBaggageItem(handler func(k, v string) bool) {
 	}
 }
 
+// setSamplingPriority sets the sampling priority of the context, along with
+// the one of the whole trace.
 func (c *spanContext) setSamplingPriority(p int) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	c.priority = p
 	c.hasPriority = true
+	c.mu.Unlock()
+	if c.trace != nil {
+		c.trace.setSamplingPriority(p)
+	}
 }
 
+// samplingPriority returns the sampling priority of the trace, which may have
+// been set using any of its spans.
 func (c *spanContext) samplingPriority() int {
+	if c.trace != nil {
+		if p, ok := c.trace.samplingPriority(); ok {
+			return p
+		}
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.priority
 }
 
 func (c *spanContext) hasSamplingPriority() bool {
+	if c.trace != nil {
+		if _, ok := c.trace.samplingPriority(); ok {
+			return true
+		}
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.hasPriority
@@ -117,7 +170,7 @@ func (c *spanContext) baggageItem(key string) string {
 }
 
 // finish marks this span as finished in the trace.
-func (c *spanContext) finish() { c.trace.ackFinish() }
+func (c *spanContext) finish() { c.trace.ackFinish(c.span) }
 
 // trace holds information about a specific trace. This structure is shared
 // between all spans in a trace.
@@ -125,7 +178,26 @@ type trace struct {
 	mu       sync.RWMutex // guards below fields
 	spans    []*span      // all the spans that are part of this trace
 	finished int          // the number of finished spans
-	full     bool         // signifies that the span buffer is full
+
+	// maxSpans is the maximum number of spans of the trace, traceMaxSize if 0.
+	// Spans started once it is reached are dropped.
+	maxSpans int
+	count    int   // the number of spans pushed since the trace started
+	dropped  int   // the number of spans dropped since the trace started
+	root     *span // the first span pushed into the trace
+
+	// partialFlushMinSpans is the number of finished spans which triggers
+	// flushing them before the whole trace is complete; 0 disables it.
+	partialFlushMinSpans int
+	done                 []*span // the finished spans, when partial flushing is enabled
+
+	priority    int  // the sampling priority of the trace
+	hasPriority bool // whether priority is set
+
+	// tracer is the tracer which started the trace and which its spans are
+	// submitted to until it stops, even once it is no longer the global
+	// tracer. It is set before the trace is shared and not modified afterwards.
+	tracer *tracer
 }
 
 var (
@@ -134,10 +206,10 @@ var (
 	// reasonable as span is actually way bigger, and avoids re-allocating
 	// over and over. Could be fine-tuned at runtime.
 	traceStartSize = 10
-	// traceMaxSize is the maximum number of spans we keep in memory.
-	// This is to avoid memory leaks, if above that value, spans are randomly
-	// dropped and ignore, resulting in corrupted tracing data, but ensuring
-	// original program continues to work as expected.
+	// traceMaxSize is the default maximum number of spans of a trace. This
+	// is to avoid memory leaks: above that value, new spans of the trace are
+	// dropped, resulting in incomplete tracing data, but ensuring the original
+	// program continues to work as expected.
 	traceMaxSize = int(1e5)
 )
 
@@ -147,47 +219,235 @@ func newTrace() *trace {
 	return &trace{spans: make([]*span, 0, traceStartSize)}
 }
 
-// push pushes a new span into the trace. If the buffer is full, it returns
-// a errBufferFull error.
-func (t *trace) push(sp *span) {
+// push pushes a new span into the trace. If the trace already holds its maximum
+// number of spans, the span is dropped and push returns false; the first time,
+// a spanBufferFullError is reported.
+func (t *trace) push(sp *span) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.full {
-		return
+	max := t.maxSpans
+	if max == 0 {
+		max = traceMaxSize
 	}
-	if len(t.spans) >= traceMaxSize {
-		// capacity is reached, we will not be able to complete this trace.
-		t.full = true
-		t.spans = nil // GC
-		if tr, ok := internal.GetGlobalTracer().(*tracer); ok {
-			// we have a tracer we can submit errors too.
-			tr.pushError(&spanBufferFullError{})
+	if t.count >= max {
+		if t.dropped == 0 {
+			if tr, ok := t.owner(); ok {
+				// we have a tracer we can submit errors too.
+				tr.pushError(&spanBufferFullError{limit: max})
+			}
 		}
-		return
+		t.dropped++
+		return false
+	}
+	if t.count == 0 {
+		t.root = sp
 	}
+	t.count++
 	t.spans = append(t.spans, sp)
+	return true
 }
 
-// ackFinish aknowledges that another span in the trace has finished, and checks
-// if the trace is complete, in which case it calls the onFinish function.
-func (t *trace) ackFinish() {
+// setPartialFlushMinSpans sets the number of finished spans which triggers a
+// partial flush of the trace.
+func (t *trace) setPartialFlushMinSpans(n int) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if t.full {
-		// capacity has been reached, the buffer is no longer tracking
-		// all the spans in the trace, so the below conditions will not
-		// be accurate and would trigger a pre-mature flush, exposing us
-		// to a race condition where spans can be modified while flushing.
+	t.partialFlushMinSpans = n
+}
+
+// setSamplingPriority sets the sampling priority of the trace. It is set on
+// the spans of the trace when they are flushed.
+func (t *trace) setSamplingPriority(p int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.priority = p
+	t.hasPriority = true
+}
+
+// samplingPriority returns the sampling priority of the trace and whether it
+// is set.
+func (t *trace) samplingPriority() (p int, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.priority, t.hasPriority
+}
+
+// pushFinished submits the given finished spans of the trace to the tracer, setting
+// the sampling priority of the trace on the first span and on the ones which
+// hold a priority, as it may have been changed after they were started. It
+// must be called with t.mu held, by the finishing span sp, whose lock is held.
+func (t *trace) pushFinished(spans []*span, sp *span) {
+	if t.hasPriority {
+		// spans are finished, so they are no longer modified
+		for i, sp := range spans {
+			if _, ok := sp.Metrics[samplingPriorityKey]; ok || i == 0 {
+				sp.Metrics[samplingPriorityKey] = float64(t.priority)
+			}
+		}
+	}
+	if t.dropped > 0 {
+		// the count goes on the root, unless it was sent with a previous part
+		// of the trace, in which case it goes on the first span of this one
+		tagged := spans[0]
+		for _, s := range spans {
+			if s == t.root {
+				tagged = s
+				break
+			}
+		}
+		if tagged != sp {
+			tagged.Lock()
+			defer tagged.Unlock()
+		}
+		tagged.meta()[droppedSpansKey] = strconv.Itoa(t.dropped)
+	}
+	if t.tracer != nil && t.tracer.pushTrace(spans) {
 		return
 	}
+	// the tracer which started the trace was stopped, e.g. as it was replaced
+	// by a restart, in which case the spans go to the one replacing it
+	if tr, ok := internal.GetGlobalTracer().(*tracer); ok && tr != t.tracer {
+		tr.pushTrace(spans)
+	}
+}
+
+// owner returns the tracer which the errors of the trace are submitted to: the
+// one which started it or, for traces created outside of a tracer, the global
+// tracer.
+func (t *trace) owner() (*tracer, bool) {
+	if t.tracer != nil {
+		return t.tracer, true
+	}
+	tr, ok := internal.GetGlobalTracer().(*tracer)
+	return tr, ok
+}
+
+// ackFinish aknowledges that another span in the trace has finished, and checks
+// if the trace is complete, in which case it calls the onFinish function. When
+// partial flushing is enabled and enough spans have finished, the finished spans
+// are submitted ahead of the rest of the trace.
+func (t *trace) ackFinish(sp *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.finished++
 	if len(t.spans) != t.finished {
+		if t.partialFlushMinSpans > 0 {
+			if t.done == nil {
+				t.done = make([]*span, 0, traceStartSize)
+			}
+			t.done = append(t.done, sp)
+			if len(t.done) >= t.partialFlushMinSpans {
+				t.flushDone(sp)
+			}
+		}
 		return
 	}
-	if tr, ok := internal.GetGlobalTracer().(*tracer); ok {
-		// we have a tracer that can receive completed traces.
-		tr.pushTrace(t.spans)
-	}
+	t.pushFinished(t.spans, sp)
 	t.spans = nil
+	t.done = nil
 	t.finished = 0 // important, because a buffer can be used for several flushes
+	t.count, t.dropped, t.root = 0, 0, nil
 }
+
+// flushDone submits the finished spans of an incomplete trace and removes
+// them from the trace. It must be called with t.mu held, by the finishing
+// span sp.
+func (t *trace) flushDone(sp *span) {
+	done := make(map[*span]struct{}, len(t.done))
+	for _, sp := range t.done {
+		done[sp] = struct{}{}
+	}
+	open := make([]*span, 0, len(t.spans)-len(t.done))
+	for _, sp := range t.spans {
+		if _, ok := done[sp]; !ok {
+			open = append(open, sp)
+		}
+	}
+	t.pushFinished(t.done, sp)
+	t.spans = open
+	t.finished -= len(t.done)
+	t.done = nil
+}
+
+// RemoteContext holds the values which identify a span of another process,
+// such as the ones received over a custom protocol which the propagators of
+// this package do not support. Its SpanContext may be used with ChildOf to
+// start a descendant of that span, without first extracting it from a carrier.
+type RemoteContext struct {
+	// TraceID and SpanID are the IDs of the trace and of the remote span. Both
+	// must be non-zero for children to join the trace.
+	TraceID, SpanID uint64
+
+	// TraceIDHigh holds the upper 64 bits of 128-bit trace IDs, if any.
+	TraceIDHigh uint64
+
+	// Priority is the sampling priority of the trace, which is only taken
+	// into account when HasPriority is true.
+	Priority    int
+	HasPriority bool
+
+	// Origin is the origin of the trace, e.g. "synthetics".
+	Origin string
+
+	// Baggage holds the baggage items which are propagated to descendants.
+	Baggage map[string]string
+}
+
+// SpanContext returns a context which can be used as the parent of new spans,
+// using the ChildOf start option.
+func (rc RemoteContext) SpanContext() ddtrace.SpanContext {
+	ctx := &spanContext{
+		traceID:     rc.TraceID,
+		spanID:      rc.SpanID,
+		traceIDHigh: rc.TraceIDHigh,
+		origin:      rc.Origin,
+		priority:    rc.Priority,
+		hasPriority: rc.HasPriority,
+	}
+	for k, v := range rc.Baggage {
+		ctx.setBaggageItem(k, v)
+	}
+	return ctx
+}
+
+// RemoteContextOf returns the values of the given context which are propagated
+// to other processes. The boolean is false when ctx was not created by this
+// package's tracer.
+func RemoteContextOf(ctx ddtrace.SpanContext) (RemoteContext, bool) {
+	c, ok := ctx.(*spanContext)
+	if !ok {
+		return RemoteContext{}, false
+	}
+	rc := RemoteContext{
+		TraceID:     c.traceID,
+		SpanID:      c.spanID,
+		TraceIDHigh: c.traceIDHigh,
+		Origin:      c.origin,
+		Priority:    c.samplingPriority(),
+		HasPriority: c.hasSamplingPriority(),
+	}
+	c.ForeachBaggageItem(func(k, v string) bool {
+		if rc.Baggage == nil {
+			rc.Baggage = make(map[string]string)
+		}
+		rc.Baggage[k] = v
+		return true
+	})
+	return rc, true
+}
+
+var _ ddtrace.Span = droppedSpan{}
+
+// droppedSpan is returned in place of the spans started once their trace holds
+// its maximum number of spans. It is not recorded. Its context is the one of its
+// parent, so that its children are dropped as well.
+type droppedSpan struct {
+	internal.NoopSpan
+	context *spanContext
+}
+
+// BaggageItem implements ddtrace.Span.
+func (s droppedSpan) BaggageItem(key string) string { return s.context.baggageItem(key) }
+
+// Context implements ddtrace.Span.
+func (s droppedSpan) Context() ddtrace.SpanContext { return s.context }
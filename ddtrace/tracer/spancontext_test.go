@@ -1,10 +1,14 @@
 package tracer
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 )
 
 func setupteardown(start, max int) func() {
@@ -33,7 +37,7 @@ func TestNewSpanContextPushError(t *testing.T) {
 
 	select {
 	case err := <-tracer.errorBuffer:
-		assert.Equal(t, &spanBufferFullError{}, err)
+		assert.Equal(t, &spanBufferFullError{limit: 2}, err)
 	default:
 		t.Fatal("no error pushed")
 	}
@@ -249,7 +253,84 @@ func TestSpanContextPushFull(t *testing.T) {
 	buffer.push(span3)
 	assert.Len(tracer.errorBuffer, 1)
 	err := <-tracer.errorBuffer
-	assert.Equal(&spanBufferFullError{}, err)
+	assert.Equal(&spanBufferFullError{limit: 2}, err)
+}
+
+func TestTracePartialFlush(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer(WithPartialFlushing(500))
+		defer stop()
+
+		root := tracer.StartSpan("pipeline").(*span)
+		for i := 0; i < 10000; i++ {
+			tracer.StartSpan("step", ChildOf(root.Context())).Finish()
+		}
+		tracer.forceFlush()
+		transport.RLock()
+		assert.Len(transport.traces, 20, "the finished children are sent in chunks")
+		transport.RUnlock()
+		assert.Len(root.context.trace.spans, 1, "only the root is kept")
+
+		root.Finish()
+		tracer.forceFlush()
+		transport.RLock()
+		defer transport.RUnlock()
+		assert.Len(transport.traces, 21)
+		ids := make(map[uint64]bool)
+		for _, chunk := range transport.traces {
+			for _, s := range chunk {
+				assert.Equal(root.TraceID, s.TraceID)
+				ids[s.SpanID] = true
+			}
+		}
+		assert.Len(ids, 10001, "all spans are delivered exactly once")
+	})
+
+	t.Run("unfinished", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer(WithPartialFlushing(2))
+		defer stop()
+
+		root := tracer.StartSpan("pipeline")
+		open := tracer.StartSpan("open", ChildOf(root.Context()))
+		tracer.StartSpan("step", ChildOf(root.Context())).Finish()
+		tracer.StartSpan("step", ChildOf(root.Context())).Finish()
+		tracer.forceFlush()
+		transport.RLock()
+		assert.Len(transport.traces, 1)
+		assert.Len(transport.traces[0], 2)
+		transport.RUnlock()
+
+		open.Finish()
+		root.Finish()
+		tracer.forceFlush()
+		transport.RLock()
+		defer transport.RUnlock()
+		assert.Len(transport.traces, 2)
+		assert.Len(transport.traces[1], 2)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer(WithPartialFlushing(0))
+		defer stop()
+
+		root := tracer.StartSpan("pipeline")
+		for i := 0; i < 1000; i++ {
+			tracer.StartSpan("step", ChildOf(root.Context())).Finish()
+		}
+		tracer.forceFlush()
+		transport.RLock()
+		assert.Len(transport.traces, 0)
+		transport.RUnlock()
+		root.Finish()
+		tracer.forceFlush()
+		transport.RLock()
+		defer transport.RUnlock()
+		assert.Len(transport.traces, 1)
+		assert.Len(transport.traces[0], 1001)
+	})
 }
 
 func TestSpanContextBaggage(t *testing.T) {
@@ -283,3 +364,81 @@ func TestSpanContextIteratorBreak(t *testing.T) {
 
 	assert.Len(t, got, 0)
 }
+
+func TestRemoteContext(t *testing.T) {
+	tracer, transport, stop := startTestTracer()
+	defer stop()
+
+	rc := RemoteContext{
+		TraceID:     42,
+		SpanID:      43,
+		Priority:    ext.PriorityUserKeep,
+		HasPriority: true,
+		Origin:      "synthetics",
+		Baggage:     map[string]string{"user": "alice"},
+	}
+	root := tracer.StartSpan("web.request", ChildOf(rc.SpanContext())).(*span)
+	child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+
+	t.Run("ids", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.EqualValues(42, root.TraceID)
+		assert.EqualValues(43, root.ParentID)
+		assert.EqualValues(42, child.TraceID)
+		assert.Equal(root.SpanID, child.ParentID)
+	})
+
+	t.Run("inject", func(t *testing.T) {
+		assert := assert.New(t)
+		carrier := TextMapCarrier(map[string]string{})
+		assert.NoError(tracer.Inject(child.Context(), carrier))
+		assert.Equal("42", carrier[DefaultTraceIDHeader])
+		assert.Equal(strconv.FormatUint(child.SpanID, 10), carrier[DefaultParentIDHeader])
+		assert.Equal("2", carrier[DefaultPriorityHeader])
+		assert.Equal("synthetics", carrier[originHeader])
+		assert.Equal("alice", carrier[DefaultBaggageHeaderPrefix+"user"])
+	})
+
+	t.Run("of", func(t *testing.T) {
+		assert := assert.New(t)
+		got, ok := RemoteContextOf(child.Context())
+		assert.True(ok)
+		assert.Equal(RemoteContext{
+			TraceID:     42,
+			SpanID:      child.SpanID,
+			Priority:    ext.PriorityUserKeep,
+			HasPriority: true,
+			Origin:      "synthetics",
+			Baggage:     map[string]string{"user": "alice"},
+		}, got)
+
+		_, ok = RemoteContextOf(internal.NoopSpanContext{})
+		assert.False(ok)
+	})
+
+	child.Finish()
+	root.Finish()
+	tracer.forceFlush()
+	traces := transport.Traces()
+	assert.Len(t, traces, 1)
+	assert.Len(t, traces[0], 2)
+	for _, s := range traces[0] {
+		assert.EqualValues(t, 42, s.TraceID)
+	}
+	assert.EqualValues(t, ext.PriorityUserKeep, traces[0][0].Metrics[samplingPriorityKey])
+}
+
+func TestRemoteContextNoPriority(t *testing.T) {
+	tracer, _, stop := startTestTracer()
+	defer stop()
+
+	root := tracer.StartSpan("web.request", ChildOf(RemoteContext{TraceID: 1, SpanID: 2}.SpanContext())).(*span)
+	defer root.Finish()
+
+	// without a priority, the process-level root is sampled by the tracer
+	assert.True(t, root.context.sampled)
+	got, ok := RemoteContextOf(root.Context())
+	assert.True(t, ok)
+	assert.EqualValues(t, 1, got.TraceID)
+	assert.Nil(t, got.Baggage)
+}
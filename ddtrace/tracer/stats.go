@@ -0,0 +1,83 @@
+package tracer
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+)
+
+// Statistics holds a snapshot of the counters of the tracer, which may help
+// finding out why traces are missing.
+type Statistics struct {
+	// SpansStarted is the number of spans which were started.
+	SpansStarted uint64
+
+	// SpansFinished is the number of spans belonging to completed traces
+	// which were submitted to the tracer.
+	SpansFinished uint64
+
+	// SpansDropped is the number of finished spans which were dropped because
+	// the trace queue was full.
+	SpansDropped uint64
+
+	// TracesLimited is the number of traces which were dropped because the
+	// limit set using SetMaxTracesPerSecond was reached.
+	TracesLimited uint64
+
+	// TracesFlushed is the number of traces which were sent to the agent.
+	TracesFlushed uint64
+
+	// FlushErrors is the number of flushes which failed.
+	FlushErrors uint64
+
+	// BytesSent is the number of payload bytes which were sent to the agent.
+	BytesSent uint64
+}
+
+// Stats returns a snapshot of the statistics of the started tracer. If the
+// tracer is not started, the zero value is returned.
+func Stats() Statistics {
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok {
+		return t.stats.snapshot()
+	}
+	return Statistics{}
+}
+
+// tracerStats holds the counters of a tracer. All fields are accessed atomically.
+type tracerStats struct {
+	spansStarted  uint64
+	spansFinished uint64
+	spansDropped  uint64
+	tracesLimited uint64
+	tracesFlushed uint64
+	flushErrors   uint64
+	bytesSent     uint64
+}
+
+// snapshot returns the current values of the counters.
+func (s *tracerStats) snapshot() Statistics {
+	return Statistics{
+		SpansStarted:  atomic.LoadUint64(&s.spansStarted),
+		SpansFinished: atomic.LoadUint64(&s.spansFinished),
+		SpansDropped:  atomic.LoadUint64(&s.spansDropped),
+		TracesLimited: atomic.LoadUint64(&s.tracesLimited),
+		TracesFlushed: atomic.LoadUint64(&s.tracesFlushed),
+		FlushErrors:   atomic.LoadUint64(&s.flushErrors),
+		BytesSent:     atomic.LoadUint64(&s.bytesSent),
+	}
+}
+
+// expvarName is the name under which the statistics are published using expvar.
+const expvarName = "datadog.tracer"
+
+var publishExpvarOnce sync.Once
+
+// publishExpvar publishes the statistics of the started tracer. It may be
+// called several times, but publishes only once.
+func publishExpvar() {
+	publishExpvarOnce.Do(func() {
+		expvar.Publish(expvarName, expvar.Func(func() interface{} { return Stats() }))
+	})
+}
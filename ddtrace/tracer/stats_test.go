@@ -0,0 +1,76 @@
+package tracer
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("started", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDummyTransport()))
+		internal.SetGlobalTracer(tracer)
+		defer Stop()
+
+		root := StartSpan("web.request")
+		StartSpan("db.query", ChildOf(root.Context())).Finish()
+		root.Finish()
+		assert.NoError(Flush())
+
+		stats := Stats()
+		assert.Equal(uint64(2), stats.SpansStarted)
+		assert.Equal(uint64(2), stats.SpansFinished)
+		assert.Equal(uint64(1), stats.TracesFlushed)
+		assert.NotZero(stats.BytesSent)
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracerChannels()
+		for i := 0; i < payloadQueueSize+2; i++ {
+			tracer.pushTrace([]*span{newBasicSpan("web.request")})
+		}
+		stats := tracer.stats.snapshot()
+		assert.Equal(uint64(payloadQueueSize+2), stats.SpansFinished)
+		assert.Equal(uint64(2), stats.SpansDropped)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracerChannels()
+		tracer.config.transport = failingTransport{errors.New("boom")}
+		tracer.pushPayload([]*span{newBasicSpan("web.request")})
+		assert.Error(tracer.sendPayload(tracer.payload))
+
+		stats := tracer.stats.snapshot()
+		assert.Equal(uint64(1), stats.FlushErrors)
+		assert.Zero(stats.TracesFlushed)
+		assert.Zero(stats.BytesSent)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		Stop()
+		assert.Equal(t, Statistics{}, Stats())
+	})
+}
+
+func TestStatsExpvar(t *testing.T) {
+	assert := assert.New(t)
+	tracer := newTracer(withTransport(newDummyTransport()), WithExpvarStats())
+	internal.SetGlobalTracer(tracer)
+	defer Stop()
+	newTracer(withTransport(newDummyTransport()), WithExpvarStats()).Stop() // publishes once
+
+	StartSpan("web.request").Finish()
+	v := expvar.Get(expvarName)
+	assert.NotNil(v)
+	var stats Statistics
+	assert.NoError(json.Unmarshal([]byte(v.String()), &stats))
+	assert.Equal(uint64(1), stats.SpansStarted)
+}
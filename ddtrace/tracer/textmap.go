@@ -1,11 +1,15 @@
 package tracer
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 )
 
 // HTTPHeadersCarrier wraps an http.Header as a TextMapWriter and TextMapReader, allowing
@@ -70,8 +74,23 @@ const (
 	// DefaultPriorityHeader specifies the key that will be used in HTTP headers
 	// or text maps to store the sampling priority value.
 	DefaultPriorityHeader = "x-datadog-sampling-priority"
+
+	// DefaultMaxBaggageSize specifies the default maximum total size, in bytes,
+	// of the baggage injected into a carrier, which keeps the headers of
+	// requests within the limits commonly enforced by servers.
+	DefaultMaxBaggageSize = 8192
 )
 
+// TraceIDHighHeader specifies the key that will be used in HTTP headers or text
+// maps to store the upper 64 bits of 128-bit trace IDs as 16 hex characters.
+// The tracer only uses the lower 64 bits, but propagates the upper ones so that
+// the full trace ID is preserved.
+const TraceIDHighHeader = "x-datadog-trace-id-high"
+
+// originHeader specifies the key used in HTTP headers or text maps to store
+// the origin of the trace.
+const originHeader = "x-datadog-origin"
+
 // PropagatorConfig defines the configuration for initializing a propagator.
 type PropagatorConfig struct {
 	// BaggagePrefix specifies the prefix that will be used to store baggage
@@ -89,11 +108,41 @@ type PropagatorConfig struct {
 	// PriorityHeader specifies the map key that will be used to store the sampling priority.
 	// It deafults to DefaultPriorityHeader.
 	PriorityHeader string
+
+	// MaxBaggageSize specifies the maximum total size, in bytes, of the baggage
+	// keys and values injected into a carrier. Items which would exceed it are
+	// not injected. It defaults to DefaultMaxBaggageSize, and a negative value
+	// means no limit.
+	MaxBaggageSize int
+
+	// Styles specifies the propagation styles used to inject and extract span
+	// contexts, overriding those read from the environment. See NewPropagator
+	// for the supported styles.
+	Styles []string
 }
 
+const (
+	// propagationStyleInjectEnvVar is the environment variable holding the
+	// comma separated propagation styles used to inject span contexts.
+	propagationStyleInjectEnvVar = "DD_PROPAGATION_STYLE_INJECT"
+
+	// propagationStyleExtractEnvVar is the environment variable holding the
+	// comma separated propagation styles used to extract span contexts.
+	propagationStyleExtractEnvVar = "DD_PROPAGATION_STYLE_EXTRACT"
+)
+
 // NewPropagator returns a new propagator which uses TextMap to inject
-// and extract values. It propagates trace and span IDs and baggage.
+// and extract values. It propagates trace and span IDs, the origin of the
+// trace and baggage.
 // To use the defaults, nil may be provided in place of the config.
+//
+// The propagation styles used to inject and extract span contexts are read
+// from the DD_PROPAGATION_STYLE_INJECT and DD_PROPAGATION_STYLE_EXTRACT
+// environment variables, as comma separated lists of "datadog", which is the
+// default, "b3" for B3 multiple headers and "b3 single header". Injection
+// uses all the styles, extraction the first one which finds a span context.
+// Both B3 styles extract span contexts from either form of B3 headers. The
+// styles may also be given using the Styles field of the config.
 func NewPropagator(cfg *PropagatorConfig) Propagator {
 	if cfg == nil {
 		cfg = new(PropagatorConfig)
@@ -110,7 +159,92 @@ func NewPropagator(cfg *PropagatorConfig) Propagator {
 	if cfg.PriorityHeader == "" {
 		cfg.PriorityHeader = DefaultPriorityHeader
 	}
-	return &propagator{cfg}
+	if cfg.MaxBaggageSize == 0 {
+		cfg.MaxBaggageSize = DefaultMaxBaggageSize
+	}
+	dd := &propagator{cfg}
+	if len(cfg.Styles) > 0 {
+		list := propagatorsFromStyles(cfg.Styles, "PropagatorConfig.Styles", dd)
+		return &chainedPropagator{injectors: list, extractors: list}
+	}
+	return &chainedPropagator{
+		injectors:  propagatorsFromEnv(propagationStyleInjectEnvVar, dd),
+		extractors: propagatorsFromEnv(propagationStyleExtractEnvVar, dd),
+	}
+}
+
+// propagatorsFromEnv returns the propagators of the styles listed in the
+// environment variable envVar, or the Datadog propagator dd if there are none.
+func propagatorsFromEnv(envVar string, dd Propagator) []Propagator {
+	return propagatorsFromStyles(strings.Split(os.Getenv(envVar), ","), envVar, dd)
+}
+
+// propagatorsFromStyles returns the propagators of the given styles, or the
+// Datadog propagator dd if there are none. Unknown styles are reported as found
+// in source.
+func propagatorsFromStyles(styles []string, source string, dd Propagator) []Propagator {
+	var list []Propagator
+	for _, style := range styles {
+		switch strings.ToLower(strings.TrimSpace(style)) {
+		case "":
+			continue
+		case "datadog":
+			list = append(list, dd)
+		case "b3":
+			list = append(list, &propagatorB3{})
+		case "b3 single header":
+			list = append(list, &propagatorB3{singleHeader: true})
+		default:
+			logf("%sunknown propagation style %q in %s", warnPrefix, style, source)
+		}
+	}
+	if len(list) == 0 {
+		return []Propagator{dd}
+	}
+	return list
+}
+
+// chainedPropagator injects span contexts using all of its injectors, and
+// extracts them using the first of its extractors which finds one.
+type chainedPropagator struct {
+	injectors  []Propagator
+	extractors []Propagator
+}
+
+// Inject implements Propagator.
+func (p *chainedPropagator) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	for _, i := range p.injectors {
+		if err := i.Inject(spanCtx, carrier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extract implements Propagator. Span contexts without a trace ID, which only
+// carry the origin of the trace, are returned as a last resort.
+func (p *chainedPropagator) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	var fallback ddtrace.SpanContext
+	var firstErr error
+	for _, e := range p.extractors {
+		ctx, err := e.Extract(carrier)
+		if err != nil {
+			if firstErr == nil || firstErr == ErrSpanContextNotFound {
+				firstErr = err
+			}
+			continue
+		}
+		if ctx.TraceID() != 0 {
+			return ctx, nil
+		}
+		if fallback == nil {
+			fallback = ctx
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, firstErr
 }
 
 // propagator implements a propagator which uses TextMap internally.
@@ -141,8 +275,35 @@ func (p *propagator) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWr
 	if ctx.hasSamplingPriority() {
 		writer.Set(p.cfg.PriorityHeader, strconv.Itoa(ctx.samplingPriority()))
 	}
+	if ctx.traceIDHigh != 0 {
+		writer.Set(TraceIDHighHeader, formatTraceIDHigh(ctx.traceIDHigh))
+	}
+	if ctx.origin != "" {
+		writer.Set(originHeader, ctx.origin)
+	}
 	// propagate OpenTracing baggage
-	for k, v := range ctx.baggage {
+	if p.cfg.MaxBaggageSize <= 0 {
+		ctx.ForeachBaggageItem(func(k, v string) bool {
+			writer.Set(p.cfg.BaggagePrefix+k, v)
+			return true
+		})
+		return nil
+	}
+	// sort the keys so that the items kept when reaching the limit are
+	// always the same
+	var keys []string
+	ctx.ForeachBaggageItem(func(k, _ string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Strings(keys)
+	var size int
+	for _, k := range keys {
+		v := ctx.baggageItem(k)
+		if size+len(k)+len(v) > p.cfg.MaxBaggageSize {
+			continue
+		}
+		size += len(k) + len(v)
 		writer.Set(p.cfg.BaggagePrefix+k, v)
 	}
 	return nil
@@ -162,27 +323,34 @@ func (p *propagator) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 	var ctx spanContext
 	err := reader.ForeachKey(func(k, v string) error {
 		var err error
+		// header names are case-insensitive
 		key := strings.ToLower(k)
 		switch key {
-		case p.cfg.TraceHeader:
+		case strings.ToLower(p.cfg.TraceHeader):
 			ctx.traceID, err = parseUint64(v)
 			if err != nil {
 				return ErrSpanContextCorrupted
 			}
-		case p.cfg.ParentHeader:
+		case strings.ToLower(p.cfg.ParentHeader):
 			ctx.spanID, err = parseUint64(v)
 			if err != nil {
 				return ErrSpanContextCorrupted
 			}
-		case p.cfg.PriorityHeader:
+		case strings.ToLower(p.cfg.PriorityHeader):
 			ctx.priority, err = strconv.Atoi(v)
 			if err != nil {
 				return ErrSpanContextCorrupted
 			}
 			ctx.hasPriority = true
+		case TraceIDHighHeader:
+			// a malformed value only loses the upper bits, the trace
+			// can still be joined using the lower ones
+			ctx.traceIDHigh, _ = parseTraceIDHigh(v)
+		case originHeader:
+			ctx.origin = v
 		default:
-			if strings.HasPrefix(key, p.cfg.BaggagePrefix) {
-				ctx.setBaggageItem(strings.TrimPrefix(key, p.cfg.BaggagePrefix), v)
+			if prefix := strings.ToLower(p.cfg.BaggagePrefix); strings.HasPrefix(key, prefix) {
+				ctx.setBaggageItem(strings.TrimPrefix(key, prefix), v)
 			}
 		}
 		return nil
@@ -190,8 +358,193 @@ func (p *propagator) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 	if err != nil {
 		return nil, err
 	}
+	if ctx.traceID == 0 && ctx.spanID == 0 && ctx.origin != "" {
+		// the origin is propagated on its own; spans started from this
+		// context begin a new trace which keeps it.
+		ctx.traceIDHigh = 0
+		return &ctx, nil
+	}
 	if ctx.traceID == 0 || ctx.spanID == 0 {
 		return nil, ErrSpanContextNotFound
 	}
 	return &ctx, nil
 }
+
+// parseTraceIDHigh parses the upper 64 bits of a trace ID, encoded as 16 hex
+// characters.
+func parseTraceIDHigh(v string) (uint64, error) {
+	if len(v) != 16 {
+		return 0, ErrSpanContextCorrupted
+	}
+	id, err := strconv.ParseUint(v, 16, 64)
+	if err != nil {
+		return 0, ErrSpanContextCorrupted
+	}
+	return id, nil
+}
+
+// formatTraceIDHigh formats the upper 64 bits of a trace ID as 16 hex characters.
+func formatTraceIDHigh(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+// B3 headers, as per https://github.com/openzipkin/b3-propagation.
+const (
+	b3TraceIDHeader = "x-b3-traceid"
+	b3SpanIDHeader  = "x-b3-spanid"
+	b3SampledHeader = "x-b3-sampled"
+	b3FlagsHeader   = "x-b3-flags"
+	b3SingleHeader  = "b3"
+)
+
+// propagatorB3 propagates trace and span IDs and the sampling decision using
+// B3 headers. IDs are hex encoded. The upper 64 bits of 128-bit trace IDs are
+// kept apart, like those found in TraceIDHighHeader. The sampled flag maps to
+// the automatic sampling priorities and the debug flag to PriorityUserKeep.
+type propagatorB3 struct {
+	// singleHeader reports whether span contexts are injected using the single
+	// b3 header rather than multiple ones.
+	singleHeader bool
+}
+
+// Inject implements Propagator.
+func (p *propagatorB3) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(TextMapWriter)
+	if !ok {
+		return ErrInvalidCarrier
+	}
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID == 0 || ctx.spanID == 0 {
+		return ErrInvalidSpanContext
+	}
+	traceID := fmt.Sprintf("%016x", ctx.traceID)
+	if ctx.traceIDHigh != 0 {
+		traceID = formatTraceIDHigh(ctx.traceIDHigh) + traceID
+	}
+	spanID := fmt.Sprintf("%016x", ctx.spanID)
+	if p.singleHeader {
+		v := traceID + "-" + spanID
+		if ctx.hasSamplingPriority() {
+			switch prio := ctx.samplingPriority(); {
+			case prio >= ext.PriorityUserKeep:
+				v += "-d"
+			case prio > 0:
+				v += "-1"
+			default:
+				v += "-0"
+			}
+		}
+		writer.Set(b3SingleHeader, v)
+		return nil
+	}
+	writer.Set(b3TraceIDHeader, traceID)
+	writer.Set(b3SpanIDHeader, spanID)
+	if ctx.hasSamplingPriority() {
+		switch prio := ctx.samplingPriority(); {
+		case prio >= ext.PriorityUserKeep:
+			// the debug flag implies that the trace is sampled
+			writer.Set(b3FlagsHeader, "1")
+		case prio > 0:
+			writer.Set(b3SampledHeader, "1")
+		default:
+			writer.Set(b3SampledHeader, "0")
+		}
+	}
+	return nil
+}
+
+// Extract implements Propagator. The single b3 header takes precedence over
+// multiple ones.
+func (*propagatorB3) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	reader, ok := carrier.(TextMapReader)
+	if !ok {
+		return nil, ErrInvalidCarrier
+	}
+	var traceID, spanID, sampled, flags, single string
+	err := reader.ForeachKey(func(k, v string) error {
+		// header names are case-insensitive
+		switch strings.ToLower(k) {
+		case b3TraceIDHeader:
+			traceID = v
+		case b3SpanIDHeader:
+			spanID = v
+		case b3SampledHeader:
+			sampled = v
+		case b3FlagsHeader:
+			flags = v
+		case b3SingleHeader:
+			single = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if single != "" {
+		parts := strings.Split(single, "-")
+		switch len(parts) {
+		case 1:
+			// only the sampling decision, there are no IDs to join
+			return nil, ErrSpanContextNotFound
+		case 2, 3, 4:
+			// the optional fourth part is the ID of the parent of the span
+			traceID, spanID = parts[0], parts[1]
+			if len(parts) > 2 {
+				sampled = parts[2]
+			}
+		default:
+			return nil, ErrSpanContextCorrupted
+		}
+	}
+	ctx, err := newB3SpanContext(traceID, spanID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case flags == "1" || sampled == "d":
+		ctx.setSamplingPriority(ext.PriorityUserKeep)
+	case sampled == "1" || sampled == "true":
+		ctx.setSamplingPriority(ext.PriorityAutoKeep)
+	case sampled == "0" || sampled == "false":
+		ctx.setSamplingPriority(ext.PriorityAutoReject)
+	}
+	return ctx, nil
+}
+
+// newB3SpanContext returns a span context with the given hex encoded B3 IDs.
+// Trace IDs may be 64 or 128-bit long.
+func newB3SpanContext(traceID, spanID string) (*spanContext, error) {
+	if traceID == "" || spanID == "" {
+		return nil, ErrSpanContextNotFound
+	}
+	var ctx spanContext
+	var err error
+	if len(traceID) == 32 {
+		if ctx.traceIDHigh, err = parseTraceIDHigh(traceID[:16]); err != nil {
+			return nil, err
+		}
+		traceID = traceID[16:]
+	}
+	if ctx.traceID, err = parseB3ID(traceID); err != nil {
+		return nil, err
+	}
+	if ctx.spanID, err = parseB3ID(spanID); err != nil {
+		return nil, err
+	}
+	if ctx.traceID == 0 || ctx.spanID == 0 {
+		return nil, ErrSpanContextCorrupted
+	}
+	return &ctx, nil
+}
+
+// parseB3ID parses a 64-bit B3 ID, encoded as up to 16 hex characters.
+func parseB3ID(v string) (uint64, error) {
+	if len(v) > 16 {
+		return 0, ErrSpanContextCorrupted
+	}
+	id, err := strconv.ParseUint(v, 16, 64)
+	if err != nil {
+		return 0, ErrSpanContextCorrupted
+	}
+	return id, nil
+}
@@ -2,8 +2,11 @@ package tracer
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -111,6 +114,83 @@ func TestTextMapPropagatorErrors(t *testing.T) {
 	assert.Equal(ErrSpanContextNotFound, err)
 }
 
+func TestTextMapPropagatorExtractValues(t *testing.T) {
+	propagator := NewPropagator(nil)
+	for name, tt := range map[string]struct {
+		carrier TextMapCarrier
+		err     error
+	}{
+		"missing-trace":  {TextMapCarrier{DefaultParentIDHeader: "2"}, ErrSpanContextNotFound},
+		"missing-parent": {TextMapCarrier{DefaultTraceIDHeader: "1"}, ErrSpanContextNotFound},
+		"empty":          {TextMapCarrier{DefaultTraceIDHeader: "", DefaultParentIDHeader: "2"}, ErrSpanContextCorrupted},
+		"oversized": {TextMapCarrier{
+			DefaultTraceIDHeader:  "18446744073709551616", // math.MaxUint64 + 1
+			DefaultParentIDHeader: "2",
+		}, ErrSpanContextCorrupted},
+		"negative": {TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "-1",
+		}, ErrSpanContextCorrupted},
+		"oversized-negative": {TextMapCarrier{
+			DefaultTraceIDHeader:  "-9223372036854775809", // math.MinInt64 - 1
+			DefaultParentIDHeader: "2",
+		}, ErrSpanContextCorrupted},
+		"priority": {TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "high",
+		}, ErrSpanContextCorrupted},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := propagator.Extract(tt.carrier)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	t.Run("max", func(t *testing.T) {
+		assert := assert.New(t)
+		sctx, err := propagator.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "18446744073709551615",
+			DefaultParentIDHeader: "18446744073709551615",
+			DefaultPriorityHeader: "2",
+		})
+		assert.NoError(err)
+		ctx := sctx.(*spanContext)
+		assert.Equal(uint64(math.MaxUint64), ctx.traceID)
+		assert.Equal(uint64(math.MaxUint64), ctx.spanID)
+		assert.Equal(2, ctx.samplingPriority())
+	})
+}
+
+func TestTextMapPropagatorCaseInsensitive(t *testing.T) {
+	assert := assert.New(t)
+	propagator := NewPropagator(&PropagatorConfig{
+		BaggagePrefix:  "X-Bg-",
+		TraceHeader:    "X-Trace",
+		ParentHeader:   "X-Parent",
+		PriorityHeader: "X-Priority",
+	})
+	sctx, err := propagator.Extract(TextMapCarrier{
+		"x-trace":    "1",
+		"X-PARENT":   "2",
+		"X-Priority": "1",
+		"x-BG-item":  "x",
+	})
+	assert.NoError(err)
+	ctx := sctx.(*spanContext)
+	assert.Equal(uint64(1), ctx.traceID)
+	assert.Equal(uint64(2), ctx.spanID)
+	assert.Equal(1, ctx.samplingPriority())
+	assert.Equal("x", ctx.baggageItem("item"))
+
+	headers := http.Header{}
+	assert.NoError(propagator.Inject(ctx, HTTPHeadersCarrier(headers)))
+	sctx, err = propagator.Extract(HTTPHeadersCarrier(headers))
+	assert.NoError(err)
+	assert.Equal(ctx.traceID, sctx.(*spanContext).traceID)
+	assert.Equal(ctx.spanID, sctx.(*spanContext).spanID)
+}
+
 func TestTextMapPropagatorInjectHeader(t *testing.T) {
 	assert := assert.New(t)
 
@@ -168,3 +248,395 @@ func TestTextMapPropagatorInjectExtract(t *testing.T) {
 	assert.Equal(xctx.priority, ctx.priority)
 	assert.Equal(xctx.hasPriority, ctx.hasPriority)
 }
+
+func TestTextMapPropagatorMaxBaggageSize(t *testing.T) {
+	propagator := NewPropagator(&PropagatorConfig{MaxBaggageSize: 10})
+	tracer := newTracer(WithPropagator(propagator))
+	root := tracer.StartSpan("web.request").(*span)
+	root.SetBaggageItem("a", "1234")     // 5 bytes
+	root.SetBaggageItem("b", "12345678") // 9 bytes, over the limit
+	root.SetBaggageItem("c", "123")      // 4 bytes
+	headers := TextMapCarrier(map[string]string{})
+	err := tracer.Inject(root.Context(), headers)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal("1234", headers[DefaultBaggageHeaderPrefix+"a"])
+	assert.Equal("123", headers[DefaultBaggageHeaderPrefix+"c"])
+	assert.NotContains(headers, DefaultBaggageHeaderPrefix+"b")
+}
+
+func TestTextMapPropagatorMaxBaggageSizeDefault(t *testing.T) {
+	big := strings.Repeat("x", DefaultMaxBaggageSize)
+	for name, tt := range map[string]struct {
+		cfg  *PropagatorConfig
+		want bool // whether the big item is injected
+	}{
+		"nil":       {nil, false},
+		"zero":      {&PropagatorConfig{}, false},
+		"unlimited": {&PropagatorConfig{MaxBaggageSize: -1}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tracer := newTracer(WithPropagator(NewPropagator(tt.cfg)))
+			root := tracer.StartSpan("web.request").(*span)
+			root.SetBaggageItem("small", "1")
+			root.SetBaggageItem("big", big)
+			headers := TextMapCarrier{}
+			assert.NoError(t, tracer.Inject(root.Context(), headers))
+			assert.Equal(t, "1", headers[DefaultBaggageHeaderPrefix+"small"])
+			_, ok := headers[DefaultBaggageHeaderPrefix+"big"]
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+}
+
+func TestTextMapPropagatorOrigin(t *testing.T) {
+	t.Run("extract", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer()
+		sctx, err := tracer.Extract(TextMapCarrier(map[string]string{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			originHeader:          "synthetics",
+		}))
+		assert.Nil(err)
+		assert.Equal("synthetics", sctx.(*spanContext).origin)
+
+		root := tracer.StartSpan("web.request", ChildOf(sctx)).(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		assert.Equal("synthetics", root.Meta[originKey])
+		assert.Equal("synthetics", child.Meta[originKey])
+
+		// re-inject
+		headers := TextMapCarrier(map[string]string{})
+		err = tracer.Inject(child.Context(), headers)
+		assert.Nil(err)
+		assert.Equal("synthetics", headers[originHeader])
+		assert.Equal(strconv.FormatUint(child.SpanID, 10), headers[DefaultParentIDHeader])
+	})
+
+	t.Run("without-ids", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer()
+		sctx, err := tracer.Extract(TextMapCarrier(map[string]string{
+			originHeader: "synthetics",
+		}))
+		assert.Nil(err)
+
+		root := tracer.StartSpan("web.request", ChildOf(sctx)).(*span)
+		assert.NotZero(root.TraceID)
+		assert.Equal(root.SpanID, root.TraceID)
+		assert.Zero(root.ParentID)
+		assert.Equal("synthetics", root.Meta[originKey])
+
+		headers := TextMapCarrier(map[string]string{})
+		err = tracer.Inject(root.Context(), headers)
+		assert.Nil(err)
+		assert.Equal("synthetics", headers[originHeader])
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer()
+		sctx, err := tracer.Extract(TextMapCarrier(map[string]string{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+		}))
+		assert.Nil(err)
+
+		root := tracer.StartSpan("web.request", ChildOf(sctx)).(*span)
+		assert.NotContains(root.Meta, originKey)
+
+		headers := TextMapCarrier(map[string]string{})
+		err = tracer.Inject(root.Context(), headers)
+		assert.Nil(err)
+		assert.NotContains(headers, originHeader)
+
+		_, err = tracer.Extract(TextMapCarrier(map[string]string{}))
+		assert.Equal(ErrSpanContextNotFound, err)
+	})
+}
+
+func TestTextMapPropagatorTraceIDHigh(t *testing.T) {
+	for name, tt := range map[string]struct {
+		in   string // value of TraceIDHighHeader, if any
+		high uint64
+	}{
+		"present":   {"463ac35c9f6413ad", 0x463ac35c9f6413ad},
+		"absent":    {"", 0},
+		"malformed": {"xyz", 0},
+		"short":     {"463ac35c", 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			tracer := newTracer()
+			carrier := TextMapCarrier(map[string]string{
+				DefaultTraceIDHeader:  "1",
+				DefaultParentIDHeader: "2",
+			})
+			if tt.in != "" {
+				carrier[TraceIDHighHeader] = tt.in
+			}
+			sctx, err := tracer.Extract(carrier)
+			assert.Nil(err)
+			assert.Equal(uint64(1), sctx.TraceID())
+			assert.Equal(tt.high, sctx.(*spanContext).traceIDHigh)
+
+			root := tracer.StartSpan("web.request", ChildOf(sctx)).(*span)
+			child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+			headers := TextMapCarrier(map[string]string{})
+			err = tracer.Inject(child.Context(), headers)
+			assert.Nil(err)
+			assert.Equal("1", headers[DefaultTraceIDHeader])
+			assert.NotContains(child.Meta, traceIDHighKey)
+			if tt.high == 0 {
+				assert.NotContains(headers, TraceIDHighHeader)
+				assert.NotContains(root.Meta, traceIDHighKey)
+				return
+			}
+			assert.Equal(tt.in, headers[TraceIDHighHeader])
+			assert.Equal(tt.in, root.Meta[traceIDHighKey])
+		})
+	}
+}
+
+func TestPropagationStylesFromEnv(t *testing.T) {
+	dd := &propagator{}
+	for in, want := range map[string][]Propagator{
+		"":                             {dd},
+		"Datadog":                      {dd},
+		"b3":                           {&propagatorB3{}},
+		"datadog, B3 single header":    {dd, &propagatorB3{singleHeader: true}},
+		"unknown":                      {dd},
+		"b3,unknown, b3 single header": {&propagatorB3{}, &propagatorB3{singleHeader: true}},
+	} {
+		os.Setenv(propagationStyleInjectEnvVar, in)
+		assert.Equal(t, want, propagatorsFromEnv(propagationStyleInjectEnvVar, dd), in)
+	}
+	os.Unsetenv(propagationStyleInjectEnvVar)
+}
+
+func TestPropagatorConfigStyles(t *testing.T) {
+	defer os.Unsetenv(propagationStyleInjectEnvVar)
+	os.Setenv(propagationStyleInjectEnvVar, "datadog")
+	p := NewPropagator(&PropagatorConfig{Styles: []string{"B3"}}).(*chainedPropagator)
+	assert.Equal(t, []Propagator{&propagatorB3{}}, p.injectors)
+	assert.Equal(t, []Propagator{&propagatorB3{}}, p.extractors)
+}
+
+func TestB3PropagatorExtract(t *testing.T) {
+	for name, tt := range map[string]struct {
+		in       TextMapCarrier
+		traceID  uint64
+		high     uint64
+		spanID   uint64
+		priority int // -2 when unset
+		err      error
+	}{
+		"multi": {
+			in:       TextMapCarrier{"X-B3-TraceId": "000000000000007b", "X-B3-SpanId": "1c8", "X-B3-Sampled": "1"},
+			traceID:  123,
+			spanID:   456,
+			priority: ext.PriorityAutoKeep,
+		},
+		"multi-128": {
+			in:       TextMapCarrier{b3TraceIDHeader: "463ac35c9f6413ad48485a3953bb6124", b3SpanIDHeader: "a2fb4a1d1a96d312"},
+			traceID:  0x48485a3953bb6124,
+			high:     0x463ac35c9f6413ad,
+			spanID:   0xa2fb4a1d1a96d312,
+			priority: -2,
+		},
+		"multi-debug": {
+			in:       TextMapCarrier{b3TraceIDHeader: "1", b3SpanIDHeader: "2", b3FlagsHeader: "1"},
+			traceID:  1,
+			spanID:   2,
+			priority: ext.PriorityUserKeep,
+		},
+		"multi-not-sampled": {
+			in:       TextMapCarrier{b3TraceIDHeader: "1", b3SpanIDHeader: "2", b3SampledHeader: "false"},
+			traceID:  1,
+			spanID:   2,
+			priority: ext.PriorityAutoReject,
+		},
+		"single": {
+			in:       TextMapCarrier{"B3": "000000000000007b-00000000000001c8-1-0000000000000001"},
+			traceID:  123,
+			spanID:   456,
+			priority: ext.PriorityAutoKeep,
+		},
+		"single-debug": {
+			in:       TextMapCarrier{b3SingleHeader: "463ac35c9f6413ad48485a3953bb6124-2-d"},
+			traceID:  0x48485a3953bb6124,
+			high:     0x463ac35c9f6413ad,
+			spanID:   2,
+			priority: ext.PriorityUserKeep,
+		},
+		"single-no-sampling": {
+			in:       TextMapCarrier{b3SingleHeader: "1-2"},
+			traceID:  1,
+			spanID:   2,
+			priority: -2,
+		},
+		"single-precedence": {
+			in:       TextMapCarrier{b3SingleHeader: "1-2-0", b3TraceIDHeader: "3", b3SpanIDHeader: "4"},
+			traceID:  1,
+			spanID:   2,
+			priority: ext.PriorityAutoReject,
+		},
+		"single-sampling-only": {in: TextMapCarrier{b3SingleHeader: "0"}, err: ErrSpanContextNotFound},
+		"single-corrupted":     {in: TextMapCarrier{b3SingleHeader: "1-2-1-3-4"}, err: ErrSpanContextCorrupted},
+		"not-found":            {in: TextMapCarrier{b3TraceIDHeader: "1"}, err: ErrSpanContextNotFound},
+		"not-hex":              {in: TextMapCarrier{b3TraceIDHeader: "xyz", b3SpanIDHeader: "2"}, err: ErrSpanContextCorrupted},
+		"too-long":             {in: TextMapCarrier{b3TraceIDHeader: "12345678901234567", b3SpanIDHeader: "2"}, err: ErrSpanContextCorrupted},
+		"zero":                 {in: TextMapCarrier{b3TraceIDHeader: "0", b3SpanIDHeader: "2"}, err: ErrSpanContextCorrupted},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			sctx, err := (&propagatorB3{}).Extract(tt.in)
+			if tt.err != nil {
+				assert.Equal(tt.err, err)
+				return
+			}
+			assert.NoError(err)
+			ctx := sctx.(*spanContext)
+			assert.Equal(tt.traceID, ctx.traceID)
+			assert.Equal(tt.high, ctx.traceIDHigh)
+			assert.Equal(tt.spanID, ctx.spanID)
+			if tt.priority == -2 {
+				assert.False(ctx.hasSamplingPriority())
+			} else {
+				assert.Equal(tt.priority, ctx.samplingPriority())
+			}
+		})
+	}
+}
+
+func TestB3PropagatorInject(t *testing.T) {
+	for name, tt := range map[string]struct {
+		singleHeader bool
+		traceIDHigh  uint64
+		priority     int // -2 when unset
+		want         TextMapCarrier
+	}{
+		"multi": {
+			priority: ext.PriorityAutoKeep,
+			want:     TextMapCarrier{b3TraceIDHeader: "000000000000007b", b3SpanIDHeader: "00000000000001c8", b3SampledHeader: "1"},
+		},
+		"multi-reject": {
+			priority: ext.PriorityUserReject,
+			want:     TextMapCarrier{b3TraceIDHeader: "000000000000007b", b3SpanIDHeader: "00000000000001c8", b3SampledHeader: "0"},
+		},
+		"multi-debug": {
+			priority: ext.PriorityUserKeep,
+			want:     TextMapCarrier{b3TraceIDHeader: "000000000000007b", b3SpanIDHeader: "00000000000001c8", b3FlagsHeader: "1"},
+		},
+		"multi-128": {
+			traceIDHigh: 0x463ac35c9f6413ad,
+			priority:    -2,
+			want:        TextMapCarrier{b3TraceIDHeader: "463ac35c9f6413ad000000000000007b", b3SpanIDHeader: "00000000000001c8"},
+		},
+		"single": {
+			singleHeader: true,
+			priority:     ext.PriorityAutoReject,
+			want:         TextMapCarrier{b3SingleHeader: "000000000000007b-00000000000001c8-0"},
+		},
+		"single-debug": {
+			singleHeader: true,
+			priority:     ext.PriorityUserKeep,
+			want:         TextMapCarrier{b3SingleHeader: "000000000000007b-00000000000001c8-d"},
+		},
+		"single-no-priority": {
+			singleHeader: true,
+			priority:     -2,
+			want:         TextMapCarrier{b3SingleHeader: "000000000000007b-00000000000001c8"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := &spanContext{traceID: 123, traceIDHigh: tt.traceIDHigh, spanID: 456}
+			if tt.priority != -2 {
+				ctx.setSamplingPriority(tt.priority)
+			}
+			carrier := TextMapCarrier{}
+			assert.NoError(t, (&propagatorB3{singleHeader: tt.singleHeader}).Inject(ctx, carrier))
+			assert.Equal(t, tt.want, carrier)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		p := &propagatorB3{}
+		assert.Equal(t, ErrInvalidCarrier, p.Inject(&spanContext{traceID: 1, spanID: 2}, "carrier"))
+		assert.Equal(t, ErrInvalidSpanContext, p.Inject(&spanContext{}, TextMapCarrier{}))
+		assert.Equal(t, ErrInvalidSpanContext, p.Inject(internal.NoopSpanContext{}, TextMapCarrier{}))
+		_, err := p.Extract("carrier")
+		assert.Equal(t, ErrInvalidCarrier, err)
+	})
+}
+
+func TestB3PropagatorInjectExtract(t *testing.T) {
+	defer os.Unsetenv(propagationStyleInjectEnvVar)
+	defer os.Unsetenv(propagationStyleExtractEnvVar)
+	for _, style := range []string{"b3", "b3 single header"} {
+		t.Run(style, func(t *testing.T) {
+			assert := assert.New(t)
+			os.Setenv(propagationStyleInjectEnvVar, style)
+			os.Setenv(propagationStyleExtractEnvVar, style)
+			tracer := newTracer()
+			root := tracer.StartSpan("web.request").(*span)
+			root.context.traceIDHigh = 0x463ac35c9f6413ad
+			root.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+			carrier := TextMapCarrier{}
+			assert.NoError(tracer.Inject(root.Context(), carrier))
+			assert.NotContains(carrier, DefaultTraceIDHeader)
+
+			sctx, err := tracer.Extract(carrier)
+			assert.NoError(err)
+			ctx := sctx.(*spanContext)
+			assert.Equal(root.TraceID, ctx.traceID)
+			assert.Equal(uint64(0x463ac35c9f6413ad), ctx.traceIDHigh)
+			assert.Equal(root.SpanID, ctx.spanID)
+			assert.Equal(ext.PriorityUserKeep, ctx.samplingPriority())
+		})
+	}
+}
+
+func TestPropagatorCrossFormat(t *testing.T) {
+	defer os.Unsetenv(propagationStyleInjectEnvVar)
+	defer os.Unsetenv(propagationStyleExtractEnvVar)
+	os.Setenv(propagationStyleInjectEnvVar, "datadog,b3")
+	inject := NewPropagator(nil)
+	root := newTracer().StartSpan("web.request").(*span)
+	root.SetBaggageItem("item", "x")
+	carrier := TextMapCarrier{}
+	assert.NoError(t, inject.Inject(root.Context(), carrier))
+	assert.Equal(t, "x", carrier[DefaultBaggageHeaderPrefix+"item"])
+
+	for _, style := range []string{"datadog", "b3", "b3,datadog"} {
+		t.Run(style, func(t *testing.T) {
+			assert := assert.New(t)
+			os.Setenv(propagationStyleExtractEnvVar, style)
+			sctx, err := NewPropagator(nil).Extract(carrier)
+			assert.NoError(err)
+			assert.Equal(root.TraceID, sctx.TraceID())
+			assert.Equal(root.SpanID, sctx.SpanID())
+			assert.Equal(ext.PriorityAutoKeep, sctx.(*spanContext).samplingPriority())
+		})
+	}
+
+	t.Run("fallback", func(t *testing.T) {
+		assert := assert.New(t)
+		os.Setenv(propagationStyleExtractEnvVar, "b3,datadog")
+		p := NewPropagator(nil)
+		sctx, err := p.Extract(TextMapCarrier{DefaultTraceIDHeader: "1", DefaultParentIDHeader: "2"})
+		assert.NoError(err)
+		assert.Equal(uint64(1), sctx.TraceID())
+
+		sctx, err = p.Extract(TextMapCarrier{originHeader: "synthetics"})
+		assert.NoError(err)
+		assert.Equal("synthetics", sctx.(*spanContext).origin)
+
+		_, err = p.Extract(TextMapCarrier{b3TraceIDHeader: "xyz", b3SpanIDHeader: "2"})
+		assert.Equal(ErrSpanContextCorrupted, err)
+		_, err = p.Extract(TextMapCarrier{})
+		assert.Equal(ErrSpanContextNotFound, err)
+	})
+}
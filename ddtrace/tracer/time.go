@@ -2,9 +2,7 @@
 
 package tracer
 
-import "time"
-
 // now returns current UTC time in nanos.
-func now() int64 {
-	return time.Now().UTC().UnixNano()
+var now = func() int64 {
+	return getClock().Now().UTC().UnixNano()
 }
@@ -1,10 +1,14 @@
 package tracer
 
 import (
-	"errors"
-	"log"
+	"context"
+	"net/http"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -26,7 +30,7 @@ type tracer struct {
 	*config
 	*payload
 
-	flushAllReq    chan chan<- struct{}
+	flushAllReq    chan chan<- error
 	flushTracesReq chan struct{}
 	flushErrorsReq chan struct{}
 	exitReq        chan struct{}
@@ -34,32 +38,93 @@ type tracer struct {
 	payloadQueue chan []*span
 	errorBuffer  chan error
 
+	// handledErrors holds the errors waiting to be passed to the error handler;
+	// nil if there is none, in which case errors are logged.
+	handledErrors chan error
+
 	// stopped is a channel that will be closed when the worker has exited.
 	stopped chan struct{}
 
+	// stop is closed by the worker once it is asked to exit, so that the
+	// transport no longer retries the payload being sent.
+	stop chan struct{}
+
+	// closing is set by the worker once it is asked to exit, after which
+	// pushTrace no longer accepts traces, so that none is left on payloadQueue
+	// once it is drained. It is guarded by closingMu.
+	closing   bool
+	closingMu sync.RWMutex
+
+	// sent receives the payloads sent by the goroutines started in flushTraces,
+	// once they are reset, so that they can be reused.
+	sent chan *payload
+
+	// sending reports whether a payload is being sent, in which case the traces
+	// buffered meanwhile are sent once it is, if flushPending is true, and the
+	// outcome of that send is given to flushWaiters. spare holds a payload free
+	// for reuse, if any. They are only used by the worker.
+	sending      bool
+	flushPending bool
+	flushWaiters []chan<- error
+	spare        *payload
+
+	// prioritySampling holds the sample rates sent by the agent, which are
+	// used to set the sampling priority of root spans.
+	prioritySampling *prioritySampler
+
+	// stats holds the counters returned by Stats.
+	stats *tracerStats
+
+	// errLog logs the errors found in errorBuffer; it is only used by the worker.
+	errLog errorLogger
+
+	// samplerMu guards config.sampler and limiter, which may be replaced
+	// using SetSampler and SetMaxTracesPerSecond.
+	samplerMu sync.RWMutex
+
+	// limiter caps the number of traces kept per second; nil means no limit.
+	limiter *rateLimiter
+
+	// wg waits for the goroutines reporting runtime metrics to exit.
+	wg sync.WaitGroup
+
 	// syncPush is used for testing. When non-nil, it causes pushTrace to become
 	// a synchronous (blocking) operation, meaning that it will only return after
 	// the trace has been fully processed and added onto the payload.
 	syncPush chan struct{}
+
+	// openSpans holds the spans which are not yet finished, to report those
+	// which are abandoned; nil unless started in debug mode.
+	openSpans *spanRegistry
 }
 
 const (
-	// flushInterval is the interval at which the payload contents will be flushed
-	// to the transport.
+	// flushInterval is the default interval at which the payload contents will
+	// be flushed to the transport.
 	flushInterval = 2 * time.Second
 
+	// minFlushInterval is the shortest flush interval which may be configured.
+	minFlushInterval = 100 * time.Millisecond
+
 	// payloadMaxLimit is the maximum payload size allowed and should indicate the
 	// maximum size of the package that the agent can receive.
 	payloadMaxLimit = 9.5 * 1024 * 1024 // 9.5 MB
 
-	// payloadSizeLimit specifies the maximum allowed size of the payload before
-	// it will trigger a flush to the transport.
+	// payloadSizeLimit specifies the default maximum allowed size of the payload
+	// before it will trigger a flush to the transport.
 	payloadSizeLimit = payloadMaxLimit / 2
+
+	// retainedMaxBytes is the size which the buffered traces may reach while a
+	// payload is being sent, past which new traces are dropped until it is.
+	retainedMaxBytes = payloadMaxLimit
 )
 
 // Start starts the tracer with the given set of options. It will stop and replace
 // any running tracer, meaning that calling it several times will result in a restart
-// of the tracer by replacing the current instance with a new one.
+// of the tracer by replacing the current instance with a new one. It is safe to call
+// while spans are being started on other goroutines: spans started afterwards belong
+// to the new tracer, and the spans of the traces started on the replaced tracer are
+// flushed by it until it stopped, and by the new tracer afterwards.
 func Start(opts ...StartOption) {
 	if internal.Testing {
 		return // mock tracer active
@@ -67,7 +132,9 @@ func Start(opts ...StartOption) {
 	internal.SetGlobalTracer(newTracer(opts...))
 }
 
-// Stop stops the started tracer. Subsequent calls are valid but become no-op.
+// Stop stops the started tracer, after sending all the spans which were finished
+// up until this point to the agent. Spans finished afterwards are discarded.
+// Subsequent calls are valid but become no-op.
 func Stop() {
 	internal.SetGlobalTracer(&internal.NoopTracer{})
 }
@@ -83,6 +150,48 @@ func StartSpan(operationName string, opts ...StartSpanOption) Span {
 	return internal.GetGlobalTracer().StartSpan(operationName, opts...)
 }
 
+// SetSampler replaces the sampler of the started tracer. Traces started
+// afterwards are sampled using s when their root span is created, once its
+// start options are applied and before any of its children are. The sampler
+// may be called from many goroutines at once, so it must be safe for concurrent
+// use. A nil sampler is ignored. If the tracer is not started, calling this
+// function is a no-op.
+func SetSampler(s Sampler) {
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok {
+		t.setSampler(s)
+	}
+}
+
+// SetMaxTracesPerSecond limits the number of traces kept by the started tracer
+// to n per second, allowing bursts of up to n traces. The limit applies to the
+// traces kept by the sampler; the others are dropped as if they weren't sampled,
+// and counted in the TracesLimited statistic. The effective rate at which traces
+// are let through is recorded on the kept root spans. Values lower than or equal
+// to 0 remove the limit. If the tracer is not started, calling this function is a
+// no-op.
+func SetMaxTracesPerSecond(n float64) {
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok {
+		t.setMaxTracesPerSecond(n)
+	}
+}
+
+// Flush synchronously sends all finished spans buffered by the started tracer
+// to the agent, returning any error that occurred while sending them. It is
+// useful in short-lived processes which may exit before the periodic flush.
+// If the tracer is not started, calling this function is a no-op.
+func Flush() error {
+	return FlushWithContext(context.Background())
+}
+
+// FlushWithContext is like Flush, but returns ctx.Err() when ctx is done
+// before the flush has completed.
+func FlushWithContext(ctx context.Context) error {
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok {
+		return t.flushWithContext(ctx)
+	}
+	return nil
+}
+
 // Extract extracts a SpanContext from the carrier. The carrier is expected
 // to implement TextMapReader, otherwise an error is returned.
 // If the tracer is not started, calling this function is a no-op.
@@ -98,7 +207,7 @@ func Inject(ctx ddtrace.SpanContext, carrier interface{}) error {
 }
 
 const (
-	// payloadQueueSize is the buffer size of the trace channel.
+	// payloadQueueSize is the default buffer size of the trace channel.
 	payloadQueueSize = 1000
 
 	// errorBufferSize is the buffer size of the error channel.
@@ -111,8 +220,48 @@ func newTracer(opts ...StartOption) *tracer {
 	for _, fn := range opts {
 		fn(c)
 	}
+	if c.logOutput == nil && c.agentAddr == defaultAddress && os.Getenv(lambdaEnvVar) != "" {
+		// there is no agent on AWS Lambda, traces are read from the logs
+		c.logOutput = os.Stdout
+	}
+	if c.transport == nil && c.logOutput != nil {
+		c.transport = &logTransport{w: c.logOutput}
+	}
+	if c.transport == nil && c.agentlessAPIKey != "" {
+		t := newAgentlessTransport(c.agentlessSite, c.agentlessAPIKey)
+		t.hostname, _ = os.Hostname()
+		t.env = c.env
+		if c.proxyURL != nil {
+			t.client.Transport.(*http.Transport).Proxy = http.ProxyURL(c.proxyURL)
+		}
+		c.transport = t
+	}
 	if c.transport == nil {
-		c.transport = newTransport(c.agentAddr)
+		t := newTransport(c.agentAddr, c.tlsConfig)
+		t.retryMaxBytes = c.retryMaxBytes
+		if c.httpClient != nil {
+			t.client = c.httpClient
+		} else {
+			if c.httpTimeout > 0 {
+				t.client.Timeout = c.httpTimeout
+			}
+			if c.proxyURL != nil && !strings.HasPrefix(c.agentAddr, unixAddrPrefix) {
+				t.client.Transport.(*http.Transport).Proxy = http.ProxyURL(c.proxyURL)
+			}
+		}
+		c.transport = t
+	}
+	if c.debug {
+		SetDebug(true)
+	}
+	c.pid = os.Getpid()
+	c.runtimeVersion = runtime.Version()
+	if c.reportHostname {
+		if h, err := os.Hostname(); err == nil {
+			c.hostname = h
+		} else {
+			logf("%sunable to look up hostname: %v", errorPrefix, err)
+		}
 	}
 	if c.propagator == nil {
 		c.propagator = NewPropagator(nil)
@@ -120,25 +269,53 @@ func newTracer(opts ...StartOption) *tracer {
 	t := &tracer{
 		config:         c,
 		payload:        newPayload(),
-		flushAllReq:    make(chan chan<- struct{}),
+		flushAllReq:    make(chan chan<- error),
 		flushTracesReq: make(chan struct{}, 1),
 		flushErrorsReq: make(chan struct{}, 1),
 		exitReq:        make(chan struct{}),
-		payloadQueue:   make(chan []*span, payloadQueueSize),
+		payloadQueue:   make(chan []*span, c.payloadQueueSize),
 		errorBuffer:    make(chan error, errorBufferSize),
 		stopped:        make(chan struct{}),
+		stop:           make(chan struct{}),
+		sent:           make(chan *payload, 1),
+
+		prioritySampling: newPrioritySampler(),
+		stats:            new(tracerStats),
+	}
+	if c.expvarStats {
+		publishExpvar()
 	}
 
 	go t.worker()
+	if c.runtimeMetricsInterval > 0 {
+		t.wg.Add(1)
+		go t.reportRuntimeMetrics(c.runtimeMetricsInterval)
+	}
+	if c.healthMetricsInterval > 0 {
+		t.wg.Add(1)
+		go t.reportHealthMetrics(c.healthMetricsInterval)
+	}
+	if c.errorHandler != nil {
+		t.handledErrors = make(chan error, errorBufferSize)
+		t.wg.Add(1)
+		go t.handleErrors()
+	}
+	if c.debug && c.abandonedSpanTimeout > 0 {
+		t.openSpans = newSpanRegistry()
+		t.wg.Add(1)
+		go t.reportAbandonedSpans(c.abandonedSpanTimeout)
+	}
 
 	return t
 }
 
 // worker receives finished traces to be added into the payload, as well
-// as periodically flushes traces to the transport.
+// as periodically flushes traces to the transport. Payloads are sent by
+// goroutines of their own, one at a time, so that traces keep on being
+// received while the agent is slow or unreachable.
 func (t *tracer) worker() {
 	defer close(t.stopped)
-	ticker := time.NewTicker(flushInterval)
+	ticker := getClock().NewTicker(t.config.flushInterval)
 	defer ticker.Stop()
 
 	for {
@@ -146,44 +323,64 @@ func (t *tracer) worker() {
 		case trace := <-t.payloadQueue:
 			t.pushPayload(trace)
 
-		case <-ticker.C:
-			t.flush()
+		case <-ticker.C():
+			t.flush(nil)
 
 		case done := <-t.flushAllReq:
-			t.flush()
-			done <- struct{}{}
+			t.drainPayloadQueue()
+			t.flush(done)
 
 		case <-t.flushTracesReq:
-			t.flushTraces()
+			t.flushTraces(nil)
+
+		case p := <-t.sent:
+			t.payloadSent(p)
 
 		case <-t.flushErrorsReq:
 			t.flushErrors()
 
 		case <-t.exitReq:
-			t.flush()
+			t.closingMu.Lock()
+			t.closing = true
+			t.closingMu.Unlock()
+			close(t.stop)
+			t.drainPayloadQueue()
+			t.flushTraces(nil)
+			for t.sending {
+				// the payload being sent, then the one holding the
+				// remaining traces
+				t.payloadSent(<-t.sent)
+			}
+			t.flushErrors()
 			return
 		}
 	}
 }
 
-func (t *tracer) pushTrace(trace []*span) {
-	select {
-	case <-t.stopped:
-		return
-	default:
+// pushTrace queues the given trace to be sent. It returns false, without doing
+// anything, if the tracer is stopping or stopped.
+func (t *tracer) pushTrace(trace []*span) bool {
+	t.closingMu.RLock()
+	if t.closing {
+		t.closingMu.RUnlock()
+		return false
 	}
+	atomic.AddUint64(&t.stats.spansFinished, uint64(len(trace)))
 	select {
 	case t.payloadQueue <- trace:
 	default:
+		atomic.AddUint64(&t.stats.spansDropped, uint64(len(trace)))
 		t.pushError(&dataLossError{
-			context: errors.New("payload queue full, dropping trace"),
+			context: errPayloadQueueFull,
 			count:   len(trace),
 		})
 	}
+	t.closingMu.RUnlock()
 	if t.syncPush != nil {
 		// only in tests
 		<-t.syncPush
 	}
+	return true
 }
 
 func (t *tracer) pushError(err error) {
@@ -192,6 +389,20 @@ func (t *tracer) pushError(err error) {
 		return
 	default:
 	}
+	if t.handledErrors != nil {
+		// drop the oldest errors rather than waiting for a slow handler
+		for {
+			select {
+			case t.handledErrors <- err:
+				return
+			default:
+			}
+			select {
+			case <-t.handledErrors:
+			default:
+			}
+		}
+	}
 	if len(t.errorBuffer) >= cap(t.errorBuffer)/2 { // starts being full, anticipate, try and flush soon
 		select {
 		case t.flushErrorsReq <- struct{}{}:
@@ -214,9 +425,10 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 	for _, fn := range options {
 		fn(&opts)
 	}
-	var startTime int64
+	var startTime, startMonotonic int64
 	if opts.StartTime.IsZero() {
 		startTime = now()
+		startMonotonic = monotonicNow()
 	} else {
 		startTime = opts.StartTime.UnixNano()
 	}
@@ -226,21 +438,26 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 			context = ctx
 		}
 	}
+	atomic.AddUint64(&t.stats.spansStarted, 1)
 	id := random.Uint64()
 	// span defaults
 	span := &span{
 		Name:     operationName,
 		Service:  t.config.serviceName,
 		Resource: operationName,
-		Meta:     map[string]string{},
 		Metrics:  map[string]float64{},
 		SpanID:   id,
 		TraceID:  id,
 		ParentID: 0,
 		Start:    startTime,
+
+		startMonotonic: startMonotonic,
+		limits:         t.config.tagLimits,
+		registry:       t.openSpans,
 	}
-	if context != nil {
-		// this is a child span
+	if context != nil && context.traceID != 0 {
+		// this is a child span; contexts without a trace ID only carry an
+		// origin, propagated without any IDs, and start a new trace
 		span.TraceID = context.traceID
 		span.ParentID = context.spanID
 		if context.hasSamplingPriority() {
@@ -252,32 +469,92 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 			context.span.RUnlock()
 		}
 	}
-	span.context = newSpanContext(span, context)
-	if context == nil || context.span == nil {
-		// this is either a global root span or a process-level root span
-		span.SetTag(ext.Pid, strconv.Itoa(os.Getpid()))
-		t.sample(span)
+	if opts.FollowsFrom && context != nil && context.span != nil {
+		// the span is held by a trace buffer of its own, so that the spans
+		// of its parent's trace are flushed without waiting for it
+		span.context = newFollowsFromContext(span, context)
+		if t.config.partialFlushMinSpans > 0 {
+			span.context.trace.setPartialFlushMinSpans(t.config.partialFlushMinSpans)
+		}
+	} else if span.context = newSpanContext(span, context); span.context == nil {
+		// the trace of the parent is full
+		return droppedSpan{context: context}
 	}
-	// add tags from options
-	for k, v := range opts.Tags {
-		span.SetTag(k, v)
+	if context == nil || span.context.trace != context.trace {
+		// the trace is new, its spans are submitted to this tracer even if
+		// it is replaced by another one before they finish
+		span.context.trace.tracer = t
+		span.context.trace.maxSpans = t.config.maxSpansPerTrace
+	}
+	if opts.FollowsFrom && span.ParentID != 0 {
+		span.meta()[followsFromKey] = strconv.FormatUint(span.ParentID, 10)
+	}
+	if context != nil && context.span == nil {
+		// this is a process-level root span, sampled below once its tags are
+		// set; they should not be discarded like the ones of unsampled spans
+		span.context.sampled = true
+	}
+	if span.context.origin != "" {
+		span.meta()[originKey] = span.context.origin
+	}
+	if t.config.env != "" {
+		span.setMeta(ext.Environment, t.config.env)
 	}
 	// add global tags
 	for k, v := range t.config.globalTags {
 		span.SetTag(k, v)
 	}
+	// add tags from options, which take precedence over global tags
+	for k, v := range opts.Tags {
+		span.SetTag(k, v)
+	}
+	if t.config.version != "" && span.Service == t.config.serviceName {
+		// the version only applies to the service of the tracer, not to the ones
+		// of its dependencies, such as databases
+		if _, ok := span.Meta[ext.Version]; !ok {
+			span.setMeta(ext.Version, t.config.version)
+		}
+	}
+	if context == nil || context.span == nil {
+		// this is either a global root span or a process-level root span
+		span.Metrics[ext.Pid] = float64(t.config.pid)
+		span.meta()[languageKey] = "go"
+		span.meta()[runtimeVersionKey] = t.config.runtimeVersion
+		if t.config.hostname != "" {
+			span.meta()[hostnameKey] = t.config.hostname
+		}
+		if context != nil && context.traceIDHigh != 0 {
+			span.meta()[traceIDHighKey] = formatTraceIDHigh(context.traceIDHigh)
+		}
+		if t.config.partialFlushMinSpans > 0 {
+			span.context.trace.setPartialFlushMinSpans(t.config.partialFlushMinSpans)
+		}
+		// sample once the tags are set, so that samplers can use them
+		t.sample(span)
+	}
+	if t.openSpans != nil {
+		t.openSpans.add(span)
+	}
+	if debugEnabled() {
+		debugf("started span %q (trace: %d, span: %d, parent: %d, sampled: %t)", span.Name, span.TraceID, span.SpanID, span.ParentID, span.context.sampled)
+	}
 	return span
 }
 
-// Stop stops the tracer.
+// Stop flushes all buffered traces and stops the tracer. It is safe for concurrent use.
 func (t *tracer) Stop() {
 	select {
 	case <-t.stopped:
-		return
 	default:
-		t.exitReq <- struct{}{}
-		<-t.stopped
+		// concurrent calls wait for the worker to exit instead of blocking
+		// on exitReq once it stopped receiving
+		select {
+		case t.exitReq <- struct{}{}:
+			<-t.stopped
+		case <-t.stopped:
+		}
 	}
+	t.wg.Wait()
 }
 
 // Inject uses the configured or default TextMap Propagator.
@@ -290,48 +567,222 @@ func (t *tracer) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
 	return t.config.propagator.Extract(carrier)
 }
 
-// flushTraces will push any currently buffered traces to the server.
-func (t *tracer) flushTraces() {
+// flushTraces starts sending the buffered traces to the server on a goroutine
+// of its own, unless a payload is already being sent, in which case they are
+// sent once it is. If done is not nil, it receives the error returned by the
+// transport once they are sent.
+func (t *tracer) flushTraces(done chan<- error) {
+	if done != nil {
+		t.flushWaiters = append(t.flushWaiters, done)
+	}
+	if t.sending {
+		t.flushPending = true
+		return
+	}
+	waiters := t.flushWaiters
+	t.flushWaiters = nil
 	if t.payload.itemCount() == 0 {
+		for _, done := range waiters {
+			done <- nil
+		}
 		return
 	}
-	size, count := t.payload.size(), t.payload.itemCount()
-	if t.config.debug {
-		log.Printf("Sending payload: size: %d traces: %d\n", size, count)
+	p := t.payload
+	if t.payload = t.spare; t.payload == nil {
+		t.payload = newPayload()
+	}
+	t.spare = nil
+	t.sending = true
+	go func() {
+		err := t.sendPayload(p)
+		for _, done := range waiters {
+			done <- err
+		}
+		t.sent <- p
+	}()
+}
+
+// payloadSent is called by the worker once the payload p, which it started
+// sending, is sent and reset. It sends the traces buffered meanwhile if a flush
+// was requested.
+func (t *tracer) payloadSent(p *payload) {
+	t.sending = false
+	t.spare = p
+	if t.flushPending {
+		t.flushPending = false
+		t.flushTraces(nil)
+	}
+}
+
+// sendPayload sends the traces of p to the server and resets it. It returns
+// the error returned by the transport, if any.
+func (t *tracer) sendPayload(p *payload) error {
+	size, count, spans := p.size(), p.itemCount(), p.spanCount()
+	if debugEnabled() {
+		debugf("sending payload: size: %d traces: %d", size, count)
+	}
+	start := getClock().Now()
+	rc, err := t.config.transport.send(p, t.stop)
+	if len(t.config.flushCallbacks) > 0 {
+		t.callFlushCallbacks(FlushStats{
+			Traces:   count,
+			Spans:    spans,
+			Bytes:    size,
+			Duration: getClock().Now().Sub(start),
+			Error:    err,
+		})
 	}
-	err := t.config.transport.send(t.payload)
 	if err != nil {
+		atomic.AddUint64(&t.stats.flushErrors, 1)
 		t.pushError(&dataLossError{context: err, count: count})
 	}
-	t.payload.reset()
+	if err == nil {
+		atomic.AddUint64(&t.stats.tracesFlushed, uint64(count))
+		atomic.AddUint64(&t.stats.bytesSent, uint64(size))
+		if err := t.prioritySampling.readRatesJSON(rc); err != nil {
+			t.pushError(&ratesDecodingError{context: err})
+		}
+	}
+	p.reset()
+	return err
+}
+
+// FlushStats describes an attempt to send the buffered traces to the agent. It
+// is given to the callbacks registered using WithFlushCallback.
+type FlushStats struct {
+	// Traces and Spans are the number of traces and spans which were sent.
+	Traces, Spans int
+
+	// Bytes is the size of the payload which was sent.
+	Bytes int
+
+	// Duration is the time it took to send the payload.
+	Duration time.Duration
+
+	// Error is the error which occurred when sending the payload, or nil if
+	// it was sent.
+	Error error
+}
+
+// callFlushCallbacks calls the flush callbacks of the tracer with the given
+// stats, recovering from their panics.
+func (t *tracer) callFlushCallbacks(stats FlushStats) {
+	for _, fn := range t.config.flushCallbacks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logf("%sflush callback panicked: %v", errorPrefix, r)
+				}
+			}()
+			fn(stats)
+		}()
+	}
+}
+
+// handleErrors passes the errors found in handledErrors to the error handler,
+// until the tracer stops.
+func (t *tracer) handleErrors() {
+	defer t.wg.Done()
+	for {
+		select {
+		case err := <-t.handledErrors:
+			t.callErrorHandler(err)
+		case <-t.stopped:
+			for {
+				select {
+				case err := <-t.handledErrors:
+					t.callErrorHandler(err)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// callErrorHandler calls the error handler of the tracer with err, recovering
+// from its panics.
+func (t *tracer) callErrorHandler(err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logf("%serror handler panicked: %v", errorPrefix, r)
+		}
+	}()
+	t.config.errorHandler(newError(err))
 }
 
 // flushErrors will process log messages that were queued
 func (t *tracer) flushErrors() {
-	logErrors(t.errorBuffer)
+	t.errLog.logErrors(t.errorBuffer, getClock().Now())
 }
 
-func (t *tracer) flush() {
-	t.flushTraces()
+// flush flushes the buffered traces and errors. If done is not nil, it
+// receives the error returned by the transport once the traces are sent.
+func (t *tracer) flush(done chan<- error) {
+	t.flushTraces(done)
 	t.flushErrors()
 }
 
+// drainPayloadQueue adds all the traces waiting in the payload queue
+// onto the payload.
+func (t *tracer) drainPayloadQueue() {
+	for {
+		select {
+		case trace := <-t.payloadQueue:
+			t.pushPayload(trace)
+		default:
+			return
+		}
+	}
+}
+
 // forceFlush forces a flush of data (traces and services) to the agent.
 // Flushes are done by a background task on a regular basis, so you never
 // need to call this manually, mostly useful for testing and debugging.
 func (t *tracer) forceFlush() {
-	done := make(chan struct{})
-	t.flushAllReq <- done
-	<-done
+	t.flushWithContext(context.Background())
+}
+
+// flushWithContext requests the worker to flush all buffered traces and waits
+// for it to complete, or for ctx to be done. It is a no-op on a stopped tracer.
+func (t *tracer) flushWithContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case t.flushAllReq <- done:
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // pushPayload pushes the trace onto the payload. If the payload becomes
 // larger than the threshold as a result, it sends a flush request.
 func (t *tracer) pushPayload(trace []*span) {
-	if err := t.payload.push(trace); err != nil {
+	if debugEnabled() {
+		for _, s := range trace {
+			// the span may still be locked by the goroutine finishing it,
+			// but it is no longer modified
+			debugf("adding span to payload: %s", s.summary())
+		}
+	}
+	if t.sending && t.payload.size() >= retainedMaxBytes {
+		// the agent is not keeping up, the trace can not be buffered
+		atomic.AddUint64(&t.stats.spansDropped, uint64(len(trace)))
+		t.pushError(&dataLossError{
+			context: errPayloadBacklogFull,
+			count:   len(trace),
+		})
+	} else if err := t.payload.push(trace); err != nil {
 		t.pushError(&traceEncodingError{context: err})
 	}
-	if t.payload.size() > payloadSizeLimit {
+	if t.payload.size() > t.config.payloadSizeLimit {
 		// getting large
 		select {
 		case t.flushTracesReq <- struct{}{}:
@@ -345,26 +796,71 @@ func (t *tracer) pushPayload(trace []*span) {
 	}
 }
 
+// isRateSampler reports whether s is a rate sampler created by NewRateSampler.
+func isRateSampler(s Sampler) bool {
+	_, ok := s.(*rateSampler)
+	return ok
+}
+
 // sampleRateMetricKey is the metric key holding the applied sample rate. Has to be the same as the Agent.
 const sampleRateMetricKey = "_sample_rate"
 
+// setSampler replaces the sampler of the tracer, unless s is nil.
+func (t *tracer) setSampler(s Sampler) {
+	if s == nil {
+		return
+	}
+	t.samplerMu.Lock()
+	t.config.sampler = s
+	t.samplerMu.Unlock()
+}
+
+// setMaxTracesPerSecond limits the number of traces kept per second to n,
+// removing the limit when n is not positive.
+func (t *tracer) setMaxTracesPerSecond(n float64) {
+	var limiter *rateLimiter
+	if n > 0 {
+		limiter = newRateLimiter(n)
+	}
+	t.samplerMu.Lock()
+	t.limiter = limiter
+	t.samplerMu.Unlock()
+}
+
 // Sample samples a span with the internal sampler.
 func (t *tracer) sample(span *span) {
-	sampler := t.config.sampler
+	t.samplerMu.RLock()
+	sampler, limiter := t.config.sampler, t.limiter
+	t.samplerMu.RUnlock()
 	sampled := sampler.Sample(span)
+	if sampled && limiter != nil {
+		var rate float64
+		if sampled, rate = limiter.allow(); sampled {
+			span.Lock()
+			span.Metrics[limitRateKey] = rate
+			span.Unlock()
+		} else {
+			atomic.AddUint64(&t.stats.tracesLimited, 1)
+		}
+	}
 	span.context.sampled = sampled
 	if !sampled {
 		return
 	}
-	if rs, ok := sampler.(RateSampler); ok && rs.Rate() < 1 {
-		// the span was sampled using a rate sampler which wasn't all permissive,
-		// so we make note of the sampling rate.
+	if rs, ok := sampler.(RateSampler); ok && !isRateSampler(sampler) && rs.Rate() < 1 {
+		// the span was sampled using a custom rate sampler which wasn't all
+		// permissive, so we make note of the sampling rate; the ones of this
+		// package record the rate they used themselves.
 		span.Lock()
-		defer span.Unlock()
-		if span.finished {
+		if !span.finished {
 			// we don't touch finished span as they might be flushing
-			return
+			span.Metrics[sampleRateMetricKey] = rs.Rate()
 		}
-		span.Metrics[sampleRateMetricKey] = rs.Rate()
+		span.Unlock()
+	}
+	if span.context.hasSamplingPriority() {
+		// the priority was propagated or set by the user
+		return
 	}
+	t.prioritySampling.apply(span)
 }
@@ -1,12 +1,19 @@
 package tracer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -195,6 +202,23 @@ func TestTracerStartChildSpan(t *testing.T) {
 
 		assert.Equal("root-service", child.Service)
 	})
+
+	t.Run("override-service", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer()
+		root := tracer.StartSpan("web.request", ServiceName("root-service")).(*span)
+		proxy := tracer.StartSpan("proxy.request", ChildOf(root.Context())).(*span)
+		before := tracer.StartSpan("proxy.dial", ChildOf(proxy.Context())).(*span)
+		proxy.SetTag(ext.ServiceName, "proxy-service")
+		after := tracer.StartSpan("proxy.send", ChildOf(proxy.Context())).(*span)
+		grandchild := tracer.StartSpan("proxy.write", ChildOf(after.Context())).(*span)
+
+		assert.Equal("root-service", root.Service)
+		assert.Equal("proxy-service", proxy.Service)
+		assert.Equal("root-service", before.Service)
+		assert.Equal("proxy-service", after.Service)
+		assert.Equal("proxy-service", grandchild.Service)
+	})
 }
 
 func TestTracerBaggagePropagation(t *testing.T) {
@@ -267,6 +291,154 @@ func TestTracerSamplingPriorityPropagation(t *testing.T) {
 	assert.True(child.context.hasPriority)
 }
 
+func TestTracerFollowsFrom(t *testing.T) {
+	t.Run("parent-finished-first", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer(WithServiceName("backend"))
+		defer stop()
+		root := tracer.StartSpan("web.request", ServiceName("web")).(*span)
+		root.SetBaggageItem("user", "bob")
+		root.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+		async := tracer.StartSpan("job.run", FollowsFrom(root.Context())).(*span)
+		child := tracer.StartSpan("db.query", ChildOf(async.Context())).(*span)
+
+		// the trace of the parent is flushed without waiting for the async span
+		root.Finish()
+		tracer.forceFlush()
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 1)
+		assert.Equal("web.request", traces[0][0].Name)
+
+		child.Finish()
+		async.Finish()
+		tracer.forceFlush()
+		traces = transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 2)
+
+		assert.Equal(root.TraceID, async.TraceID)
+		assert.Equal(root.SpanID, async.ParentID)
+		assert.Equal(strconv.FormatUint(root.SpanID, 10), async.Meta[followsFromKey])
+		assert.Equal("web", async.Service)
+		assert.Equal("bob", async.context.baggageItem("user"))
+		assert.EqualValues(ext.PriorityUserKeep, async.Metrics[samplingPriorityKey])
+		assert.Equal(async.SpanID, child.ParentID)
+		assert.NotContains(child.Meta, followsFromKey)
+	})
+
+	t.Run("async-finished-first", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer()
+		defer stop()
+		root := tracer.StartSpan("web.request").(*span)
+		async := tracer.StartSpan("job.run", FollowsFrom(root.Context())).(*span)
+		async.Finish()
+		tracer.forceFlush()
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Equal("job.run", traces[0][0].Name)
+
+		root.Finish()
+		tracer.forceFlush()
+		traces = transport.Traces()
+		assert.Len(traces, 1)
+		assert.Equal("web.request", traces[0][0].Name)
+	})
+
+	t.Run("unsampled", func(t *testing.T) {
+		tracer, _, stop := startTestTracer(WithSampler(NewRateSampler(0)))
+		defer stop()
+		root := tracer.StartSpan("web.request").(*span)
+		async := tracer.StartSpan("job.run", FollowsFrom(root.Context())).(*span)
+		assert.False(t, async.context.sampled)
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, stop := startTestTracer()
+		defer stop()
+		pctx := RemoteContext{TraceID: 1, SpanID: 2}.SpanContext()
+		async := tracer.StartSpan("job.run", FollowsFrom(pctx)).(*span)
+		assert.EqualValues(1, async.TraceID)
+		assert.EqualValues(2, async.ParentID)
+		assert.Equal("2", async.Meta[followsFromKey])
+	})
+}
+
+func TestTracerSamplingPriorityTrace(t *testing.T) {
+	t.Run("child", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer()
+		defer stop()
+		root := tracer.StartSpan("web.request").(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		sibling := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		assert.EqualValues(ext.PriorityAutoKeep, sibling.context.samplingPriority())
+
+		// set on a child after its sibling started
+		child.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+		assert.EqualValues(ext.PriorityUserKeep, root.context.samplingPriority())
+		assert.EqualValues(ext.PriorityUserKeep, sibling.context.samplingPriority())
+
+		// the value is forwarded by all spans of the trace
+		carrier := TextMapCarrier{}
+		assert.NoError(tracer.Inject(sibling.Context(), carrier))
+		assert.Equal("2", carrier[DefaultPriorityHeader])
+
+		// the flushed spans carry it
+		sibling.Finish()
+		child.Finish()
+		root.Finish()
+		tracer.forceFlush()
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 3)
+		for _, sp := range traces[0] {
+			assert.EqualValues(ext.PriorityUserKeep, sp.Metrics[samplingPriorityKey], sp.Name)
+		}
+	})
+
+	t.Run("extracted", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer()
+		defer stop()
+		pctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "1",
+		})
+		assert.NoError(err)
+		root := tracer.StartSpan("web.request", ChildOf(pctx)).(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		child.SetTag(ext.SamplingPriority, ext.PriorityUserReject)
+		child.Finish()
+		root.Finish()
+		tracer.forceFlush()
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.EqualValues(ext.PriorityUserReject, traces[0][0].Metrics[samplingPriorityKey])
+		assert.EqualValues(ext.PriorityUserReject, traces[0][1].Metrics[samplingPriorityKey])
+	})
+
+	t.Run("partial-flush", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer(WithPartialFlushing(1))
+		defer stop()
+		root := tracer.StartSpan("web.request").(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		root.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+		child.Finish() // flushed without its root
+		root.Finish()
+		tracer.forceFlush()
+		traces := transport.Traces()
+		assert.Len(traces, 2)
+		for _, trace := range traces {
+			assert.EqualValues(ext.PriorityUserKeep, trace[0].Metrics[samplingPriorityKey])
+		}
+	})
+}
+
 func TestTracerBaggageImmutability(t *testing.T) {
 	assert := assert.New(t)
 	tracer := newTracer()
@@ -295,6 +467,10 @@ func TestTracerSpanGlobalTags(t *testing.T) {
 	assert.Equal("value", s.Meta["key"])
 	child := tracer.StartSpan("db.query", ChildOf(s.Context())).(*span)
 	assert.Equal("value", child.Meta["key"])
+	override := tracer.StartSpan("db.query", Tag("key", "override")).(*span)
+	assert.Equal("override", override.Meta["key"])
+	override.SetTag("key", "other")
+	assert.Equal("other", override.Meta["key"])
 }
 
 func TestNewSpan(t *testing.T) {
@@ -330,7 +506,47 @@ func TestNewRootSpanHasPid(t *testing.T) {
 	tracer := newTracer(withTransport(newDefaultTransport()))
 	root := tracer.newRootSpan("pylons.request", "pylons", "/")
 
-	assert.Equal(strconv.Itoa(os.Getpid()), root.Meta[ext.Pid])
+	assert.Equal(float64(os.Getpid()), root.Metrics[ext.Pid])
+	assert.NotContains(root.Meta, ext.Pid)
+}
+
+func TestRootSpanProcessTags(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDummyTransport()))
+		defer tracer.Stop()
+		hostname, err := os.Hostname()
+		assert.NoError(err)
+		root := tracer.StartSpan("web.request").(*span)
+		assert.Equal(hostname, root.Meta[hostnameKey])
+		assert.Equal("go", root.Meta[languageKey])
+		assert.Equal(runtime.Version(), root.Meta[runtimeVersionKey])
+
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		for _, k := range []string{hostnameKey, languageKey, runtimeVersionKey} {
+			assert.NotContains(child.Meta, k)
+		}
+		assert.NotContains(child.Metrics, ext.Pid)
+
+		// process-level roots of distributed traces get them too
+		carrier := TextMapCarrier{}
+		assert.NoError(tracer.Inject(child.Context(), carrier))
+		pctx, err := tracer.Extract(carrier)
+		assert.NoError(err)
+		remote := tracer.StartSpan("rpc.server", ChildOf(pctx)).(*span)
+		assert.Equal(hostname, remote.Meta[hostnameKey])
+		assert.Equal(float64(os.Getpid()), remote.Metrics[ext.Pid])
+	})
+
+	t.Run("no-hostname", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(withTransport(newDummyTransport()), WithHostnameReporting(false))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		assert.NotContains(root.Meta, hostnameKey)
+		assert.Equal("go", root.Meta[languageKey])
+		assert.Equal(float64(os.Getpid()), root.Metrics[ext.Pid])
+	})
 }
 
 func TestNewChildHasNoPid(t *testing.T) {
@@ -340,7 +556,7 @@ func TestNewChildHasNoPid(t *testing.T) {
 	root := tracer.newRootSpan("pylons.request", "pylons", "/")
 	child := tracer.newChildSpan("redis.command", root)
 
-	assert.Equal("", child.Meta[ext.Pid])
+	assert.NotContains(child.Metrics, ext.Pid)
 }
 
 func TestTracerSampler(t *testing.T) {
@@ -362,6 +578,111 @@ func TestTracerSampler(t *testing.T) {
 	assert.True(ok)
 }
 
+// tagSampler drops the traces whose root span holds the given tag value.
+type tagSampler struct{ key, val string }
+
+func (s tagSampler) Sample(spn Span) bool {
+	span := spn.(*span)
+	span.RLock()
+	defer span.RUnlock()
+	return span.Meta[s.key] != s.val
+}
+
+func TestTracerCustomSampler(t *testing.T) {
+	t.Run("tags", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, transport, stop := startTestTracer(WithSampler(tagSampler{"http.useragent", "loadtest"}))
+		defer stop()
+		for _, ua := range []string{"loadtest", "browser"} {
+			root := tracer.StartSpan("web.request", Tag("http.useragent", ua))
+			child := tracer.StartSpan("db.query", ChildOf(root.Context()))
+			child.Finish()
+			root.Finish()
+		}
+		tracer.forceFlush()
+		traces := transport.Traces()
+		assert.Len(traces, 1)
+		assert.Equal("browser", traces[0][0].Meta["http.useragent"])
+	})
+
+	t.Run("set", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer, _, stop := startTestTracer()
+		defer stop()
+
+		sampled := tracer.StartSpan("web.request").(*span)
+		SetSampler(NewRateSampler(0))
+		dropped := tracer.StartSpan("web.request").(*span)
+		child := tracer.StartSpan("db.query", ChildOf(sampled.Context())).(*span)
+		SetSampler(nil)
+		_, ok := tracer.config.sampler.(RateSampler)
+		assert.True(ok)
+
+		assert.True(sampled.context.sampled)
+		assert.True(child.context.sampled, "children follow the decision of their root")
+		assert.False(dropped.context.sampled)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		tracer, _, stop := startTestTracer()
+		defer stop()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				tracer.StartSpan("web.request").Finish()
+			}()
+			go func(rate float64) {
+				defer wg.Done()
+				tracer.setSampler(NewRateSampler(rate))
+			}(float64(i) / 10)
+		}
+		wg.Wait()
+	})
+}
+
+func TestTracerUnsampledSpan(t *testing.T) {
+	assert := assert.New(t)
+	tracer, transport, stop := startTestTracer(WithSampler(NewRateSampler(0)))
+	defer stop()
+	root := tracer.StartSpan("web.request", Tag("key", "start")).(*span)
+	root.SetBaggageItem("item", "value")
+	root.SetTag("key", "value")
+	root.SetTag(ext.Error, errors.New("boom"))
+	root.Finish(WithError(errors.New("boom")))
+	assert.True(root.finished)
+	assert.Equal("start", root.Meta["key"])
+	assert.NotContains(root.Meta, ext.ErrorMsg)
+	assert.NotContains(root.Meta, baggageTagPrefix+"item")
+	assert.Equal(int32(0), root.Error)
+	tracer.forceFlush()
+	assert.Len(transport.Traces(), 0)
+
+	// propagated contexts are sampled anew
+	extracted, err := NewPropagator(nil).Extract(TextMapCarrier{
+		DefaultTraceIDHeader:  "1",
+		DefaultParentIDHeader: "2",
+	})
+	assert.NoError(err)
+	tracer.setSampler(NewAllSampler())
+	span := tracer.StartSpan("web.request", ChildOf(extracted), Tag("key", "start")).(*span)
+	assert.True(span.context.sampled)
+	assert.Equal("start", span.Meta["key"])
+}
+
+func BenchmarkUnsampledSpan(b *testing.B) {
+	tracer, _, stop := startTestTracer(WithSampler(NewRateSampler(0)))
+	defer stop()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		span := tracer.StartSpan("web.request")
+		span.SetTag("key", "value")
+		span.SetTag("number", 1)
+		span.Finish()
+	}
+}
+
 func TestTracerEdgeSampler(t *testing.T) {
 	assert := assert.New(t)
 
@@ -555,6 +876,83 @@ func TestTracerTraceMaxSize(t *testing.T) {
 	wg.Wait()
 }
 
+func TestTracerMaxSpansPerTrace(t *testing.T) {
+	assert := assert.New(t)
+	tracer, transport, stop := startTestTracer(WithMaxSpansPerTrace(10), WithPartialFlushing(0))
+	defer stop()
+
+	root := tracer.StartSpan("web.request")
+	root.SetBaggageItem("user", "42")
+	trace := root.(*span).context.trace
+	var dropped []ddtrace.Span
+	for i := 0; i < 100; i++ {
+		child := tracer.StartSpan("db.query", ChildOf(root.Context()))
+		if _, ok := child.(droppedSpan); ok {
+			dropped = append(dropped, child)
+		}
+		child.SetTag("i", i)
+		child.Finish()
+		trace.mu.RLock()
+		assert.True(len(trace.spans) <= 10)
+		trace.mu.RUnlock()
+	}
+	assert.Len(dropped, 91)
+	// children of dropped spans are dropped too
+	grandchild := tracer.StartSpan("db.query", ChildOf(dropped[0].Context()))
+	assert.IsType(droppedSpan{}, grandchild)
+	assert.Equal("42", grandchild.BaggageItem("user"))
+	grandchild.Finish()
+
+	// the error is reported once
+	assert.Len(tracer.errorBuffer, 1)
+	assert.Equal(&spanBufferFullError{limit: 10}, <-tracer.errorBuffer)
+
+	root.Finish()
+	tracer.forceFlush()
+	traces := transport.Traces()
+	assert.Len(traces, 1)
+	assert.Len(traces[0], 10)
+	for _, s := range traces[0] {
+		if s.ParentID == 0 {
+			assert.Equal("92", s.Meta[droppedSpansKey])
+		} else {
+			assert.NotContains(s.Meta, droppedSpansKey)
+		}
+	}
+
+	var c config
+	defaults(&c)
+	assert.Equal(traceMaxSize, c.maxSpansPerTrace)
+	WithMaxSpansPerTrace(0)(&c)
+	assert.Equal(traceMaxSize, c.maxSpansPerTrace)
+}
+
+func TestTracerMaxSpansPerTracePartialFlushing(t *testing.T) {
+	assert := assert.New(t)
+	tracer, transport, stop := startTestTracer(WithMaxSpansPerTrace(3), WithPartialFlushing(2))
+	defer stop()
+
+	root := tracer.StartSpan("web.request")
+	child := tracer.StartSpan("db.query", ChildOf(root.Context()))
+	open := tracer.StartSpan("db.query", ChildOf(root.Context()))
+	tracer.StartSpan("db.query", ChildOf(root.Context())).Finish()
+	root.Finish()
+	child.Finish()
+	tracer.StartSpan("db.query", ChildOf(root.Context())).Finish()
+	open.Finish()
+	tracer.forceFlush()
+
+	// the root was sent with the first part, the count of the spans dropped
+	// later goes on the span of the second one
+	traces := transport.Traces()
+	assert.Len(traces, 2)
+	assert.Len(traces[0], 2)
+	assert.Equal("1", traces[0][0].Meta[droppedSpansKey])
+	assert.NotContains(traces[0][1].Meta, droppedSpansKey)
+	assert.Len(traces[1], 1)
+	assert.Equal("2", traces[1][0].Meta[droppedSpansKey])
+}
+
 func TestTracerRace(t *testing.T) {
 	assert := assert.New(t)
 
@@ -697,7 +1095,11 @@ func TestWorker(t *testing.T) {
 }
 
 func newTracerChannels() *tracer {
+	c := new(config)
+	defaults(c)
 	return &tracer{
+		config:         c,
+		stats:          new(tracerStats),
 		payload:        newPayload(),
 		payloadQueue:   make(chan []*span, payloadQueueSize),
 		errorBuffer:    make(chan error, errorBufferSize),
@@ -722,6 +1124,30 @@ func TestPushPayload(t *testing.T) {
 	assert.Len(t, tracer.flushTracesReq, 1)
 }
 
+func TestPushPayloadBacklog(t *testing.T) {
+	assert := assert.New(t)
+	tracer := newTracerChannels()
+	tracer.sending = true
+	s := newBasicSpan("3MB")
+	s.Meta["key"] = strings.Repeat("X", payloadSizeLimit/2+10)
+
+	// traces are buffered while a payload is being sent, up to retainedMaxBytes
+	for tracer.payload.size() < retainedMaxBytes {
+		tracer.pushPayload([]*span{s})
+	}
+	n := tracer.payload.itemCount()
+	tracer.pushPayload([]*span{s})
+	assert.Equal(n, tracer.payload.itemCount())
+	assert.EqualValues(1, tracer.stats.snapshot().SpansDropped)
+	err := <-tracer.errorBuffer
+	assert.Equal(errPayloadBacklogFull, err.(*dataLossError).context)
+
+	// they are buffered again once it is sent
+	tracer.sending = false
+	tracer.pushPayload([]*span{s})
+	assert.Equal(n+1, tracer.payload.itemCount())
+}
+
 func TestPushTrace(t *testing.T) {
 	assert := assert.New(t)
 
@@ -811,7 +1237,485 @@ func BenchmarkTracerAddSpans(b *testing.B) {
 	}
 }
 
+// BenchmarkHTTPRequestTrace tests the performance of tracing a typical HTTP
+// request, producing a trace of 5 spans, up to its encoding.
+func BenchmarkHTTPRequestTrace(b *testing.B) {
+	tracer, _, stop := startTestTracer(withTransport(discardTransport{}))
+	defer stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		root := tracer.StartSpan("http.request", ServiceName("web"), ResourceName("GET /users/:id"), SpanType(ext.SpanTypeWeb))
+		root.SetTag(ext.HTTPMethod, "GET")
+		root.SetTag(ext.HTTPURL, "/users/42")
+		for i := 0; i < 3; i++ {
+			query := tracer.StartSpan("postgres.query", ChildOf(root.Context()), ServiceName("postgres"), SpanType(ext.SpanTypeSQL))
+			query.SetTag(ext.ResourceName, "SELECT * FROM users WHERE id = ?")
+			query.SetTag(ext.DBName, "users")
+			query.Finish()
+		}
+		cache := tracer.StartSpan("redis.command", ChildOf(root.Context()), ServiceName("redis"), SpanType(ext.SpanTypeRedis))
+		cache.SetTag("redis.raw_command", "GET user:42")
+		cache.Finish()
+		root.SetTag(ext.HTTPCode, "200")
+		root.Finish()
+		if n%1000 == 999 {
+			tracer.forceFlush()
+		}
+	}
+}
+
+// BenchmarkFinishSpanParallel tests the performance of finishing spans from 64
+// goroutines, either each in a trace of its own, or all in the same trace.
+func BenchmarkFinishSpanParallel(b *testing.B) {
+	const goroutines = 64
+	run := func(b *testing.B, tracer *tracer, opts ...StartSpanOption) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < b.N/goroutines+1; n++ {
+					tracer.StartSpan("redis.command", opts...).Finish()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	b.Run("own-trace", func(b *testing.B) {
+		tracer, _, stop := startTestTracer()
+		defer stop()
+		run(b, tracer)
+	})
+
+	b.Run("shared-trace", func(b *testing.B) {
+		// the trace is flushed in parts, as its root remains unfinished
+		tracer, _, stop := startTestTracer(WithPartialFlushing(goroutines))
+		defer stop()
+		root := tracer.StartSpan("pylons.request")
+		defer root.Finish()
+		run(b, tracer, ChildOf(root.Context()))
+	})
+}
+
 // startTestTracer returns a Tracer with a DummyTransport
+// discardTransport is a transport which discards the payloads it is given.
+type discardTransport struct{}
+
+func (discardTransport) send(_ *payload, _ <-chan struct{}) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("{}")), nil
+}
+
+// failingTransport is a transport which returns err on every send.
+type failingTransport struct{ err error }
+
+func (t failingTransport) send(_ *payload, _ <-chan struct{}) (io.ReadCloser, error) {
+	return nil, t.err
+}
+
+// blockingTransport is a transport which blocks on every send until it is closed.
+type blockingTransport chan struct{}
+
+func (t blockingTransport) send(_ *payload, _ <-chan struct{}) (io.ReadCloser, error) {
+	<-t
+	return ioutil.NopCloser(strings.NewReader("{}")), nil
+}
+
+func TestFlush(t *testing.T) {
+	t.Run("sends", func(t *testing.T) {
+		assert := assert.New(t)
+		transport := newDummyTransport()
+		tracer := newTracer(withTransport(transport))
+		internal.SetGlobalTracer(tracer)
+		defer Stop()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				StartSpan("web.request").Finish()
+			}()
+		}
+		wg.Wait()
+		assert.NoError(Flush())
+		transport.RLock()
+		assert.Len(transport.traces, 10)
+		transport.RUnlock()
+	})
+
+	t.Run("error", func(t *testing.T) {
+		want := errors.New("boom")
+		tracer := newTracer(withTransport(failingTransport{want}))
+		internal.SetGlobalTracer(tracer)
+		defer Stop()
+
+		StartSpan("web.request").Finish()
+		assert.Equal(t, want, Flush())
+	})
+
+	t.Run("context", func(t *testing.T) {
+		release := make(chan struct{})
+		tracer := newTracer(withTransport(blockingTransport(release)))
+		internal.SetGlobalTracer(tracer)
+		defer Stop()
+		defer close(release)
+
+		StartSpan("web.request").Finish()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, FlushWithContext(ctx))
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		tracer := newTracer(withTransport(newDummyTransport()))
+		tracer.Stop()
+		assert.NoError(t, tracer.flushWithContext(context.Background()))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		Stop()
+		assert.NoError(t, Flush())
+	})
+}
+
+func TestTracerStop(t *testing.T) {
+	t.Run("drains", func(t *testing.T) {
+		assert := assert.New(t)
+		transport := newDummyTransport()
+		tracer := newTracer(withTransport(transport))
+		internal.SetGlobalTracer(tracer)
+		for i := 0; i < 10; i++ {
+			StartSpan("web.request").Finish()
+		}
+		Stop()
+		transport.RLock()
+		assert.Len(transport.traces, 10)
+		transport.RUnlock()
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		tracer := newTracer(withTransport(newDummyTransport()))
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tracer.Stop()
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("discards", func(t *testing.T) {
+		assert := assert.New(t)
+		transport := newDummyTransport()
+		tracer := newTracer(withTransport(transport))
+		internal.SetGlobalTracer(tracer)
+		defer Stop()
+		span := tracer.StartSpan("web.request")
+		tracer.Stop()
+		span.Finish() // must not block
+		assert.Len(tracer.payloadQueue, 0)
+		transport.RLock()
+		assert.Len(transport.traces, 0)
+		transport.RUnlock()
+	})
+
+	t.Run("retrying", func(t *testing.T) {
+		assert := assert.New(t)
+		var requests int32
+		failed := make(chan struct{}, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+		}))
+		defer srv.Close()
+		transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"))
+		transport.retryInterval = time.Hour
+		tracer, _, _ := startTestTracer(withTransport(transport))
+		defer internal.SetGlobalTracer(&internal.NoopTracer{})
+
+		tracer.StartSpan("web.request").Finish()
+		tracer.flushTracesReq <- struct{}{}
+		<-failed
+		// the worker keeps on receiving traces while the payload is retried
+		tracer.StartSpan("web.request").Finish()
+
+		stopped := make(chan struct{})
+		go func() {
+			tracer.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Stop is blocked by the pending retry")
+		}
+		// the remaining trace is sent once, without being retried
+		assert.EqualValues(2, atomic.LoadInt32(&requests))
+		assert.EqualValues(2, tracer.stats.snapshot().FlushErrors)
+	})
+}
+
+func TestTracerSwap(t *testing.T) {
+	t.Run("old-tracer", func(t *testing.T) {
+		assert := assert.New(t)
+		oldTransport := newDummyTransport()
+		oldTracer := newTracer(withTransport(oldTransport))
+		internal.SetGlobalTracer(oldTracer)
+		root := StartSpan("web.request")
+		done := StartSpan("db.query", ChildOf(root.Context()))
+		done.Finish()
+		oldTracer.StartSpan("flushed.request").Finish()
+
+		tracer, transport, stop := startTestTracer()
+		defer stop()
+		child := StartSpan("db.query", ChildOf(root.Context()))
+		child.Finish()
+		root.Finish()
+		tracer.forceFlush()
+
+		// the replaced tracer flushed the traces finished before it stopped,
+		// and the one which was open is sent by the new tracer
+		traces := oldTransport.Traces()
+		assert.Len(traces, 1)
+		assert.Equal("flushed.request", traces[0][0].Name)
+		traces = transport.Traces()
+		assert.Len(traces, 1)
+		assert.Len(traces[0], 3)
+		assert.Equal(root.Context().TraceID(), traces[0][0].TraceID)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		assert := assert.New(t)
+		transport := newDummyTransport()
+		internal.SetGlobalTracer(newTracer(withTransport(transport)))
+		root := StartSpan("web.request")
+		Stop()
+		root.Finish()
+
+		// spans finished once no tracer runs are discarded
+		assert.Len(transport.Traces(), 0)
+	})
+
+	t.Run("race", func(t *testing.T) {
+		defer Stop()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					root, ctx := StartSpanFromContext(context.Background(), "web.request")
+					child, _ := StartSpanFromContext(ctx, "db.query")
+					child.SetTag("k", "v")
+					child.Finish()
+					root.Finish()
+				}
+			}()
+		}
+		for i := 0; i < 10; i++ {
+			Start(withTransport(newDummyTransport()))
+		}
+		wg.Wait()
+	})
+}
+
+func TestTracerTraceFlushedTogether(t *testing.T) {
+	assert := assert.New(t)
+	tracer, transport, stop := startAsyncTestTracer()
+	defer stop()
+
+	// spans of several traces are finished concurrently, in any order
+	const traces, spans = 20, 10
+	var wg sync.WaitGroup
+	for i := 0; i < traces; i++ {
+		root := tracer.StartSpan("web.request")
+		var children sync.WaitGroup
+		for j := 0; j < spans-1; j++ {
+			wg.Add(1)
+			children.Add(1)
+			go func() {
+				defer wg.Done()
+				defer children.Done()
+				tracer.StartSpan("db.query", ChildOf(root.Context())).Finish()
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			children.Wait()
+			root.Finish()
+		}()
+	}
+	wg.Wait()
+	tracer.forceFlush()
+
+	got := transport.Traces()
+	assert.Len(got, traces)
+	for _, trace := range got {
+		// all the spans of a trace are sent together, in a list of their own
+		assert.Len(trace, spans)
+		for _, s := range trace {
+			assert.Equal(trace[0].TraceID, s.TraceID)
+		}
+	}
+}
+
+func TestTracerFlushCallback(t *testing.T) {
+	t.Run("sent", func(t *testing.T) {
+		assert := assert.New(t)
+		tl := new(testLogger)
+		SetLogger(tl)
+		defer SetLogger(nil)
+		var got []FlushStats
+		tracer, _, stop := startTestTracer(
+			WithFlushCallback(func(FlushStats) { panic("oops") }),
+			WithFlushCallback(func(stats FlushStats) { got = append(got, stats) }),
+			WithFlushCallback(nil),
+		)
+		defer stop()
+
+		root := tracer.StartSpan("web.request")
+		tracer.StartSpan("db.query", ChildOf(root.Context())).Finish()
+		root.Finish()
+		tracer.StartSpan("web.request").Finish()
+		tracer.forceFlush()
+		tracer.forceFlush() // nothing to send
+
+		assert.Len(got, 1)
+		assert.Equal(2, got[0].Traces)
+		assert.Equal(3, got[0].Spans)
+		assert.True(got[0].Bytes > 0)
+		assert.NoError(got[0].Error)
+		assert.Equal([]string{errorPrefix + "flush callback panicked: oops"}, tl.Lines())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert := assert.New(t)
+		want := errors.New("boom")
+		var got []FlushStats
+		tracer := newTracer(
+			withTransport(failingTransport{want}),
+			WithFlushCallback(func(stats FlushStats) { got = append(got, stats) }),
+		)
+		internal.SetGlobalTracer(tracer)
+		defer Stop()
+
+		StartSpan("web.request").Finish()
+		assert.Equal(want, Flush())
+		assert.Len(got, 1)
+		assert.Equal(1, got[0].Traces)
+		assert.Equal(want, got[0].Error)
+	})
+}
+
+func TestTracerErrorHandler(t *testing.T) {
+	t.Run("handled", func(t *testing.T) {
+		assert := assert.New(t)
+		tl := new(testLogger)
+		SetLogger(tl)
+		defer SetLogger(nil)
+		errc := make(chan error, 10)
+		tracer, _, stop := startTestTracer(
+			withTransport(failingTransport{errors.New("boom")}),
+			WithErrorHandler(func(err error) { errc <- err }),
+		)
+		defer stop()
+
+		tracer.StartSpan("web.request").Finish()
+		tracer.forceFlush()
+		tracer.pushError(&spanBufferFullError{})
+		tracer.pushError(&dataLossError{context: errPayloadQueueFull, count: 1})
+		tracer.pushError(&traceEncodingError{context: errors.New("bad")})
+
+		var kinds []error
+		for i := 0; i < 4; i++ {
+			select {
+			case err := <-errc:
+				e, ok := err.(*Error)
+				assert.True(ok)
+				kinds = append(kinds, e.Kind)
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for errors")
+			}
+		}
+		assert.Equal([]error{ErrTransport, ErrBufferFull, ErrBufferFull, ErrEncoding}, kinds)
+		tracer.forceFlush()
+		assert.Empty(tl.Lines())
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		assert := assert.New(t)
+		block := make(chan struct{})
+		var handled int64
+		tracer, _, stop := startTestTracer(WithErrorHandler(func(err error) {
+			<-block
+			atomic.AddInt64(&handled, 1)
+		}))
+		for i := 0; i < 2*errorBufferSize; i++ {
+			// must not block
+			tracer.pushError(&spanBufferFullError{})
+		}
+		close(block)
+		stop()
+		// the errors which did not fit in the buffer were dropped
+		assert.True(atomic.LoadInt64(&handled) <= errorBufferSize+1)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		tl := new(testLogger)
+		SetLogger(tl)
+		defer SetLogger(nil)
+		tracer, _, stop := startTestTracer(WithErrorHandler(func(error) { panic("oops") }))
+		tracer.pushError(&spanBufferFullError{})
+		stop()
+		assert.Equal(t, []string{errorPrefix + "error handler panicked: oops"}, tl.Lines())
+	})
+}
+
+func TestTracerFlushInterval(t *testing.T) {
+	assert := assert.New(t)
+	clock := newFakeClock()
+	defer setClock(clock)()
+	flushed := make(chan FlushStats, 1)
+	tracer, transport, stop := startTestTracer(
+		WithFlushInterval(time.Minute),
+		WithFlushCallback(func(s FlushStats) { flushed <- s }),
+	)
+	defer stop()
+	clock.WaitTickers(1) // the flush ticker of the worker
+
+	for i := 1; i <= 3; i++ {
+		tracer.StartSpan("web.request").Finish()
+		clock.Advance(59 * time.Second)
+		clock.Advance(time.Second)
+		select {
+		case s := <-flushed:
+			assert.Equal(1, s.Traces)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("trace %d was not flushed", i)
+		}
+		assert.Len(transport.Traces(), 1)
+	}
+}
+
+func TestTracerPayloadSizeLimit(t *testing.T) {
+	tracer := newTracerChannels()
+	WithPayloadSizeLimit(1)(tracer.config)
+	tracer.pushPayload([]*span{newBasicSpan("web.request")})
+	assert.Len(t, tracer.flushTracesReq, 1)
+}
+
 func startTestTracer(opts ...StartOption) (*tracer, *dummyTransport, func()) {
 	transport := newDummyTransport()
 	o := append([]StartOption{withTransport(transport)}, opts...)
@@ -824,25 +1728,51 @@ func startTestTracer(opts ...StartOption) (*tracer, *dummyTransport, func()) {
 	}
 }
 
+// startAsyncTestTracer is like startTestTracer, except that finished traces
+// are encoded by the worker of the tracer, concurrently with their spans being
+// used, as they would be outside of tests.
+func startAsyncTestTracer(opts ...StartOption) (*tracer, *dummyTransport, func()) {
+	transport := newDummyTransport()
+	o := append([]StartOption{withTransport(transport)}, opts...)
+	tracer := newTracer(o...)
+	internal.SetGlobalTracer(tracer)
+	return tracer, transport, func() {
+		internal.SetGlobalTracer(&internal.NoopTracer{})
+		tracer.Stop()
+	}
+}
+
 // Mock Transport with a real Encoder
 type dummyTransport struct {
 	sync.RWMutex
 	traces spanLists
+	rates  string // JSON body of the responses, if not empty
 }
 
 func newDummyTransport() *dummyTransport {
 	return &dummyTransport{traces: spanLists{}}
 }
 
-func (t *dummyTransport) send(p *payload) error {
+func (t *dummyTransport) send(p *payload, _ <-chan struct{}) (io.ReadCloser, error) {
 	traces, err := decode(p)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	t.Lock()
+	defer t.Unlock()
 	t.traces = append(t.traces, traces...)
-	t.Unlock()
-	return nil
+	body := "{}"
+	if t.rates != "" {
+		body = t.rates
+	}
+	return ioutil.NopCloser(strings.NewReader(body)), nil
+}
+
+// setRates sets the JSON body of the responses sent by the transport.
+func (t *dummyTransport) setRates(rates string) {
+	t.Lock()
+	defer t.Unlock()
+	t.rates = rates
 }
 
 func decode(p *payload) (spanLists, error) {
@@ -1,13 +1,22 @@
 package tracer
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/tinylib/msgp/msgp"
 )
 
 var tracerVersion = "v1.2"
@@ -18,11 +27,35 @@ const (
 	defaultAddress     = defaultHostname + ":" + defaultPort
 	defaultHTTPTimeout = time.Second             // defines the current timeout before giving up with the send process
 	traceCountHeader   = "X-Datadog-Trace-Count" // header containing the number of traces in the payload
+
+	// unixAddrPrefix is the prefix of agent addresses denoting a Unix domain socket.
+	unixAddrPrefix = "unix://"
+
+	// httpAddrPrefix and httpsAddrPrefix are the prefixes of agent addresses given
+	// as URLs, the latter enabling TLS.
+	httpAddrPrefix  = "http://"
+	httpsAddrPrefix = "https://"
+
+	// tracesPath is the path of the traces endpoint of the agent. Agents which do
+	// not support it are sent traces using legacyTracesPath instead, without
+	// receiving sampling rates in response.
+	tracesPath       = "/v0.4/traces"
+	legacyTracesPath = "/v0.3/traces"
+
+	// maxRetries is the number of times a failed payload submission is retried.
+	maxRetries = 3
+
+	// retryInterval and maxRetryInterval bound the exponential backoff between retries.
+	retryInterval    = 100 * time.Millisecond
+	maxRetryInterval = 2 * time.Second
 )
 
 // Transport is an interface for span submission to the agent.
 type transport interface {
-	send(p *payload) error
+	// send sends the payload p to the agent using the transport set up.
+	// It returns a non-nil response body when no error occurred. Failed
+	// submissions are no longer retried once stop is closed.
+	send(p *payload, stop <-chan struct{}) (body io.ReadCloser, err error)
 }
 
 // newTransport returns a new Transport implementation that sends traces to a
@@ -31,8 +64,21 @@ type transport interface {
 // for hostname, and "8126" for port).
 //
 // In general, using this method is only necessary if you have a trace agent
-// running on a non-default port or if it's located on another machine.
-func newTransport(addr string) transport {
+// running on a non-default port or if it's located on another machine. Addresses
+// prefixed with "unix://" denote the path of a Unix domain socket. Addresses may
+// also be prefixed with "http://", or with "https://" to use TLS. A non-nil
+// tlsConfig enables TLS for addresses other than Unix domain sockets.
+func newTransport(addr string, tlsConfig *tls.Config) *httpTransport {
+	if path := strings.TrimPrefix(addr, unixAddrPrefix); path != addr {
+		return newUDSTransport(path)
+	}
+	if hostport := strings.TrimPrefix(addr, httpsAddrPrefix); hostport != addr {
+		return newHTTPSTransport(hostport, tlsConfig)
+	}
+	addr = strings.TrimPrefix(addr, httpAddrPrefix)
+	if tlsConfig != nil {
+		return newHTTPSTransport(addr, tlsConfig)
+	}
 	return newHTTPTransport(addr)
 }
 
@@ -42,13 +88,64 @@ func newDefaultTransport() transport {
 }
 
 type httpTransport struct {
-	traceURL string            // the delivery URL for traces
-	client   *http.Client      // the HTTP client used in the POST
-	headers  map[string]string // the Transport headers
+	traceURL       string            // the delivery URL for traces
+	legacyTraceURL string            // the delivery URL for traces, on agents not supporting traceURL
+	client         *http.Client      // the HTTP client used in the POST
+	headers        map[string]string // the Transport headers
+
+	// legacy is 1 once the agent responded that it does not support traceURL,
+	// in which case legacyTraceURL is used from then on; accessed atomically.
+	legacy int32
+
+	retryInterval time.Duration // the backoff before the first retry, growing fivefold up to maxRetryInterval
+	retryMaxBytes int           // payloads larger than this are not retried
 }
 
 // newHTTPTransport returns an httpTransport for the given endpoint
 func newHTTPTransport(addr string) *httpTransport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+	return newHTTPTransportWithDialer(fmt.Sprintf("http://%s", resolveAddr(addr)), dialer.DialContext)
+}
+
+// newHTTPSTransport returns an httpTransport for the given endpoint, which it
+// connects to using TLS with the given configuration. A nil configuration uses
+// the defaults of the crypto/tls package, verifying the certificate of the agent
+// using the root CAs of the system.
+func newHTTPSTransport(addr string, cfg *tls.Config) *httpTransport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+	t := newHTTPTransportWithDialer(fmt.Sprintf("https://%s", resolveAddr(addr)), dialer.DialContext)
+	if cfg != nil {
+		// the configuration may be modified by the HTTP transport
+		t.client.Transport.(*http.Transport).TLSClientConfig = cfg.Clone()
+	}
+	return t
+}
+
+// newUDSTransport returns an httpTransport which sends HTTP requests to an agent
+// listening on the Unix domain socket found at path.
+func newUDSTransport(path string) *httpTransport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	// the host is only used for the HTTP requests, connections go to the socket
+	return newHTTPTransportWithDialer(fmt.Sprintf("http://%s", defaultHostname), dial)
+}
+
+// newHTTPTransportWithDialer returns an httpTransport which delivers traces to the agent
+// found at agentURL, establishing connections using the given dial function.
+func newHTTPTransportWithDialer(agentURL string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *httpTransport {
 	// initialize the default EncoderPool with Encoder headers
 	defaultHeaders := map[string]string{
 		"Datadog-Meta-Lang":             "go",
@@ -57,19 +154,19 @@ func newHTTPTransport(addr string) *httpTransport {
 		"Datadog-Meta-Tracer-Version":   tracerVersion,
 		"Content-Type":                  "application/msgpack",
 	}
+	if containerID != "" {
+		defaultHeaders[containerIDHeader] = containerID
+	}
 	return &httpTransport{
-		traceURL: fmt.Sprintf("http://%s/v0.3/traces", resolveAddr(addr)),
+		traceURL:       agentURL + tracesPath,
+		legacyTraceURL: agentURL + legacyTracesPath,
 		client: &http.Client{
 			// We copy the transport to avoid using the default one, as it might be
 			// augmented with tracing and we don't want these calls to be recorded.
 			// See https://golang.org/pkg/net/http/#DefaultTransport .
 			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-					DualStack: true,
-				}).DialContext,
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           dial,
 				MaxIdleConns:          100,
 				IdleConnTimeout:       90 * time.Second,
 				TLSHandshakeTimeout:   10 * time.Second,
@@ -77,15 +174,63 @@ func newHTTPTransport(addr string) *httpTransport {
 			},
 			Timeout: defaultHTTPTimeout,
 		},
-		headers: defaultHeaders,
+		headers:       defaultHeaders,
+		retryInterval: retryInterval,
+		retryMaxBytes: payloadMaxLimit,
 	}
 }
 
-func (t *httpTransport) send(p *payload) error {
+// send sends the payload, retrying with an exponential backoff when the agent
+// can not be reached or responds with a server error, unless the payload is
+// larger than retryMaxBytes or stop is closed.
+func (t *httpTransport) send(p *payload, stop <-chan struct{}) (body io.ReadCloser, err error) {
+	retries := maxRetries
+	if p.size() > t.retryMaxBytes {
+		retries = 0
+	}
+	backoff := t.retryInterval
+	for i := 0; ; i++ {
+		var retry bool
+		body, retry, err = t.sendOnce(p)
+		if err == nil || !retry || i == retries {
+			return body, err
+		}
+		if !sleep(backoff, stop) {
+			return nil, err
+		}
+		if backoff *= 5; backoff > maxRetryInterval {
+			backoff = maxRetryInterval
+		}
+		p.rewind()
+	}
+}
+
+// sleep waits for d to elapse. It returns false without waiting any further
+// when stop is closed before that.
+func sleep(d time.Duration, stop <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// sendOnce makes a single attempt at sending the payload. When it fails, retry
+// reports whether the error is temporary. Payloads which the agent does not
+// support are sent again using the legacy endpoint, which is used from then on.
+func (t *httpTransport) sendOnce(p *payload) (body io.ReadCloser, retry bool, err error) {
+	legacy := atomic.LoadInt32(&t.legacy) == 1
+	url := t.traceURL
+	if legacy {
+		url = t.legacyTraceURL
+	}
 	// prepare the client and send the payload
-	req, err := http.NewRequest("POST", t.traceURL, p)
+	req, err := http.NewRequest("POST", url, p)
 	if err != nil {
-		return fmt.Errorf("cannot create http request: %v", err)
+		return nil, false, fmt.Errorf("cannot create http request: %v", err)
 	}
 	for header, value := range t.headers {
 		req.Header.Set(header, value)
@@ -94,21 +239,34 @@ func (t *httpTransport) send(p *payload) error {
 	req.Header.Set("Content-Length", strconv.Itoa(p.size()))
 	response, err := t.client.Do(req)
 	if err != nil {
-		return err
+		return nil, true, err
 	}
-	defer response.Body.Close()
-	if code := response.StatusCode; code >= 400 {
+	code := response.StatusCode
+	if !legacy && (code == http.StatusNotFound || code == http.StatusUnsupportedMediaType) {
+		response.Body.Close()
+		atomic.StoreInt32(&t.legacy, 1)
+		logf("%sagent does not support %s (Status: %s), using %s instead", errorPrefix, tracesPath, http.StatusText(code), legacyTracesPath)
+		p.rewind()
+		return t.sendOnce(p)
+	}
+	if code >= 400 {
 		// error, check the body for context information and
 		// return a nice error.
+		defer response.Body.Close()
 		msg := make([]byte, 1000)
 		n, _ := response.Body.Read(msg)
 		txt := http.StatusText(code)
 		if n > 0 {
-			return fmt.Errorf("%s (Status: %s)", msg[:n], txt)
+			return nil, code >= 500, fmt.Errorf("%s (Status: %s)", msg[:n], txt)
 		}
-		return fmt.Errorf("%s", txt)
+		return nil, code >= 500, fmt.Errorf("%s", txt)
+	}
+	if legacy {
+		// legacy agents do not respond with sampling rates
+		response.Body.Close()
+		return ioutil.NopCloser(strings.NewReader("{}")), false, nil
 	}
-	return nil
+	return response.Body, false, nil
 }
 
 // resolveAddr resolves the given agent address and fills in any missing host
@@ -117,7 +275,7 @@ func resolveAddr(addr string) string {
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		// no port in addr
-		host = addr
+		host = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
 	}
 	if host == "" {
 		host = defaultHostname
@@ -125,5 +283,72 @@ func resolveAddr(addr string) string {
 	if port == "" {
 		port = defaultPort
 	}
-	return fmt.Sprintf("%s:%s", host, port)
+	return net.JoinHostPort(host, port)
+}
+
+// logTransport is a transport writing traces to a writer rather than sending them
+// to the agent, as single-line JSON objects which the Datadog forwarder ingests
+// from logs, e.g. in serverless environments where there is no agent.
+type logTransport struct {
+	w io.Writer
+}
+
+// logTrace is the format of the lines written by a logTransport.
+type logTrace struct {
+	Traces [][]logSpan `json:"traces"`
+}
+
+// logSpan is the format of the spans written by a logTransport. IDs are hex
+// encoded, timestamps and durations are in nanoseconds.
+type logSpan struct {
+	TraceID  string             `json:"trace_id"`
+	SpanID   string             `json:"span_id"`
+	ParentID string             `json:"parent_id"`
+	Name     string             `json:"name"`
+	Resource string             `json:"resource"`
+	Service  string             `json:"service"`
+	Type     string             `json:"type"`
+	Start    int64              `json:"start"`
+	Duration int64              `json:"duration"`
+	Error    int32              `json:"error"`
+	Meta     map[string]string  `json:"meta"`
+	Metrics  map[string]float64 `json:"metrics"`
+}
+
+// send writes the traces of p to the writer, one per line. As there is no agent
+// to respond with sampling rates, it responds with an empty set of them.
+func (t *logTransport) send(p *payload, _ <-chan struct{}) (body io.ReadCloser, err error) {
+	var traces spanLists
+	if err := msgp.Decode(p, &traces); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, trace := range traces {
+		spans := make([]logSpan, len(trace))
+		for i, s := range trace {
+			spans[i] = logSpan{
+				TraceID:  strconv.FormatUint(s.TraceID, 16),
+				SpanID:   strconv.FormatUint(s.SpanID, 16),
+				ParentID: strconv.FormatUint(s.ParentID, 16),
+				Name:     s.Name,
+				Resource: s.Resource,
+				Service:  s.Service,
+				Type:     s.Type,
+				Start:    s.Start,
+				Duration: s.Duration,
+				Error:    s.Error,
+				Meta:     s.Meta,
+				Metrics:  s.Metrics,
+			}
+		}
+		// Encode terminates each object with a newline
+		if err := enc.Encode(logTrace{Traces: [][]logSpan{spans}}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := t.w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader("{}")), nil
 }
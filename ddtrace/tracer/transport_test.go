@@ -1,18 +1,29 @@
 package tracer
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
 )
 
 // integration indicates if the test suite should run integration tests.
@@ -94,7 +105,7 @@ func TestTracesAgentIntegration(t *testing.T) {
 		transport := newHTTPTransport(defaultAddress)
 		p, err := encode(tc.payload)
 		assert.NoError(err)
-		err = transport.send(p)
+		_, err = transport.send(p, nil)
 		assert.NoError(err)
 	}
 }
@@ -109,6 +120,9 @@ func TestResolveAddr(t *testing.T) {
 		{":1111", fmt.Sprintf("%s:1111", defaultHostname)},
 		{"", defaultAddress},
 		{"custom:1234", "custom:1234"},
+		{"::1", fmt.Sprintf("[::1]:%s", defaultPort)},
+		{"[::1]", fmt.Sprintf("[::1]:%s", defaultPort)},
+		{"[::1]:1234", "[::1]:1234"},
 	} {
 		t.Run(tt.in, func(t *testing.T) {
 			assert.Equal(t, resolveAddr(tt.in), tt.out)
@@ -128,7 +142,7 @@ func TestTransportResponseError(t *testing.T) {
 	addr := ln.Addr().String()
 	log.Println(addr)
 	transport := newHTTPTransport(addr)
-	err = transport.send(newPayload())
+	_, err = transport.send(newPayload(), nil)
 	want := fmt.Sprintf("%s (Status: Bad Request)", strings.Repeat("X", 1000))
 	assert.Equal(want, err.Error())
 }
@@ -155,9 +169,454 @@ func TestTraceCountHeader(t *testing.T) {
 		transport := newHTTPTransport(host)
 		p, err := encode(tc.payload)
 		assert.NoError(err)
-		err = transport.send(p)
+		_, err = transport.send(p, nil)
 		assert.NoError(err)
 	}
 
 	receiver.Close()
 }
+
+func TestUDSTransport(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "tracer")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "apm.socket")
+	ln, err := net.Listen("unix", path)
+	assert.NoError(err)
+	defer ln.Close()
+
+	received := make(chan *http.Request, 1)
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.Write([]byte(`{"rate_by_service":{"service:,env:":0.5}}`))
+	}))
+
+	transport := newTransport(unixAddrPrefix+path, nil)
+	p, err := encode(getTestTrace(1, 1))
+	assert.NoError(err)
+	body, err := transport.send(p, nil)
+	assert.NoError(err)
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	assert.NoError(err)
+	assert.Contains(string(b), "rate_by_service")
+
+	r := <-received
+	assert.Equal("/v0.4/traces", r.URL.Path)
+	assert.Equal("1", r.Header.Get(traceCountHeader))
+	assert.Equal("application/msgpack", r.Header.Get("Content-Type"))
+}
+
+func TestTLSTransport(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	hostport := strings.TrimPrefix(srv.URL, "https://")
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	cfg := &tls.Config{RootCAs: roots}
+
+	send := func(transport *httpTransport) error {
+		transport.retryMaxBytes = 0 // certificate errors are not temporary
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(t, err)
+		body, err := transport.send(p, nil)
+		if err == nil {
+			body.Close()
+		}
+		return err
+	}
+
+	for name, transport := range map[string]*httpTransport{
+		"url":    newTransport(srv.URL, cfg),
+		"option": newTransport(hostport, cfg),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.NoError(send(transport))
+			r := <-received
+			assert.NotNil(r.TLS)
+			assert.Equal("/v0.4/traces", r.URL.Path)
+		})
+	}
+
+	t.Run("unknown-ca", func(t *testing.T) {
+		err := send(newTransport(srv.URL, nil))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "certificate")
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		assert := assert.New(t)
+		transport := newTransport("http://"+hostport, nil)
+		assert.Equal("http://"+hostport+tracesPath, transport.traceURL)
+		transport = newTransport(hostport, nil)
+		assert.Equal("http://"+hostport+tracesPath, transport.traceURL)
+		assert.Nil(transport.client.Transport.(*http.Transport).TLSClientConfig)
+	})
+
+	t.Run("tracer", func(t *testing.T) {
+		assert := assert.New(t)
+		tracer := newTracer(WithAgentAddr(srv.URL), WithTLSConfig(cfg))
+		defer tracer.Stop()
+		tracer.StartSpan("web.request").Finish()
+		assert.NoError(tracer.flushWithContext(context.Background()))
+		r := <-received
+		assert.NotNil(r.TLS)
+	})
+}
+
+func TestTransportRetry(t *testing.T) {
+	// newServer returns a server responding with each of the given status
+	// codes in turn, then 200, and counting the requests and received traces.
+	newServer := func(codes ...int) (srv *httptest.Server, requests *int32, traces *spanLists) {
+		requests, traces = new(int32), new(spanLists)
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(requests, 1)
+			if int(n) <= len(codes) {
+				w.WriteHeader(codes[n-1])
+				return
+			}
+			var got spanLists
+			if err := msgp.Decode(r.Body, &got); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			*traces = append(*traces, got...)
+		}))
+		return srv, requests, traces
+	}
+	newTestTransport := func(srv *httptest.Server) *httpTransport {
+		transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"))
+		transport.retryInterval = time.Millisecond
+		return transport
+	}
+
+	t.Run("server-error", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, requests, traces := newServer(http.StatusInternalServerError, http.StatusServiceUnavailable)
+		defer srv.Close()
+		p, err := encode(getTestTrace(2, 3))
+		assert.NoError(err)
+		_, err = newTestTransport(srv).send(p, nil)
+		assert.NoError(err)
+		assert.EqualValues(3, atomic.LoadInt32(requests))
+		assert.Len(*traces, 2)
+		assert.Len((*traces)[0], 3)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, requests, _ := newServer(500, 500, 500, 500, 500)
+		defer srv.Close()
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		_, err = newTestTransport(srv).send(p, nil)
+		assert.Error(err)
+		assert.EqualValues(maxRetries+1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("client-error", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, requests, _ := newServer(http.StatusBadRequest)
+		defer srv.Close()
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		_, err = newTestTransport(srv).send(p, nil)
+		assert.Error(err)
+		assert.EqualValues(1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("max-bytes", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, requests, _ := newServer(http.StatusInternalServerError)
+		defer srv.Close()
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		transport := newTestTransport(srv)
+		transport.retryMaxBytes = p.size() - 1
+		_, err = transport.send(p, nil)
+		assert.Error(err)
+		assert.EqualValues(1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		assert := assert.New(t)
+		srv, requests, _ := newServer(http.StatusInternalServerError)
+		defer srv.Close()
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		transport := newTestTransport(srv)
+		transport.retryInterval = time.Hour
+		stop := make(chan struct{})
+		close(stop)
+		_, err = transport.send(p, stop)
+		assert.Error(err)
+		assert.EqualValues(1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		assert := assert.New(t)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		addr := ln.Addr().String()
+		ln.Close()
+		transport := newHTTPTransport(addr)
+		transport.retryInterval = time.Millisecond
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		start := time.Now()
+		_, err = transport.send(p, nil)
+		assert.Error(err)
+		assert.True(time.Since(start) >= 26*time.Millisecond, "should back off between retries")
+	})
+}
+
+func TestTransportDowngrade(t *testing.T) {
+	// newServer returns a server responding to v0.4 requests with the given
+	// status code and accepting v0.3 ones, which it counts.
+	newServer := func(code int) (srv *httptest.Server, v04, v03 *int32, traces *spanLists) {
+		v04, v03, traces = new(int32), new(int32), new(spanLists)
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case tracesPath:
+				atomic.AddInt32(v04, 1)
+				w.WriteHeader(code)
+			case legacyTracesPath:
+				atomic.AddInt32(v03, 1)
+				var got spanLists
+				if err := msgp.Decode(r.Body, &got); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				*traces = append(*traces, got...)
+				w.Write([]byte("OK"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		return srv, v04, v03, traces
+	}
+
+	for _, code := range []int{http.StatusNotFound, http.StatusUnsupportedMediaType} {
+		t.Run(strconv.Itoa(code), func(t *testing.T) {
+			assert := assert.New(t)
+			tl := new(testLogger)
+			SetLogger(tl)
+			defer SetLogger(nil)
+			srv, v04, v03, traces := newServer(code)
+			defer srv.Close()
+			transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"))
+
+			for i := 0; i < 2; i++ {
+				p, err := encode(getTestTrace(1, 2))
+				assert.NoError(err)
+				rc, err := transport.send(p, nil)
+				assert.NoError(err)
+				// the response can be read as one without sampling rates
+				assert.NoError(newPrioritySampler().readRatesJSON(rc))
+			}
+			assert.EqualValues(1, atomic.LoadInt32(v04))
+			assert.EqualValues(2, atomic.LoadInt32(v03))
+			assert.Len(*traces, 2)
+			assert.Len((*traces)[0], 2)
+			assert.Len(tl.Lines(), 1)
+
+			// a new transport, as used by a restarted tracer, tries v0.4 again
+			p, err := encode(getTestTrace(1, 1))
+			assert.NoError(err)
+			_, err = newHTTPTransport(strings.TrimPrefix(srv.URL, "http://")).send(p, nil)
+			assert.NoError(err)
+			assert.EqualValues(2, atomic.LoadInt32(v04))
+		})
+	}
+
+	t.Run("legacy-not-found", func(t *testing.T) {
+		assert := assert.New(t)
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+		transport := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"))
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		_, err = transport.send(p, nil)
+		assert.Error(err)
+	})
+}
+
+func TestPayloadRewind(t *testing.T) {
+	assert := assert.New(t)
+	p, err := encode(getTestTrace(3, 2))
+	assert.NoError(err)
+	size := p.size()
+	want, err := ioutil.ReadAll(p)
+	assert.NoError(err)
+	assert.Zero(p.size())
+	p.rewind()
+	assert.Equal(size, p.size())
+	got, err := ioutil.ReadAll(p)
+	assert.NoError(err)
+	assert.Equal(want, got)
+}
+
+func TestLogTransport(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	tracer := newTracer(WithLogOutput(&buf), WithServiceName("fn"))
+	defer tracer.Stop()
+
+	root := tracer.StartSpan("aws.lambda", ResourceName("handler")).(*span)
+	child := tracer.StartSpan("http.request", ChildOf(root.Context())).(*span)
+	child.SetTag("http.url", "/users")
+	child.Finish()
+	root.Finish()
+	tracer.StartSpan("other").Finish()
+	assert.NoError(tracer.flushWithContext(context.Background()))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if !assert.Len(lines, 2) {
+		return
+	}
+	var out struct {
+		Traces [][]map[string]interface{} `json:"traces"`
+	}
+	assert.NoError(json.Unmarshal([]byte(lines[0]), &out))
+	if !assert.Len(out.Traces, 1) || !assert.Len(out.Traces[0], 2) {
+		return
+	}
+	for _, s := range out.Traces[0] {
+		for _, k := range []string{"trace_id", "span_id", "parent_id", "name", "resource", "service", "type", "start", "duration", "error", "meta", "metrics"} {
+			assert.Contains(s, k)
+		}
+	}
+	var spans = map[string]map[string]interface{}{}
+	for _, s := range out.Traces[0] {
+		spans[s["name"].(string)] = s
+	}
+	s := spans["aws.lambda"]
+	assert.Equal(strconv.FormatUint(root.TraceID, 16), s["trace_id"])
+	assert.Equal(strconv.FormatUint(root.SpanID, 16), s["span_id"])
+	assert.Equal("0", s["parent_id"])
+	assert.Equal("handler", s["resource"])
+	assert.Equal("fn", s["service"])
+	assert.Equal(float64(root.Start), s["start"])
+	assert.Equal(float64(root.Duration), s["duration"])
+	assert.Equal(float64(0), s["error"])
+	s = spans["http.request"]
+	assert.Equal(strconv.FormatUint(root.SpanID, 16), s["parent_id"])
+	assert.Equal("/users", s["meta"].(map[string]interface{})["http.url"])
+
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &out))
+	assert.Equal("other", out.Traces[0][0]["name"])
+}
+
+func TestLogTransportLambda(t *testing.T) {
+	os.Setenv(lambdaEnvVar, "my-function")
+	defer os.Unsetenv(lambdaEnvVar)
+
+	tracer := newTracer()
+	defer tracer.Stop()
+	transport, ok := tracer.config.transport.(*logTransport)
+	if assert.True(t, ok) {
+		assert.Equal(t, os.Stdout, transport.w)
+	}
+
+	tracer = newTracer(WithAgentAddr("agent:8126"))
+	defer tracer.Stop()
+	assert.IsType(t, &httpTransport{}, tracer.config.transport)
+}
+
+// proxyHandler is an HTTP proxy recording the hosts of the requests which go
+// through it, supporting CONNECT for HTTPS.
+type proxyHandler struct {
+	hosts chan string
+}
+
+func (h *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.hosts <- r.Host
+	if r.Method != "CONNECT" {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	dst, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	src, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		dst.Close()
+		return
+	}
+	go func() {
+		io.Copy(dst, src)
+		dst.Close()
+	}()
+	go func() {
+		io.Copy(src, dst)
+		src.Close()
+	}()
+}
+
+func TestTransportProxy(t *testing.T) {
+	proxy := &proxyHandler{hosts: make(chan string, 10)}
+	proxySrv := httptest.NewServer(proxy)
+	defer proxySrv.Close()
+	proxyURL, err := url.Parse(proxySrv.URL)
+	assert.NoError(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+
+	run := func(t *testing.T, agentURL string, opts ...StartOption) {
+		assert := assert.New(t)
+		tracer := newTracer(append([]StartOption{WithAgentAddr(agentURL), WithProxyURL(proxyURL)}, opts...)...)
+		defer tracer.Stop()
+		tracer.StartSpan("web.request").Finish()
+		assert.NoError(tracer.flushWithContext(context.Background()))
+		select {
+		case host := <-proxy.hosts:
+			assert.Equal(strings.TrimPrefix(strings.TrimPrefix(agentURL, "http://"), "https://"), host)
+		default:
+			t.Fatal("the request did not go through the proxy")
+		}
+	}
+
+	t.Run("http", func(t *testing.T) {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		run(t, srv.URL)
+	})
+
+	t.Run("https", func(t *testing.T) {
+		srv := httptest.NewTLSServer(handler)
+		defer srv.Close()
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		run(t, srv.URL, WithTLSConfig(&tls.Config{RootCAs: roots}))
+	})
+
+	t.Run("default", func(t *testing.T) {
+		tracer := newTracer()
+		defer tracer.Stop()
+		transport := tracer.config.transport.(*httpTransport)
+		proxy := transport.client.Transport.(*http.Transport).Proxy
+		req, err := http.NewRequest("POST", transport.traceURL, nil)
+		assert.NoError(t, err)
+		u, err := proxy(req)
+		assert.NoError(t, err)
+		assert.Nil(t, u, "agents on localhost are reached directly")
+	})
+}
@@ -1,9 +1,6 @@
 package tracer
 
-import (
-	"strconv"
-	"strings"
-)
+import "strconv"
 
 // toFloat64 attempts to convert value into a float64. If it succeeds it returns
 // the value and true, otherwise 0 and false.
@@ -17,6 +14,8 @@ func toFloat64(value interface{}) (f float64, ok bool) {
 		return i, true
 	case int:
 		return float64(i), true
+	case int8:
+		return float64(i), true
 	case int16:
 		return float64(i), true
 	case int32:
@@ -36,15 +35,8 @@ func toFloat64(value interface{}) (f float64, ok bool) {
 	}
 }
 
-// parseUint64 parses a uint64 from either an unsigned 64 bit base-10 string
-// or a signed 64 bit base-10 string representing an unsigned integer
+// parseUint64 parses a uint64 from an unsigned 64 bit base-10 string. Negative
+// numbers are rejected, instead of being read as the two's complement of an ID.
 func parseUint64(str string) (uint64, error) {
-	if strings.HasPrefix(str, "-") {
-		id, err := strconv.ParseInt(str, 10, 64)
-		if err != nil {
-			return 0, err
-		}
-		return uint64(id), nil
-	}
 	return strconv.ParseUint(str, 10, 64)
 }